@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 同步后端的名称
+const (
+	backendRsync  = "rsync"
+	backendNative = "native"
+)
+
+// syncSettings 描述一次运行的同步方式：同步后端和并行同步的分片
+type syncSettings struct {
+	Backend    string // 同步后端，为空时使用 rsync
+	Shards     int    // 并行同步的分片数，不超过 1 时不分片
+	ShardDepth int    // 最多按几层目录划分分片，为 0 时只按顶层条目划分
+}
+
+// 当前运行的同步方式，由 --backend、--shards、--shard-depth 或配置中对应的设置项确定
+var syncConfig syncSettings
+
+// 检查同步后端的名称
+func checkBackend(name string) error {
+	if name != backendRsync && name != backendNative {
+		return errors.New(tr("backend.invalid", name, backendRsync, backendNative))
+	}
+	return nil
+}
+
+// backendFlag 实现 --backend 参数，只接受 rsync 和 native
+type backendFlag struct {
+	value *string
+}
+
+func (f backendFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f backendFlag) Set(value string) error {
+	if err := checkBackend(value); err != nil {
+		return err
+	}
+	*f.value = value
+	return nil
+}
+
+// 创建同步后端，rsync 通过 execCommand 执行，force 关闭时强制终止被中断的 rsync
+// 分片数大于 1 时用多个后端并行同步各个分片
+func (s syncSettings) newBackend(force <-chan struct{}) mirror.Backend {
+	var b mirror.Backend = &mirror.RsyncBackend{Command: execCommand, ForceStop: force}
+	if s.Backend == backendNative {
+		b = mirror.NativeBackend{}
+	}
+	if s.Shards > 1 {
+		return &mirror.ShardedBackend{Backend: b, Shards: s.Shards, ShardDepth: s.ShardDepth}
+	}
+	return b
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// 测试使用原生后端时 plan、apply 和 verify 不调用 rsync，以及分片同步
+func TestNativeBackendCommands(t *testing.T) {
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	oldExecCommand := execCommand
+	oldMarkerFile := markerFile
+	oldHistoryFile := historyFile
+	oldDisablePrint := disablePrint
+	oldSyncConfig := syncConfig
+	oldTesting, hadTesting := os.LookupEnv("TESTING")
+	oldStdout := os.Stdout
+	oldStderr := os.Stderr
+	defer func() {
+		execCommand = oldExecCommand
+		markerFile = oldMarkerFile
+		historyFile = oldHistoryFile
+		disablePrint = oldDisablePrint
+		syncConfig = oldSyncConfig
+		if hadTesting {
+			os.Setenv("TESTING", oldTesting)
+		}
+		os.Stdout = oldStdout
+		os.Stderr = oldStderr
+	}()
+
+	// TESTING 模式下的临时规则文件在返回前就被删除，原生后端需要真实的规则文件
+	os.Unsetenv("TESTING")
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		t.Errorf("原生后端不应调用外部命令: %s %v", name, args)
+		return exec.Command("false")
+	}
+	markerFile = filepath.Join(testDir, "marker")
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	disablePrint = true
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer devNull.Close()
+	os.Stdout = devNull
+	os.Stderr = devNull
+
+	excludeFile := filepath.Join(testDir, "exclude")
+	if err := ioutil.WriteFile(excludeFile, []byte("node_modules/\n"), 0644); err != nil {
+		t.Fatalf("无法写入排除文件: %v", err)
+	}
+	rules := []string{"--backend", "native", "--exclude-from", excludeFile,
+		"--include-from", filepath.Join(testDir, "include")}
+
+	args := append([]string{"plan"}, rules...)
+	if code := runMainForExit(append(args, sourceDir, targetDir)); code != 0 {
+		t.Fatalf("plan 退出码为 %d，期望 0", code)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "file1.txt")); !os.IsNotExist(err) {
+		t.Fatalf("plan 不应修改目标目录")
+	}
+
+	args = append([]string{"apply"}, rules...)
+	if code := runMainForExit(append(args, sourceDir, targetDir)); code != 0 {
+		t.Fatalf("apply 退出码为 %d，期望 0", code)
+	}
+	for _, name := range []string{"file1.txt", "subdir/file3.txt", "src/build/output.js"} {
+		if _, err := os.Stat(filepath.Join(targetDir, name)); err != nil {
+			t.Errorf("目标目录缺少 %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "node_modules")); !os.IsNotExist(err) {
+		t.Errorf("被排除的 node_modules 不应被同步")
+	}
+
+	args = append([]string{"verify"}, rules...)
+	if code := runMainForExit(append(args, sourceDir, targetDir)); code != 0 {
+		t.Errorf("同步后 verify 退出码为 %d，期望 0", code)
+	}
+	if err := ioutil.WriteFile(filepath.Join(targetDir, "file1.txt"), []byte("已修改的内容"), 0644); err != nil {
+		t.Fatalf("无法修改目标文件: %v", err)
+	}
+	if code := runMainForExit(append(args, sourceDir, targetDir)); code != 1 {
+		t.Errorf("目标被修改后 verify 退出码为 %d，期望 1", code)
+	}
+
+	// 配置文件中的 backend 键同样生效
+	restore := setupProfilesFile(t, testDir, "[home]\nsource = "+sourceDir+"\ntarget = "+targetDir+
+		"\nexclude_from = "+excludeFile+"\nbackend = native\n")
+	defer restore()
+	if code := runMainForExit([]string{"plan", "--profile", "home"}); code != 0 {
+		t.Errorf("使用配置文件的 plan 退出码为 %d，期望 0", code)
+	}
+	if code := runMainForExit([]string{"apply", "--profile", "home"}); code != 0 {
+		t.Errorf("使用配置文件的 apply 退出码为 %d，期望 0", code)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(targetDir, "file1.txt"))
+	if err != nil || string(data) == "已修改的内容" {
+		t.Errorf("apply 后 file1.txt 应恢复为源文件内容: %q, %v", data, err)
+	}
+
+	// 分片同步删除顶层和被继续划分的目录中多余的条目
+	for _, stale := range []string{"stale.txt", "subdir/stale.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(targetDir, stale), []byte("多余"), 0644); err != nil {
+			t.Fatalf("无法写入多余的文件: %v", err)
+		}
+	}
+	shardArgs := []string{"--profile", "home", "--shards", "3", "--shard-depth", "2"}
+	if code := runMainForExit(append([]string{"plan"}, shardArgs...)); code != 0 {
+		t.Errorf("分片 plan 退出码为 %d，期望 0", code)
+	}
+	if code := runMainForExit(append([]string{"apply"}, shardArgs...)); code != 0 {
+		t.Errorf("分片 apply 退出码为 %d，期望 0", code)
+	}
+	for _, stale := range []string{"stale.txt", "subdir/stale.txt"} {
+		if _, err := os.Stat(filepath.Join(targetDir, stale)); !os.IsNotExist(err) {
+			t.Errorf("分片同步后多余的 %s 应当被删除", stale)
+		}
+	}
+	if code := runMainForExit(append([]string{"verify"}, shardArgs...)); code != 0 {
+		t.Errorf("分片同步后 verify 退出码为 %d，期望 0", code)
+	}
+
+	if code := runMainForExit([]string{"plan", "--backend", "bogus", sourceDir, targetDir}); code == 0 {
+		t.Errorf("无效的 --backend 应当失败")
+	}
+	var p profile
+	if err := p.set("backend", "bogus"); err == nil {
+		t.Errorf("配置文件中无效的 backend 应当报错")
+	}
+	if err := p.set("backend", backendNative); err != nil || p.Sync.Backend != backendNative {
+		t.Errorf("backend = native 解析失败: %v", err)
+	}
+	if err := p.set("shards", "0"); err == nil {
+		t.Errorf("配置文件中的 shards 必须是正整数")
+	}
+	if err := p.set("shards", "4"); err != nil || p.set("shard_depth", "2") != nil || p.Sync.Shards != 4 || p.Sync.ShardDepth != 2 {
+		t.Errorf("shards 和 shard_depth 解析失败: %+v", p.Sync)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command 描述一个子命令
+type command struct {
+	Name    string              // 命令名称
+	Args    string              // 用法中选项之后的参数说明
+	Summary string              // 一行说明的消息 ID
+	Run     func(args []string) // 执行命令，args 不包含命令名称
+}
+
+// 全部子命令，按帮助信息中的显示顺序排列
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{Name: "plan", Args: "[SOURCE_DIR TARGET_DIR]", Summary: "command.plan", Run: func(args []string) { runMirrorCommand("plan", args, true) }},
+		{Name: "apply", Args: "[SOURCE_DIR TARGET_DIR]", Summary: "command.apply", Run: func(args []string) { runMirrorCommand("apply", args, false) }},
+		{Name: "watch", Args: "[SOURCE_DIR TARGET_DIR]", Summary: "command.watch", Run: runWatchCommand},
+		{Name: "daemon", Args: "[--profile NAME]", Summary: "command.daemon", Run: runDaemonCommand},
+		{Name: "install-timer", Args: "PROFILE", Summary: "command.install-timer", Run: runInstallTimerCommand},
+		{Name: "notify", Args: "--profile NAME [--unit UNIT]", Summary: "command.notify", Run: runNotifyCommand},
+		{Name: "status", Args: "[--profile NAME] [SOURCE_DIR TARGET_DIR]", Summary: "command.status", Run: runStatusCommand},
+		{Name: "verify", Args: "[SOURCE_DIR TARGET_DIR]", Summary: "command.verify", Run: runVerifyCommand},
+		{Name: "scrub", Args: "[--profile NAME] [TARGET_DIR]", Summary: "command.scrub", Run: runScrubCommand},
+		{Name: "history", Summary: "command.history", Run: runHistoryCommand},
+		{Name: "rules", Args: "lint|presets", Summary: "command.rules", Run: runRulesCommand},
+		{Name: "explain", Args: "PATH", Summary: "command.explain", Run: runExplainCommand},
+		{Name: "doctor", Summary: "command.doctor", Run: runDoctorCommand},
+		{Name: "help", Args: "[COMMAND]", Summary: "command.help", Run: runHelpCommand},
+	}
+}
+
+// 按名称查找子命令
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// 为子命令创建参数集，-h/--help 输出该命令的帮助信息
+func newCommandFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	addOutputFlag(fs)
+	addLangFlag(fs)
+	addColorFlag(fs)
+	fs.Usage = func() {
+		args := ""
+		if cmd := findCommand(name); cmd != nil {
+			fmt.Fprintf(fs.Output(), "%s\n\n", tr(cmd.Summary))
+			args = " " + cmd.Args
+		}
+		fmt.Fprintf(fs.Output(), "%s\n\n%s\n", tr("usage.command", os.Args[0], name, args), tr("usage.options"))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// 解析参数，允许选项出现在位置参数之间，返回全部位置参数
+// "--" 之后的参数全部作为位置参数
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// 解析子命令参数，请求帮助时以 0 退出，参数错误时以 1 退出
+// 返回 false 表示已经调用了 osExit
+func parseCommandArgs(fs *flag.FlagSet, args []string) ([]string, bool) {
+	positional, err := parseInterspersed(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		osExit(0)
+		return nil, false
+	}
+	if err != nil {
+		osExit(1)
+		return nil, false
+	}
+	return positional, true
+}
+
+// 输出总体帮助信息
+func printUsage() {
+	fmt.Println(tr("usage.line", os.Args[0]))
+	fmt.Println(tr("usage.legacy_line", os.Args[0]))
+	fmt.Println()
+	fmt.Println(tr("usage.commands"))
+	for _, cmd := range commands {
+		fmt.Printf("  %-14s %s\n", cmd.Name, tr(cmd.Summary))
+	}
+	fmt.Println()
+	fmt.Println(tr("usage.legacy_options"))
+	fmt.Printf("  %-19s%s\n", "--dry-run", tr("usage.opt_dry_run"))
+	fmt.Printf("  %-19s%s\n", "--profile NAME", tr("usage.opt_profile"))
+	fmt.Printf("  %-19s%s\n", "--preset NAMES", tr("usage.opt_preset"))
+	fmt.Printf("  %-19s%s\n", "--output FORMAT", tr("usage.opt_output"))
+	fmt.Printf("  %-19s%s\n", "--lang LANG", tr("usage.opt_lang"))
+	fmt.Printf("  %-19s%s\n", "--color WHEN", tr("usage.opt_color"))
+	fmt.Printf("  %-19s%s\n", "-q", tr("usage.opt_quiet"))
+	fmt.Printf("  %-19s%s\n", "-v, -vv", tr("usage.opt_verbose"))
+	fmt.Printf("  %-19s%s\n", "--help", tr("usage.opt_help"))
+	fmt.Println()
+	fmt.Println(tr("usage.arguments"))
+	fmt.Printf("  %-19s%s\n", "SOURCE_DIR", tr("usage.arg_source"))
+	fmt.Printf("  %-19s%s\n", "TARGET_DIR", tr("usage.arg_target"))
+	fmt.Println()
+	fmt.Println(tr("usage.more", os.Args[0]))
+}
+
+// 处理 help 子命令
+func runHelpCommand(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		osExit(0)
+		return
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil || cmd.Name == "help" {
+		printColored(colorRed, tr("msg.error", tr("cli.unknown_command", args[0])))
+		osExit(1)
+		return
+	}
+	cmd.Run([]string{"--help"})
+}
+
+// 根据规则参数和位置参数确定源目录和目标目录，命令行参数优先于配置
+func resolveMirrorPaths(prof *profile, positional []string) (string, string, error) {
+	switch {
+	case len(positional) == 2:
+		return positional[0], positional[1], nil
+	case len(positional) == 0 && prof != nil:
+		if prof.Source == "" || prof.Target == "" {
+			return "", "", errors.New(tr("cli.profile_no_paths", prof.Name))
+		}
+		return prof.Source, prof.Target, nil
+	case len(positional) == 0:
+		return "", "", errors.New(tr("cli.need_paths"))
+	default:
+		return "", "", errors.New(tr("cli.arg_count", strings.Join(positional, " ")))
+	}
+}
+
+// 处理 plan 和 apply 子命令
+func runMirrorCommand(name string, args []string, dryRun bool) {
+	fs := newCommandFlagSet(name)
+	addVerbosityFlags(fs)
+	rf := addRuleFlags(fs)
+	var verify, verifyChecksumFlag *bool
+	if !dryRun {
+		verify = fs.Bool("verify", false, tr("flag.verify"))
+		verifyChecksumFlag = fs.Bool("verify-checksum", false, tr("flag.verify_checksum"))
+	}
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	mode := verifyNone
+	if verify != nil && *verify {
+		mode = verifyQuick
+	}
+	if verifyChecksumFlag != nil && *verifyChecksumFlag {
+		mode = verifyChecksum
+	}
+	runMirror(rf, positional, dryRun, mode)
+}
+
+// 兼容旧用法: folder_mirror [--dry-run] SOURCE_DIR TARGET_DIR
+func runLegacy(args []string) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.Usage = printUsage
+	dryRun := fs.Bool("dry-run", false, tr("flag.dry_run"))
+	help := fs.Bool("help", false, tr("flag.help"))
+	addOutputFlag(fs)
+	addLangFlag(fs)
+	addColorFlag(fs)
+	addVerbosityFlags(fs)
+	rf := addRuleFlags(fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || *help || (len(positional) < 2 && *rf.profile == "") {
+		if err == nil {
+			printUsage()
+		}
+		osExit(1)
+		return
+	}
+	runMirror(rf, positional, *dryRun, verifyNone)
+}
+
+// 执行一次镜像预览或实际镜像，verify 为实际镜像之后的校验方式
+func runMirror(rf *ruleFlags, positional []string, dryRun bool, verify verifyMode) {
+	args, source, target, ok := prepareMirror(rf, positional)
+	if !ok {
+		return
+	}
+
+	// 根据运行模式执行不同的处理，源目录和目标目录在其中验证
+	if dryRun {
+		handleDryRun(args, source, target)
+	} else {
+		handleActualRun(args, source, target, verify)
+	}
+}
+
+// 确定规则来源、源目录和目标目录，应用配置中的设置，并返回 rsync 参数
+// 失败时输出错误并以退出码 1 结束，返回 ok 为 false
+func prepareMirror(rf *ruleFlags, positional []string) (args []string, source, target string, ok bool) {
+	// 确定规则来源
+	cfg, prof, err := rf.config()
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return nil, "", "", false
+	}
+
+	// 获取源目录和目标目录
+	source, target, err = resolveMirrorPaths(prof, positional)
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return nil, "", "", false
+	}
+
+	useProfile(prof, rf.sync(prof))
+	return mirrorArgs(cfg), source, target, true
+}
+
+// 使用配置中设置的运行日志保留策略、钩子、通知和指标，prof 为 nil 时使用默认设置
+// sync 是同步方式，通常是配置中的设置加上命令行参数的覆盖
+func useProfile(prof *profile, sync syncSettings) {
+	logRetention = defaultLogRetention
+	if prof != nil && prof.Retention != nil {
+		logRetention = *prof.Retention
+	}
+	syncConfig = sync
+	activeProfile = prof
+}
+
+// 准备rsync命令的参数，让 rsync 逐个列出文件变化以便统计和输出 JSON 事件
+func mirrorArgs(cfg ruleConfig) []string {
+	return append(rsyncVerbosityArgs(prepareRsyncArgsWith(cfg)), "--itemize-changes")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 测试选项和位置参数交错时的解析
+func TestParseInterspersed(t *testing.T) {
+	testCases := []struct {
+		args       []string
+		positional []string
+		dryRun     bool
+		profile    string
+	}{
+		{[]string{"src", "dst"}, []string{"src", "dst"}, false, ""},
+		{[]string{"--dry-run", "src", "dst"}, []string{"src", "dst"}, true, ""},
+		{[]string{"src", "dst", "--dry-run"}, []string{"src", "dst"}, true, ""},
+		{[]string{"src", "--profile", "home", "dst"}, []string{"src", "dst"}, false, "home"},
+		{[]string{"src", "--profile=home", "--dry-run", "dst"}, []string{"src", "dst"}, true, "home"},
+		{[]string{"--dry-run", "--", "--src", "-dst"}, []string{"--src", "-dst"}, true, ""},
+		{[]string{"src", "--", "--dry-run"}, []string{"src", "--dry-run"}, false, ""},
+		{[]string{}, nil, false, ""},
+	}
+
+	for _, tc := range testCases {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		dryRun := fs.Bool("dry-run", false, "")
+		prof := fs.String("profile", "", "")
+		positional, err := parseInterspersed(fs, tc.args)
+		if err != nil {
+			t.Errorf("%v: 解析失败: %v", tc.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(positional, tc.positional) {
+			t.Errorf("%v: 期望位置参数 %v，但得到 %v", tc.args, tc.positional, positional)
+		}
+		if *dryRun != tc.dryRun || *prof != tc.profile {
+			t.Errorf("%v: 期望 dry-run=%v profile=%q，但得到 dry-run=%v profile=%q", tc.args, tc.dryRun, tc.profile, *dryRun, *prof)
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	if _, err := parseInterspersed(fs, []string{"src", "--unknown", "dst"}); err == nil {
+		t.Error("未知选项应当返回错误")
+	}
+}
+
+// 测试源目录和目标目录的确定
+func TestResolveMirrorPaths(t *testing.T) {
+	prof := &profile{Name: "home", Source: "/home/u", Target: "/backup"}
+
+	if s, d, err := resolveMirrorPaths(prof, []string{"/a", "/b"}); err != nil || s != "/a" || d != "/b" {
+		t.Errorf("命令行参数应当优先于配置，得到 %s %s %v", s, d, err)
+	}
+	if s, d, err := resolveMirrorPaths(prof, nil); err != nil || s != "/home/u" || d != "/backup" {
+		t.Errorf("没有位置参数时应当使用配置，得到 %s %s %v", s, d, err)
+	}
+	if _, _, err := resolveMirrorPaths(&profile{Name: "empty"}, nil); err == nil {
+		t.Error("配置没有设置目录时应当返回错误")
+	}
+	if _, _, err := resolveMirrorPaths(nil, nil); err == nil {
+		t.Error("没有位置参数也没有配置时应当返回错误")
+	}
+	if _, _, err := resolveMirrorPaths(prof, []string{"/a"}); err == nil {
+		t.Error("只有一个位置参数时应当返回错误")
+	}
+}
+
+// 以指定参数运行 main，返回第一次调用 osExit 的退出码
+// osExit 通过 panic 中止 main 的执行，与真实退出的效果一致
+func runMainForExit(args []string) (exitCode int) {
+	type exitPanic struct{ code int }
+	oldArgs := os.Args
+	oldOsExit := osExit
+	defer func() {
+		os.Args = oldArgs
+		osExit = oldOsExit
+		if r := recover(); r != nil {
+			e, ok := r.(exitPanic)
+			if !ok {
+				panic(r)
+			}
+			exitCode = e.code
+		}
+	}()
+	osExit = func(code int) { panic(exitPanic{code}) }
+	// 保留测试程序路径，fakeExecCommand 依赖 os.Args[0]
+	os.Args = append([]string{oldArgs[0]}, args...)
+	main()
+	return -1
+}
+
+// 测试子命令分发和旧用法的退出码
+func TestMainSubcommands(t *testing.T) {
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	oldArgs := os.Args
+	oldOsExit := osExit
+	oldExecCommand := execCommand
+	oldMarkerFile := markerFile
+	oldHistoryFile := historyFile
+	oldPresetDir := presetDir
+	oldDisablePrint := disablePrint
+	oldStdout := os.Stdout
+	oldStderr := os.Stderr
+	defer func() {
+		os.Args = oldArgs
+		osExit = oldOsExit
+		execCommand = oldExecCommand
+		markerFile = oldMarkerFile
+		historyFile = oldHistoryFile
+		presetDir = oldPresetDir
+		disablePrint = oldDisablePrint
+		os.Stdout = oldStdout
+		os.Stderr = oldStderr
+	}()
+
+	os.Setenv("TESTING", "1")
+	execCommand = fakeExecCommand
+	markerFile = filepath.Join(testDir, "marker")
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	presetDir = filepath.Join(testDir, "presets")
+	disablePrint = true
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer devNull.Close()
+	os.Stdout = devNull
+	os.Stderr = devNull
+	excludeFile, _ := createTestRuleFiles(t, testDir)
+
+	testCases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"总体帮助", []string{"help"}, 0},
+		{"命令帮助", []string{"help", "plan"}, 0},
+		{"未知命令的帮助", []string{"help", "bogus"}, 1},
+		{"子命令 -h", []string{"apply", "-h"}, 0},
+		{"子命令未知选项", []string{"plan", "--bogus"}, 1},
+		{"rules 帮助", []string{"rules", "--help"}, 0},
+		{"旧用法帮助", []string{"--help"}, 1},
+		{"旧用法缺少参数", []string{}, 1},
+		{"没有标记文件时 apply", []string{"apply", sourceDir, targetDir}, 1},
+		{"plan", []string{"plan", sourceDir, targetDir}, 0},
+		{"apply", []string{"apply", sourceDir, "--preset", "node", targetDir}, 0},
+		{"旧用法交错的 --dry-run", []string{sourceDir, targetDir, "--dry-run"}, 0},
+		{"旧用法执行", []string{sourceDir, targetDir}, 0},
+		{"status", []string{"status"}, 0},
+		{"history", []string{"history", "-n", "2"}, 0},
+		// 模拟的 rsync 不复制文件，校验发现目标目录缺少文件
+		{"verify", []string{"verify", "--exclude-from", excludeFile, sourceDir, targetDir}, 1},
+	}
+
+	for _, tc := range testCases {
+		if exitCode := runMainForExit(tc.args); exitCode != tc.code {
+			t.Errorf("%s: 期望退出码 %d，但得到 %d", tc.name, tc.code, exitCode)
+		}
+	}
+
+	records, err := readHistory(historyFile)
+	if err != nil {
+		t.Fatalf("读取运行历史失败: %v", err)
+	}
+	var modes []string
+	for _, r := range records {
+		modes = append(modes, r.Mode+":"+r.Status)
+	}
+	expected := []string{"apply:failed", "plan:success", "apply:success", "plan:success", "apply:success"}
+	if !reflect.DeepEqual(modes, expected) {
+		t.Errorf("期望运行历史 %v，但得到 %v", expected, modes)
+	}
+}
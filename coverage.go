@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 按 rsync 参数中出现的顺序加载 --exclude-from 和 --include-from 指定的规则文件
+// 这样统计结果与 rsync 实际使用的规则完全一致
+func filterFromRsyncArgs(args []string) (*filter.Filter, error) {
+	var ruleSets [][]filter.Rule
+	for _, arg := range args {
+		var path string
+		include := false
+		if strings.HasPrefix(arg, "--exclude-from=") {
+			path = strings.TrimPrefix(arg, "--exclude-from=")
+		} else if strings.HasPrefix(arg, "--include-from=") {
+			path = strings.TrimPrefix(arg, "--include-from=")
+			include = true
+		} else {
+			continue
+		}
+		// 内置预设以预设名称显示，而不是写出的文件路径
+		var rules []filter.Rule
+		var err error
+		if name, ok := presetNameForFile(path); ok {
+			rules, err = filter.Preset(name)
+		} else {
+			rules, err = filter.ReadFile(path, include)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ruleSets = append(ruleSets, rules)
+	}
+	return filter.New(ruleSets...), nil
+}
+
+// 把字节数格式化为便于阅读的形式
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// 统计每条排除规则在源目录中排除的文件数和字节数，输出到终端并写入日志
+func reportRuleCoverage(args []string, source string, log io.Writer) {
+	f, err := filterFromRsyncArgs(args)
+	if err != nil {
+		printWarning(tr("coverage.read_failed", err))
+		return
+	}
+	stats, err := f.Coverage(source)
+	if err != nil {
+		printWarning(tr("coverage.failed", err))
+		return
+	}
+
+	var used, unused []int
+	for i := range f.Rules {
+		if f.Rules[i].Include {
+			continue
+		}
+		if stats[i].Paths == 0 {
+			unused = append(unused, i)
+		} else {
+			used = append(used, i)
+		}
+	}
+	sort.SliceStable(used, func(a, b int) bool { return stats[used[a]].Bytes > stats[used[b]].Bytes })
+
+	emit := func(level, color, line string) {
+		printMessage(level, color, line)
+		fmt.Fprintln(log, line)
+	}
+
+	emit(levelInfo, colorGreen, tr("coverage.title"))
+	var totalFiles, totalBytes int64
+	for _, i := range used {
+		r := &f.Rules[i]
+		totalFiles += stats[i].Files
+		totalBytes += stats[i].Bytes
+		emit(levelInfo, colorGreen, tr("coverage.rule", r.File, r.Line, r.Pattern, stats[i].Files, formatBytes(stats[i].Bytes)))
+	}
+	emit(levelInfo, colorGreen, tr("coverage.total", totalFiles, formatBytes(totalBytes)))
+
+	if len(unused) > 0 {
+		emit(levelNotice, colorYellow, tr("coverage.unused", len(unused)))
+		for _, i := range unused {
+			r := &f.Rules[i]
+			emit(levelNotice, colorYellow, fmt.Sprintf("  %s:%d: %s", r.File, r.Line, r.Pattern))
+		}
+	}
+}
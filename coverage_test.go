@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 测试按 rsync 参数顺序加载规则文件
+func TestFilterFromRsyncArgs(t *testing.T) {
+	testDir, _, _ := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+	excludeFile, includeFile := createTestRuleFiles(t, testDir)
+
+	args := []string{"-aH", "--include-from=" + includeFile, "--exclude-from=" + excludeFile, "--progress"}
+	f, err := filterFromRsyncArgs(args)
+	if err != nil {
+		t.Fatalf("filterFromRsyncArgs 失败: %v", err)
+	}
+	if len(f.Rules) != 5 {
+		t.Fatalf("规则数量不匹配: 得到 %d, 期望 5", len(f.Rules))
+	}
+	if !f.Rules[0].Include || f.Rules[len(f.Rules)-1].Include {
+		t.Error("规则顺序应当与参数顺序一致")
+	}
+
+	if _, err := filterFromRsyncArgs([]string{"--exclude-from=" + filepath.Join(testDir, "missing")}); err == nil {
+		t.Error("规则文件不存在时应当返回错误")
+	}
+}
+
+// 测试字节数格式化
+func TestFormatBytes(t *testing.T) {
+	testCases := map[int64]string{
+		0:                 "0 B",
+		1023:              "1023 B",
+		1024:              "1.0 KiB",
+		1536:              "1.5 KiB",
+		5 * 1024 * 1024:   "5.0 MiB",
+		3 << 30:           "3.0 GiB",
+		int64(1.5 * 1e12): "1.4 TiB",
+	}
+	for n, want := range testCases {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, 期望 %q", n, got, want)
+		}
+	}
+}
+
+// 测试规则覆盖报告
+func TestReportRuleCoverage(t *testing.T) {
+	testDir, sourceDir, _ := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	excludeFile := filepath.Join(testDir, "exclude")
+	ioutil.WriteFile(excludeFile, []byte("node_modules/\n*/build/*\n*.pdf\n"), 0644)
+
+	oldHook := printHook
+	oldDisablePrint := disablePrint
+	defer func() {
+		printHook = oldHook
+		disablePrint = oldDisablePrint
+	}()
+	disablePrint = true
+	var output []string
+	printHook = func(msg string) { output = append(output, msg) }
+
+	var log bytes.Buffer
+	reportRuleCoverage([]string{"--exclude-from=" + excludeFile}, sourceDir, &log)
+
+	text := strings.Join(output, "\n")
+	// setupTestDirs 中每个文件的内容都是 "test content"，共 12 字节
+	for _, want := range []string{
+		"node_modules/ 排除 1 个文件, 12 B",
+		"*/build/* 排除 2 个文件, 24 B",
+		"排除规则共排除 3 个文件, 36 B",
+		"没有匹配任何文件",
+		"*.pdf",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("覆盖报告中应当包含 %q，得到:\n%s", want, text)
+		}
+	}
+	if log.String() != text+"\n" {
+		t.Errorf("日志内容与输出不一致:\n%s", log.String())
+	}
+
+	// 规则文件不存在时只输出警告
+	output = nil
+	reportRuleCoverage([]string{"--exclude-from=" + filepath.Join(testDir, "missing")}, sourceDir, &log)
+	if len(output) != 1 || !strings.Contains(output[0], "警告") {
+		t.Errorf("规则文件不存在时应当只输出警告，得到: %v", output)
+	}
+}
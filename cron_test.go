@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试调度表达式的解析和下一次运行时间
+func TestParseSchedule(t *testing.T) {
+	// 2024-01-05 是星期五
+	base := time.Date(2024, 1, 5, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 5, 10, 45, 0, 0, time.Local)},
+		{"30 2 * * *", time.Date(2024, 1, 6, 2, 30, 0, 0, time.Local)},
+		{"@daily", time.Date(2024, 1, 6, 0, 0, 0, 0, time.Local)},
+		{"@hourly", time.Date(2024, 1, 5, 11, 0, 0, 0, time.Local)},
+		{"0 9 * * mon-fri", time.Date(2024, 1, 8, 9, 0, 0, 0, time.Local)},
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.Local)},
+		{"0 3 1,15 * *", time.Date(2024, 1, 15, 3, 0, 0, 0, time.Local)},
+		{"0 0 1 jun *", time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local)},
+		// 日和星期都有限制时满足任意一个即可
+		{"0 12 20 * sat", time.Date(2024, 1, 6, 12, 0, 0, 0, time.Local)},
+		{"@every 6h", base.Add(6 * time.Hour)},
+	}
+	for _, tt := range tests {
+		sched, err := parseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("%q: 解析失败: %v", tt.expr, err)
+			continue
+		}
+		if got := sched.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: 期望下一次运行在 %v，但得到 %v", tt.expr, tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "0 0 30 2 *", "@every 10s", "@sometimes"} {
+		if _, err := parseSchedule(expr); err == nil {
+			t.Errorf("%q: 期望解析失败", expr)
+		}
+	}
+}
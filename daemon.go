@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// 检查是否有配置到期的间隔（变量以便于测试）
+// 每次检查都按墙上时间比较，机器休眠期间错过的运行在唤醒后的下一次检查时补上
+var daemonTick = 30 * time.Second
+
+// planLimits 是无人值守运行时 plan 结果和 watch 每一轮镜像的上限，超过任意一项时不执行镜像
+type planLimits struct {
+	MaxDeletes int // 最多删除的文件数，-1 表示不限
+	MaxChanges int // 最多新建、更新和删除的文件总数，-1 表示不限
+}
+
+// 默认的无人值守运行上限
+var defaultPlanLimits = planLimits{MaxDeletes: 100, MaxChanges: -1}
+
+// 返回配置的上限，没有配置或 p 为 nil 时使用默认上限
+func profileLimits(p *profile) planLimits {
+	if p == nil || p.Limits == nil {
+		return defaultPlanLimits
+	}
+	return *p.Limits
+}
+
+// 随机推迟定时运行
+var jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// 检查 plan 的结果是否超过上限
+func (l planLimits) check(c changeCounts) error {
+	if l.MaxDeletes >= 0 && c.Deleted > l.MaxDeletes {
+		return errors.New(tr("daemon.limit_deletes", c.Deleted, l.MaxDeletes))
+	}
+	if total := c.Created + c.Updated + c.Deleted; l.MaxChanges >= 0 && total > l.MaxChanges {
+		return errors.New(tr("daemon.limit_changes", total, l.MaxChanges))
+	}
+	return nil
+}
+
+// scheduledProfile 是 daemon 定时运行的一个配置
+type scheduledProfile struct {
+	profile  *profile
+	schedule cronSchedule
+	slot     time.Time // 调度表达式给出的运行时间
+	next     time.Time // 加上随机推迟之后的实际运行时间
+}
+
+// 根据运行历史确定配置的第一次运行时间
+// 最近一次运行之后已经错过了调度时间（机器关机、休眠或 daemon 没有运行）时立即补上一次，
+// 错过多次也只补一次；没有运行过的配置等到下一个调度时间
+func newScheduledProfile(p *profile, records []runRecord, now time.Time) (*scheduledProfile, error) {
+	sched, err := parseSchedule(p.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	e := &scheduledProfile{profile: p, schedule: sched}
+	if own := profileRecords(records, p, nil); len(own) > 0 {
+		if slot := sched.Next(own[len(own)-1].Start.Round(0)); !slot.After(now) {
+			e.slot, e.next = now, now
+			printNotice(tr("daemon.catch_up", p.Name, slot.Format("2006-01-02 15:04")))
+			return e, nil
+		}
+	}
+	e.reschedule(now)
+	return e, nil
+}
+
+// 计算 after 之后的下一次运行时间
+func (e *scheduledProfile) reschedule(after time.Time) {
+	// Round(0) 去掉单调时钟读数，之后的比较按墙上时间进行
+	e.slot = e.schedule.Next(after.Round(0))
+	e.next = e.slot
+	if e.profile.Jitter > 0 {
+		e.next = e.next.Add(time.Duration(jitterRand.Int63n(int64(e.profile.Jitter))))
+	}
+	printNotice(tr("daemon.next", e.profile.Name, e.next.Format("2006-01-02 15:04:05")))
+}
+
+// 处理 daemon 子命令
+func runDaemonCommand(args []string) {
+	fs := newCommandFlagSet("daemon")
+	addVerbosityFlags(fs)
+	profileName := fs.String("profile", "", tr("flag.profile"))
+	once := fs.Bool("once", false, tr("flag.once"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	if len(positional) != 0 {
+		fs.Usage()
+		osExit(1)
+		return
+	}
+
+	var profiles []*profile
+	var err error
+	if *profileName != "" {
+		var p *profile
+		p, err = findProfile(*profileName)
+		profiles = []*profile{p}
+	} else {
+		profiles, err = loadAllProfiles()
+	}
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	if *once {
+		intr := notifyInterrupt()
+		defer intr.stop()
+		osExit(runOnce(intr, profiles, *profileName != ""))
+		return
+	}
+	entries, err := scheduleProfiles(profiles, time.Now())
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+
+	intr := notifyInterrupt()
+	defer intr.stop()
+	osExit(runDaemon(intr, entries))
+}
+
+// 立即运行一次设置了 schedule 的配置（named 为 true 时不论是否设置），返回最后一个失败的退出码
+// 供 systemd 定时器等外部调度使用，调度本身由外部负责
+func runOnce(intr *interrupter, profiles []*profile, named bool) int {
+	code := 0
+	ran := false
+	for _, p := range profiles {
+		if p.Schedule == "" && !named {
+			continue
+		}
+		ran = true
+		if p.Source == "" || p.Target == "" {
+			printError(errors.New(tr("cli.profile_no_paths", p.Name)))
+			code = 1
+			continue
+		}
+		if c := runScheduled(intr, p); c != 0 {
+			code = c
+		}
+		if intr.ctx.Err() != nil {
+			return code
+		}
+	}
+	if !ran {
+		printError(errors.New(tr("daemon.no_schedules")))
+		return 1
+	}
+	return code
+}
+
+// 为设置了 schedule 的配置确定第一次运行时间
+func scheduleProfiles(profiles []*profile, now time.Time) ([]*scheduledProfile, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	records, err := readHistory(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*scheduledProfile
+	for _, p := range profiles {
+		if p.Schedule == "" {
+			continue
+		}
+		if p.Source == "" || p.Target == "" {
+			return nil, errors.New(tr("cli.profile_no_paths", p.Name))
+		}
+		e, err := newScheduledProfile(p, records, now)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New(tr("daemon.no_schedules"))
+	}
+	return entries, nil
+}
+
+// 按调度依次运行配置，直到收到中断信号，返回退出码
+// 同一时间只运行一个配置，一个配置的运行超过调度间隔时跳过期间的调度，不会重叠运行
+func runDaemon(intr *interrupter, entries []*scheduledProfile) int {
+	ticker := time.NewTicker(daemonTick)
+	defer ticker.Stop()
+	for {
+		for _, e := range entries {
+			if intr.ctx.Err() != nil {
+				break
+			}
+			if time.Now().Round(0).Before(e.next) {
+				continue
+			}
+			code := runScheduled(intr, e.profile)
+			if intr.ctx.Err() != nil && code != 0 {
+				return code
+			}
+			now := time.Now()
+			if e.schedule.Next(e.slot).Before(now) {
+				printWarning(tr("daemon.overlap_skipped", e.profile.Name))
+			}
+			e.reschedule(now)
+		}
+		select {
+		case <-intr.ctx.Done():
+			printColored(colorGreen, tr("daemon.stopped"))
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// 执行配置的一次定时运行，返回退出码
+// 先运行 plan；无人值守的配置在 plan 的结果不超过上限时继续 apply，
+// 否则标记文件留给人工检查后运行 apply
+func runScheduled(intr *interrupter, p *profile) int {
+	printColored(colorGreen, tr("daemon.start", p.Name))
+	cfg, err := profileRuleConfig(p, "")
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	useProfile(p, p.Sync)
+	defer useProfile(nil, syncSettings{})
+	args := mirrorArgs(cfg)
+
+	if !p.Unattended {
+		return planMirror(intr, args, p.Source, p.Target, nil)
+	}
+	limits := profileLimits(p)
+	check := func(rec *runRecord) error { return limits.check(rec.Changes) }
+	if code := planMirror(intr, args, p.Source, p.Target, check); code != 0 {
+		return code
+	}
+	return applyMirror(intr, args, p.Source, p.Target, verifyNone)
+}
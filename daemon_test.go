@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试配置中的调度设置
+func TestProfileSchedule(t *testing.T) {
+	p := &profile{Name: "home"}
+	for key, value := range map[string]string{"schedule": "30 2 * * *", "jitter": "10m", "unattended": "true", "max_deletes": "5"} {
+		if err := p.set(key, value); err != nil {
+			t.Fatalf("设置 %s 失败: %v", key, err)
+		}
+	}
+	if p.Schedule != "30 2 * * *" || p.Jitter != 10*time.Minute || !p.Unattended {
+		t.Errorf("调度设置错误: %+v", p)
+	}
+	if p.Limits == nil || p.Limits.MaxDeletes != 5 || p.Limits.MaxChanges != defaultPlanLimits.MaxChanges {
+		t.Errorf("上限设置错误: %+v", p.Limits)
+	}
+	for key, value := range map[string]string{"schedule": "every day", "jitter": "soon", "unattended": "maybe", "max_changes": "-2"} {
+		if err := p.set(key, value); err == nil {
+			t.Errorf("无效的 %s 应当返回错误", key)
+		}
+	}
+}
+
+// 测试无人值守运行的上限
+func TestPlanLimits(t *testing.T) {
+	limits := planLimits{MaxDeletes: 2, MaxChanges: 10}
+	if err := limits.check(changeCounts{Created: 5, Deleted: 2}); err != nil {
+		t.Errorf("没有超过上限时不应返回错误: %v", err)
+	}
+	if err := limits.check(changeCounts{Deleted: 3}); err == nil || !strings.Contains(err.Error(), "删除 3 个文件") {
+		t.Errorf("删除的文件超过上限时应当返回错误，得到 %v", err)
+	}
+	if err := limits.check(changeCounts{Created: 8, Updated: 3}); err == nil || !strings.Contains(err.Error(), "改变 11 个文件") {
+		t.Errorf("变化的文件超过上限时应当返回错误，得到 %v", err)
+	}
+	if err := (planLimits{MaxDeletes: -1, MaxChanges: -1}).check(changeCounts{Deleted: 1000}); err != nil {
+		t.Errorf("-1 表示不限，得到 %v", err)
+	}
+}
+
+// 测试根据运行历史确定第一次运行时间
+func TestScheduleCatchUp(t *testing.T) {
+	oldDisablePrint := disablePrint
+	defer func() { disablePrint = oldDisablePrint }()
+	disablePrint = true
+
+	now := time.Date(2024, 1, 5, 10, 30, 0, 0, time.Local)
+	tomorrow := time.Date(2024, 1, 6, 2, 0, 0, 0, time.Local)
+	p := &profile{Name: "home", Schedule: "0 2 * * *"}
+	tests := []struct {
+		name    string
+		records []runRecord
+		want    time.Time
+	}{
+		{"没有运行过", nil, tomorrow},
+		{"今天已经运行", []runRecord{{Profile: "home", Start: time.Date(2024, 1, 5, 2, 3, 0, 0, time.Local)}}, tomorrow},
+		{"错过了今天的运行", []runRecord{{Profile: "home", Start: time.Date(2024, 1, 2, 2, 0, 0, 0, time.Local)}}, now},
+		{"其他配置的运行不算", []runRecord{{Profile: "docs", Start: time.Date(2024, 1, 2, 2, 0, 0, 0, time.Local)}}, tomorrow},
+	}
+	for _, tt := range tests {
+		e, err := newScheduledProfile(p, tt.records, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !e.next.Equal(tt.want) {
+			t.Errorf("%s: 期望在 %v 运行，但得到 %v", tt.name, tt.want, e.next)
+		}
+	}
+
+	p.Jitter = 10 * time.Minute
+	for i := 0; i < 20; i++ {
+		e, _ := newScheduledProfile(p, nil, now)
+		if e.next.Before(tomorrow) || !e.next.Before(tomorrow.Add(p.Jitter)) {
+			t.Fatalf("随机推迟超出范围: %v", e.next)
+		}
+	}
+}
+
+// 测试 daemon 补上错过的运行：无人值守时检查上限后 apply，否则只 plan
+func TestRunDaemon(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用 sh 模拟 rsync")
+	}
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	oldExecCommand, oldDisablePrint, oldHistoryFile, oldTick := execCommand, disablePrint, historyFile, daemonTick
+	oldTesting := os.Getenv("TESTING")
+	defer func() {
+		execCommand, disablePrint, historyFile, daemonTick = oldExecCommand, oldDisablePrint, oldHistoryFile, oldTick
+		os.Setenv("TESTING", oldTesting)
+	}()
+	os.Setenv("TESTING", "1")
+	disablePrint = true
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	daemonTick = 10 * time.Millisecond
+
+	// 每次预览都会删除两个文件
+	var applies int
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		if !strings.Contains(strings.Join(args, " "), " -n ") {
+			applies++
+		}
+		return exec.Command("sh", "-c", "printf '*deleting   a\\n*deleting   b\\n'")
+	}
+
+	paths := "source = " + sourceDir + "\ntarget = " + targetDir + "\nschedule = @every 1h\n"
+	content := "[strict]\n" + paths + "unattended = true\nmax_deletes = 1\n" +
+		"[manual]\n" + paths +
+		"[loose]\n" + paths + "unattended = true\n" +
+		"[later]\n" + paths +
+		"[unscheduled]\n"
+	restore := setupProfilesFile(t, testDir, content)
+	defer restore()
+
+	// 前三个配置两小时前运行过，错过了一次调度
+	for _, name := range []string{"strict", "manual", "loose"} {
+		appendHistory(historyFile, &runRecord{Profile: name, Mode: "plan", Start: time.Now().Add(-2 * time.Hour), Status: runSuccess})
+	}
+	appendHistory(historyFile, &runRecord{Profile: "later", Mode: "plan", Start: time.Now().Add(-time.Minute), Status: runSuccess})
+
+	profiles, err := loadAllProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := scheduleProfiles(profiles, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("期望四个定时运行的配置，但得到 %d 个", len(entries))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	intr := &interrupter{ctx: ctx, cancel: cancel, force: make(chan struct{})}
+	done := make(chan int)
+	go func() { done <- runDaemon(intr, entries) }()
+	waitHistory(t, 8)
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("停止 daemon 时期望退出码 0，但得到 %d", code)
+	}
+
+	records, _ := readHistory(historyFile)
+	var got []string
+	for _, r := range records[4:] {
+		got = append(got, r.Profile+" "+r.Mode+" "+r.Status)
+	}
+	expected := []string{"strict plan failed", "manual plan success", "loose plan success", "loose apply success"}
+	if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("期望运行 %v，但得到 %v", expected, got)
+	}
+	if applies != 1 {
+		t.Errorf("期望只执行一次实际镜像，但执行了 %d 次", applies)
+	}
+	if !strings.Contains(records[4].Error, "超过上限") {
+		t.Errorf("超过上限的错误不正确: %s", records[4].Error)
+	}
+	if activeProfile != nil {
+		t.Error("定时运行结束后应当恢复默认设置")
+	}
+}
+
+// 测试 daemon --once 立即运行一次配置
+func TestDaemonOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用 sh 模拟 rsync")
+	}
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	oldExecCommand, oldDisablePrint, oldHistoryFile := execCommand, disablePrint, historyFile
+	oldTesting := os.Getenv("TESTING")
+	defer func() {
+		execCommand, disablePrint, historyFile = oldExecCommand, oldDisablePrint, oldHistoryFile
+		os.Setenv("TESTING", oldTesting)
+	}()
+	os.Setenv("TESTING", "1")
+	disablePrint = true
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		return exec.Command("sh", "-c", "printf '>f+++++++++ new.txt\\n'")
+	}
+
+	// 指定 --profile 时不需要 schedule
+	restore := setupProfilesFile(t, testDir, "[home]\nsource = "+sourceDir+"\ntarget = "+targetDir+"\nunattended = true\n")
+	defer restore()
+	if code := runMainForExit([]string{"daemon", "--once"}); code != 1 {
+		t.Errorf("没有定时运行的配置时期望退出码 1，但得到 %d", code)
+	}
+	if code := runMainForExit([]string{"daemon", "--once", "--profile", "home"}); code != 0 {
+		t.Fatalf("期望退出码 0，但得到 %d", code)
+	}
+	records, _ := readHistory(historyFile)
+	if len(records) != 2 || records[0].Mode != "plan" || records[1].Mode != "apply" || records[1].Status != runSuccess {
+		t.Errorf("运行历史不正确: %+v", records)
+	}
+}
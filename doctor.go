@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// doctor 检查结果的级别
+const (
+	checkOK = iota
+	checkWarn
+	checkError
+)
+
+// doctorCheck 描述一项环境检查的结果
+type doctorCheck struct {
+	Level   int
+	Message string
+}
+
+// 检查 rsync 是否可用
+func checkRsync() doctorCheck {
+	output, err := execCommand("rsync", "--version").Output()
+	if err != nil {
+		return doctorCheck{checkError, tr("doctor.rsync_failed", err)}
+	}
+	version := strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0]
+	return doctorCheck{checkOK, tr("doctor.rsync_ok", version)}
+}
+
+// 检查规则文件是否存在、能否解析以及规则检查是否通过
+func checkRuleFiles(cfg ruleConfig) []doctorCheck {
+	var checks []doctorCheck
+	if _, err := os.Stat(cfg.ExcludeFrom); err != nil {
+		return append(checks, doctorCheck{checkError, tr("doctor.exclude_unusable", err)})
+	}
+	checks = append(checks, doctorCheck{checkOK, tr("doctor.exclude_file", cfg.ExcludeFrom)})
+	if _, err := os.Stat(cfg.IncludeFrom); err != nil {
+		checks = append(checks, doctorCheck{checkWarn, tr("run.include_missing", cfg.IncludeFrom)})
+	} else {
+		checks = append(checks, doctorCheck{checkOK, tr("doctor.include_file", cfg.IncludeFrom)})
+	}
+
+	f, err := loadRuleFilter(cfg)
+	if err != nil {
+		return append(checks, doctorCheck{checkError, tr("rules.read_failed", err)})
+	}
+	issues := lintRules(f.Rules)
+	if len(issues) == 0 {
+		return append(checks, doctorCheck{checkOK, tr("rules.lint_ok", len(f.Rules))})
+	}
+	for _, issue := range issues {
+		checks = append(checks, doctorCheck{checkWarn, tr("doctor.rule_issue", issue.String())})
+	}
+	return checks
+}
+
+// 检查配置文件能否解析，以及每个配置的源目录是否存在
+func checkProfiles() []doctorCheck {
+	path, err := profilesPath()
+	if err != nil {
+		return []doctorCheck{{checkWarn, tr("doctor.profiles_path_failed", err)}}
+	}
+	profiles, err := loadProfiles(path)
+	if os.IsNotExist(err) {
+		return []doctorCheck{{checkOK, tr("doctor.no_profiles", path)}}
+	}
+	if err != nil {
+		return []doctorCheck{{checkError, tr("profile.read_failed", err)}}
+	}
+	checks := []doctorCheck{{checkOK, tr("doctor.profiles", path, len(profiles))}}
+	for _, p := range profiles {
+		if p.Source != "" && !dirExists(p.Source) {
+			checks = append(checks, doctorCheck{checkWarn, tr("doctor.profile_source_missing", p.Name, p.Source)})
+		}
+	}
+	return checks
+}
+
+// 检查状态目录是否属于当前用户并且可写
+func checkStateDir() doctorCheck {
+	root, err := stateRoot()
+	if err != nil {
+		return doctorCheck{checkError, tr("doctor.state_dir_unusable", err)}
+	}
+	tmp, err := ioutil.TempFile(root, ".folder_mirror_doctor")
+	if err != nil {
+		return doctorCheck{checkError, tr("doctor.state_dir_readonly", err)}
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	return doctorCheck{checkOK, tr("doctor.state_dir_ok", root)}
+}
+
+// 处理 doctor 子命令
+func runDoctorCommand(args []string) {
+	fs := newCommandFlagSet("doctor")
+	rf := addRuleFlags(fs)
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		osExit(1)
+		return
+	}
+
+	var checks []doctorCheck
+	cfg, prof, err := rf.config()
+	// 原生同步后端不需要 rsync
+	if rf.sync(prof).Backend == backendNative {
+		checks = append(checks, doctorCheck{checkOK, tr("doctor.native_backend")})
+	} else {
+		checks = append(checks, checkRsync())
+	}
+	if err != nil {
+		checks = append(checks, doctorCheck{checkError, tr("doctor.rules_failed", err)})
+	} else {
+		checks = append(checks, checkRuleFiles(cfg)...)
+	}
+	checks = append(checks, checkProfiles()...)
+	checks = append(checks, checkStateDir())
+
+	errors := 0
+	for _, c := range checks {
+		switch c.Level {
+		case checkOK:
+			printColored(colorGreen, tr("doctor.ok", c.Message))
+		case checkWarn:
+			printMessage(levelWarning, colorYellow, tr("doctor.warn", c.Message))
+		default:
+			errors++
+			printColored(colorRed, tr("doctor.error", c.Message))
+		}
+	}
+	if errors > 0 {
+		printColored(colorRed, tr("doctor.errors", errors))
+		osExit(1)
+		return
+	}
+	printColored(colorGreen, tr("doctor.no_errors"))
+	osExit(0)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 规范化源目录中的相对路径，返回路径以及路径是否以斜杠结尾
+func normalizeRelPath(p string) (string, bool) {
+	trailingSlash := strings.HasSuffix(p, "/")
+	p = filepath.ToSlash(filepath.Clean("/" + p))
+	return strings.TrimPrefix(p, "/"), trailingSlash
+}
+
+// 输出解释结果
+func printExplanation(exp filter.Decision) {
+	printColored(colorGreen, tr("explain.path", exp.Path))
+	if exp.Rule != nil {
+		kind := tr("explain.exclude")
+		if exp.Rule.Include {
+			kind = tr("explain.include")
+		}
+		where := fmt.Sprintf("%s:%d: %s (%s)", exp.Rule.File, exp.Rule.Line, exp.Rule.Pattern, kind)
+		if exp.Parent != "" {
+			printColored(colorYellow, tr("explain.parent_excluded", exp.Parent, where))
+		} else {
+			printColored(colorYellow, tr("explain.matched", where))
+		}
+	} else {
+		printColored(colorYellow, tr("explain.no_match"))
+	}
+	if exp.Included {
+		printColored(colorGreen, tr("explain.mirrored"))
+	} else {
+		printColored(colorRed, tr("explain.not_mirrored"))
+	}
+}
+
+// 处理 explain 子命令
+func runExplainCommand(args []string) {
+	fs := newCommandFlagSet("explain")
+	rf := addRuleFlags(fs)
+	source := fs.String("source", "", tr("flag.explain_source"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		osExit(1)
+		return
+	}
+
+	cfg, prof, err := rf.config()
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	if *source == "" && prof != nil {
+		*source = prof.Source
+	}
+
+	f, err := loadRuleFilter(cfg)
+	if err != nil {
+		printColored(colorRed, tr("rules.read_failed", err))
+		osExit(1)
+		return
+	}
+
+	target := positional[0]
+	if *source != "" && filepath.IsAbs(target) {
+		rel, err := filepath.Rel(*source, target)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			printError(errors.New(tr("explain.outside_source", target)))
+			osExit(1)
+			return
+		}
+		target = rel
+	}
+	relPath, isDir := normalizeRelPath(target)
+	if relPath == "" {
+		printError(errors.New(tr("explain.empty_path")))
+		osExit(1)
+		return
+	}
+	if *source != "" {
+		if info, err := os.Stat(filepath.Join(*source, relPath)); err == nil {
+			isDir = info.IsDir()
+		} else {
+			printWarning(tr("explain.not_in_source", relPath))
+		}
+	}
+
+	printExplanation(f.Decide(relPath, isDir))
+	osExit(0)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 测试相对路径规范化
+func TestNormalizeRelPath(t *testing.T) {
+	testCases := []struct {
+		in    string
+		want  string
+		isDir bool
+	}{
+		{"a/b.txt", "a/b.txt", false},
+		{"./a/b/", "a/b", true},
+		{"/a//b", "a/b", false},
+		{"", "", false},
+	}
+	for _, tc := range testCases {
+		got, isDir := normalizeRelPath(tc.in)
+		if got != tc.want || isDir != tc.isDir {
+			t.Errorf("normalizeRelPath(%q) = (%q, %v), 期望 (%q, %v)", tc.in, got, isDir, tc.want, tc.isDir)
+		}
+	}
+}
+
+// 测试 explain 命令
+func TestRunExplainCommand(t *testing.T) {
+	testDir, sourceDir, _ := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+	excludeFile, includeFile := createTestRuleFiles(t, testDir)
+
+	oldOsExit := osExit
+	oldDisablePrint := disablePrint
+	oldHook := printHook
+	defer func() {
+		osExit = oldOsExit
+		disablePrint = oldDisablePrint
+		printHook = oldHook
+	}()
+	disablePrint = true
+
+	testCases := []struct {
+		name   string
+		args   []string
+		code   int
+		output string
+	}{
+		{"排除的文件", []string{"--exclude-from", excludeFile, "--include-from", includeFile, "--source", sourceDir, "src/build/output.js"}, 0, "不会被镜像"},
+		{"绝对路径", []string{"--exclude-from", excludeFile, "--include-from", includeFile, "--source", sourceDir, filepath.Join(sourceDir, "file1.txt")}, 0, "结果: 会被镜像"},
+		{"源目录外的路径", []string{"--exclude-from", excludeFile, "--source", sourceDir, "/etc/passwd"}, 1, "不在源目录中"},
+		{"缺少路径", []string{"--exclude-from", excludeFile}, 1, ""},
+		{"规则文件不存在", []string{"--exclude-from", filepath.Join(testDir, "missing"), "a"}, 1, "读取规则文件失败"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var output []string
+			printHook = func(msg string) { output = append(output, msg) }
+			exitCode := -1
+			osExit = func(code int) {
+				if exitCode == -1 {
+					exitCode = code
+				}
+			}
+			runExplainCommand(tc.args)
+			if exitCode != tc.code {
+				t.Errorf("期望退出码 %d，但得到 %d", tc.code, exitCode)
+			}
+			if tc.output != "" && !strings.Contains(strings.Join(output, "\n"), tc.output) {
+				t.Errorf("输出中应当包含 %q，得到: %v", tc.output, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 一致性测试使用的文件树，覆盖锚定、深层目录、字符类和带空格的文件名
+var conformanceTree = []string{
+	"a.txt",
+	"a.tmp",
+	"b.pyc",
+	"b.py",
+	"notes.swp",
+	"name with space.txt",
+	"cscope.out",
+	"cscope.po.out",
+	"empty/",
+	"src/main.go",
+	"src/main.tmp",
+	"src/build/out.js",
+	"src/build/keep.js",
+	"src/build/sub/deep.js",
+	"build/top.js",
+	"lib/a/build/x.o",
+	"lib/a/b/c/d.txt",
+	"node_modules/pkg/index.js",
+	"node_modules/pkg/README.md",
+	"web/node_modules/lib.js",
+	".git/config",
+	".git/logs/HEAD",
+	"docs/logs/today.log",
+	"logs/root.log",
+	"cache/x",
+	"a/cache/y",
+	"vendor/v.go",
+	"x/vendor/v.go",
+}
+
+// 一致性测试用例：规则顺序与 folder_mirror 传给 rsync 的参数一致（先排除，后包含）
+var conformanceCases = []struct {
+	name     string
+	excludes []string
+	includes []string
+}{
+	{"无规则", nil, nil},
+	{"扩展名", []string{"*.tmp", "*.py[co]", "*.sw[a-z]"}, nil},
+	{"目录内容", []string{"*/build/*"}, nil},
+	{"只匹配目录", []string{"node_modules/", ".git/"}, nil},
+	{"锚定", []string{"/vendor", "/*.txt"}, nil},
+	{"路径模式", []string{"a/cache", "pkg/*.md"}, nil},
+	{"双星号", []string{"**/cache", "src/**/*.js"}, nil},
+	{"三星号", []string{"/src/***"}, nil},
+	{"末尾空格", []string{"*/cscope.po.out ", "cscope.po.out "}, nil},
+	{"点斜杠前缀", []string{"./*.txt", "./.git/logs/*"}, nil},
+	{"问号和转义", []string{"?.t?t", "name\\ with*"}, nil},
+	{"包含规则被排除规则覆盖", []string{"*.js"}, []string{"keep.js"}},
+	{"包含规则在被排除目录中", []string{"node_modules/"}, []string{"node_modules/pkg/index.js"}},
+	{"前缀规则", []string{"+ keep.js", "*.js"}, nil},
+	{"目录下全部排除", []string{"*/logs/*", "logs/"}, []string{"*.log"}},
+}
+
+// 使用 rsync --list-only 获取会被传输的路径
+func rsyncListOnly(t *testing.T, rsync, root, excludeFile, includeFile string) []string {
+	args := []string{"-a", "--list-only", "--exclude-from=" + excludeFile, "--include-from=" + includeFile, root + "/"}
+	out, err := exec.Command(rsync, args...).Output()
+	if err != nil {
+		t.Fatalf("执行 rsync 失败: %v", err)
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(out), "\n") {
+		// 格式: 权限 大小 日期 时间 路径，路径中可能含有空格
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		idx := strings.Index(line, fields[3]) + len(fields[3])
+		name := strings.TrimLeft(line[idx:], " ")
+		if name == "." {
+			continue
+		}
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// 使用过滤器遍历获取会被传输的路径
+func filterListOnly(t *testing.T, f *Filter, root string) []string {
+	var paths []string
+	err := f.Walk(root, func(relPath string, info os.FileInfo, rule int, included bool) error {
+		if included {
+			paths = append(paths, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk 失败: %v", err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// 与真实的 rsync 比较过滤结果，系统中没有 rsync 时跳过
+func TestRsyncConformance(t *testing.T) {
+	rsync, err := exec.LookPath("rsync")
+	if err != nil {
+		t.Skip("系统中没有安装 rsync，跳过一致性测试")
+	}
+
+	root := makeTree(t, conformanceTree)
+	defer os.RemoveAll(root)
+
+	ruleDir, err := ioutil.TempDir("", "filter_conformance_rules_")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(ruleDir)
+
+	for _, tc := range conformanceCases {
+		t.Run(tc.name, func(t *testing.T) {
+			excludeFile := filepath.Join(ruleDir, "exclude")
+			includeFile := filepath.Join(ruleDir, "include")
+			if err := ioutil.WriteFile(excludeFile, []byte(strings.Join(tc.excludes, "\n")+"\n"), 0644); err != nil {
+				t.Fatalf("无法写入排除规则: %v", err)
+			}
+			if err := ioutil.WriteFile(includeFile, []byte(strings.Join(tc.includes, "\n")+"\n"), 0644); err != nil {
+				t.Fatalf("无法写入包含规则: %v", err)
+			}
+
+			f, err := Load(excludeFile, includeFile)
+			if err != nil {
+				t.Fatalf("Load 失败: %v", err)
+			}
+
+			want := rsyncListOnly(t, rsync, root, excludeFile, includeFile)
+			got := filterListOnly(t, f, root)
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("过滤结果与 rsync 不一致\nrsync:  %v\nfilter: %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// RuleStats 记录一条规则在源目录中决定的文件数和字节数
+type RuleStats struct {
+	Paths int   // 规则直接决定的路径数（被排除的目录只计一次）
+	Files int64 // 涉及的文件数，被排除目录中的全部文件都计入
+	Bytes int64 // 涉及的文件总字节数
+}
+
+// Coverage 遍历源目录，统计每条规则决定的文件数和字节数
+// 结果的下标与 f.Rules 一致；被排除的目录会统计其中全部内容
+func (f *Filter) Coverage(root string) ([]RuleStats, error) {
+	stats := make([]RuleStats, len(f.Rules))
+	err := f.Walk(root, func(relPath string, info os.FileInfo, rule int, included bool) error {
+		if rule < 0 {
+			return nil
+		}
+		s := &stats[rule]
+		s.Paths++
+		if !info.IsDir() {
+			s.Files++
+			s.Bytes += info.Size()
+			return nil
+		}
+		if included {
+			// 被包含的目录会继续遍历，其中的内容由各自的规则决定
+			return nil
+		}
+		return filepath.Walk(filepath.Join(root, filepath.FromSlash(relPath)), func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() {
+				s.Files++
+				s.Bytes += fi.Size()
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
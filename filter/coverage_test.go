@@ -0,0 +1,38 @@
+package filter
+
+import (
+	"os"
+	"testing"
+)
+
+// 测试规则覆盖统计
+func TestCoverage(t *testing.T) {
+	root := makeTree(t, []string{
+		"a.txt",
+		"a.tmp",
+		"b.tmp",
+		"node_modules/pkg/index.js",
+		"node_modules/pkg/README.md",
+		"src/main.go",
+	})
+	defer os.RemoveAll(root)
+
+	f := makeFilter([]string{"*.tmp", "node_modules/", "*.pdf"}, []string{"*.go"})
+	stats, err := f.Coverage(root)
+	if err != nil {
+		t.Fatalf("Coverage 失败: %v", err)
+	}
+
+	// 每个文件的内容都是 "content"，共 7 字节
+	want := []RuleStats{
+		{Paths: 2, Files: 2, Bytes: 14},
+		{Paths: 1, Files: 2, Bytes: 14},
+		{},
+		{Paths: 1, Files: 1, Bytes: 7},
+	}
+	for i, w := range want {
+		if stats[i] != w {
+			t.Errorf("规则 %q 的统计 = %+v, 期望 %+v", f.Rules[i].Pattern, stats[i], w)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package filter 在进程内实现 rsync 的 include/exclude 过滤规则语义。
+//
+// 规则按顺序匹配，第一条匹配的规则决定路径是否被包含；没有规则匹配的路径默认包含。
+// 与 rsync 一样，被排除的目录不会被遍历，因此其中的内容也不会被包含。
+package filter
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Rule 描述规则文件中的一条 rsync 过滤规则
+type Rule struct {
+	File    string // 规则所在文件
+	Line    int    // 行号（从1开始）
+	Raw     string // 原始行内容（未去除空白）
+	Pattern string // 去掉 "+ "/"- " 前缀后的模式，与 rsync 看到的完全一致
+	Include bool   // true 表示包含规则，false 表示排除规则
+
+	// 以下字段由 compile 根据 Pattern 计算
+	anchored   bool   // 以 / 开头，只从传输根目录开始匹配
+	dirOnly    bool   // 以 / 结尾，只匹配目录
+	tripleStar bool   // 以 /*** 结尾，同时匹配目录本身及其全部内容
+	pat        string // 去掉锚定、结尾斜杠和 /*** 后的模式
+}
+
+// NewRule 根据模式创建一条规则
+func NewRule(pattern string, include bool) Rule {
+	r := Rule{Raw: pattern, Pattern: pattern, Include: include}
+	r.compile()
+	return r
+}
+
+// ParseLine 解析规则文件中的一行
+// include 指定不带前缀的规则是包含规则还是排除规则；空行和注释行返回 false
+func ParseLine(raw string, include bool) (Rule, bool) {
+	// 与 rsync 一致：空行以及以 # 或 ; 开头的行被忽略
+	if strings.TrimSpace(raw) == "" || strings.HasPrefix(raw, "#") || strings.HasPrefix(raw, ";") {
+		return Rule{}, false
+	}
+
+	r := Rule{Raw: raw, Pattern: raw, Include: include}
+	// rsync 的 --include-from/--exclude-from 允许用 "+ " 和 "- " 前缀指定规则类型
+	if strings.HasPrefix(raw, "+ ") {
+		r.Include = true
+		r.Pattern = raw[2:]
+	} else if strings.HasPrefix(raw, "- ") {
+		r.Include = false
+		r.Pattern = raw[2:]
+	}
+	r.compile()
+	return r, true
+}
+
+// ReadFile 读取规则文件并保留行号和原始文本
+func ReadFile(filePath string, include bool) ([]Rule, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseRules(file, filePath, include)
+}
+
+// 逐行解析规则，name 记录在每条规则的 File 字段中
+func parseRules(r io.Reader, name string, include bool) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		r, ok := ParseLine(scanner.Text(), include)
+		if !ok {
+			continue
+		}
+		r.File = name
+		r.Line = lineNo
+		rules = append(rules, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// 根据模式文本计算匹配所需的各个字段
+func (r *Rule) compile() {
+	p := r.Pattern
+	r.anchored, r.dirOnly, r.tripleStar = false, false, false
+	if strings.HasPrefix(p, "/") {
+		r.anchored = true
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/***") {
+		r.tripleStar = true
+		p = strings.TrimSuffix(p, "/***")
+	} else if p == "***" {
+		// 单独的 *** 等价于 **
+		p = "**"
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	r.pat = p
+}
+
+// Matches 判断规则是否匹配给定的相对路径（不带开头和结尾的斜杠）
+func (r *Rule) Matches(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.tripleStar {
+		return r.matchPattern(r.pat, relPath) || r.matchPattern(r.pat+"/**", relPath)
+	}
+	return r.matchPattern(r.pat, relPath)
+}
+
+// 按照 rsync 的锚定规则匹配路径
+func (r *Rule) matchPattern(pat, relPath string) bool {
+	if r.anchored {
+		return wildMatch(pat, relPath)
+	}
+	// 不含斜杠和 ** 的模式只匹配最后一个路径组件
+	if r.nameOnly(pat) {
+		return wildMatch(pat, path.Base(relPath))
+	}
+	// 非锚定的路径模式可以匹配从任意目录边界开始的路径尾部
+	s := relPath
+	for {
+		if wildMatch(pat, s) {
+			return true
+		}
+		i := strings.IndexByte(s, '/')
+		if i < 0 {
+			return false
+		}
+		s = s[i+1:]
+	}
+}
+
+// 判断模式是否只匹配最后一个路径组件
+func (r *Rule) nameOnly(pat string) bool {
+	return !r.anchored && !strings.Contains(pat, "/") && !strings.Contains(pat, "**")
+}
+
+// Filter 是按顺序生效的一组规则
+type Filter struct {
+	Rules []Rule
+}
+
+// New 按给定顺序组合多组规则
+func New(ruleSets ...[]Rule) *Filter {
+	f := &Filter{}
+	for _, rules := range ruleSets {
+		f.Rules = append(f.Rules, rules...)
+	}
+	return f
+}
+
+// Load 读取排除和包含规则文件，顺序与传给 rsync 的参数顺序一致（先排除，后包含）
+// includePath 为空或文件不存在时只使用排除规则
+func Load(excludePath, includePath string) (*Filter, error) {
+	excludes, err := ReadFile(excludePath, false)
+	if err != nil {
+		return nil, err
+	}
+	var includes []Rule
+	if includePath != "" {
+		if _, err := os.Stat(includePath); err == nil {
+			includes, err = ReadFile(includePath, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return New(excludes, includes), nil
+}
+
+// Match 返回第一条匹配路径的规则下标，没有规则匹配时返回 -1
+func (f *Filter) Match(relPath string, isDir bool) int {
+	for i := range f.Rules {
+		if f.Rules[i].Matches(relPath, isDir) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Decision 描述一条路径的过滤结果
+type Decision struct {
+	Path     string // 相对路径
+	IsDir    bool   // 路径是否为目录
+	Rule     *Rule  // 决定结果的规则，没有规则匹配时为 nil
+	Parent   string // 结果由上级目录决定时，被排除的上级目录
+	Included bool   // 路径是否会被传输
+}
+
+// Decide 按照 rsync 的遍历方式判断一条路径是否会被传输
+// rsync 不会进入被排除的目录，因此先依次检查每一级上级目录
+func (f *Filter) Decide(relPath string, isDir bool) Decision {
+	d := Decision{Path: relPath, IsDir: isDir, Included: true}
+
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		parent := strings.Join(parts[:i], "/")
+		if idx := f.Match(parent, true); idx >= 0 && !f.Rules[idx].Include {
+			d.Rule = &f.Rules[idx]
+			d.Parent = parent
+			d.Included = false
+			return d
+		}
+	}
+
+	if idx := f.Match(relPath, isDir); idx >= 0 {
+		d.Rule = &f.Rules[idx]
+		d.Included = f.Rules[idx].Include
+	}
+	return d
+}
@@ -0,0 +1,285 @@
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 根据模式列表构造过滤器，排除规则在前
+func makeFilter(excludes, includes []string) *Filter {
+	var rules []Rule
+	for i, p := range excludes {
+		r := NewRule(p, false)
+		r.File, r.Line = "exclude", i+1
+		rules = append(rules, r)
+	}
+	for i, p := range includes {
+		r := NewRule(p, true)
+		r.File, r.Line = "include", i+1
+		rules = append(rules, r)
+	}
+	return New(rules)
+}
+
+// 在临时目录中创建文件树，以 / 结尾的路径创建为目录
+func makeTree(t *testing.T, paths []string) string {
+	root, err := ioutil.TempDir("", "filter_tree_")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	for _, p := range paths {
+		full := filepath.Join(root, p)
+		if strings.HasSuffix(p, "/") {
+			if err := os.MkdirAll(full, 0755); err != nil {
+				t.Fatalf("无法创建目录 %s: %v", full, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("无法创建目录 %s: %v", filepath.Dir(full), err)
+		}
+		if err := ioutil.WriteFile(full, []byte("content"), 0644); err != nil {
+			t.Fatalf("无法创建文件 %s: %v", full, err)
+		}
+	}
+	return root
+}
+
+// 测试规则的锚定、目录和 /*** 语义
+func TestRuleMatches(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.tmp", "a/b/c.tmp", false, true},
+		{"/*.tmp", "a/c.tmp", false, false},
+		{"/*.tmp", "c.tmp", false, true},
+		{"build/", "src/build", true, true},
+		{"build/", "src/build", false, false},
+		{"*/build/*", "src/build/out.js", false, true},
+		{"*/build/*", "build/out.js", false, false},
+		{"*/build/*", "a/src/build/out.js", false, true},
+		{"src/build", "x/src/build", true, true},
+		{"src/build", "x/mysrc/build", true, false},
+		{"/src/***", "src", true, true},
+		{"/src/***", "src/a/b", false, true},
+		{"/src/***", "x/src/a", false, false},
+		{"node_modules", "a/node_modules", true, true},
+		{"**/cache", "a/b/cache", true, true},
+		{"*/cscope.po.out ", "a/cscope.po.out", false, false},
+	}
+
+	for _, tc := range testCases {
+		r := NewRule(tc.pattern, false)
+		if got := r.Matches(tc.path, tc.isDir); got != tc.want {
+			t.Errorf("规则 %q 匹配 %q (目录=%v) = %v, 期望 %v", tc.pattern, tc.path, tc.isDir, got, tc.want)
+		}
+	}
+}
+
+// 测试规则行解析
+func TestParseLine(t *testing.T) {
+	testCases := []struct {
+		line    string
+		ok      bool
+		pattern string
+		include bool
+	}{
+		{"# 注释", false, "", false},
+		{"; 注释", false, "", false},
+		{"   ", false, "", false},
+		{"*.tmp ", true, "*.tmp ", false},
+		{"+ keep.tmp", true, "keep.tmp", true},
+		{"- drop/", true, "drop/", false},
+	}
+
+	for _, tc := range testCases {
+		r, ok := ParseLine(tc.line, false)
+		if ok != tc.ok {
+			t.Errorf("ParseLine(%q) ok = %v, 期望 %v", tc.line, ok, tc.ok)
+			continue
+		}
+		if ok && (r.Pattern != tc.pattern || r.Include != tc.include || r.Raw != tc.line) {
+			t.Errorf("ParseLine(%q) = %+v, 期望模式 %q 包含=%v", tc.line, r, tc.pattern, tc.include)
+		}
+	}
+}
+
+// 测试读取规则文件和加载过滤器
+func TestLoad(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "filter_load_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	excludeFile := filepath.Join(tempDir, "exclude")
+	includeFile := filepath.Join(tempDir, "include")
+	ioutil.WriteFile(excludeFile, []byte("# 注释\n.git/\n\n*/build/*\n"), 0644)
+	ioutil.WriteFile(includeFile, []byte("*.txt\n"), 0644)
+
+	f, err := Load(excludeFile, includeFile)
+	if err != nil {
+		t.Fatalf("Load 失败: %v", err)
+	}
+	if len(f.Rules) != 3 {
+		t.Fatalf("规则数量不匹配: 得到 %d, 期望 3", len(f.Rules))
+	}
+	if f.Rules[0].Line != 2 || f.Rules[1].Line != 4 || f.Rules[0].File != excludeFile {
+		t.Errorf("行号或文件记录错误: %+v", f.Rules[:2])
+	}
+	if f.Rules[0].Include || !f.Rules[2].Include {
+		t.Error("排除规则应当排在包含规则之前")
+	}
+
+	// 包含规则文件不存在时只返回排除规则
+	f, err = Load(excludeFile, filepath.Join(tempDir, "missing"))
+	if err != nil || len(f.Rules) != 2 {
+		t.Errorf("包含规则文件不存在时应当只加载排除规则: %v", err)
+	}
+
+	if _, err := Load(filepath.Join(tempDir, "missing"), includeFile); err == nil {
+		t.Error("排除规则文件不存在时应当返回错误")
+	}
+}
+
+// 测试路径过滤结果
+func TestDecide(t *testing.T) {
+	f := makeFilter(
+		[]string{"*.tmp", "node_modules/", "*/build/*"},
+		[]string{"keep.tmp", "node_modules/pkg/index.js"},
+	)
+
+	testCases := []struct {
+		path     string
+		isDir    bool
+		included bool
+		line     int    // 期望匹配的规则行号，0 表示没有规则匹配
+		parent   string // 期望被排除的上级目录
+	}{
+		{"a/b.txt", false, true, 0, ""},
+		{"a/b.tmp", false, false, 1, ""},
+		{"node_modules/pkg/index.js", false, false, 2, "node_modules"},
+		{"src/build/out.js", false, false, 3, ""},
+		{"src/build/sub/out.js", false, false, 3, "src/build/sub"},
+		{"node_modules", false, true, 0, ""},
+	}
+
+	for _, tc := range testCases {
+		d := f.Decide(tc.path, tc.isDir)
+		if d.Included != tc.included {
+			t.Errorf("%s: 包含结果 = %v, 期望 %v", tc.path, d.Included, tc.included)
+		}
+		if tc.line == 0 {
+			if d.Rule != nil {
+				t.Errorf("%s: 不应当匹配规则，但匹配了 %s:%d", tc.path, d.Rule.File, d.Rule.Line)
+			}
+		} else if d.Rule == nil || d.Rule.Line != tc.line {
+			t.Errorf("%s: 期望匹配第 %d 行规则，得到 %+v", tc.path, tc.line, d.Rule)
+		}
+		if d.Parent != tc.parent {
+			t.Errorf("%s: 上级目录 = %q, 期望 %q", tc.path, d.Parent, tc.parent)
+		}
+	}
+}
+
+// 测试遍历目录树时不进入被排除的目录
+func TestWalk(t *testing.T) {
+	root := makeTree(t, []string{
+		"a.txt",
+		"a.tmp",
+		"node_modules/pkg/index.js",
+		"src/main.go",
+		"src/build/out.js",
+	})
+	defer os.RemoveAll(root)
+
+	f := makeFilter([]string{"*.tmp", "node_modules/", "*/build/*"}, nil)
+
+	var included, visited []string
+	err := f.Walk(root, func(relPath string, info os.FileInfo, rule int, inc bool) error {
+		visited = append(visited, relPath)
+		if inc {
+			included = append(included, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk 失败: %v", err)
+	}
+
+	want := []string{"a.txt", "src", "src/build", "src/main.go"}
+	sort.Strings(included)
+	if strings.Join(included, ",") != strings.Join(want, ",") {
+		t.Errorf("包含的路径 = %v, 期望 %v", included, want)
+	}
+	for _, p := range visited {
+		if strings.HasPrefix(p, "node_modules/") {
+			t.Errorf("不应当进入被排除的目录: %s", p)
+		}
+	}
+
+	if err := f.Walk(filepath.Join(root, "missing"), func(string, os.FileInfo, int, bool) error { return nil }); err == nil {
+		t.Error("根目录不存在时应当返回错误")
+	}
+}
+
+// 测试内置规则预设
+func TestPresets(t *testing.T) {
+	names := PresetNames()
+	for _, want := range []string{"editor", "go", "java", "latex", "node", "os-junk", "python", "rust"} {
+		found := false
+		for _, name := range names {
+			if name == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("缺少内置预设 %q，现有预设: %v", want, names)
+		}
+	}
+
+	for _, name := range names {
+		rules, err := Preset(name)
+		if err != nil {
+			t.Errorf("读取预设 %s 失败: %v", name, err)
+			continue
+		}
+		if len(rules) == 0 {
+			t.Errorf("预设 %s 没有任何规则", name)
+		}
+		for _, r := range rules {
+			if r.File != PresetPrefix+name || r.Include {
+				t.Errorf("预设 %s 的规则 %+v 来源或类型错误", name, r)
+			}
+			if err := CheckSyntax(r.Pattern); err != nil {
+				t.Errorf("预设 %s 第 %d 行语法错误: %v", name, r.Line, err)
+			}
+		}
+	}
+
+	f := New(mustPreset(t, "node"), mustPreset(t, "editor"))
+	for _, p := range []string{"web/node_modules/x.js", ".main.go.swp", "#draft#"} {
+		if d := f.Decide(p, false); d.Included {
+			t.Errorf("预设应当排除 %s", p)
+		}
+	}
+
+	if _, err := Preset("no-such-preset"); err == nil || !strings.Contains(err.Error(), "未知的规则预设") {
+		t.Errorf("未知预设应当返回错误，得到: %v", err)
+	}
+}
+
+func mustPreset(t *testing.T, name string) []Rule {
+	rules, err := Preset(name)
+	if err != nil {
+		t.Fatalf("读取预设 %s 失败: %v", name, err)
+	}
+	return rules
+}
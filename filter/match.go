@@ -0,0 +1,187 @@
+package filter
+
+import "strings"
+
+// 实现 rsync 的通配符匹配：
+// * 匹配除 / 以外的任意字符，** 匹配包括 / 在内的任意字符，
+// ? 匹配除 / 以外的单个字符，[...] 匹配字符类，\ 转义下一个字符
+func wildMatch(pattern, text string) bool {
+	p, t := pattern, text
+	for len(p) > 0 {
+		switch c := p[0]; c {
+		case '\\':
+			if len(p) < 2 {
+				// 结尾的单独反斜杠按字面字符处理
+				return t == "\\"
+			}
+			if len(t) == 0 || t[0] != p[1] {
+				return false
+			}
+			p, t = p[2:], t[1:]
+		case '?':
+			if len(t) == 0 || t[0] == '/' {
+				return false
+			}
+			p, t = p[1:], t[1:]
+		case '*':
+			if len(p) > 1 && p[1] == '*' {
+				for len(p) > 0 && p[0] == '*' {
+					p = p[1:]
+				}
+				if len(p) == 0 {
+					return true
+				}
+				for i := 0; i <= len(t); i++ {
+					if wildMatch(p, t[i:]) {
+						return true
+					}
+				}
+				return false
+			}
+			p = p[1:]
+			if len(p) == 0 {
+				return !strings.Contains(t, "/")
+			}
+			for i := 0; i <= len(t); i++ {
+				if wildMatch(p, t[i:]) {
+					return true
+				}
+				if i < len(t) && t[i] == '/' {
+					break
+				}
+			}
+			return false
+		case '[':
+			if len(t) == 0 || t[0] == '/' {
+				return false
+			}
+			matched, n := matchClass(p, t[0])
+			if n < 0 || !matched {
+				return false
+			}
+			p, t = p[n:], t[1:]
+		default:
+			if len(t) == 0 || t[0] != c {
+				return false
+			}
+			p, t = p[1:], t[1:]
+		}
+	}
+	return len(t) == 0
+}
+
+// 字符类名称与判断函数
+var charClasses = map[string]func(byte) bool{
+	"alnum":  func(c byte) bool { return isAlpha(c) || isDigit(c) },
+	"alpha":  isAlpha,
+	"blank":  func(c byte) bool { return c == ' ' || c == '\t' },
+	"cntrl":  func(c byte) bool { return c < 0x20 || c == 0x7f },
+	"digit":  isDigit,
+	"graph":  func(c byte) bool { return c > 0x20 && c < 0x7f },
+	"lower":  func(c byte) bool { return c >= 'a' && c <= 'z' },
+	"print":  func(c byte) bool { return c >= 0x20 && c < 0x7f },
+	"punct":  func(c byte) bool { return c > 0x20 && c < 0x7f && !isAlpha(c) && !isDigit(c) },
+	"space":  func(c byte) bool { return c == ' ' || (c >= '\t' && c <= '\r') },
+	"upper":  func(c byte) bool { return c >= 'A' && c <= 'Z' },
+	"xdigit": func(c byte) bool { return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') },
+}
+
+func isAlpha(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// 匹配以 [ 开头的字符类，返回是否匹配以及字符类在模式中占用的长度
+// 字符类没有闭合或含有未知的 [:name:] 时长度返回 -1
+func matchClass(p string, c byte) (bool, int) {
+	i := 1
+	negate := false
+	if i < len(p) && (p[i] == '!' || p[i] == '^') {
+		negate = true
+		i++
+	}
+	matched := false
+	first := true
+	for {
+		if i >= len(p) {
+			return false, -1
+		}
+		ch := p[i]
+		if ch == ']' && !first {
+			i++
+			break
+		}
+		first = false
+		if ch == '[' && i+1 < len(p) && p[i+1] == ':' {
+			end := strings.Index(p[i+2:], ":]")
+			if end < 0 {
+				return false, -1
+			}
+			fn, ok := charClasses[p[i+2:i+2+end]]
+			if !ok {
+				return false, -1
+			}
+			if fn(c) {
+				matched = true
+			}
+			i += end + 4
+			continue
+		}
+		if ch == '\\' && i+1 < len(p) {
+			i++
+			ch = p[i]
+		}
+		lo := ch
+		i++
+		if i+1 < len(p) && p[i] == '-' && p[i+1] != ']' {
+			hi := p[i+1]
+			i += 2
+			if hi == '\\' && i < len(p) {
+				hi = p[i]
+				i++
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			continue
+		}
+		if c == lo {
+			matched = true
+		}
+	}
+	return matched != negate, i
+}
+
+// CheckSyntax 检查模式的通配符语法，返回描述问题的错误，没有问题时返回 nil
+func CheckSyntax(pattern string) error {
+	p := strings.TrimPrefix(pattern, "/")
+	if strings.Trim(p, "/") == "" {
+		return newError("filter.err.empty_pattern")
+	}
+	if strings.Contains(p, "//") {
+		return newError("filter.err.double_slash")
+	}
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			if i == len(p)-1 {
+				return newError("filter.err.trailing_backslash")
+			}
+			i++
+		case '[':
+			_, n := matchClass(p[i:], 'a')
+			if n < 0 {
+				return newError("filter.err.bad_class")
+			}
+			i += n - 1
+		case '*':
+			n := 0
+			for i+n < len(p) && p[i+n] == '*' {
+				n++
+			}
+			if n > 3 || (n == 3 && i+n != len(p)) {
+				return newError("filter.err.triple_star")
+			}
+			i += n - 1
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package filter
+
+import "testing"
+
+// 测试 rsync 通配符匹配
+func TestWildMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		text    string
+		want    bool
+	}{
+		{"*.tmp", "a.tmp", true},
+		{"*.tmp", "dir/a.tmp", false},
+		{"**.tmp", "dir/a.tmp", true},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", false},
+		{"*.py[co]", "x.pyc", true},
+		{"*.py[co]", "x.pyd", false},
+		{"*.sw[a-z]", "x.swp", true},
+		{"*.sw[!a-z]", "x.swp", false},
+		{"[[:digit:]]*", "1abc", true},
+		{"[]]", "]", true},
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+		{"dir/**/x", "dir/a/b/x", true},
+		{"dir/*/x", "dir/a/b/x", false},
+		{"[abc", "a", false},
+		{"", "", true},
+	}
+
+	for _, tc := range testCases {
+		if got := wildMatch(tc.pattern, tc.text); got != tc.want {
+			t.Errorf("wildMatch(%q, %q) = %v, 期望 %v", tc.pattern, tc.text, got, tc.want)
+		}
+	}
+}
+
+// 测试通配符语法检查
+func TestCheckSyntax(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"*.tmp", true},
+		{"*.py[co]", true},
+		{"dir/***", true},
+		{"**/cache", true},
+		{"*.py[co", false},
+		{"foo\\", false},
+		{"a/***/b", false},
+		{"a//b", false},
+		{"/", false},
+		{"[[:nope:]]", false},
+	}
+
+	for _, tc := range testCases {
+		err := CheckSyntax(tc.pattern)
+		if (err == nil) != tc.valid {
+			t.Errorf("CheckSyntax(%q) = %v, 期望有效=%v", tc.pattern, err, tc.valid)
+		}
+	}
+}
+
+// 测试规则之间的覆盖关系
+func TestSubsumes(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want bool
+	}{
+		{"*.out", "*/cscope.out", true},
+		{"*.out", "cscope.out", true},
+		{"*/logs/*", "./.git/logs/*", true},
+		{"*/build/*", "*/build/keep.js", true},
+		{"build/", "build", false},
+		{"build", "build/", true},
+		{"/src/*", "/src/a.c", true},
+		{"/src/*", "src/a.c", false},
+		{"src/*", "/src/a.c", true},
+		{"?.tmp", "*.tmp", false},
+		{"*.py", "*.py[co]", false},
+		{"*/build/*", "*.js", false},
+	}
+
+	for _, tc := range testCases {
+		a, b := NewRule(tc.a, false), NewRule(tc.b, false)
+		if got := a.Subsumes(&b); got != tc.want {
+			t.Errorf("%q 覆盖 %q = %v, 期望 %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+// 测试排除规则排除上级目录的判断
+func TestExcludesParentOf(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want bool
+	}{
+		{"node_modules/", "node_modules/pkg/index.js", true},
+		{"node_modules/", "*.js", false},
+		{"/vendor", "vendor/a/b.go", false},
+		{"/vendor", "/vendor/a/b.go", true},
+		{"build", "src/*/build/x", true},
+	}
+
+	for _, tc := range testCases {
+		a, b := NewRule(tc.a, false), NewRule(tc.b, true)
+		if got := a.ExcludesParentOf(&b); got != tc.want {
+			t.Errorf("%q 排除 %q 的上级目录 = %v, 期望 %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	include := NewRule("node_modules/", true)
+	b := NewRule("node_modules/pkg/index.js", true)
+	if include.ExcludesParentOf(&b) {
+		t.Error("包含规则不应当排除上级目录")
+	}
+}
@@ -0,0 +1,62 @@
+package filter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 错误的消息，键为稳定的消息 ID，值为默认的中文格式
+// 调用方可以根据 ErrorMessage 返回的 ID 和参数翻译消息
+var messages = map[string]string{
+	"filter.err.empty_pattern":      "模式为空",
+	"filter.err.double_slash":       "模式中含有连续的斜杠，永远不会匹配",
+	"filter.err.trailing_backslash": "模式以单独的反斜杠结尾",
+	"filter.err.bad_class":          "字符类 [...] 没有闭合或含有未知的 [:class:]",
+	"filter.err.triple_star":        "'***' 只能出现在模式末尾的 '/***' 中",
+	"filter.err.unknown_preset":     "未知的规则预设: %s (可用预设: %s)",
+}
+
+// 按消息 ID 生成默认的中文消息
+func message(id string, args ...interface{}) string {
+	if len(args) == 0 {
+		return messages[id]
+	}
+	return fmt.Sprintf(messages[id], args...)
+}
+
+// MessageIDs 返回所有错误的消息 ID，按名称排序
+func MessageIDs() []string {
+	ids := make([]string, 0, len(messages))
+	for id := range messages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// MessageFormat 返回消息 ID 对应的默认中文格式
+func MessageFormat(id string) string {
+	return messages[id]
+}
+
+// messageError 是按消息 ID 生成信息的错误
+type messageError struct {
+	id   string
+	args []interface{}
+}
+
+func (e *messageError) Error() string { return message(e.id, e.args...) }
+
+// 创建按消息 ID 生成信息的错误
+func newError(id string, args ...interface{}) error {
+	return &messageError{id: id, args: args}
+}
+
+// ErrorMessage 返回本包创建的错误的消息 ID 和参数，用于翻译错误信息
+// 只描述 err 本身，不展开包装；不是本包创建的错误时 ok 为 false
+func ErrorMessage(err error) (id string, args []interface{}, ok bool) {
+	if e, isMsg := err.(*messageError); isMsg {
+		return e.id, e.args, true
+	}
+	return "", nil, false
+}
@@ -0,0 +1,47 @@
+package filter
+
+import (
+	"embed"
+	"sort"
+	"strings"
+)
+
+// 内置的规则预设，随程序一起发布和升级
+//
+//go:embed presets/*.rules
+var presetFS embed.FS
+
+// PresetPrefix 是内置预设规则在 Rule.File 中使用的前缀
+const PresetPrefix = "preset:"
+
+// PresetNames 返回全部内置预设的名称
+func PresetNames() []string {
+	entries, err := presetFS.ReadDir("presets")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".rules"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PresetSource 返回内置预设的原始内容
+func PresetSource(name string) (string, error) {
+	data, err := presetFS.ReadFile("presets/" + name + ".rules")
+	if err != nil {
+		return "", newError("filter.err.unknown_preset", name, strings.Join(PresetNames(), ", "))
+	}
+	return string(data), nil
+}
+
+// Preset 返回内置预设中的排除规则，规则的 File 字段为 "preset:名称"
+func Preset(name string) ([]Rule, error) {
+	src, err := PresetSource(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(strings.NewReader(src), PresetPrefix+name, false)
+}
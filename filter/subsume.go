@@ -0,0 +1,62 @@
+package filter
+
+import "strings"
+
+// Subsumes 判断规则 r 匹配的路径是否一定包含规则 o 匹配的全部路径
+// 只在 r 不含 ? 和 [...] 时判断，避免把通配符当作字面字符造成误报
+func (r *Rule) Subsumes(o *Rule) bool {
+	if strings.ContainsAny(r.pat, "?[\\") || r.tripleStar != o.tripleStar {
+		return false
+	}
+	if r.dirOnly && !o.dirOnly {
+		return false
+	}
+	if r.nameOnly(r.pat) {
+		// r 只匹配最后一个路径组件
+		return wildMatch(r.pat, lastComponent(o.pat))
+	}
+	if o.anchored {
+		return r.matchPattern(r.pat, o.pat)
+	}
+	if o.nameOnly(o.pat) {
+		// o 只匹配名称，可以出现在任意深度，而 r 需要匹配路径
+		return false
+	}
+	return !r.anchored && r.matchPattern(r.pat, o.pat)
+}
+
+// ExcludesParentOf 判断排除规则 r 是否排除了规则 o 所有路径的某个上级目录
+func (r *Rule) ExcludesParentOf(o *Rule) bool {
+	if r.Include || strings.ContainsAny(r.pat, "?[\\") {
+		return false
+	}
+	parent := o.pat
+	for {
+		i := strings.LastIndexByte(parent, '/')
+		if i < 0 {
+			return false
+		}
+		parent = parent[:i]
+		if r.nameOnly(r.pat) {
+			// 只匹配名称的规则只需要上级目录的最后一个组件是字面值
+			if last := lastComponent(parent); !strings.ContainsAny(last, "*?[\\") && wildMatch(r.pat, last) {
+				return true
+			}
+			continue
+		}
+		if strings.ContainsAny(parent, "*?[\\") {
+			continue
+		}
+		// o 不锚定时上级目录可能出现在任意深度，锚定的 r 无法保证匹配
+		if (o.anchored || !r.anchored) && r.Matches(parent, true) {
+			return true
+		}
+	}
+}
+
+func lastComponent(p string) string {
+	if i := strings.LastIndexByte(p, '/'); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
@@ -0,0 +1,41 @@
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WalkFunc 在遍历时对每个条目调用
+// rule 为决定结果的规则下标（-1 表示没有规则匹配），included 表示条目是否会被传输
+type WalkFunc func(relPath string, info os.FileInfo, rule int, included bool) error
+
+// Walk 按 rsync 的方式遍历 root 下的目录树
+// 与 rsync 一样不跟随符号链接，被排除的目录会回调一次但不会继续深入
+func (f *Filter) Walk(root string, fn WalkFunc) error {
+	return f.walk(root, "", fn)
+}
+
+func (f *Filter) walk(dir, rel string, fn WalkFunc) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		relPath := info.Name()
+		if rel != "" {
+			relPath = rel + "/" + info.Name()
+		}
+		idx := f.Match(relPath, info.IsDir())
+		included := idx < 0 || f.Rules[idx].Include
+		if err := fn(relPath, info, idx, included); err != nil {
+			return err
+		}
+		if info.IsDir() && included {
+			if err := f.walk(filepath.Join(dir, info.Name()), relPath, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -2,20 +2,24 @@ package main
 
 import (
 	"bufio"
-	"flag"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
 )
 
 // 定义可配置参数（改为变量以便于测试）
+// markerFile 为空时使用状态目录中每对目录各自的标记文件
 var (
-	markerFile    = "/tmp/folder_mirror_marker"
+	markerFile    = ""
 	markerTimeout = int64(3600) // 1小时（秒）
 )
 
@@ -37,10 +41,27 @@ const (
 var printHook func(string)
 var disablePrint bool = false
 
-// 彩色打印
+// 彩色打印，消息级别由颜色确定
 func printColored(color, message string) {
-	if !disablePrint {
-		fmt.Printf("%s%s%s\n", color, message, colorNone)
+	printMessage(levelForColor(color), color, message)
+}
+
+// 按级别输出消息，-q 时不输出的级别直接忽略；color 为空或不使用颜色时输出纯文本
+func printMessage(level, color, message string) {
+	if level == levelWarning {
+		countWarning()
+	}
+	if !shouldPrint(level) {
+		return
+	}
+	if jsonOutput() {
+		emitJSON(outputEvent{Type: eventMessage, Level: level, Message: message})
+	} else if !disablePrint {
+		if color != "" && useColor() {
+			fmt.Printf("%s%s%s\n", color, message, colorNone)
+		} else {
+			fmt.Println(message)
+		}
 	}
 	// 如果测试钩子存在，调用它
 	if printHook != nil {
@@ -48,6 +69,11 @@ func printColored(color, message string) {
 	}
 }
 
+// 输出需要用户注意但不是问题的消息
+func printNotice(message string) {
+	printMessage(levelNotice, colorYellow, message)
+}
+
 // 读取包含或排除规则文件
 func readRuleFile(filePath string) ([]string, error) {
 	file, err := os.Open(filePath)
@@ -74,342 +100,353 @@ func readRuleFile(filePath string) ([]string, error) {
 
 // 检查目录是否存在
 func dirExists(path string) bool {
-	// 远程路径检查 (包含冒号的路径)
-	if strings.Contains(path, ":") {
-		// 如果是远程路径，我们无法直接检查，默认存在
-		return true
-	}
-
-	info, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false
-	}
-	return info.IsDir()
+	return mirror.DirExists(path)
 }
 
 // 创建目录
 func createDir(path string) error {
-	// 远程路径检查 (包含冒号的路径)
-	if strings.Contains(path, ":") {
-		return fmt.Errorf("不支持创建远程目录，请使用本地文件系统路径: %s", path)
-	}
-
-	return os.MkdirAll(path, 0755)
+	return mirror.CreateDir(path)
 }
 
 // 检查标记文件
 func checkMarkerFile() (bool, error) {
-	data, err := ioutil.ReadFile(markerFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, fmt.Errorf("找不到标记文件。请先使用 --dry-run 参数生成标记文件")
-		}
+	if err := mirror.CheckMarker(markerFile, time.Duration(markerTimeout)*time.Second); err != nil {
 		return false, err
 	}
-
-	timestampStr := strings.TrimSpace(string(data))
-	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
-	if err != nil {
-		return false, fmt.Errorf("无法解析标记文件时间戳: %v", err)
-	}
-
-	currentTime := time.Now().Unix()
-	timeDiff := currentTime - timestamp
-
-	if timeDiff > markerTimeout {
-		return false, fmt.Errorf("标记文件太旧 (%d 秒, 最大 %d)", timeDiff, markerTimeout)
-	}
-
 	return true, nil
 }
 
 // 创建标记文件
 func createMarkerFile() error {
-	timestamp := fmt.Sprintf("%d", time.Now().Unix())
-	return ioutil.WriteFile(markerFile, []byte(timestamp), 0644)
+	return mirror.CreateMarker(markerFile)
 }
 
 // 检查源目录和目标目录是否相同或有从属关系
 func checkDirSameOrNested(source, target string) (bool, error) {
-	// 检查远程路径 (包含冒号的路径)
-	if strings.Contains(source, ":") {
-		return false, fmt.Errorf("不支持远程源目录路径，请使用本地文件系统路径: %s", source)
-	}
-	if strings.Contains(target, ":") {
-		return false, fmt.Errorf("不支持远程目标目录路径，请使用本地文件系统路径: %s", target)
-	}
+	return mirror.CheckDirSameOrNested(source, target)
+}
 
-	// 获取源目录和目标目录的绝对路径
-	absSource, err := filepath.Abs(source)
-	if err != nil {
-		return false, fmt.Errorf("无法获取源目录绝对路径: %v", err)
-	}
+// 检查目录是否为空
+func isDirEmpty(dir string) (bool, error) {
+	return mirror.IsDirEmpty(dir)
+}
 
-	absTarget, err := filepath.Abs(target)
-	if err != nil {
-		return false, fmt.Errorf("无法获取目标目录绝对路径: %v", err)
+// 把镜像事件输出到终端
+func printEvent(e mirror.Event) {
+	if jsonOutput() {
+		printEventJSON(e)
+		return
 	}
-
-	// 检查目录是否相同
-	if absSource == absTarget {
-		return true, nil
+	switch e.Kind {
+	case mirror.EventOutput:
+		if verbosity > verbosityQuiet {
+			fmt.Println(e.Message)
+		}
+	case mirror.EventNotice:
+		printNotice(eventText(e))
+	case mirror.EventWarning:
+		printWarning(eventText(e))
+	default:
+		printMessage(levelInfo, colorGreen, eventText(e))
 	}
+}
 
-	// 检查目标目录是否是源目录的子目录
-	if strings.HasPrefix(absTarget, absSource+string(filepath.Separator)) {
-		return true, nil
+// 以 JSON 行输出镜像事件，rsync 的输出被解析为文件变化和进度
+func printEventJSON(e mirror.Event) {
+	var ev outputEvent
+	switch e.Kind {
+	case mirror.EventOutput:
+		ev = rsyncOutputEvent(e.Message)
+	case mirror.EventNotice:
+		ev = outputEvent{Type: eventMessage, Level: levelNotice, ID: e.ID, Message: eventText(e)}
+	case mirror.EventWarning:
+		ev = outputEvent{Type: eventMessage, Level: levelWarning, ID: e.ID, Message: eventText(e)}
+	default:
+		ev = outputEvent{Type: eventMessage, Level: levelInfo, ID: e.ID, Message: eventText(e)}
+	}
+	if (ev.Type == eventMessage && !shouldPrint(ev.Level)) || (e.Kind == mirror.EventOutput && verbosity == verbosityQuiet) {
+		return
+	}
+	emitJSON(ev)
+	if printHook != nil {
+		printHook(eventText(e))
 	}
+}
 
-	// 检查源目录是否是目标目录的子目录
-	if strings.HasPrefix(absSource, absTarget+string(filepath.Separator)) {
-		return true, nil
+// rsync 标准输出和标准错误在终端上的去向，JSON 输出时转换为事件
+// -q 时丢弃标准输出，只保留标准错误
+func terminalOutputs() (io.Writer, io.Writer) {
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if jsonOutput() {
+		stdout, stderr = &jsonOutputWriter{level: levelInfo}, &jsonOutputWriter{level: levelError}
 	}
-
-	// 检查源目录和目标目录是否通过符号链接指向相同位置
-	srcInfo, err := os.Lstat(absSource)
-	if err != nil {
-		return false, fmt.Errorf("无法获取源目录信息: %v", err)
+	if verbosity == verbosityQuiet {
+		stdout = ioutil.Discard
 	}
+	return stdout, stderr
+}
+
+// 当前运行使用的配置，没有使用 --profile 时为 nil
+var activeProfile *profile
+
+// mirrorRun 是一次 plan 或 apply 运行：镜像、运行记录、运行日志、钩子、通知和指标
+type mirrorRun struct {
+	*mirror.Mirror
+	rec        *runRecord
+	log        *runLog
+	st         *pairState
+	hooks      map[string]string
+	notify     *notifyConfig
+	metricsDir string
+	warnings   int64 // 开始时已经输出的警告数
+}
 
-	tgtInfo, err := os.Lstat(absTarget)
+// 根据全局设置开始一次运行，按 syncConfig 创建同步后端，force 关闭时强制终止被中断的 rsync
+// 标记文件、运行日志和锁文件位于这对目录的状态子目录中，运行日志创建失败时只输出警告
+// limits 不为 nil 时 Apply 不检查标记文件，而是先预览这次镜像并按 limits 检查，只用于 watch 在第一轮之后的镜像
+func startMirrorRun(mode string, args []string, source, target string, limits *planLimits, force <-chan struct{}) (*mirrorRun, error) {
+	st, err := statePaths(source, target)
 	if err != nil {
-		// 目标目录可能不存在，此时不是同一目录
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, fmt.Errorf("无法获取目标目录信息: %v", err)
+		return nil, fmt.Errorf("%s: %w", tr("run.state_dir_failed"), err)
 	}
-
-	// 如果两者都是符号链接，解析它们的真实路径并比较
-	if srcInfo.Mode()&os.ModeSymlink != 0 || tgtInfo.Mode()&os.ModeSymlink != 0 {
-		realSource, err := filepath.EvalSymlinks(absSource)
-		if err != nil {
-			return false, fmt.Errorf("无法解析源目录符号链接: %v", err)
-		}
-
-		realTarget, err := filepath.EvalSymlinks(absTarget)
-		if err != nil {
-			return false, fmt.Errorf("无法解析目标目录符号链接: %v", err)
-		}
-
-		// 比较解析后的路径
-		if realSource == realTarget {
-			return true, nil
-		}
-
-		// 检查解析后的路径是否有嵌套关系
-		if strings.HasPrefix(realTarget, realSource+string(filepath.Separator)) {
-			return true, nil
-		}
-
-		if strings.HasPrefix(realSource, realTarget+string(filepath.Separator)) {
-			return true, nil
+	run := &mirrorRun{st: st, rec: startRun(mode, source, target), warnings: warningsSoFar()}
+	if activeProfile != nil {
+		run.rec.Profile = activeProfile.Name
+		run.hooks = activeProfile.Hooks
+		run.notify = &activeProfile.Notify
+		run.metricsDir = activeProfile.MetricsDir
+	}
+	run.log, err = createRunLog(st.LogDir, run.rec, st, args)
+	if err != nil {
+		printWarning(tr("run.log_create_failed", err))
+	}
+	run.rec.LogFile = run.log.Path()
+	printVerbose(verbosityVerbose, tr("run.rsync_args", strings.Join(args, " ")))
+	if syncConfig.Shards > 1 {
+		printVerbose(verbosityVerbose, tr("run.shards", syncConfig.Shards))
+	}
+	printVerbose(verbosityDebug, tr("run.state_dir", st.Dir))
+	printVerbose(verbosityDebug, tr("run.marker_file", st.Marker))
+	printVerbose(verbosityDebug, tr("run.lock_file", st.Lock))
+
+	markerFile := st.Marker
+	var checkPlan func([]string) error
+	if limits != nil {
+		markerFile = ""
+		checkPlan = func(lines []string) error {
+			var c changeCounts
+			for _, line := range lines {
+				c.add(line)
+			}
+			return limits.check(c)
 		}
 	}
-
-	return false, nil
+	stdout, stderr := terminalOutputs()
+	run.Mirror = mirror.New(mirror.Options{
+		Source:        source,
+		Target:        target,
+		Args:          args,
+		MarkerFile:    markerFile,
+		MarkerTimeout: time.Duration(markerTimeout) * time.Second,
+		LockFile:      st.Lock,
+		CheckPlan:     checkPlan,
+		BeforeApply:   func() error { return run.runHook(hookPreApply, nil, 0) },
+		AfterApply: func(ctx context.Context, paths []string) error {
+			return run.updateManifest(ctx, args, paths)
+		},
+		Backend: syncConfig.newBackend(force),
+		OnEvent: func(e mirror.Event) {
+			if e.Kind == mirror.EventOutput {
+				run.recordChange(e.Message)
+			}
+			printEvent(e)
+			run.log.event(e)
+		},
+		Stdout: io.MultiWriter(stdout, run.log.writer(""), &lineWriter{fn: run.recordChange}),
+		Stderr: io.MultiWriter(stderr, run.log.writer("[stderr] ")),
+	})
+	// 运行记录使用规范化后的路径
+	run.rec.Source, run.rec.Target = run.Source(), run.Target()
+	return run, nil
 }
 
-// 检查目录是否为空
-func isDirEmpty(dir string) (bool, error) {
-	// 远程路径检查 (包含冒号的路径)
-	if strings.Contains(dir, ":") {
-		return false, fmt.Errorf("不支持检查远程目录是否为空，请使用本地文件系统路径: %s", dir)
+// 统计 rsync 列出的一个文件变化，新建和更新的普通文件按源文件的大小计入传输字节数
+func (r *mirrorRun) recordChange(line string) {
+	r.rec.Changes.add(line)
+	change, path, ok := parseItemizedLine(line)
+	if !ok || len(change) < 2 || (change[0] != '>' && change[0] != '<') || change[1] != 'f' {
+		return
 	}
-
-	f, err := os.Open(dir)
-	if err != nil {
-		return false, err
+	if info, err := os.Stat(filepath.Join(r.rec.Source, path)); err == nil {
+		r.rec.Bytes += info.Size()
 	}
-	defer f.Close()
+}
 
-	// 读取目录中的第一个条目
-	_, err = f.Readdirnames(1)
-	if err == nil {
-		// 找到至少一个条目，目录不为空
-		return false, nil
+// 结束运行：执行 on_success 或 on_failure 钩子，写入运行日志和运行历史，发送通知，更新指标文件，并按保留策略清理旧的日志
+// exitCode 是程序将要使用的退出码，钩子和通知失败只输出警告
+func (r *mirrorRun) finish(err error, exitCode int) {
+	hook := hookOnSuccess
+	if err != nil {
+		hook = hookOnFailure
+	}
+	if hookErr := r.runHook(hook, err, exitCode); hookErr != nil {
+		printWarning(localizedError(hookErr))
+	}
+	r.rec.Warnings = int(warningsSoFar() - r.warnings)
+	r.rec.ExitCode = exitCode
+	r.log.close(err)
+	r.rec.finish(err)
+	printSummary(r.rec)
+	if r.notify != nil {
+		sendNotifications(r.notify, r.rec)
+	}
+	if r.metricsDir != "" {
+		if err := writeMetrics(r.metricsDir, r.rec); err != nil {
+			printWarning(tr("metrics.write_failed", err))
+		}
 	}
-	if err != nil && err.Error() == "EOF" {
-		// 没有找到条目，目录为空
-		return true, nil
+	if r.log != nil {
+		if err := pruneRunLogs(r.st.LogDir, logRetention, time.Now(), r.log.Path()); err != nil {
+			printWarning(tr("run.log_prune_failed", err))
+		}
 	}
-	// 其他错误
-	return false, err
 }
 
 // 处理只读运行(dry-run)模式
 func handleDryRun(args []string, source, target string) {
-	printColored(colorYellow, "在DRY-RUN模式下运行。不会进行实际更改。")
-	
-	// 添加dry-run参数
-	args = append(args, "-n", "-v")
-	
-	// 创建临时文件保存结果
-	logFilePath := "/tmp/folder_mirror.log"
-	logFile, err := os.Create(logFilePath)
+	intr := notifyInterrupt()
+	defer intr.stop()
+	osExit(planMirror(intr, args, source, target, nil))
+}
+
+// 执行一次 plan 并返回退出码
+// check 不为 nil 时检查 plan 的结果，失败时与 post_plan 钩子失败一样删除标记文件
+func planMirror(intr *interrupter, args []string, source, target string, check func(*runRecord) error) int {
+	run, err := startMirrorRun("plan", args, source, target, nil, intr.force)
 	if err != nil {
-		printColored(colorRed, "创建日志文件失败: "+err.Error())
-		osExit(1)
+		printError(err)
+		return 1
 	}
-	defer logFile.Close()
-	
-	printColored(colorGreen, "结果将保存到: "+logFilePath)
-	
-	// 添加源和目标路径
-	args = append(args, source, target)
-	
-	// 执行rsync命令，并允许实时显示进度
-	printColored(colorGreen, "执行文件夹镜像模拟...")
-	cmd := execCommand("rsync", args...)
-	
-	// 创建一个管道，同时输出到终端和日志文件
-	cmd.Stderr = os.Stderr
-	
-	// 创建多写器，同时写入到stdout和logFile
-	stdoutPipe, err := cmd.StdoutPipe()
+	if err := run.runHook(hookPreRun, nil, 0); err != nil {
+		printError(err)
+		run.finish(err, 1)
+		return 1
+	}
+
+	res, err := run.Plan(intr.ctx)
 	if err != nil {
-		printColored(colorRed, "无法创建输出管道: "+err.Error())
-		osExit(1)
+		printError(err)
+		code := intr.exitCode(err)
+		run.finish(err, code)
+		return code
 	}
-	
-	// 启动命令
-	if err := cmd.Start(); err != nil {
-		printColored(colorRed, "执行rsync失败: "+err.Error())
-		osExit(1)
+
+	// post_plan 钩子失败时删除标记文件，使 apply 无法执行
+	err = run.runHook(hookPostPlan, nil, 0)
+	if err == nil && check != nil {
+		err = check(run.rec)
 	}
-	
-	// 读取输出并同时写入到终端和日志文件
-	go func() {
-		scanner := bufio.NewScanner(stdoutPipe)
-		for scanner.Scan() {
-			line := scanner.Text()
-			fmt.Println(line)
-			fmt.Fprintln(logFile, line)
-		}
-	}()
-	
-	// 等待命令完成
-	if err := cmd.Wait(); err != nil {
-		printColored(colorRed, "执行rsync失败: "+err.Error())
-		osExit(1)
+	if err != nil {
+		os.Remove(run.st.Marker)
+		printError(err)
+		run.finish(err, 1)
+		return 1
 	}
-	
-	// 创建标记文件
-	if err := createMarkerFile(); err != nil {
-		printColored(colorRed, "创建标记文件失败: "+err.Error())
-		osExit(1)
+
+	// 统计每条排除规则排除了多少文件和字节，报告同时写入运行日志
+	reportRuleCoverage(res.Args, run.Source(), run.log.writer(""))
+
+	if run.log != nil {
+		printColored(colorGreen, tr("run.plan_saved", run.log.Path()))
+	}
+	if check == nil {
+		printNotice(tr("run.plan_review"))
 	}
-	
-	printColored(colorGreen, "模拟操作完成。标记文件已创建: "+markerFile)
-	printColored(colorGreen, "干运行结果已保存到文件: "+logFilePath)
-	printColored(colorYellow, "请检查输出结果，确认无误后可执行实际操作(不带--dry-run参数)")
-	// 不再自动打开编辑器查看文件，用户可以手动查看结果文件
-	osExit(0)
+	run.finish(nil, 0)
+	return 0
 }
 
 // 处理实际执行模式
-func handleActualRun(args []string, source, target string) {
-	// 检查标记文件
-	valid, err := checkMarkerFile()
-	if !valid {
-		printColored(colorRed, "错误: "+err.Error())
-		printColored(colorRed, "请先使用 --dry-run 参数重新生成标记文件。")
-		osExit(1)
-	}
-	
-	printColored(colorGreen, "执行实际文件夹镜像操作...")
-	
-	// 添加源和目标路径
-	args = append(args, source, target)
-	
-	// 执行rsync命令，并允许实时输出进度
-	cmd := execCommand("rsync", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	
-	// 执行命令并等待完成
-	err = cmd.Run()
-	if err != nil {
-		printColored(colorRed, "执行rsync失败: "+err.Error())
-		osExit(1)
-	}
-	
-	printColored(colorGreen, "实际文件夹镜像操作成功完成!")
-	
-	// 删除标记文件
-	if err := os.Remove(markerFile); err != nil {
-		printColored(colorYellow, "警告: 无法删除标记文件: "+err.Error())
-	}
-	
-	// 确保调用osExit
-	osExit(0)
+func handleActualRun(args []string, source, target string, verify verifyMode) {
+	intr := notifyInterrupt()
+	defer intr.stop()
+	osExit(applyMirror(intr, args, source, target, verify))
 }
 
-// 验证路径并准备目录
-func validateAndPreparePaths(source, target string) (string, string) {
-	// 确保路径末尾有斜杠
-	if !strings.HasSuffix(source, "/") {
-		source += "/"
+// 执行一次 apply 并返回退出码
+// 镜像之后在锁定期间更新目标目录中的完整性清单；verify 不为 verifyNone 时再按相同的规则校验目标目录，发现差异时运行失败
+func applyMirror(intr *interrupter, args []string, source, target string, verify verifyMode) int {
+	run, err := startMirrorRun("apply", args, source, target, nil, intr.force)
+	if err != nil {
+		printError(err)
+		return 1
 	}
-	if !strings.HasSuffix(target, "/") {
-		target += "/"
+	if err := run.runHook(hookPreRun, nil, 0); err != nil {
+		printError(err)
+		run.finish(err, 1)
+		return 1
 	}
 
-	printColored(colorGreen, "源目录: "+source)
-	printColored(colorGreen, "目标目录: "+target)
-
-	// 检查源目录是否存在
-	if !dirExists(source) {
-		printColored(colorRed, "错误: 源目录不存在: "+source)
-		osExit(1)
+	if _, err := run.Apply(intr.ctx); err != nil {
+		printError(err)
+		if errors.Is(err, mirror.ErrMarkerMissing) || errors.Is(err, mirror.ErrMarkerStale) || errors.Is(err, mirror.ErrMarkerInvalid) {
+			printColored(colorRed, tr("run.replan"))
+		}
+		code := intr.exitCode(err)
+		run.finish(err, code)
+		return code
 	}
 
-	// 检查源目录是否为空
-	isEmpty, err := isDirEmpty(source)
-	if err != nil {
-		printColored(colorRed, "错误: 无法检查源目录是否为空: "+err.Error())
-		osExit(1)
-	}
-	if isEmpty {
-		printColored(colorRed, "错误: 源目录为空，不执行镜像操作")
-		osExit(1)
+	if verify != verifyNone {
+		if err := run.verify(intr.ctx, args, verify); err != nil {
+			printError(err)
+			code := intr.exitCode(err)
+			run.finish(err, code)
+			return code
+		}
 	}
 
-	// 检查源目录和目标目录是否相同或嵌套或为远程路径
-	isSameOrNested, err := checkDirSameOrNested(source, target)
-	if err != nil {
-		printColored(colorRed, "错误: "+err.Error())
-		osExit(1)
+	if run.log != nil {
+		printColored(colorGreen, tr("run.log_saved", run.log.Path()))
 	}
-	if isSameOrNested {
-		printColored(colorRed, "错误: 源目录和目标目录相同或互为子目录，操作危险，终止执行")
+	run.finish(nil, 0)
+	return 0
+}
+
+// 验证路径并准备目录
+func validateAndPreparePaths(source, target string) (string, string) {
+	m := mirror.New(mirror.Options{Source: source, Target: target, OnEvent: printEvent})
+	if err := m.Validate(); err != nil {
+		printError(err)
 		osExit(1)
 	}
+	return m.Source(), m.Target()
+}
 
-	// 检查目标目录是否存在，不存在则创建
-	if !dirExists(target) {
-		printColored(colorYellow, "目标目录不存在，尝试创建...")
-		if err := createDir(target); err != nil {
-			printColored(colorRed, "创建目标目录失败: "+err.Error())
-			osExit(1)
-		}
+// 获取默认的排除和包含规则文件路径
+func defaultRuleFiles() (string, string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
 	}
-	
-	return source, target
+	return filepath.Join(homeDir, "loadrc/bashrc/mirror_exclude"),
+		filepath.Join(homeDir, "loadrc/bashrc/mirror_include"), nil
 }
 
-// 准备rsync命令的参数
+// 使用默认规则文件准备rsync命令的参数
 func prepareRsyncArgs() []string {
-	// 获取用户主目录
-	homeDir, err := os.UserHomeDir()
+	// 读取排除和包含的文件列表
+	excludeListPath, includeListPath, err := defaultRuleFiles()
 	if err != nil {
-		printColored(colorRed, "无法获取用户主目录: "+err.Error())
+		printColored(colorRed, tr("run.home_dir_failed", err))
 		osExit(1)
 	}
+	return prepareRsyncArgsWith(ruleConfig{ExcludeFrom: excludeListPath, IncludeFrom: includeListPath})
+}
 
-	// 读取排除和包含的文件列表
-	excludeListPath := filepath.Join(homeDir, "loadrc/bashrc/mirror_exclude")
-	includeListPath := filepath.Join(homeDir, "loadrc/bashrc/mirror_include")
+// 根据规则来源准备rsync命令的参数
+func prepareRsyncArgsWith(cfg ruleConfig) []string {
+	excludeListPath, includeListPath := cfg.ExcludeFrom, cfg.IncludeFrom
 
 	// 在测试环境中，使用临时文件来替代实际文件
 	if os.Getenv("TESTING") == "1" {
@@ -422,71 +459,42 @@ func prepareRsyncArgs() []string {
 		}
 	}
 
-	// 验证排除规则文件是否存在
-	if _, err := os.Stat(excludeListPath); os.IsNotExist(err) {
-		printColored(colorRed, "错误: 排除规则文件不存在: "+excludeListPath)
-		osExit(1)
+	// 内置预设写入文件后按顺序添加在排除规则之后
+	excludes := []string{excludeListPath}
+	for _, name := range cfg.Presets {
+		presetPath, err := writePresetFile(name)
+		if err != nil {
+			printColored(colorRed, tr("run.preset_write_failed", err))
+			osExit(1)
+		}
+		excludes = append(excludes, presetPath)
 	}
 
-	// 构建rsync命令参数
-	args := []string{"-aH", "--force", "--delete-during", "--progress"}
-
-	// 使用文件方式添加排除规则，简化代码
-	// rsync 原生支持 */build/* 等通配符格式
-	args = append(args, "--exclude-from="+excludeListPath)
+	// 包含规则文件是可选的
+	if _, err := os.Stat(includeListPath); os.IsNotExist(err) {
+		printNotice(tr("run.include_missing", includeListPath))
+	}
 
-	// 如果包含规则文件存在，也使用文件方式添加
-	if _, err := os.Stat(includeListPath); !os.IsNotExist(err) {
-		args = append(args, "--include-from="+includeListPath)
-	} else {
-		printColored(colorYellow, "警告: 包含规则文件不存在: "+includeListPath)
-		// 继续执行，因为包含列表是可选的
+	// rsync 原生支持 */build/* 等通配符格式，规则文件直接传给 rsync
+	args, err := mirror.RsyncArgs(excludes, includeListPath)
+	if err != nil {
+		printError(err)
+		osExit(1)
 	}
-	
 	return args
 }
 
 func main() {
-	// 检查是否存在--dry-run参数（无论位置）
-	hasDryRunFlag := false
-	for _, arg := range os.Args {
-		if arg == "--dry-run" || arg == "-dry-run" {
-			hasDryRunFlag = true
-			break
-		}
-	}
+	applyLangArg(os.Args[1:])
 
-	// 解析命令行参数
-	dryRun := flag.Bool("dry-run", hasDryRunFlag, "测试镜像操作，不实际复制文件")
-	help := flag.Bool("help", false, "显示帮助信息")
-	flag.Parse()
-
-	if *help || flag.NArg() < 2 {
-		fmt.Printf("用法: %s [--dry-run] SOURCE_DIR TARGET_DIR\n\n", os.Args[0])
-		fmt.Println("选项:")
-		fmt.Println("  --dry-run          测试镜像操作，不实际复制文件")
-		fmt.Println("  --help             显示帮助信息")
-		fmt.Println()
-		fmt.Println("参数:")
-		fmt.Println("  SOURCE_DIR         源目录路径")
-		fmt.Println("  TARGET_DIR         目标目录路径")
-		osExit(1)
+	// 子命令，未知的第一个参数按旧用法处理
+	if len(os.Args) > 1 {
+		if cmd := findCommand(os.Args[1]); cmd != nil {
+			cmd.Run(os.Args[2:])
+			return
+		}
 	}
 
-	// 获取源目录和目标目录
-	source := flag.Arg(0)
-	target := flag.Arg(1)
-	
-	// 验证路径并准备目录
-	source, target = validateAndPreparePaths(source, target)
-	
-	// 准备rsync命令的参数
-	args := prepareRsyncArgs()
-	
-	// 根据运行模式执行不同的处理
-	if *dryRun || hasDryRunFlag {
-		handleDryRun(args, source, target)
-	} else {
-		handleActualRun(args, source, target)
-	}
-} 
+	// 兼容旧用法: folder_mirror [--dry-run] SOURCE_DIR TARGET_DIR
+	runLegacy(os.Args[1:])
+}
@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"bytes"
 	"io"
+	"runtime"
 )
 
 // 用于测试的全局变量
@@ -28,9 +29,20 @@ func TestMain(m *testing.M) {
 	origArgs := os.Args
 	origPrintHook := printHook
 	origDisablePrint := disablePrint
+
+	// 运行历史和状态文件写入临时目录，避免污染真实的状态目录
+	historyDir, err := ioutil.TempDir("", "folder_mirror_state")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	stateDir = historyDir + "/state"
+	// 测试检查中文消息，不受运行环境的 LANG 影响
+	language = langZH
 	
 	// 执行测试
 	result := m.Run()
+	os.RemoveAll(historyDir)
 	
 	// 恢复原始状态
 	os.Args = origArgs
@@ -920,11 +932,6 @@ func TestHandleDryRun(t *testing.T) {
 		disablePrint = oldDisablePrint
 		os.Setenv("TESTING", oldTesting)
 		
-		// 确保测试后删除日志文件
-		if _, err := os.Stat("/tmp/folder_mirror.log"); err == nil {
-			os.Remove("/tmp/folder_mirror.log")
-		}
-		
 		fmt.Println("===== 结束测试 TestHandleDryRun =====")
 	}()
 
@@ -958,11 +965,6 @@ func TestHandleDryRun(t *testing.T) {
 	// 在源目录创建测试文件
 	ioutil.WriteFile(source+"test.txt", []byte("test content"), 0644)
 	
-	// 确保日志文件不存在
-	if _, err := os.Stat("/tmp/folder_mirror.log"); err == nil {
-		os.Remove("/tmp/folder_mirror.log")
-	}
-	
 	// 调用被测试的函数
 	fmt.Println("调用handleDryRun...")
 	handleDryRun(args, source, target)
@@ -981,11 +983,25 @@ func TestHandleDryRun(t *testing.T) {
 		fmt.Println("标记文件创建成功:", markerFile)
 	}
 	
-	// 检查日志文件是否被创建
-	if _, err := os.Stat("/tmp/folder_mirror.log"); os.IsNotExist(err) {
+	// 检查运行日志是否被创建并记录在运行历史中
+	path, _ := historyPath()
+	records, _ := readHistory(path)
+	if len(records) == 0 || records[len(records)-1].LogFile == "" {
+		t.Fatal("运行历史中没有记录运行日志")
+	}
+	logPath := records[len(records)-1].LogFile
+	if info, err := os.Stat(logPath); os.IsNotExist(err) {
 		t.Error("日志文件未被创建")
+	} else if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("日志文件权限应当为 0600，但得到 %v", info.Mode().Perm())
 	} else {
-		fmt.Println("日志文件创建成功: /tmp/folder_mirror.log")
+		fmt.Println("日志文件创建成功:", logPath)
+	}
+	data, _ := ioutil.ReadFile(logPath)
+	for _, want := range []string{"# 命令行: ", "success\n", "# 结果: success"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("运行日志应当包含 %q，实际内容:\n%s", want, data)
+		}
 	}
 }
 
@@ -1061,7 +1077,7 @@ func TestHandleActualRun(t *testing.T) {
 	
 	// 调用被测试的函数
 	fmt.Println("调用handleActualRun...")
-	handleActualRun(args, source, target)
+	handleActualRun(args, source, target, verifyNone)
 	
 	// 验证结果
 	if !exitCalled {
@@ -1374,14 +1390,20 @@ func TestMainCommandLineArgs(t *testing.T) {
 				if err := ioutil.WriteFile("/tmp/src/test.txt", []byte("test"), 0644); err != nil {
 					t.Fatalf("无法创建测试文件: %v", err)
 				}
-				// 创建标记文件
-				if err := ioutil.WriteFile(markerFile, []byte(fmt.Sprintf("%d", time.Now().Unix())), 0644); err != nil {
+				// 在这对目录的状态目录中创建标记文件
+				st, err := statePaths("/tmp/src", "/tmp/dst")
+				if err != nil {
+					t.Fatalf("无法获取状态文件路径: %v", err)
+				}
+				if err := ioutil.WriteFile(st.Marker, []byte(fmt.Sprintf("%d", time.Now().Unix())), 0644); err != nil {
 					t.Fatalf("无法创建标记文件: %v", err)
 				}
 			},
 			validateFunc: func() {
 				// 清理标记文件
-				os.Remove(markerFile)
+				if st, err := statePaths("/tmp/src", "/tmp/dst"); err == nil {
+					os.Remove(st.Marker)
+				}
 			},
 			expectOsExit: true,
 			expectPanic:  false, // handleActualRun中的osExit(0)不会导致panic
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// 运行历史文件，每行一条 JSON 记录，为空时使用状态目录中的 history.jsonl（变量以便于测试）
+var historyFile = ""
+
+// 运行结果
+const (
+	runSuccess     = "success"
+	runFailed      = "failed"
+	runInterrupted = "interrupted"
+)
+
+// runRecord 描述一次 plan 或 apply 运行
+type runRecord struct {
+	ID      string    `json:"id"`
+	Mode    string    `json:"mode"` // plan 或 apply
+	Source  string    `json:"source"`
+	Target  string    `json:"target"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	LogFile string    `json:"log_file,omitempty"`
+	Profile string    `json:"profile,omitempty"`
+
+	// rsync 列出的文件变化，plan 时为将要进行的变化
+	Changes changeCounts `json:"changes"`
+	// 新建和更新的文件的总大小
+	Bytes int64 `json:"bytes"`
+	// 运行中输出的警告数
+	Warnings int `json:"warnings,omitempty"`
+	// 程序的退出码
+	ExitCode int `json:"exit_code"`
+	// watch 增量镜像的路径数，为 0 表示完整镜像
+	Paths int `json:"paths,omitempty"`
+}
+
+// 开始记录一次运行
+func startRun(mode, source, target string) *runRecord {
+	now := time.Now()
+	return &runRecord{
+		ID:     now.Format("20060102-150405.000"),
+		Mode:   mode,
+		Source: source,
+		Target: target,
+		Start:  now,
+	}
+}
+
+// 结束运行并写入运行历史，err 为 nil 表示运行成功
+// 写入失败只输出警告，不影响运行结果
+func (r *runRecord) finish(err error) {
+	r.End = time.Now()
+	r.Status = runStatus(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	path, err := historyPath()
+	if err == nil {
+		err = appendHistory(path, r)
+	}
+	if err != nil {
+		printWarning(tr("history.write_failed", err))
+	}
+}
+
+// 根据运行错误确定运行结果
+func runStatus(err error) string {
+	switch {
+	case err == nil:
+		return runSuccess
+	case errors.Is(err, mirror.ErrInterrupted):
+		return runInterrupted
+	default:
+		return runFailed
+	}
+}
+
+// 运行耗时
+func (r *runRecord) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// 向运行历史文件追加一条记录
+func appendHistory(path string, r *runRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := securefile.OpenFile(path, os.O_WRONLY|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 读取运行历史，按时间从早到晚排列，文件不存在时返回空列表
+// 无法解析的行会被跳过，避免一条损坏的记录导致整个历史不可用
+func readHistory(path string) ([]runRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []runRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r runRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// 格式化一条运行记录
+func formatRunRecord(r runRecord) string {
+	line := fmt.Sprintf("%s  %-5s  %-11s  %8s  %s -> %s",
+		r.Start.Format("2006-01-02 15:04:05"), r.Mode, r.Status,
+		r.Duration().Round(time.Second), r.Source, r.Target)
+	if r.Error != "" {
+		line += "  (" + r.Error + ")"
+	}
+	return line
+}
+
+// 处理 history 子命令
+func runHistoryCommand(args []string) {
+	fs := newCommandFlagSet("history")
+	limit := fs.Int("n", 20, tr("flag.history_n"))
+	asJSON := fs.Bool("json", false, tr("flag.history_json"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		osExit(1)
+		return
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		printColored(colorRed, tr("history.read_failed", err))
+		osExit(1)
+		return
+	}
+	records, err := readHistory(path)
+	if err != nil {
+		printColored(colorRed, tr("history.read_failed", err))
+		osExit(1)
+		return
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[len(records)-*limit:]
+	}
+	if len(records) == 0 && !*asJSON {
+		printNotice(tr("history.empty"))
+		osExit(0)
+		return
+	}
+
+	for _, r := range records {
+		if *asJSON {
+			data, _ := json.Marshal(r)
+			fmt.Println(string(data))
+			continue
+		}
+		color := colorGreen
+		if r.Status != runSuccess {
+			color = colorRed
+		}
+		printColored(color, formatRunRecord(r))
+	}
+	osExit(0)
+}
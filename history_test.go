@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 测试运行历史的写入和读取
+func TestHistoryRoundTrip(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "history_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	oldHistoryFile := historyFile
+	oldDisablePrint := disablePrint
+	defer func() {
+		historyFile = oldHistoryFile
+		disablePrint = oldDisablePrint
+	}()
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	disablePrint = true
+
+	if records, err := readHistory(historyFile); err != nil || len(records) != 0 {
+		t.Fatalf("历史文件不存在时应当返回空列表，得到 %v %v", records, err)
+	}
+
+	startRun("plan", "/src/", "/dst/").finish(nil)
+	// 损坏的行应当被跳过
+	f, _ := os.OpenFile(historyFile, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("{not json\n")
+	f.Close()
+	startRun("apply", "/src/", "/dst/").finish(errors.New("rsync 失败"))
+	startRun("apply", "/src/", "/dst/").finish(fmt.Errorf("运行失败: %w", mirror.ErrInterrupted))
+
+	records, err := readHistory(historyFile)
+	if err != nil {
+		t.Fatalf("读取运行历史失败: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("期望 3 条记录，但得到 %d 条", len(records))
+	}
+	if records[0].Mode != "plan" || records[0].Status != runSuccess || records[0].Error != "" {
+		t.Errorf("第一条记录不正确: %+v", records[0])
+	}
+	if records[1].Mode != "apply" || records[1].Status != runFailed || records[1].Error != "rsync 失败" {
+		t.Errorf("第二条记录不正确: %+v", records[1])
+	}
+	if records[2].Status != runInterrupted {
+		t.Errorf("被中断的运行应当记录为 %s，但得到 %s", runInterrupted, records[2].Status)
+	}
+	if records[1].End.Before(records[1].Start) {
+		t.Errorf("结束时间早于开始时间: %+v", records[1])
+	}
+
+	line := formatRunRecord(records[1])
+	for _, want := range []string{"apply", runFailed, "/src/ -> /dst/", "rsync 失败"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("格式化结果 %q 应当包含 %q", line, want)
+		}
+	}
+}
+
+// 测试标记文件状态的描述
+func TestDescribeMarker(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "status_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	oldMarkerFile := markerFile
+	defer func() { markerFile = oldMarkerFile }()
+	markerFile = filepath.Join(testDir, "marker")
+
+	now := time.Now()
+	if _, valid := describeMarker(markerFile, now); valid {
+		t.Error("标记文件不存在时不应当有效")
+	}
+	createMarkerFile()
+	if msg, valid := describeMarker(markerFile, now); !valid || !strings.Contains(msg, "剩余") {
+		t.Errorf("新建的标记文件应当有效，得到 %q", msg)
+	}
+	later := now.Add(time.Duration(markerTimeout+60) * time.Second)
+	if msg, valid := describeMarker(markerFile, later); valid || !strings.Contains(msg, "已过期") {
+		t.Errorf("超时的标记文件应当过期，得到 %q", msg)
+	}
+	ioutil.WriteFile(markerFile, []byte("garbage"), 0644)
+	if _, valid := describeMarker(markerFile, now); valid {
+		t.Error("无法解析的标记文件不应当有效")
+	}
+}
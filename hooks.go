@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// 钩子的执行时机，也是配置中 hook_ 之后的名称
+const (
+	hookPreRun    = "pre_run"    // 验证目录之前，失败时终止运行
+	hookPostPlan  = "post_plan"  // plan 成功之后，失败时删除标记文件，plan 失败
+	hookPreApply  = "pre_apply"  // apply 检查标记文件之后、rsync 开始之前，失败时终止运行
+	hookOnSuccess = "on_success" // plan 或 apply 成功之后
+	hookOnFailure = "on_failure" // plan 或 apply 失败之后，包括被中断
+)
+
+// 所有钩子，按执行顺序排列
+var hookNames = []string{hookPreRun, hookPostPlan, hookPreApply, hookOnSuccess, hookOnFailure}
+
+// 判断是否是有效的钩子名称
+func validHook(name string) bool {
+	for _, n := range hookNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// errHookFailed 表示钩子命令失败，可以用 errors.Is 判断
+var errHookFailed error = catalogError("hook.err")
+
+// hookError 描述一个失败的钩子
+type hookError struct {
+	name string
+	err  error
+}
+
+func (e *hookError) Error() string        { return tr("hook.failed", e.name, e.err) }
+func (e *hookError) Unwrap() error        { return e.err }
+func (e *hookError) Is(target error) bool { return target == errHookFailed }
+
+// 创建通过 shell 执行命令的 Cmd
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return execCommand("cmd", "/C", command)
+	}
+	return execCommand("sh", "-c", command)
+}
+
+// 执行配置中的钩子，没有配置时直接返回
+// runErr 和 exitCode 是运行的结果，只对 on_success 和 on_failure 有意义
+// 钩子的输出与 rsync 的输出一样显示在终端上并写入运行日志
+func (r *mirrorRun) runHook(name string, runErr error, exitCode int) error {
+	command := r.hooks[name]
+	if command == "" {
+		return nil
+	}
+	printVerbose(verbosityVerbose, tr("hook.running", name, command))
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), r.hookEnv(name, runErr, exitCode)...)
+	stdout, stderr := terminalOutputs()
+	cmd.Stdout = io.MultiWriter(stdout, r.log.writer("[hook "+name+"] "))
+	cmd.Stderr = io.MultiWriter(stderr, r.log.writer("[hook "+name+" stderr] "))
+	if err := cmd.Run(); err != nil {
+		return &hookError{name: name, err: err}
+	}
+	return nil
+}
+
+// 描述运行的环境变量
+func (r *mirrorRun) hookEnv(name string, runErr error, exitCode int) []string {
+	status := "running"
+	if name == hookOnSuccess || name == hookOnFailure {
+		status = runStatus(runErr)
+	}
+	env := map[string]string{
+		"HOOK":        name,
+		"MODE":        r.rec.Mode,
+		"RUN_ID":      r.rec.ID,
+		"PROFILE":     r.rec.Profile,
+		"SOURCE":      r.rec.Source,
+		"TARGET":      r.rec.Target,
+		"LOG_FILE":    r.rec.LogFile,
+		"MARKER_FILE": r.st.Marker,
+		"STATUS":      status,
+		"EXIT_CODE":   strconv.Itoa(exitCode),
+		"CREATED":     strconv.Itoa(r.rec.Changes.Created),
+		"UPDATED":     strconv.Itoa(r.rec.Changes.Updated),
+		"DELETED":     strconv.Itoa(r.rec.Changes.Deleted),
+	}
+	if runErr != nil {
+		env["ERROR"] = runErr.Error()
+	}
+	var vars []string
+	for key, value := range env {
+		vars = append(vars, fmt.Sprintf("FOLDER_MIRROR_%s=%s", key, value))
+	}
+	return vars
+}
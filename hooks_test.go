@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// 读取钩子写入的环境变量
+func readHookEnv(t *testing.T, path string) map[string]string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("钩子没有执行: %v", err)
+	}
+	env := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "="); i > 0 && strings.HasPrefix(line, "FOLDER_MIRROR_") {
+			env[strings.TrimPrefix(line[:i], "FOLDER_MIRROR_")] = line[i+1:]
+		}
+	}
+	return env
+}
+
+// 测试配置中的钩子设置
+func TestProfileHooks(t *testing.T) {
+	p := &profile{Name: "home"}
+	if err := p.set("hook_pre_run", "systemctl stop db"); err != nil {
+		t.Fatalf("设置钩子失败: %v", err)
+	}
+	if p.Hooks[hookPreRun] != "systemctl stop db" {
+		t.Errorf("钩子设置错误: %v", p.Hooks)
+	}
+	if err := p.set("hook_before_everything", "true"); err == nil {
+		t.Error("未知的钩子应当返回错误")
+	}
+}
+
+// 测试钩子的执行时机、环境变量和失败时的处理
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("钩子测试使用 sh")
+	}
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+	hookDir := filepath.Join(testDir, "hooks")
+	os.MkdirAll(hookDir, 0755)
+
+	oldExecCommand := execCommand
+	oldTesting := os.Getenv("TESTING")
+	oldDisablePrint := disablePrint
+	defer func() {
+		execCommand = oldExecCommand
+		os.Setenv("TESTING", oldTesting)
+		disablePrint = oldDisablePrint
+		activeProfile = nil
+	}()
+	os.Setenv("TESTING", "1")
+	disablePrint = true
+
+	applied := false
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		if name != "rsync" {
+			return exec.Command(name, args...)
+		}
+		if !strings.Contains(strings.Join(args, " "), " -n ") {
+			applied = true
+		}
+		return exec.Command("sh", "-c", "printf '>f+++++++++ new.txt\\n>f.st...... changed.txt\\n*deleting   old.txt\\n.d..t...... dir/\\n'")
+	}
+
+	record := `env > "` + hookDir + `/$FOLDER_MIRROR_HOOK.env"`
+	writeProfile := func(hooks ...string) {
+		content := "[p]\nsource = " + sourceDir + "\ntarget = " + targetDir + "\n" + strings.Join(hooks, "\n") + "\n"
+		restore := setupProfilesFile(t, testDir, content)
+		t.Cleanup(restore)
+		os.RemoveAll(hookDir)
+		os.MkdirAll(hookDir, 0755)
+	}
+
+	// 成功运行时依次执行 pre_run、post_plan、pre_apply 和 on_success
+	writeProfile("hook_pre_run = "+record, "hook_post_plan = "+record, "hook_pre_apply = "+record,
+		"hook_on_success = "+record, "hook_on_failure = "+record)
+	if code := runMainForExit([]string{"plan", "--profile", "p"}); code != 0 {
+		t.Fatalf("plan 退出码 %d", code)
+	}
+	postPlan := readHookEnv(t, filepath.Join(hookDir, "post_plan.env"))
+	if postPlan["MODE"] != "plan" || postPlan["CREATED"] != "1" || postPlan["UPDATED"] != "1" || postPlan["DELETED"] != "1" {
+		t.Errorf("post_plan 环境变量不正确: %v", postPlan)
+	}
+	if code := runMainForExit([]string{"apply", "--profile", "p"}); code != 0 || !applied {
+		t.Fatalf("apply 退出码 %d，rsync 执行: %v", code, applied)
+	}
+	readHookEnv(t, filepath.Join(hookDir, "pre_run.env"))
+	readHookEnv(t, filepath.Join(hookDir, "pre_apply.env"))
+	success := readHookEnv(t, filepath.Join(hookDir, "on_success.env"))
+	if success["MODE"] != "apply" || success["STATUS"] != "success" || success["EXIT_CODE"] != "0" || success["PROFILE"] != "p" ||
+		success["SOURCE"] == "" || success["RUN_ID"] == "" || success["CREATED"] != "1" {
+		t.Errorf("on_success 环境变量不正确: %v", success)
+	}
+	if _, err := os.Stat(success["LOG_FILE"]); err != nil {
+		t.Errorf("FOLDER_MIRROR_LOG_FILE 应当指向运行日志: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(hookDir, "on_failure.env")); err == nil {
+		t.Error("成功时不应执行 on_failure")
+	}
+
+	// pre_apply 失败时终止 apply，执行 on_failure
+	writeProfile("hook_pre_apply = exit 3", "hook_on_failure = "+record)
+	if code := runMainForExit([]string{"plan", "--profile", "p"}); code != 0 {
+		t.Fatalf("plan 退出码 %d", code)
+	}
+	applied = false
+	if code := runMainForExit([]string{"apply", "--profile", "p"}); code != 1 || applied {
+		t.Fatalf("pre_apply 失败时期望退出码 1 且不执行 rsync，但得到 %d，rsync 执行: %v", code, applied)
+	}
+	failure := readHookEnv(t, filepath.Join(hookDir, "on_failure.env"))
+	if failure["STATUS"] != "failed" || failure["EXIT_CODE"] != "1" || !strings.Contains(failure["ERROR"], "pre_apply") {
+		t.Errorf("on_failure 环境变量不正确: %v", failure)
+	}
+
+	// post_plan 失败时删除标记文件
+	writeProfile("hook_post_plan = exit 1")
+	if code := runMainForExit([]string{"plan", "--profile", "p"}); code != 1 {
+		t.Fatalf("post_plan 失败时期望退出码 1，但得到 %d", code)
+	}
+	st, err := statePaths(sourceDir, targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(st.Marker); !os.IsNotExist(err) {
+		t.Errorf("post_plan 失败后标记文件应当被删除: %v", err)
+	}
+}
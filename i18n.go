@@ -0,0 +1,602 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/your-username/folder_mirror/filter"
+	"github.com/your-username/folder_mirror/mirror"
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// 支持的消息语言
+const (
+	langZH = "zh"
+	langEN = "en"
+)
+
+// 当前的消息语言，由 --lang 或 LC_ALL/LC_MESSAGES/LANG 确定（变量以便于测试）
+var language = detectLanguage(os.Getenv)
+
+// 根据环境变量确定消息语言，依次检查 LC_ALL、LC_MESSAGES 和 LANG 中第一个不为空的
+// 以 zh 开头、C、POSIX 或都未设置时使用中文，其余使用英文
+func detectLanguage(getenv func(string) string) string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := getenv(name); locale != "" {
+			return languageForLocale(locale)
+		}
+	}
+	return langZH
+}
+
+// 把 locale（例如 zh_CN.UTF-8、en_US.UTF-8）转换为消息语言
+func languageForLocale(locale string) string {
+	switch {
+	case strings.HasPrefix(locale, "zh"), locale == "C", locale == "POSIX", strings.HasPrefix(locale, "C."):
+		return langZH
+	default:
+		return langEN
+	}
+}
+
+// langFlag 实现 --lang 参数，只接受 zh 和 en
+type langFlag struct{}
+
+func (langFlag) String() string { return language }
+
+func (langFlag) Set(value string) error {
+	if value != langZH && value != langEN {
+		return errors.New(tr("lang.invalid", langZH, langEN))
+	}
+	language = value
+	return nil
+}
+
+// 添加 --lang 参数
+func addLangFlag(fs *flag.FlagSet) {
+	fs.Var(langFlag{}, "lang", tr("flag.lang"))
+}
+
+// 在解析参数之前处理 --lang，使帮助信息和参数说明使用指定的语言
+// 无效的值留给参数解析报告
+func applyLangArg(args []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return
+		}
+		name := strings.TrimLeft(arg, "-")
+		if len(arg)-len(name) != 1 && len(arg)-len(name) != 2 {
+			continue
+		}
+		value := ""
+		switch {
+		case strings.HasPrefix(name, "lang="):
+			value = strings.TrimPrefix(name, "lang=")
+		case name == "lang" && i+1 < len(args):
+			value = args[i+1]
+		default:
+			continue
+		}
+		if value == langZH || value == langEN {
+			language = value
+		}
+	}
+}
+
+// translation 是一条消息的中文和英文格式
+type translation struct {
+	zh, en string
+}
+
+// 消息目录，键为稳定的消息 ID
+// mirror、filter 和 securefile 包的消息只需填写英文，中文使用这些包的默认消息
+var catalog = map[string]translation{
+	// 通用
+	"msg.error":   {"错误: %s", "Error: %s"},
+	"msg.warning": {"警告: %s", "Warning: %s"},
+
+	// 总体帮助信息
+	"usage.line":           {"用法: %s <命令> [选项] [参数]", "Usage: %s <command> [options] [arguments]"},
+	"usage.legacy_line":    {"      %s [--dry-run] [--profile NAME] [--preset NAMES] SOURCE_DIR TARGET_DIR", "       %s [--dry-run] [--profile NAME] [--preset NAMES] SOURCE_DIR TARGET_DIR"},
+	"usage.commands":       {"命令:", "Commands:"},
+	"usage.legacy_options": {"兼容旧用法的选项:", "Legacy options:"},
+	"usage.opt_dry_run":    {"测试镜像操作，不实际复制文件（相当于 plan）", "preview the mirror without copying anything (same as plan)"},
+	"usage.opt_profile":    {"使用配置文件中的镜像配置", "use a mirror profile from the config file"},
+	"usage.opt_preset":     {"启用的内置规则预设，多个预设用逗号分隔", "built-in rule presets to enable, comma separated"},
+	"usage.opt_output":     {"输出格式: text 或 json", "output format: text or json"},
+	"usage.opt_lang":       {"消息语言: zh 或 en", "message language: zh or en"},
+	"usage.opt_color":      {"何时使用颜色: auto、always 或 never", "when to use colour: auto, always or never"},
+	"usage.opt_quiet":      {"只输出警告和错误", "print only warnings and errors"},
+	"usage.opt_verbose":    {"输出更多细节，rsync 同样加上 -v 或 -vv", "print more detail and pass -v or -vv to rsync"},
+	"usage.opt_help":       {"显示帮助信息", "show this help"},
+	"usage.arguments":      {"参数:", "Arguments:"},
+	"usage.arg_source":     {"源目录路径", "source directory"},
+	"usage.arg_target":     {"目标目录路径", "target directory"},
+	"usage.more":           {"使用 \"%s help <命令>\" 查看命令的选项。", "Run \"%s help <command>\" for the options of a command."},
+	"usage.command":        {"用法: %s %s [选项]%s", "Usage: %s %s [options]%s"},
+	"usage.options":        {"选项:", "Options:"},
+
+	// 子命令说明
+	"command.plan":          {"预览镜像操作并生成标记文件（相当于 --dry-run）", "preview the mirror and create the marker file (same as --dry-run)"},
+	"command.apply":         {"执行镜像操作，需要先运行 plan", "run the mirror; requires a recent plan"},
+	"command.watch":         {"镜像一次后监视源目录，持续镜像变化的文件", "mirror once, then watch the source and mirror changes continuously"},
+	"command.daemon":        {"按配置中的调度定时运行镜像", "run profiles on their schedules"},
+	"command.install-timer": {"为配置生成 systemd 服务和定时器", "write a systemd service and timer for a profile"},
+	"command.notify":        {"通过配置中的通知方式报告 systemd 服务失败", "report a failed systemd service through the profile's notifiers"},
+	"command.status":        {"显示每个配置和每对目录的镜像状态", "show the mirror status of each profile and directory pair"},
+	"command.verify":        {"检查目标目录与源目录是否一致", "check that the target matches the source"},
+	"command.scrub":         {"按完整性清单重新读取目标目录，检查文件是否损坏", "re-read the target and check its files against the integrity manifest"},
+	"command.history":       {"显示运行历史", "show the run history"},
+	"command.rules":         {"检查规则文件或查看内置规则预设", "lint rule files or list the built-in rule presets"},
+	"command.explain":       {"解释一条路径会被镜像还是被排除", "explain whether a path is mirrored or excluded"},
+	"command.doctor":        {"检查运行环境和配置", "check the environment and configuration"},
+	"command.help":          {"显示命令的帮助信息", "show help for a command"},
+
+	// 参数说明
+	"flag.dry_run":      {"测试镜像操作，不实际复制文件", "preview the mirror without copying anything"},
+	"flag.help":         {"显示帮助信息", "show help"},
+	"flag.output":       {"输出格式: text 或 json（每个事件输出一行 JSON）", "output format: text or json (one JSON object per event)"},
+	"flag.lang":         {"消息语言: zh 或 en（默认根据 LANG/LC_MESSAGES 确定）", "message language: zh or en (default from LANG/LC_MESSAGES)"},
+	"flag.color":        {"何时使用颜色: auto、always 或 never（auto 时只在终端上使用，NO_COLOR 禁用）", "when to use colour: auto, always or never (auto uses colour only on a terminal, NO_COLOR disables it)"},
+	"flag.quiet":        {"只输出警告和错误，适合定时任务", "print only warnings and errors, for cron jobs"},
+	"flag.verbose":      {"输出 rsync 参数，rsync 加上 -v", "print the rsync arguments and pass -v to rsync"},
+	"flag.very_verbose": {"再输出状态文件的路径，rsync 加上 -vv", "also print the state file paths and pass -vv to rsync"},
+	"flag.exclude_from": {"排除规则文件（默认使用配置或默认规则文件）", "exclude rule file (default from the profile or the default rule file)"},
+	"flag.include_from": {"包含规则文件（默认使用配置或默认规则文件）", "include rule file (default from the profile or the default rule file)"},
+	"flag.profile":      {"使用配置文件中的镜像配置", "use a mirror profile from the config file"},
+	"flag.preset":       {"启用的内置规则预设，多个预设用逗号分隔", "built-in rule presets to enable, comma separated"},
+	"flag.backend":      {"同步后端: rsync 或 native（内置实现，不需要 rsync；默认使用配置或 rsync）", "sync backend: rsync or native (built in, no rsync needed; default from the profile or rsync)"},
+	"flag.shards":       {"并行同步的分片数，按顶层条目把源目录划分为多个分片同时同步（默认使用配置或不分片）", "number of shards synced in parallel, splitting the source by top-level entries (default from the profile or no sharding)"},
+	"flag.shard_depth":  {"最多按几层目录划分分片，超过平均大小的目录继续按下一层划分（默认 1）", "maximum directory depth for splitting shards; directories larger than the average shard are split further (default 1)"},
+
+	// 参数错误
+	"cli.unknown_command":  {"未知的命令: %s", "unknown command: %s"},
+	"cli.profile_no_paths": {"配置 %s 没有设置 source 和 target", "profile %s does not set source and target"},
+	"cli.need_paths":       {"需要指定 SOURCE_DIR 和 TARGET_DIR，或使用 --profile", "SOURCE_DIR and TARGET_DIR are required unless --profile is given"},
+	"cli.arg_count":        {"参数数量错误: %s", "wrong number of arguments: %s"},
+	"output.invalid":       {"输出格式必须是 %s 或 %s", "output format must be %s or %s"},
+	"lang.invalid":         {"语言必须是 %s 或 %s", "language must be %s or %s"},
+	"color.invalid":        {"颜色模式必须是 %s、%s 或 %s", "colour mode must be %s, %s or %s"},
+	"verbosity.invalid":    {"无效的值: %s", "invalid value: %s"},
+	"backend.invalid":      {"无效的同步后端 %s，可用的值为 %s 和 %s", "invalid sync backend %s, use %s or %s"},
+
+	// plan 和 apply
+	"run.state_dir_failed":    {"无法使用状态目录", "cannot use the state directory"},
+	"run.rsync_args":          {"rsync 参数: %s", "rsync arguments: %s"},
+	"run.shards":              {"把源目录划分为最多 %d 个分片并行同步", "Syncing the source in up to %d parallel shards"},
+	"run.state_dir":           {"状态目录: %s", "State directory: %s"},
+	"run.marker_file":         {"标记文件: %s", "Marker file: %s"},
+	"run.lock_file":           {"锁文件: %s", "Lock file: %s"},
+	"run.log_create_failed":   {"无法创建运行日志: %v", "cannot create the run log: %v"},
+	"run.log_prune_failed":    {"清理旧的运行日志失败: %v", "failed to prune old run logs: %v"},
+	"run.plan_saved":          {"干运行结果已保存到文件: %s", "Dry-run output saved to: %s"},
+	"run.plan_review":         {"请检查输出结果，确认无误后可执行 apply 命令(或不带--dry-run参数运行)进行实际操作", "Review the output, then run the apply command (or run without --dry-run) to mirror for real"},
+	"run.replan":              {"请先运行 plan 命令（或使用 --dry-run 参数）重新生成标记文件。", "Run the plan command (or use --dry-run) to create a new marker file first."},
+	"run.log_saved":           {"运行日志已保存到文件: %s", "Run log saved to: %s"},
+	"run.home_dir_failed":     {"无法获取用户主目录: %v", "cannot determine the home directory: %v"},
+	"run.preset_write_failed": {"写入内置规则预设失败: %v", "failed to write built-in rule preset: %v"},
+	"run.include_missing":     {"包含规则文件不存在: %s", "include rule file does not exist: %s"},
+
+	// 运行日志
+	"runlog.bad_days":     {"无效的天数: %s", "invalid number of days: %s"},
+	"runlog.bad_duration": {"无效的时间长度: %s", "invalid duration: %s"},
+	"runlog.id":           {"# 运行 ID: %s", "# Run ID: %s"},
+	"runlog.start":        {"# 开始时间: %s", "# Started: %s"},
+	"runlog.command":      {"# 命令行: %s", "# Command line: %s"},
+	"runlog.source":       {"# 源目录: %s", "# Source: %s"},
+	"runlog.target":       {"# 目标目录: %s", "# Target: %s"},
+	"runlog.rsync_args":   {"# rsync 参数: %s", "# rsync arguments: %s"},
+	"runlog.host":         {"# 主机: %s  PID: %d  系统: %s/%s", "# Host: %s  PID: %d  System: %s/%s"},
+	"runlog.workdir":      {"# 工作目录: %s", "# Working directory: %s"},
+	"runlog.end":          {"# 结束时间: %s  耗时: %s", "# Finished: %s  Duration: %s"},
+	"runlog.result":       {"# 结果: %s", "# Result: %s"},
+
+	// 配置文件
+	"profile.empty_name":       {"%s:%d: 配置名称为空", "%s:%d: empty profile name"},
+	"profile.duplicate":        {"%s:%d: 配置 %s 重复定义", "%s:%d: profile %s is defined twice"},
+	"profile.outside_section":  {"%s:%d: 设置项必须位于 [配置名称] 之后", "%s:%d: settings must follow a [profile name] line"},
+	"profile.bad_line":         {"%s:%d: 无法解析的行: %s", "%s:%d: cannot parse the line: %s"},
+	"profile.not_positive":     {"%s 必须是正整数: %s", "%s must be a positive integer: %s"},
+	"profile.not_non_negative": {"%s 必须是非负整数: %s", "%s must be a non-negative integer: %s"},
+	"profile.bad_limit":        {"%s 必须是非负整数或 -1（不限）: %s", "%s must be a non-negative integer or -1 (unlimited): %s"},
+	"profile.unknown_key":      {"未知的设置项: %s", "unknown setting: %s"},
+	"profile.read_failed":      {"读取配置文件失败: %v", "failed to read the profiles file: %v"},
+	"profile.not_found":        {"配置文件 %s 中没有名为 %s 的配置", "the profiles file %s has no profile named %s"},
+
+	// status 和 history 命令
+	"status.running":            {"正在运行: %s", "running: %s"},
+	"status.last_run":           {"最近一次运行: %s", "last run: %s"},
+	"status.last_success_age":   {"最近一次成功镜像: %s (%s 前)", "last successful mirror: %s (%s ago)"},
+	"status.never_succeeded":    {"从未成功镜像", "never mirrored successfully"},
+	"status.no_paths":           {"配置中没有源目录和目标目录", "the profile has no source and target"},
+	"status.stale_never":        {"已过期: 从未成功镜像 (要求 %s 之内)", "stale: never mirrored successfully (required within %s)"},
+	"status.stale":              {"已过期: 最近一次成功镜像在 %s 前，超过了要求的 %s", "stale: last successful mirror %s ago, more than the required %s"},
+	"status.fresh":              {"新鲜: 最近一次成功镜像在 %s 前 (要求 %s 之内)", "fresh: last successful mirror %s ago (required within %s)"},
+	"status.target_unreachable": {"目标目录无法访问: %v", "the target is not accessible: %v"},
+	"status.target_not_dir":     {"目标路径不是目录: %s", "the target is not a directory: %s"},
+	"status.target_no_space":    {"目标目录可以访问，无法获取可用空间: %v", "the target is accessible, cannot get its free space: %v"},
+	"status.target_ok":          {"目标目录可以访问，可用空间 %s / %s", "the target is accessible, %s free of %s"},
+	"status.marker_missing":     {"标记文件不存在，执行 apply 之前需要先运行 plan", "no marker file, run plan before apply"},
+	"status.marker_invalid":     {"标记文件无效: %v", "invalid marker file: %v"},
+	"status.marker_stale":       {"标记文件已过期 (创建于 %s，%s 前)，需要重新运行 plan", "the marker file has expired (created %s, %s ago), run plan again"},
+	"status.marker_valid":       {"标记文件有效 (创建于 %s，剩余 %s)", "the marker file is valid (created %s, %s left)"},
+	"status.log_file":           {"日志文件: %s", "log file: %s"},
+	"status.last_success":       {"最近一次成功镜像: %s", "last successful mirror: %s"},
+	"status.state_dir_failed":   {"读取状态目录失败: %v", "failed to read the state directory: %v"},
+	"history.empty":             {"没有运行历史", "no run history"},
+	"history.read_failed":       {"读取运行历史失败: %v", "failed to read the run history: %v"},
+	"history.write_failed":      {"无法写入运行历史: %v", "cannot write the run history: %v"},
+	"flag.history_n":            {"显示最近的记录数，0 表示全部", "number of recent records to show, 0 for all"},
+	"flag.history_json":         {"以 JSON 行格式输出", "print JSON lines"},
+
+	// rules 和 explain 命令
+	"lint.bad_syntax":            {"无效的通配符语法: %v", "invalid wildcard syntax: %v"},
+	"lint.trailing_space":        {"模式末尾有空白字符，rsync 会把它当作文件名的一部分", "the pattern ends with whitespace, which rsync treats as part of the name"},
+	"lint.leading_space":         {"模式开头有空白字符，rsync 会把它当作文件名的一部分", "the pattern starts with whitespace, which rsync treats as part of the name"},
+	"lint.duplicate":             {"与 %s 的规则重复", "duplicates the rule at %s"},
+	"lint.subsumed":              {"已被 %s 的规则 %q 覆盖，永远不会生效", "never takes effect, the rule at %s (%q) already covers it"},
+	"lint.include_shadowed":      {"包含规则永远无法生效: %s 的排除规则 %q 会先匹配", "the include rule never takes effect: the exclude rule at %s (%q) matches first"},
+	"lint.no_match":              {"在源目录中没有匹配任何路径", "matches no path in the source"},
+	"lint.include_never_decides": {"包含规则在源目录中从未生效，匹配的路径都已被更早的规则决定", "the include rule never takes effect in the source, earlier rules decide every path it matches"},
+	"lint.never_decides":         {"匹配的路径都已被更早的规则决定", "earlier rules decide every path it matches"},
+	"rules.usage_lint":           {"用法: %s rules lint [--profile NAME] [--preset NAMES] [--exclude-from FILE] [--include-from FILE] [--source DIR]", "Usage: %s rules lint [--profile NAME] [--preset NAMES] [--exclude-from FILE] [--include-from FILE] [--source DIR]"},
+	"rules.usage_presets":        {"      %s rules presets [NAME]", "       %s rules presets [NAME]"},
+	"rules.read_failed":          {"读取规则文件失败: %v", "failed to read the rule files: %v"},
+	"rules.source_missing":       {"源目录不存在: %s", "the source directory does not exist: %s"},
+	"rules.walk_failed":          {"遍历源目录失败: %v", "failed to walk the source directory: %v"},
+	"rules.lint_failed":          {"规则检查发现 %d 个问题 (共 %d 条规则)", "the rule check found %d problems (%d rules)"},
+	"rules.lint_ok":              {"规则检查通过 (共 %d 条规则)", "the rule check passed (%d rules)"},
+	"explain.path":               {"路径: %s", "Path: %s"},
+	"explain.exclude":            {"排除", "exclude"},
+	"explain.include":            {"包含", "include"},
+	"explain.parent_excluded":    {"上级目录 %s 被排除: %s", "parent directory %s is excluded: %s"},
+	"explain.matched":            {"匹配规则: %s", "matching rule: %s"},
+	"explain.no_match":           {"没有匹配的规则，默认包含", "no rule matches, included by default"},
+	"explain.mirrored":           {"结果: 会被镜像", "Result: mirrored"},
+	"explain.not_mirrored":       {"结果: 不会被镜像", "Result: not mirrored"},
+	"explain.outside_source":     {"路径不在源目录中: %s", "the path is not inside the source directory: %s"},
+	"explain.empty_path":         {"路径为空", "the path is empty"},
+	"explain.not_in_source":      {"源目录中不存在该路径: %s", "the path does not exist in the source directory: %s"},
+	"flag.explain_source":        {"源目录，用于判断路径是否为目录（默认使用配置中的源目录）", "source directory, used to tell whether the path is a directory (default from the profile)"},
+	"flag.lint_source":           {"用于检查规则是否匹配的源目录（默认使用配置中的源目录）", "source directory to check the rules against (default from the profile)"},
+
+	// doctor 命令
+	"doctor.rsync_failed":           {"无法执行 rsync: %v（没有 rsync 时可以使用 --backend=native）", "cannot run rsync: %v (use --backend=native without rsync)"},
+	"doctor.rsync_ok":               {"rsync 可用: %s", "rsync is available: %s"},
+	"doctor.native_backend":         {"使用原生同步后端，不需要 rsync", "using the native backend, rsync is not needed"},
+	"doctor.rules_failed":           {"确定规则来源失败: %v", "failed to determine the rule sources: %v"},
+	"doctor.exclude_unusable":       {"排除规则文件不可用: %v", "the exclude rule file is not usable: %v"},
+	"doctor.exclude_file":           {"排除规则文件: %s", "exclude rule file: %s"},
+	"doctor.include_file":           {"包含规则文件: %s", "include rule file: %s"},
+	"doctor.rule_issue":             {"规则问题: %s", "rule problem: %s"},
+	"doctor.profiles_path_failed":   {"无法确定配置文件路径: %v", "cannot determine the profiles file path: %v"},
+	"doctor.no_profiles":            {"没有配置文件: %s", "no profiles file: %s"},
+	"doctor.profiles":               {"配置文件: %s (共 %d 个配置)", "profiles file: %s (%d profiles)"},
+	"doctor.profile_source_missing": {"配置 %s 的源目录不存在: %s", "the source of profile %s does not exist: %s"},
+	"doctor.state_dir_unusable":     {"状态目录不可用: %v", "the state directory is not usable: %v"},
+	"doctor.state_dir_readonly":     {"状态目录不可写: %v", "the state directory is not writable: %v"},
+	"doctor.state_dir_ok":           {"状态目录可写: %s", "the state directory is writable: %s"},
+	"doctor.ok":                     {"[正常] %s", "[ OK ] %s"},
+	"doctor.warn":                   {"[警告] %s", "[WARN] %s"},
+	"doctor.error":                  {"[错误] %s", "[FAIL] %s"},
+	"doctor.errors":                 {"发现 %d 个错误", "found %d errors"},
+	"doctor.no_errors":              {"检查完成，没有发现错误", "check complete, no errors found"},
+
+	// 钩子
+	"hook.running": {"执行钩子 %s: %s", "Running hook %s: %s"},
+	"hook.failed":  {"钩子 %s 失败: %v", "hook %s failed: %v"},
+	"hook.err":     {"钩子命令失败", "hook command failed"},
+
+	// 通知
+	"notify.sending":  {"发送 %s 通知", "Sending %s notification"},
+	"notify.failed":   {"发送 %s 通知失败: %v", "failed to send %s notification: %v"},
+	"notify.subject":  {"[folder_mirror] %s %s: %s", "[folder_mirror] %s %s: %s"},
+	"notify.run_id":   {"运行 ID: %s", "Run ID: %s"},
+	"notify.mode":     {"模式: %s", "Mode: %s"},
+	"notify.status":   {"结果: %s", "Status: %s"},
+	"notify.source":   {"源目录: %s", "Source: %s"},
+	"notify.target":   {"目标目录: %s", "Target: %s"},
+	"notify.start":    {"开始时间: %s", "Started: %s"},
+	"notify.duration": {"耗时: %s", "Duration: %s"},
+	"notify.changes":  {"文件变化: 新建 %d，更新 %d，删除 %d", "Changes: %d created, %d updated, %d deleted"},
+	"notify.warnings": {"警告: %d", "Warnings: %d"},
+	"notify.error":    {"错误: %s", "Error: %s"},
+	"notify.log_file": {"运行日志: %s", "Run log: %s"},
+	"notify.host":     {"主机: %s", "Host: %s"},
+	"notify.bad_on":   {"%s 必须是 %s、%s 或 %s: %s", "%s must be %s, %s or %s: %s"},
+	"config.not_bool": {"%s 必须是 true 或 false: %s", "%s must be true or false: %s"},
+
+	// 指标
+	"metrics.write_failed": {"无法写入指标文件: %v", "cannot write the metrics file: %v"},
+
+	// watch 命令
+	"watch.start_failed":  {"无法监视源目录: %v", "cannot watch the source directory: %v"},
+	"watch.too_many_dirs": {"inotify 监视的目录数达到上限，请增大 fs.inotify.max_user_watches", "reached the inotify watch limit, increase fs.inotify.max_user_watches"},
+	"watch.source_gone":   {"源目录被删除或移动", "the source directory was deleted or moved"},
+	"watch.watching":      {"正在监视 %s 中的变化，按 Ctrl-C 停止", "Watching %s for changes, press Ctrl-C to stop"},
+	"watch.stopped":       {"停止监视", "Stopped watching"},
+	"watch.pass_full":     {"完整镜像", "Full mirror pass"},
+	"watch.pass_paths":    {"增量镜像 %d 个路径", "Incremental pass for %d paths"},
+	"flag.debounce":       {"最后一次变化之后等待多久开始增量镜像", "how long to wait after the last change before an incremental pass"},
+	"flag.full_interval":  {"完整镜像的间隔，0 表示只在需要时完整镜像", "interval between full passes, 0 to run them only when needed"},
+
+	// daemon 命令
+	"daemon.no_schedules":    {"没有设置了 schedule 的配置", "no profile has a schedule"},
+	"daemon.catch_up":        {"[%s] 错过了 %s 的运行，立即补上", "[%s] missed the run at %s, running it now"},
+	"daemon.next":            {"[%s] 下一次运行: %s", "[%s] next run: %s"},
+	"daemon.start":           {"[%s] 开始定时运行", "[%s] starting scheduled run"},
+	"daemon.overlap_skipped": {"[%s] 运行时间超过了调度间隔，跳过期间的调度", "[%s] the run took longer than the schedule interval, skipping the missed runs"},
+	"daemon.stopped":         {"停止定时运行", "Stopped the scheduler"},
+	"daemon.limit_deletes":   {"预览将删除 %d 个文件，超过上限 %d，不执行镜像", "the plan deletes %d files, more than the limit of %d; not mirroring"},
+	"daemon.limit_changes":   {"预览将改变 %d 个文件，超过上限 %d，不执行镜像", "the plan changes %d files, more than the limit of %d; not mirroring"},
+	"cron.bad_every":         {"@every 的间隔必须是至少 1m 的时长: %s", "@every needs a duration of at least 1m: %s"},
+	"cron.field_count":       {"调度表达式必须有五个字段（分钟 小时 日 月 星期）: %s", "a schedule needs five fields (minute hour day-of-month month day-of-week): %s"},
+	"cron.never":             {"调度表达式永远不会触发: %s", "the schedule never fires: %s"},
+	"cron.bad_step":          {"无效的步长: %s", "invalid step: %s"},
+	"cron.out_of_range":      {"取值超出范围 %d-%d: %s", "value out of range %d-%d: %s"},
+	"cron.bad_value":         {"无效的取值: %s", "invalid value: %s"},
+	"flag.once":              {"立即运行一次配置后退出，调度由 systemd 定时器等外部负责", "run the profiles once and exit, leaving the scheduling to a systemd timer or similar"},
+
+	// install-timer 和 notify 命令
+	"timer.no_schedule":    {"配置 %s 没有设置 schedule，请使用 --schedule 指定", "profile %s has no schedule, use --schedule"},
+	"timer.dom_and_dow":    {"systemd 定时器无法表示同时限制日和星期的调度: %s", "a systemd timer cannot express a schedule that restricts both day of month and day of week: %s"},
+	"timer.bad_schedule":   {"无法转换的调度表达式: %s", "cannot convert the schedule to a systemd timer: %s"},
+	"timer.exists":         {"%s 不是 install-timer 生成的文件，使用 --force 覆盖", "%s was not written by install-timer, use --force to overwrite it"},
+	"timer.written":        {"已写入 %s", "Wrote %s"},
+	"timer.target_missing": {"目标目录 %s 不存在，服务启动前需要先创建，否则无法设置 ReadWritePaths", "the target %s does not exist; create it before the service runs, ReadWritePaths needs it"},
+	"timer.enable":         {"启用定时器: %s", "Enable the timer with: %s"},
+	"notify.already_sent":  {"运行 %s 失败时已经发送过通知", "Run %s already sent a failure notification"},
+	"notify.unit_failed":   {"systemd 单元 %s 失败: %s", "systemd unit %s failed: %s"},
+	"flag.system":          {"生成系统单元而不是用户单元", "write system units instead of user units"},
+	"flag.schedule":        {"调度表达式，默认使用配置中的 schedule", "schedule expression, default from the profile"},
+	"flag.unit_dir":        {"写入单元文件的目录（默认 ~/.config/systemd/user 或 /etc/systemd/system）", "directory for the unit files (default ~/.config/systemd/user or /etc/systemd/system)"},
+	"flag.force":           {"覆盖不是 install-timer 生成的单元文件", "overwrite unit files not written by install-timer"},
+	"flag.unit":            {"失败的 systemd 单元", "the failed systemd unit"},
+
+	// verify 命令和 apply --verify
+	"verify.start":          {"校验目标目录: %s", "Verifying the target: %s"},
+	"verify.missing":        {"缺少: %s", "missing: %s"},
+	"verify.extra":          {"多余: %s", "extra: %s"},
+	"verify.differ":         {"不同: %s（%s）", "differs: %s (%s)"},
+	"verify.reason.type":    {"类型不同", "type"},
+	"verify.reason.size":    {"大小不同", "size"},
+	"verify.reason.mtime":   {"修改时间不同", "modification time"},
+	"verify.reason.content": {"内容不同", "content"},
+	"verify.reason.link":    {"链接目标不同", "link target"},
+	"verify.summary":        {"比较了 %d 个条目，计算哈希 %s：缺少 %d，多余 %d，不同 %d", "Compared %d entries, hashed %s: %d missing, %d extra, %d differing"},
+	"verify.ok":             {"目标目录与源目录一致", "The target matches the source"},
+	"verify.drift":          {"校验发现 %d 处差异", "verification found %d differences"},
+	"verify.err_drift":      {"目标目录与源目录不一致", "the target does not match the source"},
+	"verify.dir_missing":    {"目录不存在: %s", "directory does not exist: %s"},
+	"verify.rules_failed":   {"无法读取规则", "cannot read the rules"},
+	"flag.checksum":         {"同时比较文件内容的 SHA-256，而不只是比较大小和修改时间", "also compare SHA-256 content hashes, not only sizes and modification times"},
+	"flag.verify":           {"镜像完成后比较源目录和目标目录的条目、大小和修改时间，有差异时以非零状态退出", "after mirroring, compare the entries, sizes and modification times of the source and target, exiting non-zero on drift"},
+	"flag.verify_checksum":  {"与 --verify 相同，同时比较文件内容的 SHA-256", "like --verify, also comparing SHA-256 content hashes"},
+
+	// 完整性清单和 scrub 命令
+	"manifest.updated":   {"完整性清单: %d 个文件，重新计算哈希 %d 个（%s），删除 %d 个", "Integrity manifest: %d files, %d rehashed (%s), %d removed"},
+	"manifest.failed":    {"无法更新完整性清单: %v", "cannot update the integrity manifest: %v"},
+	"scrub.start":        {"按完整性清单检查目标目录: %s", "Scrubbing the target against its integrity manifest: %s"},
+	"scrub.resume":       {"从检查点继续：这一轮开始于 %s，已检查 %d 个文件", "Resuming from the checkpoint: this round started %s, %d files checked"},
+	"scrub.missing":      {"缺少: %s", "missing: %s"},
+	"scrub.truncated":    {"被截断: %s", "truncated: %s"},
+	"scrub.modified":     {"在镜像之外被修改: %s", "modified outside the mirror: %s"},
+	"scrub.bitrot":       {"内容损坏: %s（大小和修改时间没有变化）", "bitrot: %s (size and modification time unchanged)"},
+	"scrub.unreadable":   {"无法读取: %s: %v", "unreadable: %s: %v"},
+	"scrub.paused":       {"已检查 %d/%d 个文件（这次读取 %s），进度已保存，下次运行时继续", "Checked %d/%d files (%s read this time); progress saved, the next run continues from here"},
+	"scrub.summary":      {"检查完成: %d 个文件，读取 %s，发现 %d 个问题", "Scrub complete: %d files, %s read, %d problems"},
+	"scrub.problems":     {"scrub 发现 %d 个问题", "scrub found %d problems"},
+	"scrub.err_problems": {"scrub 发现问题", "scrub found problems"},
+	"scrub.no_manifest":  {"目标目录中没有完整性清单，请先运行 apply: %s", "the target has no integrity manifest; run apply first: %s"},
+	"scrub.need_target":  {"需要 TARGET_DIR 或 --profile", "TARGET_DIR or --profile is required"},
+	"scrub.bad_size":     {"无法解析数据量: %s", "invalid size: %s"},
+	"flag.max_bytes":     {"这次最多读取的数据量，例如 500G，达到后保存进度并停止（默认不限制）", "maximum amount of data to read this run, e.g. 500G; progress is saved when it is reached (default unlimited)"},
+	"flag.max_duration":  {"这次最长的运行时间，例如 6h，达到后保存进度并停止（默认不限制）", "maximum run time, e.g. 6h; progress is saved when it is reached (default unlimited)"},
+	"flag.scrub_restart": {"丢弃检查点，从头开始新的一轮", "discard the checkpoint and start a new round"},
+
+	// 中断
+	"signal.waiting": {"收到 %s，正在等待 rsync 结束当前文件... 再次按 Ctrl-C 强制终止", "Received %s, waiting for rsync to finish the current file... press Ctrl-C again to kill it"},
+	"signal.force":   {"强制终止 rsync", "Killing rsync"},
+
+	// 规则覆盖报告
+	"coverage.read_failed": {"无法读取规则文件，跳过规则覆盖统计: %v", "cannot read the rule files, skipping the rule coverage report: %v"},
+	"coverage.failed":      {"无法统计规则覆盖情况: %v", "cannot compute rule coverage: %v"},
+	"coverage.title":       {"规则覆盖报告:", "Rule coverage:"},
+	"coverage.rule":        {"  %s:%d: %s 排除 %d 个文件, %s", "  %s:%d: %s excludes %d files, %s"},
+	"coverage.total":       {"排除规则共排除 %d 个文件, %s", "Exclude rules exclude %d files, %s in total"},
+	"coverage.unused":      {"以下 %d 条排除规则没有匹配任何文件:", "%d exclude rules match no files:"},
+
+	// mirror 包的事件
+	"mirror.source_dir":          {en: "Source: %s"},
+	"mirror.target_dir":          {en: "Target: %s"},
+	"mirror.create_target":       {en: "Target directory does not exist, creating it..."},
+	"mirror.release_lock_failed": {en: "cannot release lock: %v"},
+	"mirror.stale_lock":          {en: "Took over stale lock file %s (%s)"},
+	"mirror.dry_run":             {en: "Running in DRY-RUN mode. No changes will be made."},
+	"mirror.log_file":            {en: "Output will be saved to: %s"},
+	"mirror.plan_start":          {en: "Previewing folder mirror..."},
+	"mirror.plan_done_marker":    {en: "Preview finished. Marker file created: %s"},
+	"mirror.plan_done":           {en: "Preview finished."},
+	"mirror.apply_start":         {en: "Mirroring folder..."},
+	"mirror.apply_done":          {en: "Folder mirror finished successfully!"},
+	"mirror.remove_marker":       {en: "cannot remove marker file: %v"},
+	"mirror.cleanup_failed":      {en: "failed to clean up rsync temporary files: %v"},
+	"mirror.partial_removed":     {en: "Removed %d temporary files left by rsync"},
+	"mirror.lock_holder":         {en: "PID %d on %s, started %s, command %s"},
+	"mirror.lock_holder_unknown": {en: "unknown holder"},
+	"mirror.native_entry_failed": {en: "cannot sync %s: %v"},
+	"mirror.native_skip_special": {en: "skipping entry that is not a regular file: %s"},
+	"mirror.native_not_empty":    {en: "cannot delete non-empty directory: %s"},
+
+	// mirror 包的错误
+	"mirror.err.source_missing":     {en: "source directory does not exist"},
+	"mirror.err.source_missing_at":  {en: "source directory does not exist: %s"},
+	"mirror.err.source_empty":       {en: "source directory is empty, refusing to mirror"},
+	"mirror.err.nested_paths":       {en: "source and target are the same directory or nested in each other, refusing to mirror"},
+	"mirror.err.remote_path":        {en: "remote paths are not supported"},
+	"mirror.err.remote_create":      {en: "cannot create a remote directory, use a local path: %s"},
+	"mirror.err.remote_empty_check": {en: "cannot check whether a remote directory is empty, use a local path: %s"},
+	"mirror.err.remote_source":      {en: "remote source directories are not supported, use a local path: %s"},
+	"mirror.err.remote_target":      {en: "remote target directories are not supported, use a local path: %s"},
+	"mirror.err.marker_missing":     {en: "marker file not found. Run the plan command (or use --dry-run) first to create it"},
+	"mirror.err.marker_stale":       {en: "marker file is too old"},
+	"mirror.err.marker_stale_age":   {en: "marker file is too old (%d seconds, max %d)"},
+	"mirror.err.marker_invalid":     {en: "cannot parse the marker file timestamp"},
+	"mirror.err.marker_invalid_at":  {en: "cannot parse the marker file timestamp: %v"},
+	"mirror.err.rule_file_missing":  {en: "exclude rule file does not exist"},
+	"mirror.err.rule_file_at":       {en: "exclude rule file does not exist: %s"},
+	"mirror.err.rsync_failed":       {en: "rsync failed"},
+	"mirror.err.rsync_failed_with":  {en: "rsync failed: %v"},
+	"mirror.err.sync_failed":        {en: "sync failed"},
+	"mirror.err.native_arg":         {en: "the native backend does not support this rsync argument: %s"},
+	"mirror.err.native_rules":       {en: "cannot read rule file %s: %v"},
+	"mirror.err.native_failed":      {en: "native sync failed: %v"},
+	"mirror.err.native_partial":     {en: "native sync failed: %d entries could not be synced"},
+	"mirror.err.shard_plan":         {en: "cannot split into shards: %v"},
+	"mirror.err.verify_read":        {en: "cannot read %s while verifying: %v"},
+	"mirror.err.manifest_read":      {en: "cannot read %s while updating the integrity manifest: %v"},
+	"mirror.err.manifest_write":     {en: "cannot write the integrity manifest: %v"},
+	"mirror.err.manifest_invalid":   {en: "cannot parse integrity manifest %s, line %d: %v"},
+	"mirror.err.checkpoint_invalid": {en: "cannot parse scrub checkpoint %s: %v"},
+	"mirror.err.interrupted":        {en: "mirror interrupted"},
+	"mirror.err.interrupted_killed": {en: "mirror interrupted, rsync was killed"},
+	"mirror.err.locked":             {en: "locked by another folder_mirror process"},
+	"mirror.err.locked_by":          {en: "%s is locked by another folder_mirror process (%s)"},
+	"mirror.err.locked_by_dead":     {en: "%s is locked by another folder_mirror process (%s); the recorded process is gone, a child process may have inherited the lock"},
+	"mirror.err.check_empty":        {en: "cannot check whether the source directory is empty: %v"},
+	"mirror.err.create_target":      {en: "failed to create the target directory: %v"},
+	"mirror.err.create_log":         {en: "failed to create the log file: %v"},
+	"mirror.err.files_from":         {en: "cannot write the list of paths to mirror: %v"},
+	"mirror.err.create_marker":      {en: "failed to create the marker file: %v"},
+	"mirror.err.abs_source":         {en: "cannot get the absolute source path: %v"},
+	"mirror.err.abs_target":         {en: "cannot get the absolute target path: %v"},
+	"mirror.err.stat_source":        {en: "cannot stat the source directory: %v"},
+	"mirror.err.stat_target":        {en: "cannot stat the target directory: %v"},
+	"mirror.err.eval_source":        {en: "cannot resolve source directory symlinks: %v"},
+	"mirror.err.eval_target":        {en: "cannot resolve target directory symlinks: %v"},
+	"mirror.err.open_lock":          {en: "cannot open the lock file: %v"},
+	"mirror.err.lock_failed":        {en: "cannot lock %s: %v"},
+	"mirror.err.write_lock":         {en: "cannot write the lock file: %v"},
+	"mirror.err.lock_replaced":      {en: "cannot lock %s: the lock file keeps being replaced"},
+	"mirror.err.would_block":        {en: "the lock is held"},
+	"mirror.err.no_flock":           {en: "the file system does not support flock"},
+
+	// filter 包的错误
+	"filter.err.empty_pattern":      {en: "the pattern is empty"},
+	"filter.err.double_slash":       {en: "the pattern contains consecutive slashes and never matches"},
+	"filter.err.trailing_backslash": {en: "the pattern ends with a lone backslash"},
+	"filter.err.bad_class":          {en: "a character class [...] is not closed or has an unknown [:class:]"},
+	"filter.err.triple_star":        {en: "'***' may only appear at the end of the pattern as '/***'"},
+	"filter.err.unknown_preset":     {en: "unknown rule preset: %s (available presets: %s)"},
+
+	// securefile 包的错误
+	"securefile.err.not_owned":      {en: "is not owned by the current user"},
+	"securefile.err.symlink":        {en: "is a symbolic link"},
+	"securefile.err.not_regular":    {en: "is not a regular file"},
+	"securefile.err.not_owned_at":   {en: "%s is not owned by the current user"},
+	"securefile.err.symlink_at":     {en: "%s is a symbolic link"},
+	"securefile.err.not_regular_at": {en: "%s is not a regular file"},
+	"securefile.err.not_dir_at":     {en: "%s is not a directory"},
+}
+
+// 自带默认中文消息的包：消息 ID、默认格式以及错误的消息 ID 和参数
+var messagePackages = []struct {
+	ids          func() []string
+	format       func(id string) string
+	errorMessage func(err error) (string, []interface{}, bool)
+}{
+	{mirror.MessageIDs, mirror.MessageFormat, mirror.ErrorMessage},
+	{filter.MessageIDs, filter.MessageFormat, filter.ErrorMessage},
+	{securefile.MessageIDs, securefile.MessageFormat, securefile.ErrorMessage},
+}
+
+func init() {
+	for _, pkg := range messagePackages {
+		for _, id := range pkg.ids() {
+			t := catalog[id]
+			if t.zh == "" {
+				t.zh = pkg.format(id)
+				catalog[id] = t
+			}
+		}
+	}
+}
+
+// 按当前语言生成消息，未知的消息 ID 原样返回
+func tr(id string, args ...interface{}) string {
+	t, ok := catalog[id]
+	if !ok {
+		return id
+	}
+	format := t.zh
+	if language == langEN {
+		format = t.en
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, localizeArgs(args)...)
+}
+
+// 翻译消息参数中的错误和锁持有者
+func localizeArgs(args []interface{}) []interface{} {
+	if language == langZH {
+		return args
+	}
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case error:
+			out[i] = localizedError(v)
+		case mirror.LockInfo:
+			out[i] = lockHolderText(v)
+		case *mirror.LockInfo:
+			out[i] = lockHolderText(*v)
+		default:
+			out[i] = arg
+		}
+	}
+	return out
+}
+
+// 锁持有者的说明
+func lockHolderText(i mirror.LockInfo) string {
+	if i.PID == 0 {
+		return tr("mirror.lock_holder_unknown")
+	}
+	return tr("mirror.lock_holder", i.PID, i.Host, i.Started.Format("2006-01-02 15:04:05"), i.Command)
+}
+
+// 按当前语言生成错误信息，无法翻译的错误使用 Error()
+func localizedError(err error) string {
+	if language == langZH {
+		return err.Error()
+	}
+	for _, pkg := range messagePackages {
+		if id, args, ok := pkg.errorMessage(err); ok {
+			return tr(id, args...)
+		}
+	}
+	return err.Error()
+}
+
+// catalogError 是以消息 ID 表示的哨兵错误，Error() 按当前语言生成消息
+type catalogError string
+
+func (e catalogError) Error() string { return tr(string(e)) }
+
+// 按当前语言生成镜像事件的消息，rsync 的输出原样返回
+func eventText(e mirror.Event) string {
+	if e.ID == "" || language == langZH {
+		return e.Message
+	}
+	return tr(e.ID, e.Args...)
+}
+
+// 输出警告
+func printWarning(message string) {
+	printMessage(levelWarning, colorYellow, tr("msg.warning", message))
+}
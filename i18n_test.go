@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/your-username/folder_mirror/filter"
+	"github.com/your-username/folder_mirror/mirror"
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// 格式中的动词，例如 %s、%d、%-10s
+var formatVerb = regexp.MustCompile(`%[-+# 0]*\d*(?:\.\d+)?[a-zA-Z%]`)
+
+// 返回格式中的动词字母，两种语言的格式必须使用相同的参数
+func formatVerbs(format string) []string {
+	var verbs []string
+	for _, v := range formatVerb.FindAllString(format, -1) {
+		verbs = append(verbs, v[len(v)-1:])
+	}
+	return verbs
+}
+
+// 测试每条消息都有中文和英文，并且使用相同的参数
+func TestCatalogComplete(t *testing.T) {
+	for id, msg := range catalog {
+		if msg.zh == "" || msg.en == "" {
+			t.Errorf("%s: 缺少翻译 (zh=%q, en=%q)", id, msg.zh, msg.en)
+			continue
+		}
+		if zh, en := formatVerbs(msg.zh), formatVerbs(msg.en); !reflect.DeepEqual(zh, en) {
+			t.Errorf("%s: 中文参数 %v 与英文参数 %v 不一致", id, zh, en)
+		}
+	}
+
+	for _, pkg := range messagePackages {
+		for _, id := range pkg.ids() {
+			if _, ok := catalog[id]; !ok {
+				t.Errorf("消息 %s 没有翻译", id)
+			}
+		}
+	}
+	for _, cmd := range commands {
+		if _, ok := catalog[cmd.Summary]; !ok {
+			t.Errorf("命令 %s 的说明 %s 不在消息目录中", cmd.Name, cmd.Summary)
+		}
+	}
+}
+
+// 测试源代码中使用的消息 ID 都在消息目录中
+func TestCatalogIDsUsed(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := regexp.MustCompile(`\b(?:tr|catalogError)\("([^"]+)"`)
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range call.FindAllStringSubmatch(string(data), -1) {
+			if _, ok := catalog[m[1]]; !ok {
+				t.Errorf("%s: 消息 %s 不在消息目录中", file, m[1])
+			}
+		}
+	}
+}
+
+// 测试用户可见的中文文本都在消息目录中，源代码的其他地方不含中文字符串
+func TestNoHardcodedText(t *testing.T) {
+	var files []string
+	for _, dir := range []string{".", "filter", "mirror", "securefile"} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	// 消息目录本身，以及只在测试中使用的辅助代码
+	skip := map[string]bool{"i18n.go": true, "messages.go": true, "folder_mirror_test_utils.go": true}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || skip[filepath.Base(file)] {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			for _, r := range lit.Value {
+				if unicode.Is(unicode.Han, r) {
+					t.Errorf("%s: 中文字符串应当放到消息目录中: %s", fset.Position(lit.Pos()), lit.Value)
+					break
+				}
+			}
+			return true
+		})
+	}
+}
+
+// 测试根据环境变量确定语言
+func TestDetectLanguage(t *testing.T) {
+	testCases := []struct {
+		env      map[string]string
+		expected string
+	}{
+		{map[string]string{}, langZH},
+		{map[string]string{"LANG": "zh_CN.UTF-8"}, langZH},
+		{map[string]string{"LANG": "en_US.UTF-8"}, langEN},
+		{map[string]string{"LANG": "C.UTF-8"}, langZH},
+		{map[string]string{"LANG": "de_DE.UTF-8"}, langEN},
+		{map[string]string{"LANG": "zh_CN.UTF-8", "LC_MESSAGES": "en_US.UTF-8"}, langEN},
+		{map[string]string{"LC_MESSAGES": "en_US.UTF-8", "LC_ALL": "zh_TW.UTF-8"}, langZH},
+	}
+	for _, tc := range testCases {
+		getenv := func(name string) string { return tc.env[name] }
+		if got := detectLanguage(getenv); got != tc.expected {
+			t.Errorf("%v: 期望 %s，但得到 %s", tc.env, tc.expected, got)
+		}
+	}
+}
+
+// 测试在解析参数之前处理 --lang
+func TestApplyLangArg(t *testing.T) {
+	defer func() { language = langZH }()
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"plan", "--lang", "en", "a", "b"}, langEN},
+		{[]string{"plan", "-lang=en"}, langEN},
+		{[]string{"plan", "--lang=fr"}, langZH},
+		{[]string{"plan", "--", "--lang=en"}, langZH},
+		{[]string{"plan", "---lang=en"}, langZH},
+	}
+	for _, tc := range testCases {
+		language = langZH
+		applyLangArg(tc.args)
+		if language != tc.expected {
+			t.Errorf("%v: 期望 %s，但得到 %s", tc.args, tc.expected, language)
+		}
+	}
+
+	if err := (langFlag{}).Set("fr"); err == nil {
+		t.Error("--lang=fr 应当返回错误")
+	}
+}
+
+// 测试英文消息，包括 mirror 包的事件和错误
+func TestEnglishMessages(t *testing.T) {
+	defer func() { language = langZH }()
+	language = langEN
+
+	if got := tr("run.plan_saved", "/tmp/x.log"); got != "Dry-run output saved to: /tmp/x.log" {
+		t.Errorf("tr 结果错误: %q", got)
+	}
+	if got := tr("no.such.id"); got != "no.such.id" {
+		t.Errorf("未知的消息 ID 应当原样返回，但得到 %q", got)
+	}
+
+	e := mirror.Event{Kind: mirror.EventInfo, Message: "源目录: /src", ID: "mirror.source_dir", Args: []interface{}{"/src"}}
+	if got := eventText(e); got != "Source: /src" {
+		t.Errorf("事件消息错误: %q", got)
+	}
+	output := mirror.Event{Kind: mirror.EventOutput, Message: "sending incremental file list"}
+	if got := eventText(output); got != output.Message {
+		t.Errorf("rsync 输出不应翻译: %q", got)
+	}
+
+	// 错误参数中的错误和锁持有者同样翻译
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	locked := &mirror.LockedError{Path: "/state.lock", Holder: mirror.LockInfo{PID: 42, Host: "other-host", Started: started, Command: "folder_mirror apply"}}
+	expected := "/state.lock is locked by another folder_mirror process (PID 42 on other-host, started 2024-01-02 03:04:05, command folder_mirror apply)"
+	if got := localizedError(locked); got != expected {
+		t.Errorf("锁错误消息错误:\n期望 %q\n得到 %q", expected, got)
+	}
+	if got := localizedError(&mirror.RsyncError{Err: mirror.ErrInterrupted}); got != "rsync failed: mirror interrupted" {
+		t.Errorf("rsync 错误消息错误: %q", got)
+	}
+	if got := localizedError(mirror.ErrMarkerMissing); !strings.HasPrefix(got, "marker file not found") {
+		t.Errorf("标记文件错误消息错误: %q", got)
+	}
+	// 哨兵错误按当前语言生成消息
+	if got := errHookFailed.Error(); got != "hook command failed" {
+		t.Errorf("哨兵错误消息错误: %q", got)
+	}
+	// filter 和 securefile 包的错误
+	if got := localizedError(filter.CheckSyntax("a//b")); got != "the pattern contains consecutive slashes and never matches" {
+		t.Errorf("规则语法错误消息错误: %q", got)
+	}
+	if got := localizedError(securefile.ErrSymlink); got != "is a symbolic link" {
+		t.Errorf("securefile 错误消息错误: %q", got)
+	}
+	// 不是 mirror 包的错误使用 Error()
+	if got := localizedError(errors.New("其他错误")); got != "其他错误" {
+		t.Errorf("其他错误消息错误: %q", got)
+	}
+
+	language = langZH
+	if got := localizedError(locked); got != locked.Error() {
+		t.Errorf("中文错误消息应当与 Error() 相同: %q", got)
+	}
+}
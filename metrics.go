@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 指标文件中不能出现在文件名里的字符
+var unsafeMetricsName = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// 指标文件的路径：每个配置一个文件，node_exporter 只读取 .prom 结尾的文件
+func metricsPath(dir, profile string) string {
+	return filepath.Join(dir, "folder_mirror_"+unsafeMetricsName.ReplaceAllString(profile, "_")+".prom")
+}
+
+// modeMetrics 是一种运行模式的最近一次运行和最近一次成功的运行
+type modeMetrics struct {
+	last    *runRecord
+	success *runRecord
+}
+
+// 从运行历史中收集配置每种模式的最近运行，rec 是刚结束的运行，没有写入运行历史时同样计入
+func collectMetrics(records []runRecord, rec *runRecord) map[string]*modeMetrics {
+	found := false
+	for _, r := range records {
+		if r.ID == rec.ID && r.Mode == rec.Mode {
+			found = true
+		}
+	}
+	if !found {
+		records = append(records, *rec)
+	}
+	modes := map[string]*modeMetrics{}
+	for i := range records {
+		r := &records[i]
+		if r.Profile != rec.Profile {
+			continue
+		}
+		m := modes[r.Mode]
+		if m == nil {
+			m = &modeMetrics{}
+			modes[r.Mode] = m
+		}
+		m.last = r
+		if r.Status == runSuccess {
+			m.success = r
+		}
+	}
+	return modes
+}
+
+// 转义标签值中的反斜杠、引号和换行
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// 生成 Prometheus 文本格式的指标，模式按 plan、apply 的顺序输出
+func formatMetrics(profile string, modes map[string]*modeMetrics) []byte {
+	type sample struct {
+		labels string
+		value  float64
+	}
+	type metric struct {
+		name, help string
+		samples    []sample
+	}
+	metrics := []*metric{
+		{name: "folder_mirror_last_run_timestamp_seconds", help: "End time of the last run."},
+		{name: "folder_mirror_last_success_timestamp_seconds", help: "End time of the last successful run."},
+		{name: "folder_mirror_last_run_success", help: "Whether the last run succeeded."},
+		{name: "folder_mirror_last_run_duration_seconds", help: "Duration of the last run."},
+		{name: "folder_mirror_last_run_exit_code", help: "Exit code of the last run."},
+		{name: "folder_mirror_last_run_transferred_bytes", help: "Total size of files created or updated by the last run."},
+		{name: "folder_mirror_last_run_files", help: "Files created, updated or deleted by the last run."},
+		{name: "folder_mirror_last_run_warnings", help: "Warnings printed during the last run."},
+	}
+	for _, mode := range []string{"plan", "apply"} {
+		m := modes[mode]
+		if m == nil {
+			continue
+		}
+		labels := fmt.Sprintf(`profile="%s",mode="%s"`, escapeLabel(profile), mode)
+		last := m.last
+		success := 0.0
+		if last.Status == runSuccess {
+			success = 1
+		}
+		metrics[0].samples = append(metrics[0].samples, sample{labels, float64(last.End.Unix())})
+		if m.success != nil {
+			metrics[1].samples = append(metrics[1].samples, sample{labels, float64(m.success.End.Unix())})
+		}
+		metrics[2].samples = append(metrics[2].samples, sample{labels, success})
+		metrics[3].samples = append(metrics[3].samples, sample{labels, last.Duration().Seconds()})
+		metrics[4].samples = append(metrics[4].samples, sample{labels, float64(last.ExitCode)})
+		metrics[5].samples = append(metrics[5].samples, sample{labels, float64(last.Bytes)})
+		metrics[6].samples = append(metrics[6].samples,
+			sample{labels + `,change="created"`, float64(last.Changes.Created)},
+			sample{labels + `,change="updated"`, float64(last.Changes.Updated)},
+			sample{labels + `,change="deleted"`, float64(last.Changes.Deleted)})
+		metrics[7].samples = append(metrics[7].samples, sample{labels, float64(last.Warnings)})
+	}
+
+	var b bytes.Buffer
+	for _, m := range metrics {
+		if len(m.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, s := range m.samples {
+			fmt.Fprintf(&b, "%s{%s} %s\n", m.name, s.labels, strconv.FormatFloat(s.value, 'f', -1, 64))
+		}
+	}
+	return b.Bytes()
+}
+
+// 根据运行历史更新配置的指标文件
+// 先写入临时文件再重命名，node_exporter 不会读到写了一半的文件
+func writeMetrics(dir string, rec *runRecord) error {
+	var records []runRecord
+	if path, err := historyPath(); err == nil {
+		records, _ = readHistory(path)
+	}
+	data := formatMetrics(rec.Profile, collectMetrics(records, rec))
+
+	tmp, err := ioutil.TempFile(dir, ".folder_mirror_*.prom.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// node_exporter 通常以其他用户运行
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), metricsPath(dir, rec.Profile))
+}
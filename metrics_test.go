@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试根据运行历史生成的指标
+func TestFormatMetrics(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	success := runRecord{ID: "1", Mode: "apply", Profile: "home", Start: start, End: start.Add(time.Minute), Status: runSuccess,
+		Bytes: 2048, Changes: changeCounts{Created: 1, Updated: 2, Deleted: 3}}
+	other := runRecord{ID: "2", Mode: "apply", Profile: "work", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour), Status: runSuccess}
+	failed := &runRecord{ID: "3", Mode: "apply", Profile: "home", Start: start.Add(time.Hour), End: start.Add(time.Hour + 30*time.Second),
+		Status: runFailed, ExitCode: 1, Warnings: 2}
+
+	// 刚结束的运行没有写入运行历史时同样计入
+	data := string(formatMetrics("home", collectMetrics([]runRecord{success, other}, failed)))
+	expected := []string{
+		"# TYPE folder_mirror_last_run_timestamp_seconds gauge\n",
+		`folder_mirror_last_run_timestamp_seconds{profile="home",mode="apply"} 1700003630` + "\n",
+		`folder_mirror_last_success_timestamp_seconds{profile="home",mode="apply"} 1700000060` + "\n",
+		`folder_mirror_last_run_success{profile="home",mode="apply"} 0` + "\n",
+		`folder_mirror_last_run_duration_seconds{profile="home",mode="apply"} 30` + "\n",
+		`folder_mirror_last_run_exit_code{profile="home",mode="apply"} 1` + "\n",
+		`folder_mirror_last_run_transferred_bytes{profile="home",mode="apply"} 0` + "\n",
+		`folder_mirror_last_run_files{profile="home",mode="apply",change="deleted"} 0` + "\n",
+		`folder_mirror_last_run_warnings{profile="home",mode="apply"} 2` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(data, line) {
+			t.Errorf("指标中缺少 %q:\n%s", line, data)
+		}
+	}
+	if strings.Contains(data, `profile="work"`) || strings.Contains(data, `mode="plan"`) {
+		t.Errorf("指标中不应包含其他配置或没有运行过的模式:\n%s", data)
+	}
+
+	// 没有成功过时不输出成功时间
+	data = string(formatMetrics("home", collectMetrics(nil, failed)))
+	if strings.Contains(data, "folder_mirror_last_success_timestamp_seconds") {
+		t.Errorf("没有成功的运行时不应输出成功时间:\n%s", data)
+	}
+
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("标签转义错误: %s", got)
+	}
+}
+
+// 测试运行结束时写入指标文件，以及传输字节数的统计
+func TestMetricsFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用 sh 模拟 rsync")
+	}
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+	metricsDir := filepath.Join(testDir, "textfile")
+	os.MkdirAll(metricsDir, 0755)
+	ioutil.WriteFile(filepath.Join(sourceDir, "new.txt"), []byte("12345"), 0644)
+	ioutil.WriteFile(filepath.Join(sourceDir, "changed.txt"), []byte("1234567890"), 0644)
+
+	oldExecCommand := execCommand
+	oldTesting := os.Getenv("TESTING")
+	oldDisablePrint := disablePrint
+	oldHistoryFile := historyFile
+	defer func() {
+		execCommand = oldExecCommand
+		os.Setenv("TESTING", oldTesting)
+		disablePrint = oldDisablePrint
+		historyFile = oldHistoryFile
+		activeProfile = nil
+	}()
+	os.Setenv("TESTING", "1")
+	disablePrint = true
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		if name != "rsync" {
+			return exec.Command(name, args...)
+		}
+		return exec.Command("sh", "-c", "printf '>f+++++++++ new.txt\\n>f.st...... changed.txt\\n*deleting   old.txt\\n.d..t...... ./\\n'")
+	}
+
+	restore := setupProfilesFile(t, testDir, "[my home]\nsource = "+sourceDir+"\ntarget = "+targetDir+"\nmetrics_dir = "+metricsDir+"\n")
+	defer restore()
+	if code := runMainForExit([]string{"plan", "--profile", "my home"}); code != 0 {
+		t.Fatalf("plan 退出码 %d", code)
+	}
+	path := filepath.Join(metricsDir, "folder_mirror_my_home.prom")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("没有写入指标文件: %v", err)
+	}
+	for _, line := range []string{
+		`folder_mirror_last_run_success{profile="my home",mode="plan"} 1`,
+		`folder_mirror_last_run_transferred_bytes{profile="my home",mode="plan"} 15`,
+		`folder_mirror_last_run_files{profile="my home",mode="plan",change="created"} 1`,
+	} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Errorf("指标中缺少 %q:\n%s", line, data)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("指标文件应当可以被其他用户读取: %v", info.Mode())
+	}
+	if files, _ := filepath.Glob(filepath.Join(metricsDir, "*.tmp")); len(files) != 0 {
+		t.Errorf("临时文件没有删除: %v", files)
+	}
+
+	// 之后的 apply 不会覆盖 plan 的指标
+	if code := runMainForExit([]string{"apply", "--profile", "my home"}); code != 0 {
+		t.Fatalf("apply 退出码 %d", code)
+	}
+	data, _ = ioutil.ReadFile(path)
+	for _, line := range []string{
+		`folder_mirror_last_run_success{profile="my home",mode="plan"} 1`,
+		`folder_mirror_last_success_timestamp_seconds{profile="my home",mode="apply"}`,
+		`folder_mirror_last_run_exit_code{profile="my home",mode="apply"} 0`,
+	} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("指标中缺少 %q:\n%s", line, data)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Backend 执行一次同步
+// args 是 rsync 格式的参数，最后两个参数为源目录和目标目录（都带结尾的斜杠）；
+// 文件变化按 rsync --itemize-changes 的格式逐行写入 stdout，问题写入 stderr。
+// ctx 取消时应当尽快停止，不在目标目录中留下写了一半的文件
+type Backend interface {
+	Run(ctx context.Context, args []string, stdout, stderr io.Writer) error
+}
+
+// 运行后端，ctx 已取消时把返回的错误转换为中断错误
+func runBackend(ctx context.Context, b Backend, args []string, stdout, stderr io.Writer) error {
+	err := b.Run(ctx, args, stdout, stderr)
+	if ctx.Err() != nil && !errors.Is(err, ErrInterrupted) {
+		return &interruptedError{cause: ctx.Err()}
+	}
+	return err
+}
+
+// lineWriter 把写入的内容按行交给 fn，不完整的行等到换行或 flush 时才处理
+type lineWriter struct {
+	fn  func(string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// 处理最后一个没有换行的行
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.fn(strings.TrimSuffix(string(w.buf), "\r"))
+		w.buf = nil
+	}
+}
@@ -0,0 +1,359 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 一致性测试使用的后端：原生后端总是测试，rsync 只在安装了时测试
+func testBackends(t *testing.T) map[string]Backend {
+	backends := map[string]Backend{"native": NativeBackend{}}
+	if _, err := exec.LookPath("rsync"); err == nil {
+		backends["rsync"] = &RsyncBackend{}
+	} else {
+		t.Log("没有安装 rsync，只测试原生后端")
+	}
+	return backends
+}
+
+// 文件树中条目的修改时间，比当前时间早，使修改时间的比较有意义
+var treeTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+
+// 按描述创建文件树：以 / 结尾的是目录，值以 -> 开头的是符号链接，其余为文件内容
+func writeTree(t *testing.T, root string, tree map[string]string) {
+	paths := make([]string, 0, len(tree))
+	for p := range tree {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		full := filepath.Join(root, filepath.FromSlash(strings.TrimSuffix(p, "/")))
+		os.MkdirAll(filepath.Dir(full), 0755)
+		var err error
+		switch v := tree[p]; {
+		case strings.HasSuffix(p, "/"):
+			err = os.MkdirAll(full, 0755)
+		case strings.HasPrefix(v, "->"):
+			err = os.Symlink(v[2:], full)
+		default:
+			err = ioutil.WriteFile(full, []byte(v), 0644)
+			if err == nil {
+				err = os.Chtimes(full, treeTime, treeTime)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	touchDirs(root)
+}
+
+// 把目录的修改时间设为 treeTime
+func touchDirs(root string) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			os.Chtimes(path, treeTime, treeTime)
+		}
+		return nil
+	})
+}
+
+// 描述目录树中的全部条目：类型、权限、修改时间以及文件内容或链接目标
+// 根目录的修改时间会因为锁文件而改变，不列出；skip 中的路径也不列出
+func snapshot(t *testing.T, root string, skip ...string) []string {
+	var entries []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		for _, s := range skip {
+			if rel == s {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		mode := info.Mode()
+		switch {
+		case mode&os.ModeSymlink != 0:
+			link, _ := os.Readlink(path)
+			entries = append(entries, fmt.Sprintf("%s -> %s", rel, link))
+		case mode.IsDir():
+			entries = append(entries, fmt.Sprintf("%s/ %v %d", rel, mode.Perm(), info.ModTime().Unix()))
+		default:
+			data, _ := ioutil.ReadFile(path)
+			entries = append(entries, fmt.Sprintf("%s %v %d %q", rel, mode.Perm(), info.ModTime().Unix(), data))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// 一致性测试的目录
+type backendDirs struct {
+	dir, source, target, rules string
+}
+
+// 创建源目录、目标目录和排除规则文件
+func setupBackendDirs(t *testing.T, source, target map[string]string, excludes ...string) backendDirs {
+	dir, err := ioutil.TempDir("", "backend_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := backendDirs{dir: dir, source: filepath.Join(dir, "source"), target: filepath.Join(dir, "target"), rules: filepath.Join(dir, "exclude")}
+	writeTree(t, d.source, source)
+	if target != nil {
+		writeTree(t, d.target, target)
+	}
+	ioutil.WriteFile(d.rules, []byte(strings.Join(excludes, "\n")+"\n"), 0644)
+	return d
+}
+
+// 使用后端执行 Apply，返回 --itemize-changes 的输出
+func applyWith(t *testing.T, b Backend, d backendDirs, extra ...string) (string, error) {
+	var out strings.Builder
+	args := append(append([]string(nil), DefaultArgs...), "--itemize-changes", "--exclude-from="+d.rules)
+	m := New(Options{Source: d.source, Target: d.target, Args: append(args, extra...), Backend: b, Stdout: &out})
+	_, err := m.Apply(context.Background())
+	return out.String(), err
+}
+
+// 测试新建目标目录时复制全部内容，保留权限、修改时间、符号链接和硬链接
+func TestBackendCopy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用符号链接和 Unix 权限")
+	}
+	for name, b := range testBackends(t) {
+		d := setupBackendDirs(t, map[string]string{
+			"a.txt":          "alpha",
+			"script.sh":      "#!/bin/sh\n",
+			"sub/b.txt":      "beta",
+			"sub/deep/c.txt": "gamma",
+			"empty/":         "",
+			"link":           "->sub/b.txt",
+			"cache.tmp":      "skip",
+		}, nil, "*.tmp")
+		os.Chmod(filepath.Join(d.source, "script.sh"), 0750)
+		os.Chmod(filepath.Join(d.source, "sub"), 0700)
+		os.Link(filepath.Join(d.source, "a.txt"), filepath.Join(d.source, "sub", "hard.txt"))
+		touchDirs(d.source)
+
+		out, err := applyWith(t, b, d)
+		if err != nil {
+			t.Fatalf("%s: 镜像失败: %v", name, err)
+		}
+		want := snapshot(t, d.source, "cache.tmp")
+		if got := snapshot(t, d.target, LockFileName); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: 目标目录与源目录不一致\n期望:\n%s\n得到:\n%s", name, strings.Join(want, "\n"), strings.Join(got, "\n"))
+		}
+		a, _ := os.Stat(filepath.Join(d.target, "a.txt"))
+		hard, _ := os.Stat(filepath.Join(d.target, "sub", "hard.txt"))
+		if a == nil || hard == nil || !os.SameFile(a, hard) {
+			t.Errorf("%s: 没有保留硬链接", name)
+		}
+		for _, line := range []string{">f+++++++++ a.txt", "cd+++++++++ sub/deep/", "cL+++++++++ link -> sub/b.txt"} {
+			if !strings.Contains(out, line+"\n") {
+				t.Errorf("%s: 输出中缺少 %q:\n%s", name, line, out)
+			}
+		}
+
+		// 再次镜像时没有变化，只有根目录的修改时间因为锁文件而不同
+		out, err = applyWith(t, b, d)
+		if err != nil || (out != "" && out != ".d..t...... ./\n") {
+			t.Errorf("%s: 再次镜像时不应当有变化，但得到 %v:\n%s", name, err, out)
+		}
+		os.RemoveAll(d.dir)
+	}
+}
+
+// 测试更新变化的文件、删除多余的条目、替换类型改变的条目，并保护被排除的条目
+func TestBackendUpdate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用符号链接")
+	}
+	for name, b := range testBackends(t) {
+		d := setupBackendDirs(t, map[string]string{
+			"same.txt":      "same",
+			"changed.txt":   "new content",
+			"resized.txt":   "longer content",
+			"dir/file.txt":  "file",
+			"became_dir/x":  "x",
+			"became_file":   "file now",
+			"link":          "->same.txt",
+			"keep/data.txt": "data",
+		}, map[string]string{
+			"same.txt":         "same",
+			"changed.txt":      "old content",
+			"resized.txt":      "short",
+			"extra.txt":        "extra",
+			"extra_dir/a/b":    "b",
+			"became_dir":       "was a file",
+			"became_file/y":    "y",
+			"link":             "->changed.txt",
+			"notes.tmp":        "excluded, kept",
+			"keep/local.tmp":   "kept",
+			"gone/cache.tmp":   "keeps gone/",
+			"gone/removed.txt": "removed",
+		}, "*.tmp")
+		// 内容变化但大小相同的文件通过修改时间发现
+		os.Chtimes(filepath.Join(d.source, "changed.txt"), treeTime.Add(time.Hour), treeTime.Add(time.Hour))
+
+		out, err := applyWith(t, b, d)
+		if err != nil {
+			t.Fatalf("%s: 镜像失败: %v\n%s", name, err, out)
+		}
+		got := snapshot(t, d.target, LockFileName, "notes.tmp", "keep/local.tmp", "gone")
+		if want := snapshot(t, d.source); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: 目标目录与源目录不一致\n期望:\n%s\n得到:\n%s", name, strings.Join(want, "\n"), strings.Join(got, "\n"))
+		}
+		for _, kept := range []string{"notes.tmp", "keep/local.tmp", "gone/cache.tmp"} {
+			if _, err := os.Stat(filepath.Join(d.target, kept)); err != nil {
+				t.Errorf("%s: 被排除的 %s 应当保留", name, kept)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(d.target, "gone", "removed.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: 应当删除 gone/removed.txt", name)
+		}
+		for _, line := range []string{"*deleting   extra.txt", "*deleting   extra_dir/", ">f..t...... changed.txt", ">f.s....... resized.txt"} {
+			if !strings.Contains(out, line) {
+				t.Errorf("%s: 输出中缺少 %q:\n%s", name, line, out)
+			}
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if len(line) > 12 && line[12:] == "same.txt" {
+				t.Errorf("%s: 没有变化的文件不应当列出: %s", name, line)
+			}
+		}
+		os.RemoveAll(d.dir)
+	}
+}
+
+// 测试 --checksum 发现大小和修改时间都相同的内容变化
+func TestBackendChecksum(t *testing.T) {
+	for name, b := range testBackends(t) {
+		d := setupBackendDirs(t, map[string]string{"data.bin": "good data"}, map[string]string{"data.bin": "bad! data"})
+		if _, err := applyWith(t, b, d); err != nil {
+			t.Fatalf("%s: 镜像失败: %v", name, err)
+		}
+		if data, _ := ioutil.ReadFile(filepath.Join(d.target, "data.bin")); string(data) != "bad! data" {
+			t.Errorf("%s: 不使用 --checksum 时大小和修改时间相同的文件不应当更新", name)
+		}
+		out, err := applyWith(t, b, d, "--checksum")
+		if err != nil {
+			t.Fatalf("%s: 镜像失败: %v", name, err)
+		}
+		if data, _ := ioutil.ReadFile(filepath.Join(d.target, "data.bin")); string(data) != "good data" {
+			t.Errorf("%s: 使用 --checksum 时应当更新内容不同的文件", name)
+		}
+		if !strings.Contains(out, ">fc........ data.bin") {
+			t.Errorf("%s: 输出不正确:\n%s", name, out)
+		}
+		os.RemoveAll(d.dir)
+	}
+}
+
+// 测试 Plan 只列出变化而不修改目标目录
+func TestBackendPlan(t *testing.T) {
+	for name, b := range testBackends(t) {
+		d := setupBackendDirs(t, map[string]string{"new.txt": "new", "sub/file.txt": "file"}, map[string]string{"old.txt": "old"})
+		before := snapshot(t, d.target)
+		var lines []string
+		m := New(Options{
+			Source:  d.source,
+			Target:  d.target,
+			Args:    append(append([]string(nil), DefaultArgs...), "--itemize-changes"),
+			Backend: b,
+			OnEvent: func(e Event) {
+				if e.Kind == EventOutput {
+					lines = append(lines, e.Message)
+				}
+			},
+		})
+		if _, err := m.Plan(context.Background()); err != nil {
+			t.Fatalf("%s: 预览失败: %v", name, err)
+		}
+		if after := snapshot(t, d.target, LockFileName); strings.Join(after, "\n") != strings.Join(before, "\n") {
+			t.Errorf("%s: 预览不应当修改目标目录", name)
+		}
+		out := strings.Join(lines, "\n") + "\n"
+		for _, line := range []string{">f+++++++++ new.txt", "cd+++++++++ sub/", ">f+++++++++ sub/file.txt", "*deleting   old.txt"} {
+			if !strings.Contains(out, line+"\n") {
+				t.Errorf("%s: 预览输出中缺少 %q:\n%s", name, line, out)
+			}
+		}
+		os.RemoveAll(d.dir)
+	}
+}
+
+// 测试 ApplyPaths 只镜像列出的路径，并删除源目录中已经不存在的路径
+func TestBackendApplyPaths(t *testing.T) {
+	for name, b := range testBackends(t) {
+		d := setupBackendDirs(t,
+			map[string]string{"a/b/new.txt": "new", "a/b/keep.txt": "keep", "other.txt": "not listed"},
+			map[string]string{"a/b/keep.txt": "keep", "a/b/stale.txt": "stale", "removed.txt": "removed"})
+		args := append(append([]string(nil), DefaultArgs...), "--itemize-changes")
+		m := New(Options{Source: d.source, Target: d.target, Args: args, Backend: b})
+		if _, err := m.ApplyPaths(context.Background(), []string{"a/b", "removed.txt"}); err != nil {
+			t.Fatalf("%s: 镜像失败: %v", name, err)
+		}
+		for p, want := range map[string]bool{"a/b/new.txt": true, "a/b/keep.txt": true, "a/b/stale.txt": false, "removed.txt": false, "other.txt": false} {
+			if _, err := os.Stat(filepath.Join(d.target, filepath.FromSlash(p))); (err == nil) != want {
+				t.Errorf("%s: %s 存在=%v，期望 %v", name, p, err == nil, want)
+			}
+		}
+		os.RemoveAll(d.dir)
+	}
+}
+
+// 测试原生后端被取消时返回中断错误，并且不留下临时文件
+func TestNativeInterrupt(t *testing.T) {
+	d := setupBackendDirs(t, map[string]string{"big.bin": strings.Repeat("x", 1<<20), "small.txt": "small"}, nil)
+	defer os.RemoveAll(d.dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m := New(Options{Source: d.source, Target: d.target, Backend: NativeBackend{}})
+	if _, err := m.Apply(ctx); !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("期望中断错误，但得到 %v", err)
+	}
+	infos, _ := ioutil.ReadDir(d.target)
+	for _, info := range infos {
+		if _, ok := partialFileName(info.Name()); ok {
+			t.Errorf("不应当留下临时文件 %s", info.Name())
+		}
+	}
+}
+
+// 测试原生后端拒绝不支持的参数，并把失败报告为 ErrSyncFailed
+func TestNativeErrors(t *testing.T) {
+	d := setupBackendDirs(t, map[string]string{"a.txt": "a"}, nil)
+	defer os.RemoveAll(d.dir)
+	for _, args := range [][]string{{"-aH", "--compress"}, {"-az"}, {"-a", "--exclude-from=" + filepath.Join(d.dir, "missing")}} {
+		m := New(Options{Source: d.source, Target: d.target, Args: args, Backend: NativeBackend{}})
+		_, err := m.Apply(context.Background())
+		if !errors.Is(err, ErrSyncFailed) || errors.Is(err, ErrRsyncFailed) {
+			t.Errorf("%v: 期望 ErrSyncFailed，但得到 %v", args, err)
+		}
+	}
+	if !errors.Is(&RsyncError{Err: errors.New("exit status 23")}, ErrSyncFailed) {
+		t.Error("RsyncError 应当与 ErrSyncFailed 匹配")
+	}
+}
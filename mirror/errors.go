@@ -0,0 +1,78 @@
+package mirror
+
+import "errors"
+
+// 镜像操作返回的错误，可以用 errors.Is 判断错误类型
+var (
+	ErrSourceMissing   = errors.New(message("mirror.err.source_missing"))
+	ErrSourceEmpty     = errors.New(message("mirror.err.source_empty"))
+	ErrNestedPaths     = errors.New(message("mirror.err.nested_paths"))
+	ErrRemotePath      = errors.New(message("mirror.err.remote_path"))
+	ErrMarkerMissing   = errors.New(message("mirror.err.marker_missing"))
+	ErrMarkerStale     = errors.New(message("mirror.err.marker_stale"))
+	ErrMarkerInvalid   = errors.New(message("mirror.err.marker_invalid"))
+	ErrRuleFileMissing = errors.New(message("mirror.err.rule_file_missing"))
+	ErrRsyncFailed     = errors.New(message("mirror.err.rsync_failed"))
+	ErrSyncFailed      = errors.New(message("mirror.err.sync_failed"))
+	ErrInterrupted     = errors.New(message("mirror.err.interrupted"))
+)
+
+// kindError 是由消息 ID 和参数描述的错误，errors.Is 时与对应的错误类型匹配
+// kind 为 nil 时不与任何错误类型匹配
+type kindError struct {
+	kind error
+	id   string
+	args []interface{}
+}
+
+func (e *kindError) Error() string                      { return message(e.id, e.args...) }
+func (e *kindError) Unwrap() error                      { return e.kind }
+func (e *kindError) messageID() (string, []interface{}) { return e.id, e.args }
+
+// 创建带参数的错误
+func newError(kind error, id string, args ...interface{}) error {
+	return &kindError{kind: kind, id: id, args: args}
+}
+
+// RsyncError 描述 rsync 执行失败，Err 为底层错误（通常是 *exec.ExitError）
+// errors.Is(err, ErrRsyncFailed) 对它成立；ErrSyncFailed 表示任意后端的同步失败，对它也成立
+type RsyncError struct {
+	Err error
+}
+
+func (e *RsyncError) Error() string {
+	id, args := e.messageID()
+	return message(id, args...)
+}
+func (e *RsyncError) Unwrap() error { return e.Err }
+
+func (e *RsyncError) messageID() (string, []interface{}) {
+	return "mirror.err.rsync_failed_with", []interface{}{e.Err}
+}
+
+// Is 使 RsyncError 与 ErrRsyncFailed 和 ErrSyncFailed 匹配
+func (e *RsyncError) Is(target error) bool {
+	return target == ErrRsyncFailed || target == ErrSyncFailed
+}
+
+// interruptedError 描述因 ctx 取消而中断的运行
+// errors.Is 对 ErrInterrupted 以及 ctx 的错误（context.Canceled 等）都成立
+type interruptedError struct {
+	cause  error
+	killed bool // rsync 没有及时结束而被强制终止
+}
+
+func (e *interruptedError) Error() string {
+	id, args := e.messageID()
+	return message(id, args...)
+}
+
+func (e *interruptedError) messageID() (string, []interface{}) {
+	if e.killed {
+		return "mirror.err.interrupted_killed", nil
+	}
+	return "mirror.err.interrupted", nil
+}
+
+func (e *interruptedError) Unwrap() error        { return e.cause }
+func (e *interruptedError) Is(target error) bool { return target == ErrInterrupted }
@@ -0,0 +1,20 @@
+package mirror
+
+// EventKind 表示事件的类型
+type EventKind int
+
+const (
+	EventInfo    EventKind = iota // 普通的进度信息
+	EventNotice                   // 需要用户注意的信息
+	EventWarning                  // 不影响结果的问题
+	EventOutput                   // rsync 输出的一行
+)
+
+// Event 是镜像过程中产生的一条用户可见的消息
+// 除 EventOutput 外，ID 和 Args 是消息的 ID 和参数（见 MessageIDs），可以用来翻译 Message
+type Event struct {
+	Kind    EventKind
+	Message string
+	ID      string
+	Args    []interface{}
+}
@@ -0,0 +1,209 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// LockFileName 是目标目录中锁文件的名称，镜像时会被排除，不会被 rsync 删除
+const LockFileName = ".folder_mirror.lock"
+
+// ErrLocked 表示锁已被另一个进程持有
+var ErrLocked = errors.New(message("mirror.err.locked"))
+
+// flockExclusive 的结果：锁已被占用，或者文件系统不支持 flock
+var (
+	errWouldBlock = errors.New(message("mirror.err.would_block"))
+	errNoFlock    = errors.New(message("mirror.err.no_flock"))
+)
+
+// LockInfo 是写入锁文件的持有者信息
+type LockInfo struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+	Command string    `json:"command"`
+}
+
+func (i LockInfo) String() string {
+	if i.PID == 0 {
+		return message("mirror.lock_holder_unknown")
+	}
+	return message("mirror.lock_holder", i.PID, i.Host, i.Started.Format("2006-01-02 15:04:05"), i.Command)
+}
+
+// 当前进程的锁信息
+func currentLockInfo() LockInfo {
+	host, _ := os.Hostname()
+	return LockInfo{PID: os.Getpid(), Host: host, Started: time.Now(), Command: strings.Join(os.Args, " ")}
+}
+
+// 判断锁信息记录的进程是否仍在运行，其他主机上的进程无法检查，视为仍在运行
+func (i LockInfo) alive() bool {
+	host, _ := os.Hostname()
+	if i.Host != host {
+		return true
+	}
+	return i.PID == os.Getpid() || processAlive(i.PID)
+}
+
+// Running 判断锁文件记录的持有者是否仍在运行，没有记录持有者或持有者已经退出时为 false
+// 与 LockedError 一样，其他主机上的进程无法检查，视为仍在运行
+func (i LockInfo) Running() bool {
+	return i.PID != 0 && i.alive()
+}
+
+// LockedError 描述获取锁失败，Holder 为锁文件中记录的持有者
+// errors.Is(err, ErrLocked) 对它成立
+type LockedError struct {
+	Path   string
+	Holder LockInfo
+}
+
+func (e *LockedError) Error() string {
+	id, args := e.messageID()
+	return message(id, args...)
+}
+
+func (e *LockedError) messageID() (string, []interface{}) {
+	if e.Holder.PID != 0 && !e.Holder.alive() {
+		return "mirror.err.locked_by_dead", []interface{}{e.Path, e.Holder}
+	}
+	return "mirror.err.locked_by", []interface{}{e.Path, e.Holder}
+}
+
+// Is 使 LockedError 与 ErrLocked 匹配
+func (e *LockedError) Is(target error) bool { return target == ErrLocked }
+
+// Lock 是一个已获取的锁
+type Lock struct {
+	path string
+	file *os.File
+
+	// 获取锁时发现的遗留锁文件的持有者，没有时为 nil
+	Stale *LockInfo
+}
+
+// AcquireLock 获取锁文件上的排他锁，不等待
+// 使用 flock 加锁，进程退出时锁自动释放；文件系统不支持 flock 时，
+// 根据锁文件中记录的 PID 是否仍在运行判断锁是否有效
+// 锁文件不跟随符号链接，已存在的锁文件必须属于当前用户
+func AcquireLock(path string) (*Lock, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		f, err := securefile.OpenFile(path, os.O_RDWR)
+		if err != nil {
+			return nil, newError(err, "mirror.err.open_lock", err)
+		}
+		previous := readLockInfo(f)
+
+		switch err := flockExclusive(f); {
+		case err == errWouldBlock:
+			f.Close()
+			return nil, &LockedError{Path: path, Holder: previous}
+		case err == errNoFlock:
+			// 不支持 flock，只能依赖锁文件中记录的进程
+			if previous.PID != 0 && previous.alive() && previous.PID != os.Getpid() {
+				f.Close()
+				return nil, &LockedError{Path: path, Holder: previous}
+			}
+		case err != nil:
+			f.Close()
+			return nil, newError(err, "mirror.err.lock_failed", path, err)
+		}
+
+		// 加锁期间锁文件可能已被之前的持有者删除，此时锁住的是旧文件，需要重试
+		if !sameFile(f, path) {
+			f.Close()
+			continue
+		}
+
+		l := &Lock{path: path, file: f}
+		if previous.PID != 0 && previous.PID != os.Getpid() {
+			l.Stale = &previous
+		}
+		if err := writeLockInfo(f, currentLockInfo()); err != nil {
+			l.Release()
+			return nil, newError(err, "mirror.err.write_lock", err)
+		}
+		return l, nil
+	}
+	return nil, newError(nil, "mirror.err.lock_replaced", path)
+}
+
+// Release 删除锁文件并释放锁
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	// 先删除再关闭，关闭文件时 flock 自动释放
+	err := os.Remove(l.path)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// ReadLockInfo 读取锁文件中记录的持有者信息
+func ReadLockInfo(path string) (LockInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return LockInfo{}, err
+	}
+	defer f.Close()
+	return readLockInfo(f), nil
+}
+
+func readLockInfo(f *os.File) LockInfo {
+	var info LockInfo
+	if _, err := f.Seek(0, 0); err != nil {
+		return info
+	}
+	data, err := ioutil.ReadAll(f)
+	if err == nil {
+		json.Unmarshal(data, &info)
+	}
+	return info
+}
+
+func writeLockInfo(f *os.File, info LockInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(append(data, '\n'), 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// 判断已打开的文件是否仍是路径指向的文件
+func sameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi, pi)
+}
+
+// 目标目录的锁文件路径，远程目标目录不加锁
+func targetLockPath(target string) string {
+	if strings.Contains(target, ":") {
+		return ""
+	}
+	return filepath.Join(target, LockFileName)
+}
@@ -0,0 +1,128 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试锁的获取、冲突和释放
+func TestAcquireLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.lock")
+
+	l, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("获取锁失败: %v", err)
+	}
+	if l.Stale != nil {
+		t.Errorf("新建的锁不应当有遗留的持有者: %v", l.Stale)
+	}
+	info, err := ReadLockInfo(path)
+	if err != nil || info.PID != os.Getpid() || !info.Running() {
+		t.Errorf("锁文件应当记录当前进程，得到 %+v %v", info, err)
+	}
+
+	_, err = AcquireLock(path)
+	var locked *LockedError
+	if !errors.Is(err, ErrLocked) || !errors.As(err, &locked) {
+		t.Fatalf("锁被持有时期望 ErrLocked，但得到 %v", err)
+	}
+	if locked.Holder.PID != os.Getpid() || !strings.Contains(err.Error(), "PID") {
+		t.Errorf("错误信息应当指出锁的持有者: %v", err)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Errorf("释放锁失败: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("释放锁后应当删除锁文件")
+	}
+	l, err = AcquireLock(path)
+	if err != nil {
+		t.Fatalf("释放后重新获取锁失败: %v", err)
+	}
+	l.Release()
+}
+
+// 测试接管进程已退出而遗留的锁文件
+func TestAcquireStaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.lock")
+
+	// 用一个已经退出的进程的 PID 模拟遗留的锁文件
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("无法运行 true: %v", err)
+	}
+	host, _ := os.Hostname()
+	stale := LockInfo{PID: cmd.Process.Pid, Host: host, Started: time.Now().Add(-time.Hour), Command: "folder_mirror apply"}
+	data, _ := json.Marshal(stale)
+	ioutil.WriteFile(path, data, 0644)
+	if stale.alive() {
+		t.Skip("测试使用的 PID 已被复用")
+	}
+	if info, _ := ReadLockInfo(path); info.Running() {
+		t.Errorf("已经退出的持有者不应当被视为仍在运行: %+v", info)
+	}
+
+	l, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("应当接管遗留的锁文件，但得到 %v", err)
+	}
+	defer l.Release()
+	if l.Stale == nil || l.Stale.PID != stale.PID {
+		t.Errorf("应当报告遗留锁文件的持有者，得到 %v", l.Stale)
+	}
+	if info, _ := ReadLockInfo(path); info.PID != os.Getpid() {
+		t.Errorf("接管后锁文件应当记录当前进程，得到 %+v", info)
+	}
+}
+
+// 测试目标目录被锁定时不执行镜像
+func TestMirrorLocked(t *testing.T) {
+	dir, source, target := setupDirs(t)
+	defer os.RemoveAll(dir)
+	os.MkdirAll(target, 0755)
+
+	l, err := AcquireLock(filepath.Join(target, LockFileName))
+	if err != nil {
+		t.Fatalf("获取锁失败: %v", err)
+	}
+
+	var got []string
+	stateLock := filepath.Join(dir, "state.lock")
+	m := New(Options{Source: source, Target: target, LockFile: stateLock, Command: fakeCommand("exit 0", &got)})
+	if _, err := m.Plan(context.Background()); !errors.Is(err, ErrLocked) {
+		t.Errorf("目标目录被锁定时期望 ErrLocked，但得到 %v", err)
+	}
+	if got != nil {
+		t.Errorf("目标目录被锁定时不应当执行 rsync，但执行了 %v", got)
+	}
+	if _, err := os.Stat(stateLock); !os.IsNotExist(err) {
+		t.Error("获取目标目录锁失败后应当释放状态锁")
+	}
+
+	l.Release()
+	if _, err := m.Plan(context.Background()); err != nil {
+		t.Fatalf("释放锁后 Plan 失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, LockFileName)); !os.IsNotExist(err) {
+		t.Error("Plan 结束后应当释放目标目录的锁")
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+import (
+	"os"
+	"syscall"
+)
+
+// 以不等待的方式获取文件上的排他 flock
+func flockExclusive(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		switch err {
+		case nil:
+			return nil
+		case syscall.EINTR:
+			continue
+		case syscall.EWOULDBLOCK:
+			return errWouldBlock
+		case syscall.ENOLCK, syscall.EOPNOTSUPP, syscall.ENOSYS:
+			return errNoFlock
+		default:
+			return err
+		}
+	}
+}
+
+// 检查进程是否仍在运行，没有权限发送信号时进程也是存在的
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,23 @@
+package mirror
+
+import (
+	"os"
+)
+
+// Windows 上没有 flock，只能依赖锁文件中记录的进程
+func flockExclusive(f *os.File) error {
+	return errNoFlock
+}
+
+// 检查进程是否仍在运行
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,280 @@
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/your-username/folder_mirror/filter"
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// ManifestFileName 是目标目录中完整性清单的名称，镜像时会被排除，不会被 rsync 删除
+const ManifestFileName = ".folder_mirror.manifest"
+
+// 写入清单时使用的临时文件，写完后重命名为 ManifestFileName
+const manifestTempName = ManifestFileName + ".tmp"
+
+// 目标目录根部由 folder_mirror 自己维护的文件，镜像、校验和清单都不包括它们
+var stateFileNames = []string{LockFileName, ManifestFileName, manifestTempName, ScrubCheckpointName}
+
+// 判断目标目录根部的条目是否是 folder_mirror 自己的文件
+func isStateFile(name string) bool {
+	for _, n := range stateFileNames {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// ManifestEntry 是完整性清单中的一个文件
+type ManifestEntry struct {
+	Path   string    `json:"path"` // 相对于目标目录的路径，使用 / 分隔
+	Size   int64     `json:"size"`
+	Mtime  time.Time `json:"mtime"`
+	SHA256 string    `json:"sha256"`
+}
+
+// Manifest 记录目标目录中每个普通文件的大小、修改时间和内容的 SHA-256，按路径排序
+type Manifest struct {
+	Entries []ManifestEntry
+}
+
+// ManifestOptions 描述一次更新完整性清单的配置
+type ManifestOptions struct {
+	// 过滤规则，被排除的条目不记录；目标目录根部 folder_mirror 自己的文件总是不记录
+	Filter *filter.Filter
+	// 只重新检查这些相对路径及其中的条目，清单中的其余条目保持不变；为 nil 时检查整个目标目录
+	Paths []string
+}
+
+// ManifestResult 描述一次更新完整性清单的结果
+type ManifestResult struct {
+	Files   int   // 清单中的文件数
+	Hashed  int   // 重新计算 SHA-256 的文件数
+	Bytes   int64 // 重新计算 SHA-256 的字节数
+	Removed int   // 从清单中删除的文件数
+}
+
+// ReadManifest 读取目标目录中的完整性清单，清单不存在时返回 IsNotExist 错误
+func ReadManifest(target string) (*Manifest, error) {
+	name := filepath.Join(target, ManifestFileName)
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m := &Manifest{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, newError(nil, "mirror.err.manifest_invalid", name, line, err)
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, newError(nil, "mirror.err.manifest_invalid", name, 0, err)
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+	return m, nil
+}
+
+// 先写入临时文件再重命名，中途失败时原来的清单保持不变
+func writeManifest(target string, m *Manifest) error {
+	name := filepath.Join(target, ManifestFileName)
+	tmp := filepath.Join(target, manifestTempName)
+	// 上次写入中途崩溃时会留下临时文件，调用者持有目标目录的锁，不会有其他进程正在写入
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return newError(nil, "mirror.err.manifest_write", err)
+	}
+	file, err := securefile.Create(tmp)
+	if err != nil {
+		return newError(nil, "mirror.err.manifest_write", err)
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, e := range m.Entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return newError(nil, "mirror.err.manifest_write", err)
+	}
+	return nil
+}
+
+// UpdateManifest 遍历目标目录并更新其中的完整性清单。
+// 大小和修改时间与清单中的记录相同的文件沿用记录的 SHA-256，只有变化或新增的文件才重新读取，
+// 因此清单中的哈希是镜像写入时的内容，之后的静默损坏不会被更新掉，可以由 Scrub 发现。
+// 调用方应当持有目标目录的锁；ctx 取消时返回中断错误，原来的清单保持不变
+func UpdateManifest(ctx context.Context, target string, opts ManifestOptions) (*ManifestResult, error) {
+	if opts.Filter == nil {
+		opts.Filter = filter.New()
+	}
+	old, err := ReadManifest(target)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if old == nil {
+		old = &Manifest{}
+	}
+
+	u := &manifestUpdater{
+		ctx:    ctx,
+		target: target,
+		filter: opts.Filter,
+		old:    make(map[string]ManifestEntry, len(old.Entries)),
+		res:    &ManifestResult{},
+	}
+	for _, e := range old.Entries {
+		u.old[e.Path] = e
+	}
+
+	roots := opts.Paths
+	if roots == nil {
+		roots = []string{""}
+	}
+	for _, e := range old.Entries {
+		if !underAny(e.Path, roots) {
+			u.entries = append(u.entries, e)
+		}
+	}
+	for _, root := range roots {
+		if err := u.scan(strings.Trim(root, "/")); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(u.entries, func(i, j int) bool { return u.entries[i].Path < u.entries[j].Path })
+	kept := make(map[string]bool, len(u.entries))
+	for _, e := range u.entries {
+		kept[e.Path] = true
+	}
+	for p := range u.old {
+		if !kept[p] {
+			u.res.Removed++
+		}
+	}
+	u.res.Files = len(u.entries)
+	if err := writeManifest(target, &Manifest{Entries: u.entries}); err != nil {
+		return nil, err
+	}
+	return u.res, nil
+}
+
+// 判断路径是否是 roots 中的某个路径或位于其中，空路径表示整个目录
+func underAny(p string, roots []string) bool {
+	for _, root := range roots {
+		root = strings.Trim(root, "/")
+		if root == "" || p == root || strings.HasPrefix(p, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// 一次清单更新的状态
+type manifestUpdater struct {
+	ctx     context.Context
+	target  string
+	filter  *filter.Filter
+	old     map[string]ManifestEntry
+	entries []ManifestEntry
+	res     *ManifestResult
+}
+
+// 检查一个相对路径，目录递归检查，不存在的路径没有条目
+func (u *manifestUpdater) scan(rel string) error {
+	if rel == "" {
+		return u.scanDir(rel)
+	}
+	info, err := os.Lstat(filepath.Join(u.target, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return newError(err, "mirror.err.manifest_read", rel, err)
+	}
+	if info.IsDir() {
+		return u.scanDir(rel)
+	}
+	return u.addFile(rel, info)
+}
+
+func (u *manifestUpdater) scanDir(rel string) error {
+	infos, err := ioutil.ReadDir(filepath.Join(u.target, filepath.FromSlash(rel)))
+	if err != nil {
+		return newError(err, "mirror.err.manifest_read", rel, err)
+	}
+	for _, info := range infos {
+		if err := u.ctx.Err(); err != nil {
+			return &interruptedError{cause: err}
+		}
+		if rel == "" && isStateFile(info.Name()) {
+			continue
+		}
+		child := path.Join(rel, info.Name())
+		if idx := u.filter.Match(child, info.IsDir()); idx >= 0 && !u.filter.Rules[idx].Include {
+			continue
+		}
+		if info.IsDir() {
+			err = u.scanDir(child)
+		} else {
+			err = u.addFile(child, info)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 记录一个普通文件，大小和修改时间没有变化时沿用原来的哈希；符号链接等其他条目不记录
+func (u *manifestUpdater) addFile(rel string, info os.FileInfo) error {
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	e, ok := u.old[rel]
+	if !ok || e.Size != info.Size() || !e.Mtime.Equal(info.ModTime()) {
+		sum, err := HashFile(u.ctx, filepath.Join(u.target, filepath.FromSlash(rel)))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return hashError("mirror.err.manifest_read", rel, err)
+		}
+		e = ManifestEntry{Path: rel, Size: info.Size(), Mtime: info.ModTime(), SHA256: sum}
+		u.res.Hashed++
+		u.res.Bytes += info.Size()
+	}
+	u.entries = append(u.entries, e)
+	return nil
+}
@@ -0,0 +1,140 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 列出清单中的路径
+func manifestPaths(t *testing.T, target string) string {
+	m, err := ReadManifest(target)
+	if err != nil {
+		t.Fatalf("读取清单失败: %v", err)
+	}
+	var paths []string
+	for _, e := range m.Entries {
+		paths = append(paths, e.Path)
+	}
+	return strings.Join(paths, " ")
+}
+
+// 测试完整性清单只记录被镜像的普通文件，并且只重新计算变化的文件的哈希
+func TestUpdateManifest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用符号链接")
+	}
+	d := setupBackendDirs(t, nil, map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "beta",
+		"cache.tmp": "excluded",
+		"link":      "->a.txt",
+		"empty/":    "",
+	})
+	defer os.RemoveAll(d.dir)
+	ioutil.WriteFile(filepath.Join(d.target, LockFileName), []byte("lock"), 0644)
+	opts := ManifestOptions{Filter: filter.New([]filter.Rule{filter.NewRule("*.tmp", false)})}
+	update := func(opts ManifestOptions) *ManifestResult {
+		t.Helper()
+		res, err := UpdateManifest(context.Background(), d.target, opts)
+		if err != nil {
+			t.Fatalf("更新清单失败: %v", err)
+		}
+		return res
+	}
+
+	if res := update(opts); res.Files != 2 || res.Hashed != 2 || res.Bytes != 9 {
+		t.Errorf("第一次更新的结果不正确: %+v", res)
+	}
+	if got := manifestPaths(t, d.target); got != "a.txt sub/b.txt" {
+		t.Errorf("清单中的文件为 %q", got)
+	}
+	m, _ := ReadManifest(d.target)
+	if e := m.Entries[0]; e.Size != 5 || !e.Mtime.Equal(treeTime) || e.SHA256 != "8ed3f6ad685b959ead7022518e1af76cd816f8e8ec7ccdda1ed4018e8f2223f8" {
+		t.Errorf("a.txt 的记录不正确: %+v", e)
+	}
+	if res := update(opts); res.Hashed != 0 || res.Files != 2 {
+		t.Errorf("没有变化时不应重新计算哈希: %+v", res)
+	}
+
+	// 修改、删除和新增文件
+	ioutil.WriteFile(filepath.Join(d.target, "sub", "b.txt"), []byte("beta 2"), 0644)
+	os.Remove(filepath.Join(d.target, "a.txt"))
+	ioutil.WriteFile(filepath.Join(d.target, "c.txt"), []byte("gamma"), 0644)
+	if res := update(opts); res.Files != 2 || res.Hashed != 2 || res.Removed != 1 {
+		t.Errorf("变化后的更新结果不正确: %+v", res)
+	}
+
+	// 大小和修改时间没有变化的损坏不会更新记录的哈希
+	info, _ := os.Stat(filepath.Join(d.target, "c.txt"))
+	ioutil.WriteFile(filepath.Join(d.target, "c.txt"), []byte("GAMMA"), 0644)
+	os.Chtimes(filepath.Join(d.target, "c.txt"), info.ModTime(), info.ModTime())
+	before, _ := ReadManifest(d.target)
+	if res := update(opts); res.Hashed != 0 {
+		t.Errorf("大小和修改时间没有变化时不应重新计算哈希: %+v", res)
+	}
+	after, _ := ReadManifest(d.target)
+	if before.Entries[0] != after.Entries[0] {
+		t.Errorf("损坏的文件的记录不应改变: %+v", after.Entries[0])
+	}
+
+	// 只更新指定的路径
+	ioutil.WriteFile(filepath.Join(d.target, "sub", "d.txt"), []byte("delta"), 0644)
+	ioutil.WriteFile(filepath.Join(d.target, "e.txt"), []byte("epsilon"), 0644)
+	opts.Paths = []string{"sub", "gone.txt"}
+	if res := update(opts); res.Hashed != 1 || res.Files != 3 {
+		t.Errorf("只更新指定路径的结果不正确: %+v", res)
+	}
+	if got := manifestPaths(t, d.target); got != "c.txt sub/b.txt sub/d.txt" {
+		t.Errorf("只更新指定路径后清单中的文件为 %q", got)
+	}
+}
+
+// 测试更新清单在 ctx 取消时中断，原来的清单保持不变
+func TestUpdateManifestInterrupt(t *testing.T) {
+	d := setupBackendDirs(t, nil, map[string]string{"a.txt": "a"})
+	defer os.RemoveAll(d.dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := UpdateManifest(ctx, d.target, ManifestOptions{}); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("期望中断错误，得到 %v", err)
+	}
+	if _, err := ReadManifest(d.target); !os.IsNotExist(err) {
+		t.Errorf("中断时不应写入清单: %v", err)
+	}
+}
+
+// 测试上次写入中断留下的临时文件不影响更新清单
+func TestUpdateManifestStaleTemp(t *testing.T) {
+	d := setupBackendDirs(t, nil, map[string]string{"a.txt": "a"})
+	defer os.RemoveAll(d.dir)
+	tmp := filepath.Join(d.target, manifestTempName)
+	if err := ioutil.WriteFile(tmp, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateManifest(context.Background(), d.target, ManifestOptions{}); err != nil {
+		t.Fatalf("存在残留的临时文件时更新清单失败: %v", err)
+	}
+	if got := manifestPaths(t, d.target); got != "a.txt" {
+		t.Errorf("清单中的文件为 %q", got)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("临时文件应当被替换: %v", err)
+	}
+}
+
+// 测试读取无效的清单
+func TestReadManifestInvalid(t *testing.T) {
+	d := setupBackendDirs(t, nil, map[string]string{ManifestFileName: `{"path":"a","size":1}` + "\nnot json\n"})
+	defer os.RemoveAll(d.dir)
+	if _, err := ReadManifest(d.target); err == nil || !strings.Contains(err.Error(), "第 2 行") {
+		t.Errorf("期望指出无效的行，得到 %v", err)
+	}
+}
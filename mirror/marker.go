@@ -0,0 +1,52 @@
+package mirror
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// DefaultMarkerTimeout 是标记文件的默认有效期
+const DefaultMarkerTimeout = time.Hour
+
+// CreateMarker 创建标记文件，内容为当前的 Unix 时间戳
+// 文件权限为 0600，已存在的符号链接或其他用户的文件会被拒绝
+func CreateMarker(path string) error {
+	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	return securefile.WriteFile(path, []byte(timestamp))
+}
+
+// MarkerTime 读取标记文件的创建时间
+func MarkerTime(path string) (time.Time, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	timestamp, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return time.Time{}, newError(ErrMarkerInvalid, "mirror.err.marker_invalid_at", err)
+	}
+	return time.Unix(timestamp, 0), nil
+}
+
+// CheckMarker 检查标记文件是否存在并且没有超过有效期
+func CheckMarker(path string, timeout time.Duration) error {
+	created, err := MarkerTime(path)
+	if os.IsNotExist(err) {
+		return ErrMarkerMissing
+	}
+	if err != nil {
+		return err
+	}
+
+	age := int64(time.Since(created) / time.Second)
+	if max := int64(timeout / time.Second); age > max {
+		return newError(ErrMarkerStale, "mirror.err.marker_stale_age", age, max)
+	}
+	return nil
+}
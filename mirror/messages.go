@@ -0,0 +1,140 @@
+package mirror
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 事件和错误的消息，键为稳定的消息 ID，值为默认的中文格式
+// 调用方可以根据 Event.ID/Event.Args 以及 ErrorMessage 返回的 ID 和参数翻译消息
+var messages = map[string]string{
+	"mirror.source_dir":          "源目录: %s",
+	"mirror.target_dir":          "目标目录: %s",
+	"mirror.create_target":       "目标目录不存在，尝试创建...",
+	"mirror.release_lock_failed": "无法释放锁: %v",
+	"mirror.stale_lock":          "接管了遗留的锁文件 %s (%s)",
+	"mirror.dry_run":             "在DRY-RUN模式下运行。不会进行实际更改。",
+	"mirror.log_file":            "结果将保存到: %s",
+	"mirror.plan_start":          "执行文件夹镜像模拟...",
+	"mirror.plan_done_marker":    "模拟操作完成。标记文件已创建: %s",
+	"mirror.plan_done":           "模拟操作完成。",
+	"mirror.apply_start":         "执行实际文件夹镜像操作...",
+	"mirror.apply_done":          "实际文件夹镜像操作成功完成!",
+	"mirror.remove_marker":       "无法删除标记文件: %v",
+	"mirror.cleanup_failed":      "清理 rsync 临时文件失败: %v",
+	"mirror.partial_removed":     "已删除 %d 个 rsync 遗留的临时文件",
+	"mirror.lock_holder":         "PID %d，主机 %s，开始于 %s，命令 %s",
+	"mirror.lock_holder_unknown": "持有者未知",
+	"mirror.native_entry_failed": "无法同步 %s: %v",
+	"mirror.native_skip_special": "跳过不是普通文件的条目: %s",
+	"mirror.native_not_empty":    "无法删除非空目录: %s",
+
+	"mirror.err.source_missing":     "源目录不存在",
+	"mirror.err.source_missing_at":  "源目录不存在: %s",
+	"mirror.err.source_empty":       "源目录为空，不执行镜像操作",
+	"mirror.err.nested_paths":       "源目录和目标目录相同或互为子目录，操作危险，终止执行",
+	"mirror.err.remote_path":        "不支持远程路径",
+	"mirror.err.remote_create":      "不支持创建远程目录，请使用本地文件系统路径: %s",
+	"mirror.err.remote_empty_check": "不支持检查远程目录是否为空，请使用本地文件系统路径: %s",
+	"mirror.err.remote_source":      "不支持远程源目录路径，请使用本地文件系统路径: %s",
+	"mirror.err.remote_target":      "不支持远程目标目录路径，请使用本地文件系统路径: %s",
+	"mirror.err.marker_missing":     "找不到标记文件。请先运行 plan 命令（或使用 --dry-run 参数）生成标记文件",
+	"mirror.err.marker_stale":       "标记文件太旧",
+	"mirror.err.marker_stale_age":   "标记文件太旧 (%d 秒, 最大 %d)",
+	"mirror.err.marker_invalid":     "无法解析标记文件时间戳",
+	"mirror.err.marker_invalid_at":  "无法解析标记文件时间戳: %v",
+	"mirror.err.rule_file_missing":  "排除规则文件不存在",
+	"mirror.err.rule_file_at":       "排除规则文件不存在: %s",
+	"mirror.err.rsync_failed":       "执行rsync失败",
+	"mirror.err.rsync_failed_with":  "执行rsync失败: %v",
+	"mirror.err.sync_failed":        "同步失败",
+	"mirror.err.native_arg":         "原生后端不支持这个 rsync 参数: %s",
+	"mirror.err.native_rules":       "无法读取规则文件 %s: %v",
+	"mirror.err.native_failed":      "原生同步失败: %v",
+	"mirror.err.native_partial":     "原生同步失败: %d 个条目无法同步",
+	"mirror.err.shard_plan":         "无法划分分片: %v",
+	"mirror.err.verify_read":        "校验时无法读取 %s: %v",
+	"mirror.err.manifest_read":      "更新完整性清单时无法读取 %s: %v",
+	"mirror.err.manifest_write":     "无法写入完整性清单: %v",
+	"mirror.err.manifest_invalid":   "无法解析完整性清单 %s 的第 %d 行: %v",
+	"mirror.err.checkpoint_invalid": "无法解析 scrub 检查点 %s: %v",
+	"mirror.err.interrupted":        "镜像被中断",
+	"mirror.err.interrupted_killed": "镜像被中断，rsync 已被强制终止",
+	"mirror.err.locked":             "已被另一个 folder_mirror 进程锁定",
+	"mirror.err.locked_by":          "%s 已被另一个 folder_mirror 进程锁定 (%s)",
+	"mirror.err.locked_by_dead":     "%s 已被另一个 folder_mirror 进程锁定 (%s)；记录的进程已不存在，锁可能被它的子进程继承",
+	"mirror.err.check_empty":        "无法检查源目录是否为空: %v",
+	"mirror.err.create_target":      "创建目标目录失败: %v",
+	"mirror.err.create_log":         "创建日志文件失败: %v",
+	"mirror.err.files_from":         "无法写入要镜像的路径列表: %v",
+	"mirror.err.create_marker":      "创建标记文件失败: %v",
+	"mirror.err.abs_source":         "无法获取源目录绝对路径: %v",
+	"mirror.err.abs_target":         "无法获取目标目录绝对路径: %v",
+	"mirror.err.stat_source":        "无法获取源目录信息: %v",
+	"mirror.err.stat_target":        "无法获取目标目录信息: %v",
+	"mirror.err.eval_source":        "无法解析源目录符号链接: %v",
+	"mirror.err.eval_target":        "无法解析目标目录符号链接: %v",
+	"mirror.err.open_lock":          "无法打开锁文件: %v",
+	"mirror.err.lock_failed":        "无法锁定 %s: %v",
+	"mirror.err.write_lock":         "无法写入锁文件: %v",
+	"mirror.err.lock_replaced":      "无法锁定 %s: 锁文件不断被替换",
+	"mirror.err.would_block":        "锁已被占用",
+	"mirror.err.no_flock":           "文件系统不支持 flock",
+}
+
+// 按消息 ID 生成默认的中文消息
+func message(id string, args ...interface{}) string {
+	if len(args) == 0 {
+		return messages[id]
+	}
+	return fmt.Sprintf(messages[id], args...)
+}
+
+// MessageIDs 返回所有事件和错误的消息 ID，按名称排序
+func MessageIDs() []string {
+	ids := make([]string, 0, len(messages))
+	for id := range messages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// MessageFormat 返回消息 ID 对应的默认中文格式，参数的顺序与 Event.Args 相同
+func MessageFormat(id string) string {
+	return messages[id]
+}
+
+// translatable 由可以按消息 ID 翻译的错误实现
+type translatable interface {
+	messageID() (string, []interface{})
+}
+
+// 错误类型对应的消息 ID
+var sentinelMessages = map[error]string{
+	ErrSourceMissing:   "mirror.err.source_missing",
+	ErrSourceEmpty:     "mirror.err.source_empty",
+	ErrNestedPaths:     "mirror.err.nested_paths",
+	ErrRemotePath:      "mirror.err.remote_path",
+	ErrMarkerMissing:   "mirror.err.marker_missing",
+	ErrMarkerStale:     "mirror.err.marker_stale",
+	ErrMarkerInvalid:   "mirror.err.marker_invalid",
+	ErrRuleFileMissing: "mirror.err.rule_file_missing",
+	ErrRsyncFailed:     "mirror.err.rsync_failed",
+	ErrSyncFailed:      "mirror.err.sync_failed",
+	ErrInterrupted:     "mirror.err.interrupted",
+	ErrLocked:          "mirror.err.locked",
+	errWouldBlock:      "mirror.err.would_block",
+	errNoFlock:         "mirror.err.no_flock",
+}
+
+// ErrorMessage 返回本包创建的错误的消息 ID 和参数，用于翻译错误信息
+// 只描述 err 本身，不展开包装；不是本包创建的错误时 ok 为 false
+func ErrorMessage(err error) (id string, args []interface{}, ok bool) {
+	if t, isT := err.(translatable); isT {
+		id, args = t.messageID()
+		return id, args, true
+	}
+	id, ok = sentinelMessages[err]
+	return id, nil, ok
+}
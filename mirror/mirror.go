@@ -0,0 +1,340 @@
+// Package mirror 使用 rsync 或内置的原生后端把一个目录镜像到另一个目录
+//
+// 镜像分为两步：Plan 以 dry-run 方式运行同步并创建标记文件，
+// Apply 在标记文件有效时执行实际的镜像。所有失败都以错误返回，
+// 用户可见的消息通过 Options.OnEvent 回调输出。
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// Options 描述一次镜像的配置
+type Options struct {
+	Source string // 源目录
+	Target string // 目标目录，不存在时自动创建
+
+	// rsync 参数（不含源目录和目标目录），通常由 RsyncArgs 生成
+	// 为空时使用 DefaultArgs
+	Args []string
+
+	// 标记文件路径，为空时 Plan 不创建标记文件，Apply 也不检查
+	MarkerFile string
+	// 标记文件有效期，为 0 时使用 DefaultMarkerTimeout
+	MarkerTimeout time.Duration
+
+	// Plan 保存 rsync 输出的日志文件，为空时不保存
+	LogFile string
+
+	// 保护标记文件和日志等状态的锁文件，为空时只锁定目标目录
+	LockFile string
+
+	// 不为 nil 时 Apply 在检查标记文件之后先以 dry-run 方式运行同一次同步，把输出的每一行交给 CheckPlan，
+	// 返回错误时 Apply 终止并返回该错误；预览与镜像在同一次锁定期间进行
+	CheckPlan func(lines []string) error
+	// Apply 在获取锁并检查标记文件之后、运行 rsync 之前调用，返回错误时 Apply 终止并返回该错误
+	BeforeApply func() error
+	// Apply 同步成功并删除标记文件之后、释放锁之前调用，paths 为 ApplyPaths 的路径，Apply 时为 nil
+	// 返回错误时 Apply 返回该错误；用于在锁定目标目录期间更新目标目录中的状态
+	AfterApply func(ctx context.Context, paths []string) error
+
+	// 执行同步的后端，为空时使用由下面三项配置的 RsyncBackend
+	Backend Backend
+	// 取消后等待 rsync 结束当前文件的时间，为 0 时使用 DefaultGracePeriod
+	GracePeriod time.Duration
+	// 关闭时不再等待，立即强制终止已被取消的 rsync
+	ForceStop <-chan struct{}
+	// 创建命令的函数，为空时使用 exec.Command
+	Command func(name string, arg ...string) *exec.Cmd
+
+	// 接收事件的回调，为空时丢弃事件
+	OnEvent func(Event)
+	// Apply 时同步的标准输出和所有运行中同步的标准错误，为空时丢弃
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Result 描述一次 Plan 或 Apply 的结果
+type Result struct {
+	Args     []string // 执行的 rsync 参数，包含源目录和目标目录
+	LogFile  string   // 保存 rsync 输出的日志文件，没有保存时为空
+	Duration time.Duration
+}
+
+// Mirror 执行一个源目录到目标目录的镜像
+type Mirror struct {
+	opts Options
+}
+
+// New 根据配置创建 Mirror，源目录和目标目录会补上结尾的斜杠
+func New(opts Options) *Mirror {
+	opts.Source = withTrailingSlash(opts.Source)
+	opts.Target = withTrailingSlash(opts.Target)
+	if opts.Args == nil {
+		opts.Args = DefaultArgs
+	}
+	if opts.MarkerTimeout == 0 {
+		opts.MarkerTimeout = DefaultMarkerTimeout
+	}
+	if opts.Backend == nil {
+		opts.Backend = &RsyncBackend{Command: opts.Command, GracePeriod: opts.GracePeriod, ForceStop: opts.ForceStop}
+	}
+	if opts.OnEvent == nil {
+		opts.OnEvent = func(Event) {}
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = ioutil.Discard
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = ioutil.Discard
+	}
+	return &Mirror{opts: opts}
+}
+
+// Source 返回规范化后的源目录
+func (m *Mirror) Source() string { return m.opts.Source }
+
+// Target 返回规范化后的目标目录
+func (m *Mirror) Target() string { return m.opts.Target }
+
+// 发出由消息 ID 描述的事件
+func (m *Mirror) emit(kind EventKind, id string, args ...interface{}) {
+	m.opts.OnEvent(Event{Kind: kind, Message: message(id, args...), ID: id, Args: args})
+}
+
+// 生成完整的 rsync 参数
+// 目标目录中的锁文件、完整性清单和 scrub 检查点排在所有规则之前排除，rsync 不会复制或删除它们
+func (m *Mirror) rsyncArgs(extra ...string) []string {
+	var args []string
+	for _, name := range stateFileNames {
+		args = append(args, "--exclude=/"+name)
+	}
+	args = append(args, m.opts.Args...)
+	args = append(args, extra...)
+	return append(args, m.opts.Source, m.opts.Target)
+}
+
+// Validate 检查源目录和目标目录，目标目录不存在时创建
+func (m *Mirror) Validate() error {
+	source, target := m.opts.Source, m.opts.Target
+	m.emit(EventInfo, "mirror.source_dir", source)
+	m.emit(EventInfo, "mirror.target_dir", target)
+
+	if !DirExists(source) {
+		return newError(ErrSourceMissing, "mirror.err.source_missing_at", source)
+	}
+
+	// 空源目录会清空目标目录
+	isEmpty, err := IsDirEmpty(source)
+	if err != nil {
+		return newError(err, "mirror.err.check_empty", err)
+	}
+	if isEmpty {
+		return ErrSourceEmpty
+	}
+
+	isSameOrNested, err := CheckDirSameOrNested(source, target)
+	if err != nil {
+		return err
+	}
+	if isSameOrNested {
+		return ErrNestedPaths
+	}
+
+	if !DirExists(target) {
+		m.emit(EventNotice, "mirror.create_target")
+		if err := CreateDir(target); err != nil {
+			return newError(err, "mirror.err.create_target", err)
+		}
+	}
+	return nil
+}
+
+// 依次锁定状态锁文件和目标目录，防止多个进程同时镜像到同一个目标
+// 返回的函数按相反顺序释放锁
+func (m *Mirror) lock() (func(), error) {
+	var locks []*Lock
+	release := func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			if err := locks[i].Release(); err != nil {
+				m.emit(EventWarning, "mirror.release_lock_failed", err)
+			}
+		}
+	}
+	for _, path := range []string{m.opts.LockFile, targetLockPath(m.opts.Target)} {
+		if path == "" {
+			continue
+		}
+		l, err := AcquireLock(path)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if l.Stale != nil {
+			m.emit(EventNotice, "mirror.stale_lock", path, l.Stale)
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
+
+// Plan 以 dry-run 方式运行同步，输出将要进行的更改并创建标记文件
+// 同步的每一行输出作为 EventOutput 事件发出，同时写入日志文件
+func (m *Mirror) Plan(ctx context.Context) (*Result, error) {
+	start := time.Now()
+	m.emit(EventNotice, "mirror.dry_run")
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	release, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	res := &Result{Args: m.rsyncArgs("-n", "-v")}
+
+	var logFile *os.File
+	if m.opts.LogFile != "" {
+		logFile, err = securefile.Create(m.opts.LogFile)
+		if err != nil {
+			return nil, newError(err, "mirror.err.create_log", err)
+		}
+		defer logFile.Close()
+		res.LogFile = m.opts.LogFile
+		m.emit(EventInfo, "mirror.log_file", m.opts.LogFile)
+	}
+
+	m.emit(EventInfo, "mirror.plan_start")
+	// 同步的每一行输出都发出事件并同时写入日志文件
+	out := &lineWriter{fn: func(line string) {
+		m.opts.OnEvent(Event{Kind: EventOutput, Message: line})
+		if logFile != nil {
+			io.WriteString(logFile, line+"\n")
+		}
+	}}
+	err = runBackend(ctx, m.opts.Backend, res.Args, out, m.opts.Stderr)
+	out.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	if m.opts.MarkerFile != "" {
+		if err := CreateMarker(m.opts.MarkerFile); err != nil {
+			return nil, newError(err, "mirror.err.create_marker", err)
+		}
+		m.emit(EventInfo, "mirror.plan_done_marker", m.opts.MarkerFile)
+	} else {
+		m.emit(EventInfo, "mirror.plan_done")
+	}
+	res.Duration = time.Since(start)
+	return res, nil
+}
+
+// Apply 在标记文件有效时执行实际的镜像，成功后删除标记文件
+func (m *Mirror) Apply(ctx context.Context) (*Result, error) {
+	return m.apply(ctx, nil)
+}
+
+// ApplyPaths 与 Apply 相同，但只镜像 paths 列出的路径（相对于源目录，使用 / 分隔）
+// 目录会递归镜像并删除目标中多余的文件，源目录中已经不存在的路径会从目标目录删除
+func (m *Mirror) ApplyPaths(ctx context.Context, paths []string) (*Result, error) {
+	list, err := writeFileList(paths)
+	if err != nil {
+		return nil, newError(err, "mirror.err.files_from", err)
+	}
+	defer os.Remove(list)
+	// --files-from 会关闭 -a 隐含的 -r，需要重新打开
+	return m.apply(ctx, paths, "--files-from="+list, "--from0", "-r", "--delete-missing-args")
+}
+
+func (m *Mirror) apply(ctx context.Context, paths []string, extra ...string) (*Result, error) {
+	start := time.Now()
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	release, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if m.opts.MarkerFile != "" {
+		if err := CheckMarker(m.opts.MarkerFile, m.opts.MarkerTimeout); err != nil {
+			return nil, err
+		}
+	}
+	if m.opts.CheckPlan != nil {
+		if err := m.checkPlan(ctx, extra); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.opts.BeforeApply != nil {
+		if err := m.opts.BeforeApply(); err != nil {
+			return nil, err
+		}
+	}
+
+	m.emit(EventInfo, "mirror.apply_start")
+	res := &Result{Args: m.rsyncArgs(extra...)}
+	if err := runBackend(ctx, m.opts.Backend, res.Args, m.opts.Stdout, m.opts.Stderr); err != nil {
+		if errors.Is(err, ErrInterrupted) {
+			m.cleanupInterrupted(err)
+		}
+		return nil, err
+	}
+	m.emit(EventInfo, "mirror.apply_done")
+
+	if m.opts.MarkerFile != "" {
+		if err := os.Remove(m.opts.MarkerFile); err != nil {
+			m.emit(EventWarning, "mirror.remove_marker", err)
+		}
+	}
+	if m.opts.AfterApply != nil {
+		if err := m.opts.AfterApply(ctx, paths); err != nil {
+			return nil, err
+		}
+	}
+	res.Duration = time.Since(start)
+	return res, nil
+}
+
+// 以 dry-run 方式运行 Apply 将要执行的同步，把输出交给 CheckPlan 检查
+func (m *Mirror) checkPlan(ctx context.Context, extra []string) error {
+	var lines []string
+	out := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+	err := runBackend(ctx, m.opts.Backend, m.rsyncArgs(append([]string{"-n"}, extra...)...), out, m.opts.Stderr)
+	out.flush()
+	if err != nil {
+		return err
+	}
+	return m.opts.CheckPlan(lines)
+}
+
+// 中断后的清理：删除标记文件，使下次 apply 之前必须重新运行 plan；
+// rsync 被强制终止时还要删除它遗留在目标目录中的临时文件
+func (m *Mirror) cleanupInterrupted(err error) {
+	if m.opts.MarkerFile != "" {
+		if err := os.Remove(m.opts.MarkerFile); err != nil && !os.IsNotExist(err) {
+			m.emit(EventWarning, "mirror.remove_marker", err)
+		}
+	}
+	var ie *interruptedError
+	if !errors.As(err, &ie) || !ie.killed {
+		return
+	}
+	removed, cleanupErr := RemovePartialFiles(m.opts.Source, m.opts.Target)
+	if cleanupErr != nil {
+		m.emit(EventWarning, "mirror.cleanup_failed", cleanupErr)
+	}
+	if len(removed) > 0 {
+		m.emit(EventNotice, "mirror.partial_removed", len(removed))
+	}
+}
@@ -0,0 +1,423 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 创建包含一个文件的源目录和空的目标目录
+func setupDirs(t *testing.T) (string, string, string) {
+	dir, err := ioutil.TempDir("", "mirror_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	source := filepath.Join(dir, "source")
+	target := filepath.Join(dir, "target")
+	os.MkdirAll(source, 0755)
+	ioutil.WriteFile(filepath.Join(source, "file.txt"), []byte("content"), 0644)
+	return dir, source, target
+}
+
+// 返回执行指定 shell 脚本的命令函数，并记录收到的 rsync 参数
+func fakeCommand(script string, got *[]string) func(string, ...string) *exec.Cmd {
+	return func(name string, args ...string) *exec.Cmd {
+		*got = append([]string{name}, args...)
+		return exec.Command("sh", "-c", script)
+	}
+}
+
+// 测试源目录和目标目录的检查
+func TestValidate(t *testing.T) {
+	dir, source, target := setupDirs(t)
+	defer os.RemoveAll(dir)
+	emptyDir := filepath.Join(dir, "empty")
+	os.MkdirAll(emptyDir, 0755)
+
+	testCases := []struct {
+		name           string
+		source, target string
+		want           error
+	}{
+		{"正常", source, target, nil},
+		{"源目录不存在", filepath.Join(dir, "missing"), target, ErrSourceMissing},
+		{"源目录为空", emptyDir, target, ErrSourceEmpty},
+		{"相同目录", source, source, ErrNestedPaths},
+		{"目标在源目录中", source, filepath.Join(source, "sub"), ErrNestedPaths},
+		{"远程源目录", "host:/src", target, ErrRemotePath},
+		{"远程目标目录", source, "host:/dst", ErrRemotePath},
+	}
+	for _, tc := range testCases {
+		err := New(Options{Source: tc.source, Target: tc.target}).Validate()
+		if tc.want == nil && err != nil {
+			t.Errorf("%s: 期望没有错误，但得到 %v", tc.name, err)
+		}
+		if tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: 期望错误 %v，但得到 %v", tc.name, tc.want, err)
+		}
+	}
+	if !DirExists(target) {
+		t.Error("检查通过后应当创建目标目录")
+	}
+}
+
+// 测试 Plan 执行 dry-run、保存日志并创建标记文件
+func TestPlan(t *testing.T) {
+	dir, source, target := setupDirs(t)
+	defer os.RemoveAll(dir)
+
+	var got []string
+	var output []string
+	m := New(Options{
+		Source:     source,
+		Target:     target,
+		Args:       []string{"-a"},
+		MarkerFile: filepath.Join(dir, "marker"),
+		LogFile:    filepath.Join(dir, "plan.log"),
+		Command:    fakeCommand("printf 'file.txt\\nsub/\\n'", &got),
+		OnEvent: func(e Event) {
+			if e.Kind == EventOutput {
+				output = append(output, e.Message)
+			}
+		},
+	})
+	res, err := m.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Plan 失败: %v", err)
+	}
+
+	expected := []string{"rsync", "--exclude=/" + LockFileName, "--exclude=/" + ManifestFileName, "--exclude=/" + manifestTempName, "--exclude=/" + ScrubCheckpointName,
+		"-a", "-n", "-v", source + "/", target + "/"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("期望 rsync 参数 %v，但得到 %v", expected, got)
+	}
+	if !reflect.DeepEqual(res.Args, expected[1:]) {
+		t.Errorf("结果中的参数不正确: %v", res.Args)
+	}
+	if !reflect.DeepEqual(output, []string{"file.txt", "sub/"}) {
+		t.Errorf("输出事件不正确: %v", output)
+	}
+	if data, _ := ioutil.ReadFile(res.LogFile); string(data) != "file.txt\nsub/\n" {
+		t.Errorf("日志文件内容不正确: %q", data)
+	}
+	if err := CheckMarker(filepath.Join(dir, "marker"), time.Minute); err != nil {
+		t.Errorf("Plan 之后标记文件应当有效: %v", err)
+	}
+}
+
+// 测试 Apply 对标记文件的要求以及成功后删除标记文件
+func TestApply(t *testing.T) {
+	dir, source, target := setupDirs(t)
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "marker")
+
+	var got []string
+	opts := Options{Source: source, Target: target, MarkerFile: marker, Command: fakeCommand("exit 0", &got)}
+
+	if _, err := New(opts).Apply(context.Background()); !errors.Is(err, ErrMarkerMissing) {
+		t.Errorf("没有标记文件时期望 ErrMarkerMissing，但得到 %v", err)
+	}
+	if got != nil {
+		t.Errorf("没有标记文件时不应当执行 rsync，但执行了 %v", got)
+	}
+
+	ioutil.WriteFile(marker, []byte(fmt.Sprintf("%d", time.Now().Add(-2*time.Hour).Unix())), 0644)
+	if _, err := New(opts).Apply(context.Background()); !errors.Is(err, ErrMarkerStale) {
+		t.Errorf("标记文件过期时期望 ErrMarkerStale，但得到 %v", err)
+	}
+
+	ioutil.WriteFile(marker, []byte("garbage"), 0644)
+	if _, err := New(opts).Apply(context.Background()); !errors.Is(err, ErrMarkerInvalid) {
+		t.Errorf("标记文件无效时期望 ErrMarkerInvalid，但得到 %v", err)
+	}
+
+	CreateMarker(marker)
+	if _, err := New(opts).Apply(context.Background()); err != nil {
+		t.Fatalf("Apply 失败: %v", err)
+	}
+	if got[0] != "rsync" || got[len(got)-1] != target+"/" {
+		t.Errorf("rsync 参数不正确: %v", got)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Apply 成功后应当删除标记文件")
+	}
+}
+
+// 测试只镜像指定的路径
+func TestApplyPaths(t *testing.T) {
+	dir, source, target := setupDirs(t)
+	defer os.RemoveAll(dir)
+
+	var got []string
+	var listed string
+	command := func(name string, args ...string) *exec.Cmd {
+		got = append([]string{name}, args...)
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "--files-from=") {
+				data, _ := ioutil.ReadFile(strings.TrimPrefix(arg, "--files-from="))
+				listed = string(data)
+			}
+		}
+		return exec.Command("sh", "-c", "exit 0")
+	}
+	var after []string
+	afterApply := func(ctx context.Context, paths []string) error {
+		after = paths
+		// 回调期间目标目录仍然被锁定
+		if l, err := AcquireLock(targetLockPath(target)); err == nil {
+			l.Release()
+			t.Error("AfterApply 期间目标目录应当仍然被锁定")
+		}
+		return nil
+	}
+	m := New(Options{Source: source, Target: target, Command: command, AfterApply: afterApply})
+	if _, err := m.ApplyPaths(context.Background(), []string{"file.txt", "dir with space/new.txt"}); err != nil {
+		t.Fatalf("ApplyPaths 失败: %v", err)
+	}
+	if !reflect.DeepEqual(after, []string{"file.txt", "dir with space/new.txt"}) {
+		t.Errorf("AfterApply 收到的路径错误: %v", after)
+	}
+	if listed != "file.txt\x00dir with space/new.txt\x00" {
+		t.Errorf("路径列表错误: %q", listed)
+	}
+	args := strings.Join(got, " ")
+	for _, want := range []string{" --from0 ", " -r ", " --delete-missing-args "} {
+		if !strings.Contains(args, want) {
+			t.Errorf("rsync 参数中缺少 %q: %v", want, got)
+		}
+	}
+	if got[len(got)-2] != source+"/" || got[len(got)-1] != target+"/" {
+		t.Errorf("rsync 参数不正确: %v", got)
+	}
+
+	// 与 Apply 一样检查源目录
+	os.Remove(filepath.Join(source, "file.txt"))
+	if _, err := m.ApplyPaths(context.Background(), []string{"file.txt"}); !errors.Is(err, ErrSourceEmpty) {
+		t.Errorf("源目录为空时期望 ErrSourceEmpty，但得到 %v", err)
+	}
+}
+
+// 测试 Apply 之前的预览检查
+func TestCheckPlan(t *testing.T) {
+	dir, source, target := setupDirs(t)
+	defer os.RemoveAll(dir)
+
+	var calls [][]string
+	command := func(name string, args ...string) *exec.Cmd {
+		calls = append(calls, args)
+		return exec.Command("sh", "-c", "echo '*deleting   old.txt'")
+	}
+	var checked []string
+	limit := errors.New("too many")
+	opts := Options{Source: source, Target: target, Command: command, CheckPlan: func(lines []string) error {
+		checked = lines
+		return limit
+	}}
+	if _, err := New(opts).ApplyPaths(context.Background(), []string{"old.txt"}); err != limit {
+		t.Errorf("预览检查失败时期望返回它的错误，但得到 %v", err)
+	}
+	if len(calls) != 1 || !strings.Contains(strings.Join(calls[0], " "), " -n --files-from=") {
+		t.Errorf("预览检查失败时应当只以 dry-run 方式运行一次: %v", calls)
+	}
+	if !reflect.DeepEqual(checked, []string{"*deleting   old.txt"}) {
+		t.Errorf("预览的输出不正确: %q", checked)
+	}
+
+	calls = nil
+	opts.CheckPlan = func([]string) error { return nil }
+	if _, err := New(opts).Apply(context.Background()); err != nil {
+		t.Fatalf("Apply 失败: %v", err)
+	}
+	if len(calls) != 2 || calls[0][len(calls[0])-3] != "-n" || calls[1][len(calls[1])-3] == "-n" {
+		t.Errorf("应当先预览再镜像: %v", calls)
+	}
+}
+
+// 测试 rsync 失败和取消时返回的错误
+func TestRsyncErrors(t *testing.T) {
+	dir, source, target := setupDirs(t)
+	defer os.RemoveAll(dir)
+
+	var got []string
+	m := New(Options{Source: source, Target: target, Command: fakeCommand("exit 23", &got)})
+	_, err := m.Apply(context.Background())
+	if !errors.Is(err, ErrRsyncFailed) {
+		t.Fatalf("期望 ErrRsyncFailed，但得到 %v", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 23 {
+		t.Errorf("应当能取得 rsync 的退出码 23，得到 %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "执行rsync失败") {
+		t.Errorf("错误信息不正确: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	m = New(Options{Source: source, Target: target, Command: fakeCommand("exec sleep 10", &got)})
+	start := time.Now()
+	if _, err := m.Plan(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("取消后期望 context.DeadlineExceeded，但得到 %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("取消后 rsync 应当被终止")
+	}
+}
+
+// 测试根据规则文件生成 rsync 参数
+func TestRsyncArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rsync_args_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	exclude := filepath.Join(dir, "exclude")
+	preset := filepath.Join(dir, "preset")
+	include := filepath.Join(dir, "include")
+	for _, f := range []string{exclude, preset, include} {
+		ioutil.WriteFile(f, []byte("*.tmp\n"), 0644)
+	}
+
+	args, err := RsyncArgs([]string{exclude, preset}, include)
+	if err != nil {
+		t.Fatalf("生成参数失败: %v", err)
+	}
+	expected := append(append([]string(nil), DefaultArgs...), "--exclude-from="+exclude, "--exclude-from="+preset, "--include-from="+include)
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("期望 %v，但得到 %v", expected, args)
+	}
+
+	args, _ = RsyncArgs([]string{exclude}, filepath.Join(dir, "missing"))
+	if strings.Contains(strings.Join(args, " "), "--include-from") {
+		t.Errorf("包含规则文件不存在时不应当添加 --include-from: %v", args)
+	}
+	if _, err := RsyncArgs([]string{filepath.Join(dir, "missing")}, ""); !errors.Is(err, ErrRuleFileMissing) {
+		t.Errorf("排除规则文件不存在时期望 ErrRuleFileMissing，但得到 %v", err)
+	}
+}
+
+// 测试取消时 rsync 收到中断信号后正常退出，以及不响应时被强制终止
+func TestInterrupt(t *testing.T) {
+	dir, source, target := setupDirs(t)
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "marker")
+	partial := filepath.Join(target, ".file.txt.Ab12Cd")
+	unrelated := filepath.Join(target, ".other.abcdef")
+
+	testCases := []struct {
+		name   string
+		script string
+		grace  time.Duration
+		force  bool
+		killed bool
+	}{
+		{"响应中断信号", "trap 'kill $!; exit 20' INT; sleep 10 & wait", time.Minute, false, false},
+		{"超时后强制终止", "trap '' INT; sleep 10 & wait", 100 * time.Millisecond, false, true},
+		{"再次中断时强制终止", "trap '' INT; sleep 10 & wait", time.Minute, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		os.MkdirAll(target, 0755)
+		ioutil.WriteFile(partial, []byte("partial"), 0644)
+		ioutil.WriteFile(unrelated, []byte("keep"), 0644)
+		CreateMarker(marker)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		force := make(chan struct{})
+		var got []string
+		m := New(Options{
+			Source:      source,
+			Target:      target,
+			MarkerFile:  marker,
+			GracePeriod: tc.grace,
+			ForceStop:   force,
+			Command:     fakeCommand(tc.script, &got),
+		})
+		time.AfterFunc(100*time.Millisecond, func() {
+			cancel()
+			if tc.force {
+				time.AfterFunc(100*time.Millisecond, func() { close(force) })
+			}
+		})
+
+		start := time.Now()
+		_, err := m.Apply(ctx)
+		cancel()
+		if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: 期望中断错误，但得到 %v", tc.name, err)
+		}
+		if killed := strings.Contains(err.Error(), "强制终止"); killed != tc.killed {
+			t.Errorf("%s: 期望强制终止=%v，但错误为 %v", tc.name, tc.killed, err)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%s: 中断后等待时间过长", tc.name)
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Errorf("%s: 中断后应当删除标记文件", tc.name)
+		}
+		if _, err := os.Stat(partial); os.IsNotExist(err) == !tc.killed {
+			t.Errorf("%s: 临时文件的清理不正确，强制终止=%v", tc.name, tc.killed)
+		}
+		if _, err := os.Stat(unrelated); err != nil {
+			t.Errorf("%s: 不应当删除与源目录无关的文件", tc.name)
+		}
+	}
+}
+
+// 测试 rsync 临时文件名的识别
+func TestPartialFileName(t *testing.T) {
+	testCases := []struct {
+		name string
+		orig string
+		ok   bool
+	}{
+		{".file.txt.Ab12Cd", "file.txt", true},
+		{".a.xY9z0Q", "a", true},
+		{".file.txt.Ab12C", "", false},
+		{"file.txt.Ab12Cd", "", false},
+		{".file.txt.Ab-2Cd", "", false},
+		{"..Ab12Cd", "", false},
+	}
+	for _, tc := range testCases {
+		orig, ok := partialFileName(tc.name)
+		if orig != tc.orig || ok != tc.ok {
+			t.Errorf("partialFileName(%q) = %q, %v，期望 %q, %v", tc.name, orig, ok, tc.orig, tc.ok)
+		}
+	}
+}
+
+// 测试错误的消息 ID 和参数与 Error() 一致
+func TestErrorMessage(t *testing.T) {
+	testCases := []struct {
+		err error
+		id  string
+	}{
+		{ErrMarkerMissing, "mirror.err.marker_missing"},
+		{newError(ErrMarkerStale, "mirror.err.marker_stale_age", int64(7200), int64(3600)), "mirror.err.marker_stale_age"},
+		{&RsyncError{Err: errors.New("exit status 23")}, "mirror.err.rsync_failed_with"},
+		{&interruptedError{killed: true}, "mirror.err.interrupted_killed"},
+		{&LockedError{Path: "/x.lock"}, "mirror.err.locked_by"},
+	}
+	for _, tc := range testCases {
+		id, args, ok := ErrorMessage(tc.err)
+		if !ok || id != tc.id {
+			t.Errorf("%v: 期望消息 %s，但得到 %s (ok=%v)", tc.err, tc.id, id, ok)
+			continue
+		}
+		if got := message(id, args...); got != tc.err.Error() {
+			t.Errorf("%s: 消息 %q 与 Error() %q 不一致", id, got, tc.err.Error())
+		}
+	}
+
+	if _, _, ok := ErrorMessage(errors.New("其他错误")); ok {
+		t.Error("其他错误不应有消息 ID")
+	}
+}
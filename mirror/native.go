@@ -0,0 +1,801 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// NativeBackend 是不依赖外部程序的本地同步后端，用 Go 实现镜像用到的 rsync 功能：
+// 按大小和修改时间（--checksum 时按内容）比较文件，通过临时文件和重命名更新文件，
+// 删除目标目录中多余的文件，并保留权限、修改时间、符号链接和硬链接。
+//
+// 只支持本地目录和 folder_mirror 使用的 rsync 参数，遇到其他参数时返回错误。
+// 以 root 运行时还会保留属主和属组；设备文件、FIFO 和套接字会被跳过
+type NativeBackend struct{}
+
+// 原生后端的设置，由 rsync 格式的参数解析得到
+type nativeOptions struct {
+	source, target string
+	filter         *filter.Filter
+	archive        bool // -a：递归，保留符号链接、权限、修改时间和属主
+	recursive      bool // -r
+	hardLinks      bool // -H
+	dryRun         bool // -n
+	checksum       bool // -c：按内容而不是大小和修改时间判断文件是否需要更新
+	delete         bool // --delete-during：删除目标目录中多余的条目
+	itemize        bool // --itemize-changes
+	verbose        bool // -v
+	filesFrom      string
+	from0          bool
+	deleteMissing  bool // --delete-missing-args：删除列表中源目录已经不存在的路径
+}
+
+// 解析 rsync 格式的参数，最后两个参数为源目录和目标目录
+// 过滤规则按参数中出现的顺序生效，与 rsync 一致
+func parseNativeArgs(args []string) (*nativeOptions, error) {
+	if len(args) < 2 {
+		return nil, newError(ErrSyncFailed, "mirror.err.native_arg", strings.Join(args, " "))
+	}
+	o := &nativeOptions{source: args[len(args)-2], target: args[len(args)-1]}
+	var ruleSets [][]filter.Rule
+	for _, arg := range args[:len(args)-2] {
+		name, value := arg, ""
+		if i := strings.IndexByte(arg, '='); i >= 0 && strings.HasPrefix(arg, "--") {
+			name, value = arg[:i], arg[i+1:]
+		}
+		switch name {
+		case "--force", "--progress":
+			// 原生后端总是可以删除非空目录，也不输出传输进度
+		case "--delete", "--delete-during":
+			o.delete = true
+		case "--itemize-changes":
+			o.itemize = true
+		case "--archive":
+			o.archive = true
+		case "--recursive":
+			o.recursive = true
+		case "--hard-links":
+			o.hardLinks = true
+		case "--dry-run":
+			o.dryRun = true
+		case "--checksum":
+			o.checksum = true
+		case "--verbose":
+			o.verbose = true
+		case "--files-from":
+			o.filesFrom = value
+		case "--from0":
+			o.from0 = true
+		case "--delete-missing-args":
+			o.deleteMissing = true
+		case "--exclude", "--include", "--exclude-from", "--include-from":
+			rules, _, err := filterArg(name, value)
+			if err != nil {
+				return nil, err
+			}
+			ruleSets = append(ruleSets, rules)
+		default:
+			if !strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "--") || len(arg) == 1 {
+				return nil, newError(ErrSyncFailed, "mirror.err.native_arg", arg)
+			}
+			for _, c := range arg[1:] {
+				switch c {
+				case 'a':
+					o.archive = true
+				case 'r':
+					o.recursive = true
+				case 'H':
+					o.hardLinks = true
+				case 'n':
+					o.dryRun = true
+				case 'c':
+					o.checksum = true
+				case 'v':
+					o.verbose = true
+				default:
+					return nil, newError(ErrSyncFailed, "mirror.err.native_arg", arg)
+				}
+			}
+		}
+	}
+	// 与 rsync 一样，--files-from 不再隐含 -a 中的 -r
+	if o.archive && o.filesFrom == "" {
+		o.recursive = true
+	}
+	o.filter = filter.New(ruleSets...)
+	return o, nil
+}
+
+// 把 rsync 的一个过滤参数解析为规则，name 不是过滤参数时返回 false
+func filterArg(name, value string) ([]filter.Rule, bool, error) {
+	switch name {
+	case "--exclude", "--include":
+		return []filter.Rule{filter.NewRule(value, name == "--include")}, true, nil
+	case "--exclude-from", "--include-from":
+		rules, err := filter.ReadFile(value, name == "--include-from")
+		if err != nil {
+			return nil, true, newError(ErrSyncFailed, "mirror.err.native_rules", value, err)
+		}
+		return rules, true, nil
+	}
+	return nil, false, nil
+}
+
+// 硬链接的源文件由设备号和 inode 标识
+type fileKey struct {
+	dev, ino uint64
+}
+
+// 一次原生同步的状态
+type nativeSync struct {
+	ctx    context.Context
+	opts   *nativeOptions
+	out    io.Writer
+	errOut io.Writer
+	owner  bool // 保留属主和属组，只有 root 才能做到
+
+	links    map[fileKey]string // 有多个链接的源文件第一次出现时的相对路径
+	replaced map[string]bool    // 本次同步中重新写入的文件
+	dirs     []nativeDir        // 内容同步完成后才设置属性的目录，按进入的顺序排列
+	failed   int                // 失败的条目数
+}
+
+// nativeDir 是等待设置属性的目录
+type nativeDir struct {
+	rel  string
+	info os.FileInfo
+}
+
+// Run 按 rsync 参数把源目录同步到目标目录
+// 单个条目失败时继续同步其余条目，最后返回 ErrSyncFailed；ctx 取消时在当前文件之后停止
+func (NativeBackend) Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	opts, err := parseNativeArgs(args)
+	if err != nil {
+		return err
+	}
+	s := &nativeSync{
+		ctx:      ctx,
+		opts:     opts,
+		out:      stdout,
+		errOut:   stderr,
+		owner:    opts.archive && os.Geteuid() == 0,
+		links:    make(map[fileKey]string),
+		replaced: make(map[string]bool),
+	}
+	if opts.filesFrom != "" {
+		err = s.syncList()
+	} else {
+		err = s.syncRoot()
+	}
+	if err != nil {
+		return err
+	}
+	if s.failed > 0 {
+		return newError(ErrSyncFailed, "mirror.err.native_partial", s.failed)
+	}
+	return nil
+}
+
+// 源目录和目标目录中相对路径对应的文件路径
+func (s *nativeSync) sourcePath(rel string) string {
+	return filepath.Join(s.opts.source, filepath.FromSlash(rel))
+}
+
+func (s *nativeSync) targetPath(rel string) string {
+	return filepath.Join(s.opts.target, filepath.FromSlash(rel))
+}
+
+// 判断路径是否被过滤规则排除，上级目录已经在遍历时检查过
+func (s *nativeSync) excluded(rel string, isDir bool) bool {
+	idx := s.opts.filter.Match(rel, isDir)
+	return idx >= 0 && !s.opts.filter.Rules[idx].Include
+}
+
+// 按 rsync 的格式输出一个变化：--itemize-changes 时输出变化代码和名称，-v 时只输出名称
+func (s *nativeSync) item(code, name string) {
+	switch {
+	case s.opts.itemize:
+		fmt.Fprintf(s.out, "%-11s %s\n", code, name)
+	case !s.opts.verbose || code[0] == '.':
+	case code == "*deleting":
+		fmt.Fprintf(s.out, "deleting %s\n", name)
+	default:
+		fmt.Fprintln(s.out, name)
+	}
+}
+
+// 记录一个失败的条目并继续
+func (s *nativeSync) fail(rel string, err error) {
+	s.failed++
+	fmt.Fprintln(s.errOut, message("mirror.native_entry_failed", displayName(rel, false), err))
+}
+
+// 输出中使用的名称：目录带结尾的斜杠，传输根目录为 ./
+func displayName(rel string, isDir bool) string {
+	switch {
+	case rel == "":
+		return "./"
+	case isDir:
+		return rel + "/"
+	default:
+		return rel
+	}
+}
+
+// 获取目标条目的信息，不存在时返回 nil
+// dry-run 时上级目录可能仍然是将被替换的文件，这时同样视为不存在
+func (s *nativeSync) targetInfo(rel string) (os.FileInfo, error) {
+	info, err := os.Lstat(s.targetPath(rel))
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+		return nil, nil
+	}
+	return info, err
+}
+
+// 同步整个源目录
+func (s *nativeSync) syncRoot() error {
+	info, err := os.Stat(s.opts.source)
+	if err != nil {
+		return newError(ErrSyncFailed, "mirror.err.native_failed", err)
+	}
+	if err := s.syncDir("", info, s.opts.recursive); err != nil {
+		return err
+	}
+	s.finishDirs()
+	return nil
+}
+
+// 只同步 --files-from 列出的路径，列出的目录在 -r 时递归同步
+// 缺少的上级目录会一起创建；--delete-missing-args 时删除源目录中已经不存在的路径
+func (s *nativeSync) syncList() error {
+	data, err := ioutil.ReadFile(s.opts.filesFrom)
+	if err != nil {
+		return newError(ErrSyncFailed, "mirror.err.native_failed", err)
+	}
+	sep := "\n"
+	if s.opts.from0 {
+		sep = "\x00"
+	}
+	seen := make(map[string]bool)
+	for _, p := range strings.Split(string(data), sep) {
+		p = strings.TrimSuffix(p, "\r")
+		if p == "" {
+			continue
+		}
+		rel := strings.TrimPrefix(path.Clean("/"+p), "/")
+		if rel == "" || seen[rel] {
+			continue
+		}
+		seen[rel] = true
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.syncListed(rel); err != nil {
+			return err
+		}
+	}
+	s.finishDirs()
+	return nil
+}
+
+// 同步列表中的一个路径
+func (s *nativeSync) syncListed(rel string) error {
+	info, err := os.Lstat(s.sourcePath(rel))
+	if os.IsNotExist(err) {
+		if !s.opts.deleteMissing {
+			s.fail(rel, err)
+			return nil
+		}
+		tinfo, err := s.targetInfo(rel)
+		if err != nil {
+			s.fail(rel, err)
+			return nil
+		}
+		if tinfo == nil || !s.opts.filter.Decide(rel, tinfo.IsDir()).Included {
+			return nil
+		}
+		s.remove(rel, tinfo)
+		return nil
+	}
+	if err != nil {
+		s.fail(rel, err)
+		return nil
+	}
+	if !s.opts.filter.Decide(rel, info.IsDir()).Included {
+		return nil
+	}
+
+	// 与 rsync 的 --relative 一样创建上级目录，并复制它们的属性
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		parent := strings.Join(parts[:i], "/")
+		pinfo, err := os.Stat(s.sourcePath(parent))
+		if err != nil {
+			s.fail(parent, err)
+			return nil
+		}
+		if err := s.syncDir(parent, pinfo, false); err != nil {
+			return err
+		}
+	}
+	return s.syncEntry(rel, info)
+}
+
+// 按类型同步一个源条目
+func (s *nativeSync) syncEntry(rel string, info os.FileInfo) error {
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		return s.syncDir(rel, info, s.opts.recursive)
+	case mode.IsRegular():
+		return s.syncFile(rel, info)
+	case mode&os.ModeSymlink != 0 && s.opts.archive:
+		s.syncLink(rel)
+	default:
+		fmt.Fprintln(s.errOut, message("mirror.native_skip_special", rel))
+	}
+	return nil
+}
+
+// 同步一个目录，recurse 为 true 时同步其中的内容
+// 目录的权限和修改时间在全部内容同步之后才设置，否则写入内容会再次改变修改时间
+func (s *nativeSync) syncDir(rel string, info os.FileInfo, recurse bool) error {
+	dst := s.targetPath(rel)
+	tinfo, err := s.targetInfo(rel)
+	if err != nil {
+		s.fail(rel, err)
+		return nil
+	}
+	if tinfo != nil && !tinfo.IsDir() {
+		if !s.remove(rel, tinfo) {
+			return nil
+		}
+		tinfo = nil
+	}
+
+	exists := tinfo != nil
+	if !exists {
+		s.item("cd+++++++++", displayName(rel, true))
+		if !s.opts.dryRun {
+			if err := os.Mkdir(dst, 0700); err != nil {
+				s.fail(rel, err)
+				return nil
+			}
+		}
+	} else {
+		if flags := s.attrFlags(info, tinfo); flags != "........." {
+			s.item(".d"+flags, displayName(rel, true))
+		}
+		// 暂时允许写入只读的目录，最后再恢复源目录的权限
+		if !s.opts.dryRun && tinfo.Mode().Perm()&0700 != 0700 {
+			os.Chmod(dst, tinfo.Mode().Perm()|0700)
+		}
+	}
+	if !s.opts.dryRun {
+		s.dirs = append(s.dirs, nativeDir{rel: rel, info: info})
+	}
+	if !recurse {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(s.sourcePath(rel))
+	if err != nil {
+		s.fail(rel, err)
+		return nil
+	}
+	var included []os.FileInfo
+	names := make(map[string]bool)
+	for _, e := range entries {
+		childRel := path.Join(rel, e.Name())
+		if s.excluded(childRel, e.IsDir()) {
+			continue
+		}
+		included = append(included, e)
+		names[e.Name()] = true
+	}
+
+	// 与 --delete-during 一样，先删除这个目录中多余的条目，再同步内容
+	if s.opts.delete && exists {
+		existing, err := ioutil.ReadDir(dst)
+		if err != nil {
+			s.fail(rel, err)
+			return nil
+		}
+		for _, e := range existing {
+			childRel := path.Join(rel, e.Name())
+			if names[e.Name()] || s.excluded(childRel, e.IsDir()) {
+				continue
+			}
+			s.remove(childRel, e)
+		}
+	}
+
+	for _, e := range included {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.syncEntry(path.Join(rel, e.Name()), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按相反的顺序设置目录的属性，子目录先于上级目录
+func (s *nativeSync) finishDirs() {
+	for i := len(s.dirs) - 1; i >= 0; i-- {
+		d := s.dirs[i]
+		if err := s.setAttrs(s.targetPath(d.rel), d.info); err != nil {
+			s.fail(d.rel, err)
+		}
+	}
+	s.dirs = nil
+}
+
+// 同步一个普通文件
+func (s *nativeSync) syncFile(rel string, info os.FileInfo) error {
+	dst := s.targetPath(rel)
+	tinfo, err := s.targetInfo(rel)
+	if err != nil {
+		s.fail(rel, err)
+		return nil
+	}
+	if tinfo != nil && !tinfo.Mode().IsRegular() {
+		if !s.remove(rel, tinfo) {
+			return nil
+		}
+		tinfo = nil
+	}
+
+	if s.opts.hardLinks {
+		if key, ok := hardLinkKey(info); ok {
+			if first, seen := s.links[key]; seen {
+				s.syncHardLink(rel, first, info, tinfo)
+				return nil
+			}
+			s.links[key] = rel
+		}
+	}
+
+	if tinfo == nil {
+		s.item(">f+++++++++", rel)
+		return s.copyFile(rel, info)
+	}
+	differs := info.Size() != tinfo.Size()
+	if s.opts.checksum && !differs {
+		same, err := s.sameContent(s.sourcePath(rel), dst)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return s.ctx.Err()
+			}
+			s.fail(rel, err)
+			return nil
+		}
+		differs = !same
+	} else if !s.opts.checksum {
+		differs = differs || !sameTime(info, tinfo)
+	}
+
+	flags := s.attrFlags(info, tinfo)
+	if differs {
+		if s.opts.checksum {
+			flags = "c" + flags[1:]
+		}
+		s.item(">f"+flags, rel)
+		return s.copyFile(rel, info)
+	}
+	if flags != "........." {
+		s.item(".f"+flags, rel)
+		if !s.opts.dryRun {
+			if err := s.setAttrs(dst, info); err != nil {
+				s.fail(rel, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 把源文件复制到临时文件，设置属性后重命名为目标文件
+// ctx 取消时删除临时文件并返回 ctx 的错误
+func (s *nativeSync) copyFile(rel string, info os.FileInfo) error {
+	s.replaced[rel] = true
+	if s.opts.dryRun {
+		return nil
+	}
+	dst := s.targetPath(rel)
+	in, err := os.Open(s.sourcePath(rel))
+	if err != nil {
+		s.fail(rel, err)
+		return nil
+	}
+	defer in.Close()
+	tmp, err := createTempFile(dst)
+	if err != nil {
+		s.fail(rel, err)
+		return nil
+	}
+	err = s.copyData(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.setAttrs(tmp.Name(), info)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		if s.ctx.Err() != nil {
+			return s.ctx.Err()
+		}
+		s.fail(rel, err)
+	}
+	return nil
+}
+
+// 分块复制数据，每块之间检查 ctx
+func (s *nativeSync) copyData(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 256*1024)
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 逐块比较两个文件的内容
+func (s *nativeSync) sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	bufA, bufB := make([]byte, 256*1024), make([]byte, 256*1024)
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return false, err
+		}
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !endA {
+			return false, errA
+		}
+		if errB != nil && !endB {
+			return false, errB
+		}
+		if endA || endB {
+			return endA == endB, nil
+		}
+	}
+}
+
+// 同步一个符号链接，链接内容原样复制
+func (s *nativeSync) syncLink(rel string) {
+	dst := s.targetPath(rel)
+	link, err := os.Readlink(s.sourcePath(rel))
+	if err != nil {
+		s.fail(rel, err)
+		return
+	}
+	code := "cL+++++++++"
+	tinfo, err := s.targetInfo(rel)
+	if err != nil {
+		s.fail(rel, err)
+		return
+	}
+	if tinfo != nil {
+		if tinfo.Mode()&os.ModeSymlink != 0 {
+			if old, err := os.Readlink(dst); err == nil && old == link {
+				return
+			}
+			code = "cLc........"
+		} else if tinfo.IsDir() && !s.remove(rel, tinfo) {
+			return
+		}
+	}
+	s.item(code, rel+" -> "+link)
+	if s.opts.dryRun {
+		return
+	}
+	err = withTempName(dst, func(tmp string) error { return os.Symlink(link, tmp) })
+	if err != nil {
+		s.fail(rel, err)
+	}
+}
+
+// 把已经同步的 first 的硬链接同步为 rel，目标中两者已经是同一个文件时不做任何事
+func (s *nativeSync) syncHardLink(rel, first string, info, tinfo os.FileInfo) {
+	firstDst := s.targetPath(first)
+	code := "hf+++++++++"
+	if tinfo != nil {
+		if finfo, err := os.Lstat(firstDst); err == nil && !s.replaced[first] && os.SameFile(finfo, tinfo) {
+			return
+		}
+		code = "hf" + s.attrFlags(info, tinfo)
+	}
+	s.item(code, rel+" => "+first)
+	s.replaced[rel] = true
+	if s.opts.dryRun {
+		return
+	}
+	err := withTempName(s.targetPath(rel), func(tmp string) error { return os.Link(firstDst, tmp) })
+	if err != nil {
+		s.fail(rel, err)
+	}
+}
+
+// 删除目标目录中的一个条目，目录会递归删除，返回是否已经删除
+// 目录中被排除的内容受到保护，这时目录本身也无法删除，与 rsync 一致
+func (s *nativeSync) remove(rel string, info os.FileInfo) bool {
+	dst := s.targetPath(rel)
+	if info.IsDir() {
+		entries, err := ioutil.ReadDir(dst)
+		if err != nil {
+			s.fail(rel, err)
+			return false
+		}
+		kept := false
+		for _, e := range entries {
+			childRel := path.Join(rel, e.Name())
+			if s.excluded(childRel, e.IsDir()) || !s.remove(childRel, e) {
+				kept = true
+			}
+		}
+		if kept {
+			fmt.Fprintln(s.errOut, message("mirror.native_not_empty", displayName(rel, true)))
+			return false
+		}
+	}
+	s.item("*deleting", displayName(rel, info.IsDir()))
+	if s.opts.dryRun {
+		return true
+	}
+	if err := os.Remove(dst); err != nil {
+		s.fail(rel, err)
+		return false
+	}
+	return true
+}
+
+// 比较源条目和目标条目的属性，返回 rsync 格式的 9 个属性字符
+// 依次为内容、大小、修改时间、权限、属主、属组和三个不使用的位置
+func (s *nativeSync) attrFlags(info, tinfo os.FileInfo) string {
+	flags := []byte(".........")
+	if info.Mode().IsRegular() && info.Size() != tinfo.Size() {
+		flags[1] = 's'
+	}
+	if s.opts.archive && !sameTime(info, tinfo) {
+		flags[2] = 't'
+	}
+	if s.opts.archive && permBits(info.Mode()) != permBits(tinfo.Mode()) {
+		flags[3] = 'p'
+	}
+	if s.owner {
+		uid, gid, ok := fileOwner(info)
+		tuid, tgid, tok := fileOwner(tinfo)
+		if ok && tok && uid != tuid {
+			flags[4] = 'o'
+		}
+		if ok && tok && gid != tgid {
+			flags[5] = 'g'
+		}
+	}
+	return string(flags)
+}
+
+// 设置目标文件或目录的属主、权限和修改时间
+// 先设置属主，因为修改属主会清除 setuid 位
+func (s *nativeSync) setAttrs(path string, info os.FileInfo) error {
+	if !s.opts.archive {
+		return nil
+	}
+	if s.owner {
+		if uid, gid, ok := fileOwner(info); ok {
+			if err := os.Lchown(path, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Chmod(path, permBits(info.Mode())); err != nil {
+		return err
+	}
+	return os.Chtimes(path, time.Now(), info.ModTime())
+}
+
+// 权限位，包括 setuid、setgid 和 sticky
+func permBits(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// 按秒比较修改时间，与 rsync 默认的比较精度一致
+func sameTime(a, b os.FileInfo) bool {
+	return a.ModTime().Unix() == b.ModTime().Unix()
+}
+
+// 创建与 rsync 同样格式的临时文件 ".原文件名.XXXXXX"，
+// 被中断后遗留的临时文件同样可以由 RemovePartialFiles 清理
+func createTempFile(dst string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name, err := tempName(dst)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// 在临时名称上创建条目后重命名为 dst，替换已有的条目
+func withTempName(dst string, create func(tmp string) error) error {
+	for i := 0; ; i++ {
+		tmp, err := tempName(dst)
+		if err != nil {
+			return err
+		}
+		err = create(tmp)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	}
+}
+
+// 生成 dst 所在目录中的随机临时文件名
+func tempName(dst string) (string, error) {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = chars[int(b[i])%len(chars)]
+	}
+	dir, name := filepath.Split(dst)
+	return filepath.Join(dir, "."+name+"."+string(b)), nil
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+import (
+	"os"
+	"syscall"
+)
+
+// 返回有多个链接的普通文件的设备号和 inode，只有一个链接的文件不需要检查硬链接
+func hardLinkKey(info os.FileInfo) (fileKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// 返回文件的属主和属组
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
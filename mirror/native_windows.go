@@ -0,0 +1,13 @@
+package mirror
+
+import "os"
+
+// Windows 上不检查硬链接
+func hardLinkKey(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
+
+// Windows 上没有属主和属组
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,59 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 判断文件名是否为 rsync 传输时使用的临时文件名，返回对应的原文件名
+// rsync 的临时文件名为 ".原文件名.XXXXXX"，XXXXXX 为 6 个随机字母或数字
+func partialFileName(name string) (string, bool) {
+	if len(name) < 9 || name[0] != '.' || name[len(name)-7] != '.' {
+		return "", false
+	}
+	for _, c := range name[len(name)-6:] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+	return name[1 : len(name)-7], true
+}
+
+// RemovePartialFiles 删除 rsync 被强制终止后遗留在目标目录中的临时文件
+// 只删除源目录中存在对应原文件、而源目录中没有同名文件的临时文件，返回删除的路径
+func RemovePartialFiles(source, target string) ([]string, error) {
+	if strings.Contains(source, ":") || strings.Contains(target, ":") {
+		return nil, nil
+	}
+	var removed []string
+	err := filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		orig, ok := partialFileName(info.Name())
+		if !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(target, path)
+		if err != nil {
+			return nil
+		}
+		srcDir := filepath.Join(source, filepath.Dir(rel))
+		if _, err := os.Lstat(filepath.Join(srcDir, orig)); err != nil {
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(source, rel)); err == nil {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed = append(removed, path)
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,119 @@
+package mirror
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirExists 检查目录是否存在
+// 远程路径（包含冒号）无法直接检查，视为存在
+func DirExists(path string) bool {
+	if strings.Contains(path, ":") {
+		return true
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false
+	}
+	return err == nil && info.IsDir()
+}
+
+// CreateDir 创建目录，不支持远程路径
+func CreateDir(path string) error {
+	if strings.Contains(path, ":") {
+		return newError(ErrRemotePath, "mirror.err.remote_create", path)
+	}
+
+	return os.MkdirAll(path, 0755)
+}
+
+// IsDirEmpty 检查目录是否为空，不支持远程路径
+func IsDirEmpty(dir string) (bool, error) {
+	if strings.Contains(dir, ":") {
+		return false, newError(ErrRemotePath, "mirror.err.remote_empty_check", dir)
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// 读取目录中的第一个条目
+	_, err = f.Readdirnames(1)
+	if err == nil {
+		return false, nil
+	}
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
+// CheckDirSameOrNested 检查源目录和目标目录是否相同或有从属关系
+// 会解析符号链接，不支持远程路径
+func CheckDirSameOrNested(source, target string) (bool, error) {
+	if strings.Contains(source, ":") {
+		return false, newError(ErrRemotePath, "mirror.err.remote_source", source)
+	}
+	if strings.Contains(target, ":") {
+		return false, newError(ErrRemotePath, "mirror.err.remote_target", target)
+	}
+
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return false, newError(nil, "mirror.err.abs_source", err)
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return false, newError(nil, "mirror.err.abs_target", err)
+	}
+	if isSameOrNested(absSource, absTarget) {
+		return true, nil
+	}
+
+	// 检查源目录和目标目录是否通过符号链接指向相同位置
+	srcInfo, err := os.Lstat(absSource)
+	if err != nil {
+		return false, newError(nil, "mirror.err.stat_source", err)
+	}
+	tgtInfo, err := os.Lstat(absTarget)
+	if err != nil {
+		// 目标目录可能不存在，此时不是同一目录
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, newError(nil, "mirror.err.stat_target", err)
+	}
+
+	if srcInfo.Mode()&os.ModeSymlink != 0 || tgtInfo.Mode()&os.ModeSymlink != 0 {
+		realSource, err := filepath.EvalSymlinks(absSource)
+		if err != nil {
+			return false, newError(nil, "mirror.err.eval_source", err)
+		}
+		realTarget, err := filepath.EvalSymlinks(absTarget)
+		if err != nil {
+			return false, newError(nil, "mirror.err.eval_target", err)
+		}
+		return isSameOrNested(realSource, realTarget), nil
+	}
+
+	return false, nil
+}
+
+// 判断两个绝对路径是否相同或互为子目录
+func isSameOrNested(a, b string) bool {
+	sep := string(filepath.Separator)
+	return a == b || strings.HasPrefix(b, a+sep) || strings.HasPrefix(a, b+sep)
+}
+
+// 确保目录路径以斜杠结尾，使 rsync 复制目录的内容而不是目录本身
+func withTrailingSlash(path string) string {
+	if !strings.HasSuffix(path, "/") {
+		return path + "/"
+	}
+	return path
+}
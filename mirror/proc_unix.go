@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package mirror
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// 让 rsync 运行在独立的进程组中，终端的 Ctrl-C 不会直接发给 rsync，而是由调用方决定如何停止
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// 向 rsync 的进程组发送 SIGINT，rsync 会删除正在传输的临时文件后退出
+func interruptProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+}
+
+// 强制终止 rsync 的整个进程组
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
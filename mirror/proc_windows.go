@@ -0,0 +1,14 @@
+package mirror
+
+import "os/exec"
+
+// Windows 上没有进程组信号，取消时直接终止 rsync
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func interruptProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
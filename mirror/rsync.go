@@ -0,0 +1,107 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultArgs 是镜像使用的基本 rsync 参数
+var DefaultArgs = []string{"-aH", "--force", "--delete-during", "--progress"}
+
+// RsyncArgs 根据规则文件生成 rsync 参数（不含源目录和目标目录）
+// 排除规则文件按顺序添加且必须存在；包含规则文件为空或不存在时跳过
+func RsyncArgs(excludeFrom []string, includeFrom string) ([]string, error) {
+	args := append([]string(nil), DefaultArgs...)
+	for _, path := range excludeFrom {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, newError(ErrRuleFileMissing, "mirror.err.rule_file_at", path)
+		}
+		args = append(args, "--exclude-from="+path)
+	}
+	if includeFrom != "" {
+		if _, err := os.Stat(includeFrom); err == nil {
+			args = append(args, "--include-from="+includeFrom)
+		}
+	}
+	return args, nil
+}
+
+// DefaultGracePeriod 是取消后等待 rsync 结束当前文件的默认时间
+const DefaultGracePeriod = 10 * time.Second
+
+// RsyncBackend 通过外部的 rsync 程序同步
+type RsyncBackend struct {
+	// 创建命令的函数，为空时使用 exec.Command
+	Command func(name string, arg ...string) *exec.Cmd
+	// 取消后等待 rsync 结束当前文件的时间，为 0 时使用 DefaultGracePeriod
+	GracePeriod time.Duration
+	// 关闭时不再等待，立即强制终止已被取消的 rsync
+	ForceStop <-chan struct{}
+}
+
+// Run 运行 rsync 直到结束，ctx 取消时停止 rsync
+func (b *RsyncBackend) Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	command := b.Command
+	if command == nil {
+		command = exec.Command
+	}
+	cmd := command("rsync", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return &RsyncError{Err: err}
+	}
+	stop := b.watch(ctx, cmd)
+	err := cmd.Wait()
+	return commandResult(ctx, err, stop())
+}
+
+// 监视 ctx：取消时向 rsync 发送中断信号，让它结束当前文件并清理临时文件；
+// 超过 GracePeriod 或 ForceStop 被关闭时强制终止。
+// 返回的函数停止监视，并报告 rsync 是否被强制终止
+func (b *RsyncBackend) watch(ctx context.Context, cmd *exec.Cmd) func() bool {
+	grace := b.GracePeriod
+	if grace == 0 {
+		grace = DefaultGracePeriod
+	}
+	done := make(chan struct{})
+	var killed int32
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		interruptProcess(cmd)
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		case <-b.ForceStop:
+		}
+		atomic.StoreInt32(&killed, 1)
+		killProcess(cmd)
+	}()
+	return func() bool {
+		close(done)
+		return atomic.LoadInt32(&killed) == 1
+	}
+}
+
+// 把命令的结束状态转换为返回的错误，ctx 已取消时返回中断错误
+func commandResult(ctx context.Context, err error, killed bool) error {
+	if ctx.Err() != nil {
+		return &interruptedError{cause: ctx.Err(), killed: killed}
+	}
+	if err != nil {
+		return &RsyncError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// ScrubCheckpointName 是目标目录中 scrub 检查点的名称，镜像时会被排除，不会被 rsync 删除
+const ScrubCheckpointName = ".folder_mirror.scrub"
+
+// ScrubKind 是 Scrub 发现的问题类型
+type ScrubKind string
+
+// 问题类型
+const (
+	ScrubMissing    ScrubKind = "missing"    // 清单中的文件不存在或不再是普通文件
+	ScrubTruncated  ScrubKind = "truncated"  // 文件比清单中记录的小
+	ScrubModified   ScrubKind = "modified"   // 文件变大或修改时间变化，在镜像之外被修改
+	ScrubBitrot     ScrubKind = "bitrot"     // 大小和修改时间都没有变化，但内容的 SHA-256 不同
+	ScrubUnreadable ScrubKind = "unreadable" // 读取文件内容时出错，例如磁盘的 I/O 错误
+)
+
+// ScrubProblem 是 Scrub 发现的一个问题
+type ScrubProblem struct {
+	Kind ScrubKind
+	Path string // 相对于目标目录的路径，使用 / 分隔
+	Err  error  // Kind 为 ScrubUnreadable 时的读取错误
+}
+
+// ScrubOptions 描述一次 scrub 的配置
+type ScrubOptions struct {
+	// 只检查路径排在 After 之后的条目，用于从检查点继续；为空时从头开始
+	After string
+	// 读取的字节数达到 MaxBytes 后停止，为 0 时不限制
+	MaxBytes int64
+	// 超过 Deadline 后不再开始检查新的文件，为零值时不限制
+	Deadline time.Time
+	// 每发现一个问题调用一次，为空时只在结果中返回
+	OnProblem func(ScrubProblem)
+}
+
+// ScrubResult 描述一次 scrub 的结果
+type ScrubResult struct {
+	Total    int   // 清单中的文件数
+	Checked  int   // 这次检查的文件数
+	Bytes    int64 // 这次读取的字节数
+	Problems []ScrubProblem
+	// 最后检查的路径，没有检查任何文件时为 After；没有检查完时下一次作为 After 传入
+	Resume string
+	// 检查到了清单的末尾
+	Complete bool
+}
+
+// Scrub 按路径顺序重新读取清单中的文件，与记录的大小、修改时间和 SHA-256 比较，
+// 报告被截断、在镜像之外被修改、内容静默损坏和无法读取的文件。
+// 达到 MaxBytes 或 Deadline 时停止并在 Resume 中返回进度，很大的目标目录可以分多次检查完。
+// ctx 取消时同时返回已经检查的结果和中断错误
+func Scrub(ctx context.Context, target string, m *Manifest, opts ScrubOptions) (*ScrubResult, error) {
+	res := &ScrubResult{Total: len(m.Entries), Resume: opts.After}
+	start := sort.Search(len(m.Entries), func(i int) bool { return m.Entries[i].Path > opts.After })
+	for _, e := range m.Entries[start:] {
+		if (opts.MaxBytes > 0 && res.Bytes >= opts.MaxBytes) || (!opts.Deadline.IsZero() && time.Now().After(opts.Deadline)) {
+			return res, nil
+		}
+		kind, n, err := scrubEntry(ctx, target, e)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return res, &interruptedError{cause: err}
+		}
+		res.Checked++
+		res.Bytes += n
+		res.Resume = e.Path
+		if kind != "" {
+			p := ScrubProblem{Kind: kind, Path: e.Path, Err: err}
+			res.Problems = append(res.Problems, p)
+			if opts.OnProblem != nil {
+				opts.OnProblem(p)
+			}
+		}
+	}
+	res.Complete = true
+	return res, nil
+}
+
+// 检查一个文件，返回问题类型（没有问题时为空）和读取的字节数
+func scrubEntry(ctx context.Context, target string, e ManifestEntry) (ScrubKind, int64, error) {
+	name := filepath.Join(target, filepath.FromSlash(e.Path))
+	info, err := os.Lstat(name)
+	switch {
+	case os.IsNotExist(err) || (err == nil && !info.Mode().IsRegular()):
+		return ScrubMissing, 0, nil
+	case err != nil:
+		return ScrubUnreadable, 0, err
+	case info.Size() < e.Size:
+		return ScrubTruncated, 0, nil
+	case info.Size() > e.Size || !info.ModTime().Equal(e.Mtime):
+		return ScrubModified, 0, nil
+	}
+	sum, err := HashFile(ctx, name)
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return "", 0, err
+	}
+	if os.IsNotExist(err) {
+		return ScrubMissing, 0, nil
+	}
+	if err != nil {
+		return ScrubUnreadable, 0, err
+	}
+	if sum != e.SHA256 {
+		return ScrubBitrot, info.Size(), nil
+	}
+	return "", info.Size(), nil
+}
+
+// ScrubCheckpoint 记录分多次进行的一轮 scrub 的进度
+type ScrubCheckpoint struct {
+	Started  time.Time `json:"started"` // 这一轮开始的时间
+	After    string    `json:"after"`   // 已经检查到的路径
+	Checked  int       `json:"checked"`
+	Bytes    int64     `json:"bytes"`
+	Problems int       `json:"problems"`
+}
+
+// ReadScrubCheckpoint 读取目标目录中的 scrub 检查点，没有检查点时返回 nil
+func ReadScrubCheckpoint(target string) (*ScrubCheckpoint, error) {
+	name := filepath.Join(target, ScrubCheckpointName)
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp ScrubCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, newError(nil, "mirror.err.checkpoint_invalid", name, err)
+	}
+	return &cp, nil
+}
+
+// WriteScrubCheckpoint 把 scrub 检查点写入目标目录，cp 为 nil 时删除检查点
+func WriteScrubCheckpoint(target string, cp *ScrubCheckpoint) error {
+	name := filepath.Join(target, ScrubCheckpointName)
+	if cp == nil {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return securefile.WriteFile(name, append(data, '\n'))
+}
@@ -0,0 +1,124 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 测试 scrub 报告缺少、截断、被修改和内容损坏的文件
+func TestScrub(t *testing.T) {
+	d := setupBackendDirs(t, nil, map[string]string{
+		"a.txt":       "alpha",
+		"bitrot.txt":  "good data",
+		"gone.txt":    "gone",
+		"grown.txt":   "grown",
+		"touched.txt": "touched",
+		"trunc.txt":   "truncated",
+		"z/ok.txt":    "ok",
+	})
+	defer os.RemoveAll(d.dir)
+	if _, err := UpdateManifest(context.Background(), d.target, ManifestOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadManifest(d.target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Scrub(context.Background(), d.target, m, ScrubOptions{})
+	if err != nil || len(res.Problems) != 0 || res.Checked != 7 || !res.Complete || res.Bytes != 41 {
+		t.Fatalf("没有变化时不应发现问题: %+v, %v", res, err)
+	}
+
+	write := func(name, content string, mtime time.Time) {
+		path := filepath.Join(d.target, name)
+		ioutil.WriteFile(path, []byte(content), 0644)
+		os.Chtimes(path, mtime, mtime)
+	}
+	write("bitrot.txt", "good dat4", treeTime)
+	write("grown.txt", "grown larger", treeTime)
+	write("touched.txt", "touched", treeTime.Add(time.Second))
+	write("trunc.txt", "trunc", treeTime)
+	os.Remove(filepath.Join(d.target, "gone.txt"))
+
+	var reported []ScrubProblem
+	res, err = Scrub(context.Background(), d.target, m, ScrubOptions{OnProblem: func(p ScrubProblem) {
+		reported = append(reported, p)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ScrubProblem{
+		{Kind: ScrubBitrot, Path: "bitrot.txt"},
+		{Kind: ScrubMissing, Path: "gone.txt"},
+		{Kind: ScrubModified, Path: "grown.txt"},
+		{Kind: ScrubModified, Path: "touched.txt"},
+		{Kind: ScrubTruncated, Path: "trunc.txt"},
+	}
+	if !reflect.DeepEqual(res.Problems, want) {
+		t.Errorf("期望问题\n%v\n得到\n%v", want, res.Problems)
+	}
+	if !reflect.DeepEqual(reported, want) {
+		t.Errorf("OnProblem 应当收到全部问题，得到 %v", reported)
+	}
+}
+
+// 测试 scrub 达到上限时停止，并从返回的进度继续
+func TestScrubResume(t *testing.T) {
+	d := setupBackendDirs(t, nil, map[string]string{"a": "1234", "b": "1234", "c": "1234", "d": "1234"})
+	defer os.RemoveAll(d.dir)
+	if _, err := UpdateManifest(context.Background(), d.target, ManifestOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := ReadManifest(d.target)
+
+	res, err := Scrub(context.Background(), d.target, m, ScrubOptions{MaxBytes: 6})
+	if err != nil || res.Complete || res.Checked != 2 || res.Resume != "b" {
+		t.Fatalf("读取 6 字节后应当在第二个文件之后停止: %+v, %v", res, err)
+	}
+	res, err = Scrub(context.Background(), d.target, m, ScrubOptions{After: res.Resume})
+	if err != nil || !res.Complete || res.Checked != 2 || res.Resume != "d" {
+		t.Errorf("应当从 b 之后继续检查完: %+v, %v", res, err)
+	}
+
+	// 已经超过时间的限制不再检查文件，进度不变
+	res, err = Scrub(context.Background(), d.target, m, ScrubOptions{After: "a", Deadline: time.Now().Add(-time.Second)})
+	if err != nil || res.Complete || res.Checked != 0 || res.Resume != "a" {
+		t.Errorf("超过时间限制时不应检查文件: %+v, %v", res, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err = Scrub(ctx, d.target, m, ScrubOptions{After: "b"})
+	if !errors.Is(err, ErrInterrupted) || res == nil || res.Resume != "b" {
+		t.Errorf("中断时应当返回进度和中断错误: %+v, %v", res, err)
+	}
+}
+
+// 测试检查点的读写
+func TestScrubCheckpoint(t *testing.T) {
+	d := setupBackendDirs(t, nil, map[string]string{"a": "a"})
+	defer os.RemoveAll(d.dir)
+	if cp, err := ReadScrubCheckpoint(d.target); cp != nil || err != nil {
+		t.Errorf("没有检查点时应当返回 nil: %v, %v", cp, err)
+	}
+	want := &ScrubCheckpoint{Started: treeTime, After: "x/y", Checked: 3, Bytes: 100, Problems: 1}
+	if err := WriteScrubCheckpoint(d.target, want); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := ReadScrubCheckpoint(d.target)
+	if err != nil || !cp.Started.Equal(want.Started) || cp.After != want.After || cp.Checked != 3 || cp.Bytes != 100 || cp.Problems != 1 {
+		t.Errorf("读回的检查点不正确: %+v, %v", cp, err)
+	}
+	if err := WriteScrubCheckpoint(d.target, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(d.target, ScrubCheckpointName)); !os.IsNotExist(err) {
+		t.Errorf("检查点应当被删除: %v", err)
+	}
+}
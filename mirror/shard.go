@@ -0,0 +1,298 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// DefaultShardDepth 是 ShardedBackend 默认的划分深度：只按顶层条目划分
+const DefaultShardDepth = 1
+
+// ShardedBackend 把源目录划分为多个分片，用 Shards 个并发的 Backend 同时同步
+//
+// 源目录按顶层条目划分；ShardDepth 大于 1 时，超过平均分片大小的目录继续按下一层划分，
+// 最多到 ShardDepth 层。条目的大小按其中的条目数加上以 MiB 计的字节数估算，
+// 然后按大小均衡地分配到各个分片。每个分片通过 --files-from 同步自己的条目，
+// 目标目录中只在划分边界处多余的条目作为源目录中已经不存在的路径加入分片并被删除，
+// 被过滤规则排除的条目不会被删除。
+//
+// 所有分片的输出按行合并写入 stdout 和 stderr。一个分片失败时其余分片继续运行，
+// 结束后返回第一个失败分片的错误。-H 只在同一个分片内保留硬链接。
+// 参数中已经有 --files-from 时（如 ApplyPaths）不再划分
+type ShardedBackend struct {
+	Backend    Backend // 同步每个分片的后端，为空时使用 RsyncBackend
+	Shards     int     // 分片数，也是并发运行的后端数，不超过 1 时不划分
+	ShardDepth int     // 最多按几层目录划分，为 0 时使用 DefaultShardDepth
+}
+
+// 分片中的一个条目
+type shardEntry struct {
+	path   string // 相对于源目录的路径，使用 / 分隔
+	weight int64
+}
+
+// Run 划分源目录并并发同步各个分片
+func (b *ShardedBackend) Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	backend := b.Backend
+	if backend == nil {
+		backend = &RsyncBackend{}
+	}
+	if b.Shards <= 1 || len(args) < 2 || hasFilesFrom(args) {
+		return backend.Run(ctx, args, stdout, stderr)
+	}
+	source, target := args[len(args)-2], args[len(args)-1]
+	f, err := argsFilter(args[:len(args)-2])
+	if err != nil {
+		return err
+	}
+	shards, err := b.plan(source, target, f)
+	if err != nil {
+		return newError(ErrSyncFailed, "mirror.err.shard_plan", err)
+	}
+	if len(shards) <= 1 {
+		return backend.Run(ctx, args, stdout, stderr)
+	}
+
+	lists := make([]string, len(shards))
+	defer func() {
+		for _, name := range lists {
+			if name != "" {
+				os.Remove(name)
+			}
+		}
+	}()
+	for i, paths := range shards {
+		name, err := writeFileList(paths)
+		if err != nil {
+			return newError(err, "mirror.err.files_from", err)
+		}
+		lists[i] = name
+	}
+
+	// 各个分片的输出按整行写入，避免不同分片的行交错
+	var mu sync.Mutex
+	writer := func(w io.Writer) func(string) {
+		return func(line string) {
+			mu.Lock()
+			io.WriteString(w, line+"\n")
+			mu.Unlock()
+		}
+	}
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i := range shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			out := &lineWriter{fn: writer(stdout)}
+			errOut := &lineWriter{fn: writer(stderr)}
+			// --files-from 会关闭 -a 隐含的 -r，需要重新打开
+			shardArgs := append(append([]string(nil), args[:len(args)-2]...),
+				"--files-from="+lists[i], "--from0", "-r", "--delete-missing-args", source, target)
+			errs[i] = backend.Run(ctx, shardArgs, out, errOut)
+			out.flush()
+			errOut.flush()
+		}(i)
+	}
+	wg.Wait()
+	return firstShardError(errs)
+}
+
+// 返回第一个失败分片的错误；被强制终止的中断优先，以便 Apply 清理遗留的临时文件
+func firstShardError(errs []error) error {
+	var first error
+	for _, err := range errs {
+		var ie *interruptedError
+		if errors.As(err, &ie) && ie.killed {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// 参数中是否已经指定了 --files-from
+func hasFilesFrom(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--files-from=") {
+			return true
+		}
+	}
+	return false
+}
+
+// 按参数中的过滤规则创建 Filter，忽略其他参数
+func argsFilter(args []string) (*filter.Filter, error) {
+	var ruleSets [][]filter.Rule
+	for _, arg := range args {
+		name, value := arg, ""
+		if i := strings.IndexByte(arg, '='); i >= 0 && strings.HasPrefix(arg, "--") {
+			name, value = arg[:i], arg[i+1:]
+		}
+		rules, ok, err := filterArg(name, value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ruleSets = append(ruleSets, rules)
+		}
+	}
+	return filter.New(ruleSets...), nil
+}
+
+// 把路径列表写入以 NUL 分隔的临时文件，返回文件名
+func writeFileList(paths []string) (string, error) {
+	list, err := ioutil.TempFile("", "folder_mirror_files_")
+	if err != nil {
+		return "", err
+	}
+	for _, p := range paths {
+		if _, err := io.WriteString(list, p+"\x00"); err != nil {
+			list.Close()
+			os.Remove(list.Name())
+			return "", err
+		}
+	}
+	if err := list.Close(); err != nil {
+		os.Remove(list.Name())
+		return "", err
+	}
+	return list.Name(), nil
+}
+
+// 划分源目录，返回每个分片的路径列表；没有可以划分的条目时返回 nil
+func (b *ShardedBackend) plan(source, target string, f *filter.Filter) ([][]string, error) {
+	depth := b.ShardDepth
+	if depth <= 0 {
+		depth = DefaultShardDepth
+	}
+	weights, total, err := shardWeights(source, f, depth)
+	if err != nil {
+		return nil, err
+	}
+	p := &shardPlanner{
+		source:  source,
+		target:  target,
+		filter:  f,
+		depth:   depth,
+		weights: weights,
+		share:   total / int64(b.Shards),
+	}
+	if err := p.expand("", 1); err != nil {
+		return nil, err
+	}
+	if len(p.entries) <= 1 {
+		return nil, nil
+	}
+
+	// 从大到小依次分配给当前最小的分片
+	sort.SliceStable(p.entries, func(i, j int) bool { return p.entries[i].weight > p.entries[j].weight })
+	n := b.Shards
+	if n > len(p.entries) {
+		n = len(p.entries)
+	}
+	shards := make([][]string, n)
+	loads := make([]int64, n)
+	for _, e := range p.entries {
+		least := 0
+		for i := 1; i < n; i++ {
+			if loads[i] < loads[least] {
+				least = i
+			}
+		}
+		shards[least] = append(shards[least], e.path)
+		loads[least] += e.weight
+	}
+	for _, paths := range shards {
+		sort.Strings(paths)
+	}
+	return shards, nil
+}
+
+// 遍历源目录，估算不超过 depth 层的每个条目的大小（包含其中的全部内容）
+func shardWeights(source string, f *filter.Filter, depth int) (map[string]int64, int64, error) {
+	weights := make(map[string]int64)
+	var total int64
+	err := f.Walk(source, func(rel string, info os.FileInfo, rule int, included bool) error {
+		if !included {
+			return nil
+		}
+		w := int64(1)
+		if info.Mode().IsRegular() {
+			w += info.Size() >> 20
+		}
+		total += w
+		parts := strings.Split(rel, "/")
+		for i := 1; i <= len(parts) && i <= depth; i++ {
+			weights[strings.Join(parts[:i], "/")] += w
+		}
+		return nil
+	})
+	return weights, total, err
+}
+
+// shardPlanner 把源目录展开为分片的条目
+type shardPlanner struct {
+	source, target string
+	filter         *filter.Filter
+	depth          int
+	weights        map[string]int64
+	share          int64 // 平均每个分片的大小，超过它的目录继续划分
+	entries        []shardEntry
+}
+
+// 把目录 rel 中的条目加入分片，level 是这些条目的层数
+// 目标目录中多余的条目也加入分片，由 --delete-missing-args 删除
+func (p *shardPlanner) expand(rel string, level int) error {
+	sources, err := ioutil.ReadDir(filepath.Join(p.source, filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, info := range sources {
+		name := path.Join(rel, info.Name())
+		seen[info.Name()] = true
+		if !p.filter.Decide(name, info.IsDir()).Included {
+			continue
+		}
+		if info.IsDir() && level < p.depth && p.weights[name] > p.share && p.targetIsDir(name) {
+			if err := p.expand(name, level+1); err != nil {
+				return err
+			}
+			continue
+		}
+		p.entries = append(p.entries, shardEntry{name, p.weights[name]})
+	}
+
+	targets, err := ioutil.ReadDir(filepath.Join(p.target, filepath.FromSlash(rel)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, info := range targets {
+		name := path.Join(rel, info.Name())
+		if seen[info.Name()] || !p.filter.Decide(name, info.IsDir()).Included {
+			continue
+		}
+		p.entries = append(p.entries, shardEntry{name, 1})
+	}
+	return nil
+}
+
+// 目标中对应的路径是否为目录或者还不存在；是其他类型的文件时不能按下一层划分，
+// 否则目录内的条目无法替换它
+func (p *shardPlanner) targetIsDir(rel string) bool {
+	info, err := os.Lstat(filepath.Join(p.target, filepath.FromSlash(rel)))
+	return err != nil || info.IsDir()
+}
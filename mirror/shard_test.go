@@ -0,0 +1,224 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 分片测试的源目录和目标目录：目标中既有顶层的多余条目，也有目录内部的多余条目
+var (
+	shardSource = map[string]string{
+		"a.txt":         "alpha",
+		"docs/readme":   "readme",
+		"docs/old/x":    "x",
+		"big/one.txt":   "1",
+		"big/two.txt":   "2",
+		"big/three.txt": "3",
+		"big/sub/four":  "4",
+		"big/sub/five":  "5",
+		"small/s.txt":   "s",
+		"cache.tmp":     "skip",
+	}
+	shardTarget = map[string]string{
+		"a.txt":         "old alpha",
+		"stale.txt":     "stale",
+		"stale_dir/x":   "x",
+		"docs/gone.txt": "gone",
+		"big/gone.txt":  "gone",
+		"big/sub/gone":  "gone",
+		"keep.tmp":      "excluded, kept",
+		"big/keep.tmp":  "excluded, kept",
+	}
+)
+
+// 测试分片同步的结果与源目录一致，划分边界处多余的条目被删除，被排除的条目保留
+func TestShardedBackend(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试比较 Unix 权限")
+	}
+	for name, b := range testBackends(t) {
+		for _, depth := range []int{1, 2} {
+			d := setupBackendDirs(t, shardSource, shardTarget, "*.tmp")
+			sharded := &ShardedBackend{Backend: b, Shards: 3, ShardDepth: depth}
+			out, err := applyWith(t, sharded, d)
+			if err != nil {
+				t.Fatalf("%s 深度 %d: 镜像失败: %v", name, depth, err)
+			}
+			for _, p := range []string{"stale.txt", "stale_dir", "docs/gone.txt", "big/gone.txt", "big/sub/gone"} {
+				if _, err := os.Lstat(filepath.Join(d.target, p)); !os.IsNotExist(err) {
+					t.Errorf("%s 深度 %d: 多余的 %s 没有被删除", name, depth, p)
+				}
+			}
+			for _, p := range []string{"keep.tmp", "big/keep.tmp"} {
+				if _, err := os.Lstat(filepath.Join(d.target, p)); err != nil {
+					t.Errorf("%s 深度 %d: 被排除的 %s 不应被删除: %v", name, depth, p, err)
+				}
+			}
+			if !strings.Contains(out, "*deleting   stale.txt\n") || !strings.Contains(out, ">f") {
+				t.Errorf("%s 深度 %d: 合并的输出中缺少变化:\n%s", name, depth, out)
+			}
+
+			// 文件内容和权限与源目录一致
+			want := fileContents(t, d.source, "cache.tmp")
+			if got := fileContents(t, d.target, LockFileName, "keep.tmp", "big/keep.tmp"); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s 深度 %d: 目标目录与源目录不一致\n期望: %v\n得到: %v", name, depth, want, got)
+			}
+			os.RemoveAll(d.dir)
+		}
+	}
+}
+
+// 列出目录树中的文件及其内容，skip 中的路径不列出
+func fileContents(t *testing.T, root string, skip ...string) map[string]string {
+	files := make(map[string]string)
+	for _, entry := range snapshot(t, root, skip...) {
+		fields := strings.Fields(entry)
+		if strings.HasSuffix(fields[0], "/") {
+			files[fields[0]] = fields[1]
+		} else {
+			files[fields[0]] = fields[1] + " " + fields[len(fields)-1]
+		}
+	}
+	return files
+}
+
+// 测试按大小继续划分目录
+func TestShardPlan(t *testing.T) {
+	d := setupBackendDirs(t, shardSource, shardTarget, "*.tmp")
+	defer os.RemoveAll(d.dir)
+	f := filter.New([]filter.Rule{filter.NewRule("*.tmp", false)})
+
+	shards, err := (&ShardedBackend{Shards: 2}).plan(d.source, d.target, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joinShards(shards); got != "a.txt big docs small stale.txt stale_dir" {
+		t.Errorf("按顶层划分的条目为 %q", got)
+	}
+	if len(shards) != 2 {
+		t.Errorf("期望 2 个分片，得到 %d", len(shards))
+	}
+
+	// big 超过平均分片大小，继续按下一层划分，big 中多余的条目也加入分片
+	shards, err = (&ShardedBackend{Shards: 3, ShardDepth: 3}).plan(d.source, d.target, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a.txt big/gone.txt big/one.txt big/sub big/three.txt big/two.txt docs small stale.txt stale_dir"
+	if got := joinShards(shards); got != want {
+		t.Errorf("按深度划分的条目为\n%q\n期望\n%q", got, want)
+	}
+
+	// 只有一个条目时不划分
+	single := setupBackendDirs(t, map[string]string{"only/a": "a", "only/b": "b"}, nil)
+	defer os.RemoveAll(single.dir)
+	if shards, err := (&ShardedBackend{Shards: 4}).plan(single.source, single.target, f); err != nil || shards != nil {
+		t.Errorf("只有一个顶层条目时不应划分: %v, %v", shards, err)
+	}
+}
+
+// 按名称排序列出所有分片中的条目
+func joinShards(shards [][]string) string {
+	var all []string
+	for _, paths := range shards {
+		all = append(all, paths...)
+	}
+	sort.Strings(all)
+	return strings.Join(all, " ")
+}
+
+// recordingBackend 记录每次运行的参数和 --files-from 列出的路径，fail 中的路径所在的分片返回错误
+type recordingBackend struct {
+	mu    sync.Mutex
+	args  [][]string
+	paths []string
+	fail  string
+}
+
+func (r *recordingBackend) Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var paths []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--files-from=") {
+			data, _ := ioutil.ReadFile(strings.TrimPrefix(arg, "--files-from="))
+			if len(data) > 0 {
+				paths = strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+			}
+		}
+	}
+	r.mu.Lock()
+	r.args = append(r.args, args)
+	r.paths = append(r.paths, paths...)
+	r.mu.Unlock()
+	var err error
+	for _, p := range paths {
+		io.WriteString(stdout, ">f+++++++++ "+p+"\n")
+		if p == r.fail {
+			err = &RsyncError{Err: errors.New("exit status 23")}
+		}
+	}
+	return err
+}
+
+// 测试分片的参数、输出合并和错误
+func TestShardedBackendRun(t *testing.T) {
+	d := setupBackendDirs(t, shardSource, nil)
+	defer os.RemoveAll(d.dir)
+	args := []string{"-aH", "--exclude=*.tmp", d.source + "/", d.target + "/"}
+
+	// 不划分时参数原样传给后端
+	for _, b := range []*ShardedBackend{{Shards: 1}, {Shards: 3}} {
+		r := &recordingBackend{}
+		b.Backend = r
+		filesFrom := append([]string{"--files-from=/dev/null"}, args...)
+		runArgs := args
+		if b.Shards > 1 {
+			runArgs = filesFrom
+		}
+		if err := b.Run(context.Background(), runArgs, ioutil.Discard, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.args) != 1 || !reflect.DeepEqual(r.args[0], runArgs) {
+			t.Errorf("不划分时参数应当原样传递，得到 %v", r.args)
+		}
+	}
+
+	r := &recordingBackend{fail: "docs"}
+	var out strings.Builder
+	err := (&ShardedBackend{Backend: r, Shards: 3}).Run(context.Background(), args, &out, ioutil.Discard)
+	if !errors.Is(err, ErrRsyncFailed) {
+		t.Errorf("期望返回失败分片的错误，得到 %v", err)
+	}
+	if len(r.args) != 3 {
+		t.Fatalf("期望运行 3 个分片，得到 %d", len(r.args))
+	}
+	for _, a := range r.args {
+		tail := strings.Join(a[len(a)-6:], " ")
+		if !strings.HasPrefix(tail, "--files-from=") || !strings.HasSuffix(tail, "--from0 -r --delete-missing-args "+d.source+"/ "+d.target+"/") {
+			t.Errorf("分片的参数不正确: %v", a)
+		}
+		list := strings.TrimPrefix(a[len(a)-6], "--files-from=")
+		if _, err := os.Stat(list); !os.IsNotExist(err) {
+			t.Errorf("分片的路径列表 %s 应当在结束后删除", list)
+		}
+	}
+	sort.Strings(r.paths)
+	if got := strings.Join(r.paths, " "); got != "a.txt big docs small" {
+		t.Errorf("分片中的条目为 %q", got)
+	}
+	// 其余分片继续运行，所有输出按行合并
+	if lines := strings.Count(out.String(), "\n"); lines != 4 {
+		t.Errorf("期望合并 4 行输出，得到:\n%s", out.String())
+	}
+}
@@ -0,0 +1,245 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// DriftKind 是目标目录与源目录的差异类型
+type DriftKind string
+
+// 差异类型
+const (
+	DriftMissing DriftKind = "missing" // 源目录中有，目标目录中没有
+	DriftExtra   DriftKind = "extra"   // 目标目录中多余
+	DriftDiffer  DriftKind = "differ"  // 两边都有但不一致，原因见 Drift.Reason
+)
+
+// 条目不一致的原因
+const (
+	ReasonType    = "type"    // 类型不同，例如一边是文件另一边是目录
+	ReasonSize    = "size"    // 文件大小不同
+	ReasonMtime   = "mtime"   // 文件修改时间不同（按秒比较）
+	ReasonContent = "content" // 大小和修改时间相同但 SHA-256 不同
+	ReasonLink    = "link"    // 符号链接的目标不同
+)
+
+// Drift 是 Verify 发现的一处差异
+type Drift struct {
+	Kind   DriftKind
+	Path   string // 相对于源目录的路径，使用 / 分隔，目录以 / 结尾
+	Reason string // Kind 为 DriftDiffer 时的原因
+}
+
+// VerifyOptions 描述一次校验的配置
+type VerifyOptions struct {
+	// 过滤规则，为空时比较全部条目；被排除的条目两边都不比较，目标目录根部的锁文件和完整性清单总是被忽略
+	Filter *filter.Filter
+	// 大小和修改时间都相同时再比较两边文件内容的 SHA-256
+	Checksum bool
+	// 每发现一处差异调用一次，为空时只在结果中返回
+	OnDrift func(Drift)
+}
+
+// VerifyResult 描述一次校验的结果
+type VerifyResult struct {
+	Entries int   // 比较过的条目数
+	Hashed  int64 // 计算 SHA-256 的字节数，两边合计
+	Drift   []Drift
+}
+
+// Verify 同时遍历源目录和目标目录，比较条目集合、类型、文件大小、修改时间、符号链接的目标，
+// Checksum 时还比较文件内容。与 rsync 的快速检查不同，内容比较会读出目标目录中的每个文件，
+// 可以发现大小和修改时间没有变化的损坏。
+// 多余或缺少的目录只报告目录本身；目录的权限和修改时间不比较。ctx 取消时返回中断错误
+func Verify(ctx context.Context, source, target string, opts VerifyOptions) (*VerifyResult, error) {
+	if opts.Filter == nil {
+		opts.Filter = filter.New()
+	}
+	v := &verifier{ctx: ctx, source: source, target: target, opts: opts, res: &VerifyResult{}}
+	if err := v.compareDir(""); err != nil {
+		return nil, err
+	}
+	return v.res, nil
+}
+
+// 一次校验的状态
+type verifier struct {
+	ctx            context.Context
+	source, target string
+	opts           VerifyOptions
+	res            *VerifyResult
+}
+
+func (v *verifier) report(kind DriftKind, rel string, isDir bool, reason string) {
+	if isDir {
+		rel += "/"
+	}
+	d := Drift{Kind: kind, Path: rel, Reason: reason}
+	v.res.Drift = append(v.res.Drift, d)
+	if v.opts.OnDrift != nil {
+		v.opts.OnDrift(d)
+	}
+}
+
+// 读取目录中的条目，按名称索引；根目录中 folder_mirror 自己的文件不列出，目录不存在时返回空
+func (v *verifier) readDir(root, rel string) (map[string]os.FileInfo, []string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, newError(err, "mirror.err.verify_read", filepath.Join(root, filepath.FromSlash(rel)), err)
+	}
+	entries := make(map[string]os.FileInfo, len(infos))
+	var names []string
+	for _, info := range infos {
+		if rel == "" && isStateFile(info.Name()) {
+			continue
+		}
+		entries[info.Name()] = info
+		names = append(names, info.Name())
+	}
+	return entries, names, nil
+}
+
+// 判断条目是否会被镜像，上级目录已经在遍历时检查过
+func (v *verifier) included(rel string, isDir bool) bool {
+	idx := v.opts.Filter.Match(rel, isDir)
+	return idx < 0 || v.opts.Filter.Rules[idx].Include
+}
+
+// 比较一个目录中的条目，两边都是目录的条目递归比较
+func (v *verifier) compareDir(rel string) error {
+	sources, sourceNames, err := v.readDir(v.source, rel)
+	if err != nil {
+		return err
+	}
+	targets, targetNames, err := v.readDir(v.target, rel)
+	if err != nil {
+		return err
+	}
+	for _, name := range sourceNames {
+		if err := v.ctx.Err(); err != nil {
+			return &interruptedError{cause: err}
+		}
+		s := sources[name]
+		child := path.Join(rel, name)
+		if !v.included(child, s.IsDir()) {
+			continue
+		}
+		v.res.Entries++
+		t, ok := targets[name]
+		if !ok {
+			v.report(DriftMissing, child, s.IsDir(), "")
+			continue
+		}
+		if err := v.compareEntry(child, s, t); err != nil {
+			return err
+		}
+	}
+	for _, name := range targetNames {
+		t := targets[name]
+		child := path.Join(rel, name)
+		if _, ok := sources[name]; ok || !v.included(child, t.IsDir()) {
+			continue
+		}
+		v.res.Entries++
+		v.report(DriftExtra, child, t.IsDir(), "")
+	}
+	return nil
+}
+
+// 比较两边都存在的条目
+func (v *verifier) compareEntry(rel string, s, t os.FileInfo) error {
+	if s.Mode().Type() != t.Mode().Type() {
+		v.report(DriftDiffer, rel, s.IsDir(), ReasonType)
+		return nil
+	}
+	switch {
+	case s.IsDir():
+		return v.compareDir(rel)
+	case s.Mode()&os.ModeSymlink != 0:
+		sl, err := os.Readlink(filepath.Join(v.source, filepath.FromSlash(rel)))
+		if err != nil {
+			return newError(err, "mirror.err.verify_read", rel, err)
+		}
+		tl, err := os.Readlink(filepath.Join(v.target, filepath.FromSlash(rel)))
+		if err != nil {
+			return newError(err, "mirror.err.verify_read", rel, err)
+		}
+		if sl != tl {
+			v.report(DriftDiffer, rel, false, ReasonLink)
+		}
+	case s.Mode().IsRegular():
+		return v.compareFile(rel, s, t)
+	}
+	// 设备文件、FIFO 等不比较内容
+	return nil
+}
+
+// 比较两边的普通文件
+func (v *verifier) compareFile(rel string, s, t os.FileInfo) error {
+	if s.Size() != t.Size() {
+		v.report(DriftDiffer, rel, false, ReasonSize)
+		return nil
+	}
+	if v.opts.Checksum {
+		sh, err := HashFile(v.ctx, filepath.Join(v.source, filepath.FromSlash(rel)))
+		if err != nil {
+			return hashError("mirror.err.verify_read", rel, err)
+		}
+		th, err := HashFile(v.ctx, filepath.Join(v.target, filepath.FromSlash(rel)))
+		if err != nil {
+			return hashError("mirror.err.verify_read", rel, err)
+		}
+		v.res.Hashed += 2 * s.Size()
+		if sh != th {
+			v.report(DriftDiffer, rel, false, ReasonContent)
+			return nil
+		}
+	}
+	if !sameTime(s, t) {
+		v.report(DriftDiffer, rel, false, ReasonMtime)
+	}
+	return nil
+}
+
+// 计算哈希时的错误，ctx 取消时为中断错误，否则为消息 id 描述的读取错误
+func hashError(id, rel string, err error) error {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return &interruptedError{cause: err}
+	}
+	return newError(err, id, rel, err)
+}
+
+// HashFile 计算文件内容的 SHA-256，返回十六进制字符串
+// 读取时检查 ctx，取消时返回 ctx 的错误
+func HashFile(ctx context.Context, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	buf := make([]byte, 1<<20)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,120 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 测试校验报告缺少、多余和不一致的条目，并忽略被排除的条目
+func TestVerify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用符号链接")
+	}
+	d := setupBackendDirs(t, map[string]string{
+		"same.txt":       "same",
+		"missing.txt":    "missing",
+		"missing_dir/a":  "a",
+		"size.txt":       "longer",
+		"mtime.txt":      "mtime",
+		"corrupt.txt":    "good data",
+		"type":           "file",
+		"link":           "->same.txt",
+		"sub/deep.txt":   "deep",
+		"cache.tmp":      "excluded",
+		"node/modules.x": "excluded dir",
+	}, map[string]string{
+		"same.txt":      "same",
+		"size.txt":      "short",
+		"mtime.txt":     "mtime",
+		"corrupt.txt":   "bad! data",
+		"type/x":        "x",
+		"link":          "->other",
+		"sub/deep.txt":  "deep",
+		"sub/extra.txt": "extra",
+		"extra_dir/b":   "b",
+		"local.tmp":     "excluded, kept",
+		"node/other":    "inside an excluded dir",
+		LockFileName:    "lock",
+	})
+	defer os.RemoveAll(d.dir)
+	os.Chtimes(filepath.Join(d.target, "mtime.txt"), treeTime.Add(time.Hour), treeTime.Add(time.Hour))
+	f := filter.New([]filter.Rule{filter.NewRule("*.tmp", false), filter.NewRule("node/", false)})
+
+	res, err := Verify(context.Background(), d.source, d.target, VerifyOptions{Filter: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Drift{
+		{DriftDiffer, "link", ReasonLink},
+		{DriftMissing, "missing.txt", ""},
+		{DriftMissing, "missing_dir/", ""},
+		{DriftDiffer, "mtime.txt", ReasonMtime},
+		{DriftDiffer, "size.txt", ReasonSize},
+		{DriftExtra, "sub/extra.txt", ""},
+		{DriftDiffer, "type", ReasonType},
+		{DriftExtra, "extra_dir/", ""},
+	}
+	if !reflect.DeepEqual(res.Drift, want) {
+		t.Errorf("期望差异\n%v\n得到\n%v", want, res.Drift)
+	}
+	if res.Hashed != 0 {
+		t.Errorf("没有指定 Checksum 时不应计算哈希，得到 %d 字节", res.Hashed)
+	}
+
+	// 大小和修改时间相同的损坏只有比较内容才能发现
+	var reported []Drift
+	res, err = Verify(context.Background(), d.source, d.target, VerifyOptions{Filter: f, Checksum: true, OnDrift: func(d Drift) {
+		reported = append(reported, d)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := Drift{DriftDiffer, "corrupt.txt", ReasonContent}
+	if len(res.Drift) != len(want)+1 || res.Drift[0] != corrupt {
+		t.Errorf("指定 Checksum 时应当发现 %v，得到 %v", corrupt, res.Drift)
+	}
+	if !reflect.DeepEqual(reported, res.Drift) {
+		t.Errorf("OnDrift 应当收到全部差异，得到 %v", reported)
+	}
+	if res.Hashed == 0 {
+		t.Errorf("指定 Checksum 时应当统计计算哈希的字节数")
+	}
+}
+
+// 测试校验在 ctx 取消时中断
+func TestVerifyInterrupt(t *testing.T) {
+	d := setupBackendDirs(t, map[string]string{"a.txt": "a"}, map[string]string{"a.txt": "a"})
+	defer os.RemoveAll(d.dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Verify(ctx, d.source, d.target, VerifyOptions{}); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("期望中断错误，得到 %v", err)
+	}
+}
+
+// 测试文件哈希
+func TestHashFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hash_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "abc")
+	ioutil.WriteFile(path, []byte("abc"), 0644)
+	sum, err := HashFile(context.Background(), path)
+	if err != nil || sum != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("abc 的 SHA-256 不正确: %s, %v", sum, err)
+	}
+	if _, err := HashFile(context.Background(), filepath.Join(dir, "none")); !os.IsNotExist(err) {
+		t.Errorf("不存在的文件应当返回 IsNotExist 错误，得到 %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 通知的触发条件，也是配置中 notify_*_on 的取值
+const (
+	notifyOnFailure = "failure" // 运行失败或被中断时（默认）
+	notifyOnWarning = "warning" // 运行失败或运行中输出了警告时
+	notifyOnAlways  = "always"  // 每次运行结束时
+)
+
+// 发送通知的超时时间（变量以便于测试）
+var notifyTimeout = 30 * time.Second
+
+// 运行中输出的警告数，每次运行记录开始和结束时的差值
+var warningCount int64
+
+// notifyConfig 描述配置中的通知设置
+type notifyConfig struct {
+	Webhook   string // 接收 JSON 的 HTTP 地址
+	WebhookOn string
+
+	Email        []string // 收件人
+	EmailOn      string
+	SMTPServer   string // host:port，默认 localhost:25
+	SMTPFrom     string // 默认 folder_mirror@主机名
+	SMTPUsername string // 为空时不认证
+	SMTPPassword string // 为空时使用环境变量 FOLDER_MIRROR_SMTP_PASSWORD
+
+	Desktop   bool // 使用 notify-send 发送桌面通知
+	DesktopOn string
+}
+
+// 设置通知的配置项，key 不是通知的配置项时返回 false
+func (c *notifyConfig) set(key, value string) (bool, error) {
+	switch key {
+	case "notify_webhook":
+		c.Webhook = value
+	case "notify_email":
+		c.Email = splitList(value)
+	case "notify_desktop":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return true, errors.New(tr("config.not_bool", key, value))
+		}
+		c.Desktop = b
+	case "notify_webhook_on", "notify_email_on", "notify_desktop_on":
+		if value != notifyOnFailure && value != notifyOnWarning && value != notifyOnAlways {
+			return true, errors.New(tr("notify.bad_on", key, notifyOnFailure, notifyOnWarning, notifyOnAlways, value))
+		}
+		switch key {
+		case "notify_webhook_on":
+			c.WebhookOn = value
+		case "notify_email_on":
+			c.EmailOn = value
+		default:
+			c.DesktopOn = value
+		}
+	case "smtp_server":
+		c.SMTPServer = value
+	case "smtp_from":
+		c.SMTPFrom = value
+	case "smtp_username":
+		c.SMTPUsername = value
+	case "smtp_password":
+		c.SMTPPassword = value
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// notifier 是一种通知方式
+type notifier struct {
+	name string
+	on   string
+	send func(n *notification) error
+}
+
+// 返回配置的通知方式
+func (c *notifyConfig) notifiers() []notifier {
+	var list []notifier
+	if c.Webhook != "" {
+		list = append(list, notifier{name: "webhook", on: c.WebhookOn, send: c.sendWebhook})
+	}
+	if len(c.Email) > 0 {
+		list = append(list, notifier{name: "email", on: c.EmailOn, send: c.sendEmail})
+	}
+	if c.Desktop {
+		list = append(list, notifier{name: "desktop", on: c.DesktopOn, send: sendDesktop})
+	}
+	return list
+}
+
+// 判断运行结果是否满足触发条件，未设置时只在失败时通知
+func shouldNotify(on string, rec *runRecord) bool {
+	switch on {
+	case notifyOnAlways:
+		return true
+	case notifyOnWarning:
+		return rec.Status != runSuccess || rec.Warnings > 0
+	default:
+		return rec.Status != runSuccess
+	}
+}
+
+// notification 是一次运行结束时发送的通知
+type notification struct {
+	Subject string
+	Body    string
+	Host    string
+	Run     *runRecord
+}
+
+// 根据运行记录生成通知，内容包括运行摘要和运行日志路径
+func newNotification(rec *runRecord) *notification {
+	host, _ := os.Hostname()
+	name := rec.Profile
+	if name == "" {
+		name = rec.Target
+	}
+	lines := []string{
+		tr("notify.run_id", rec.ID),
+		tr("notify.mode", rec.Mode),
+		tr("notify.status", rec.Status),
+		tr("notify.source", rec.Source),
+		tr("notify.target", rec.Target),
+		tr("notify.start", rec.Start.Format("2006-01-02 15:04:05")),
+		tr("notify.duration", rec.End.Sub(rec.Start).Round(time.Second)),
+		tr("notify.changes", rec.Changes.Created, rec.Changes.Updated, rec.Changes.Deleted),
+		tr("notify.warnings", rec.Warnings),
+	}
+	if rec.Error != "" {
+		lines = append(lines, tr("notify.error", rec.Error))
+	}
+	if rec.LogFile != "" {
+		lines = append(lines, tr("notify.log_file", rec.LogFile))
+	}
+	lines = append(lines, tr("notify.host", host))
+	return &notification{
+		Subject: tr("notify.subject", rec.Mode, rec.Status, name),
+		Body:    strings.Join(lines, "\n") + "\n",
+		Host:    host,
+		Run:     rec,
+	}
+}
+
+// 发送满足触发条件的通知，失败只输出警告
+func sendNotifications(cfg *notifyConfig, rec *runRecord) {
+	var n *notification
+	for _, nt := range cfg.notifiers() {
+		if !shouldNotify(nt.on, rec) {
+			continue
+		}
+		if n == nil {
+			n = newNotification(rec)
+		}
+		printVerbose(verbosityVerbose, tr("notify.sending", nt.name))
+		if err := nt.send(n); err != nil {
+			printWarning(tr("notify.failed", nt.name, err))
+		}
+	}
+}
+
+// webhookPayload 是 webhook 收到的 JSON
+type webhookPayload struct {
+	Subject string     `json:"subject"`
+	Message string     `json:"message"`
+	Host    string     `json:"host"`
+	Run     *runRecord `json:"run"`
+}
+
+// 以 JSON 向 webhook 发送 POST 请求，返回 2xx 以外的状态码时失败
+func (c *notifyConfig) sendWebhook(n *notification) error {
+	body, err := json.Marshal(webhookPayload{Subject: n.Subject, Message: n.Body, Host: n.Host, Run: n.Run})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(c.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+// 通过 SMTP 发送邮件，服务器支持 STARTTLS 时先加密
+func (c *notifyConfig) sendEmail(n *notification) error {
+	server := c.SMTPServer
+	if server == "" {
+		server = "localhost:25"
+	}
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return err
+	}
+	from := c.SMTPFrom
+	if from == "" {
+		from = "folder_mirror@" + n.Host
+	}
+
+	conn, err := net.DialTimeout("tcp", server, notifyTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(notifyTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if c.SMTPUsername != "" {
+		password := c.SMTPPassword
+		if password == "" {
+			password = os.Getenv("FOLDER_MIRROR_SMTP_PASSWORD")
+		}
+		if err := client.Auth(smtp.PlainAuth("", c.SMTPUsername, password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range c.Email {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(emailMessage(from, c.Email, n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// 生成邮件内容，标题按 RFC 2047 编码
+func emailMessage(from string, to []string, n *notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(n.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// 使用 notify-send 发送桌面通知，失败时使用 critical 级别
+func sendDesktop(n *notification) error {
+	urgency := "normal"
+	if n.Run.Status != runSuccess {
+		urgency = "critical"
+	}
+	out, err := execCommand("notify-send", "--app-name=folder_mirror", "--urgency="+urgency, n.Subject, n.Body).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// 运行失败后多久之内的 systemd 单元失败视为已经通知过
+const unitFailureWindow = 5 * time.Minute
+
+// 处理 notify 子命令：systemd 服务失败时由 OnFailure 单元调用，通过配置中的通知方式报告失败
+// 运行本身失败时已经发送过通知，只有最近一次运行没有记录失败时（例如进程被终止或超时）才发送
+func runNotifyCommand(args []string) {
+	fs := newCommandFlagSet("notify")
+	profileName := fs.String("profile", "", tr("flag.profile"))
+	unit := fs.String("unit", "", tr("flag.unit"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	if len(positional) != 0 || *profileName == "" {
+		fs.Usage()
+		osExit(1)
+		return
+	}
+	p, err := findProfile(*profileName)
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+
+	now := time.Now()
+	if path, err := historyPath(); err == nil {
+		records, _ := readHistory(path)
+		if own := profileRecords(records, p, nil); len(own) > 0 {
+			last := own[len(own)-1]
+			if last.Status != runSuccess && now.Sub(last.End) < unitFailureWindow {
+				printNotice(tr("notify.already_sent", last.ID))
+				osExit(0)
+				return
+			}
+		}
+	}
+
+	// systemd 在 OnFailure 单元的环境中给出失败的原因，例如 exit-code、signal 或 timeout
+	result := os.Getenv("MONITOR_SERVICE_RESULT")
+	if result == "" {
+		result = "unknown"
+	}
+	rec := &runRecord{ID: now.Format("20060102-150405.000"), Mode: "daemon", Source: p.Source, Target: p.Target,
+		Start: now, End: now, Status: runFailed, Profile: p.Name, Error: tr("notify.unit_failed", *unit, result)}
+	sendNotifications(&p.Notify, rec)
+	osExit(0)
+}
+
+// 记录输出了一条警告
+func countWarning() {
+	atomic.AddInt64(&warningCount, 1)
+}
+
+// 返回已经输出的警告数
+func warningsSoFar() int64 {
+	return atomic.LoadInt64(&warningCount)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试用的运行记录
+func testRunRecord(status string) *runRecord {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	return &runRecord{
+		ID:      "20240102-030405.000",
+		Mode:    "apply",
+		Source:  "/src",
+		Target:  "/dst",
+		Start:   start,
+		End:     start.Add(90 * time.Second),
+		Status:  status,
+		LogFile: "/state/logs/apply.log",
+		Profile: "home",
+		Changes: changeCounts{Created: 1, Updated: 2, Deleted: 3},
+	}
+}
+
+// 测试配置中的通知设置
+func TestProfileNotify(t *testing.T) {
+	p := &profile{Name: "home"}
+	settings := [][2]string{
+		{"notify_webhook", "http://localhost/hook"},
+		{"notify_webhook_on", "always"},
+		{"notify_email", "a@example.com, b@example.com"},
+		{"smtp_server", "mail.example.com:587"},
+		{"notify_desktop", "true"},
+	}
+	for _, s := range settings {
+		if err := p.set(s[0], s[1]); err != nil {
+			t.Fatalf("设置 %s 失败: %v", s[0], err)
+		}
+	}
+	if p.Notify.WebhookOn != notifyOnAlways || len(p.Notify.Email) != 2 || !p.Notify.Desktop || p.Notify.SMTPServer != "mail.example.com:587" {
+		t.Errorf("通知设置错误: %+v", p.Notify)
+	}
+	if n := len(p.Notify.notifiers()); n != 3 {
+		t.Errorf("期望 3 种通知方式，但得到 %d", n)
+	}
+	if err := p.set("notify_email_on", "sometimes"); err == nil {
+		t.Error("无效的触发条件应当返回错误")
+	}
+	if err := p.set("notify_desktop", "maybe"); err == nil {
+		t.Error("无效的 notify_desktop 应当返回错误")
+	}
+}
+
+// 测试通知的触发条件
+func TestShouldNotify(t *testing.T) {
+	success := testRunRecord(runSuccess)
+	warned := testRunRecord(runSuccess)
+	warned.Warnings = 1
+	failed := testRunRecord(runFailed)
+	interrupted := testRunRecord(runInterrupted)
+
+	testCases := []struct {
+		on       string
+		rec      *runRecord
+		expected bool
+	}{
+		{"", success, false},
+		{"", warned, false},
+		{"", failed, true},
+		{notifyOnFailure, interrupted, true},
+		{notifyOnWarning, success, false},
+		{notifyOnWarning, warned, true},
+		{notifyOnWarning, failed, true},
+		{notifyOnAlways, success, true},
+	}
+	for _, tc := range testCases {
+		if got := shouldNotify(tc.on, tc.rec); got != tc.expected {
+			t.Errorf("on=%q status=%s warnings=%d: 期望 %v，但得到 %v", tc.on, tc.rec.Status, tc.rec.Warnings, tc.expected, got)
+		}
+	}
+}
+
+// 测试 webhook 收到的 JSON，以及服务器返回错误时的处理
+func TestWebhookNotifier(t *testing.T) {
+	var payload webhookPayload
+	var contentType string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("无法解析请求: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	rec := testRunRecord(runFailed)
+	rec.Error = "rsync 执行失败"
+	cfg := &notifyConfig{Webhook: server.URL}
+	if err := cfg.sendWebhook(newNotification(rec)); err != nil {
+		t.Fatalf("发送 webhook 失败: %v", err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type 错误: %s", contentType)
+	}
+	if payload.Run == nil || payload.Run.LogFile != rec.LogFile || payload.Run.Changes.Deleted != 3 || payload.Run.Status != runFailed {
+		t.Errorf("webhook 中的运行记录错误: %+v", payload.Run)
+	}
+	if payload.Subject != "[folder_mirror] apply failed: home" {
+		t.Errorf("标题错误: %q", payload.Subject)
+	}
+	for _, want := range []string{"rsync 执行失败", rec.LogFile, "耗时: 1m30s", "新建 1，更新 2，删除 3"} {
+		if !strings.Contains(payload.Message, want) {
+			t.Errorf("消息中缺少 %q:\n%s", want, payload.Message)
+		}
+	}
+
+	status = http.StatusInternalServerError
+	if err := cfg.sendWebhook(newNotification(rec)); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("服务器返回 500 时应当失败，但得到 %v", err)
+	}
+}
+
+// fakeSMTPServer 是一个只接受邮件的 SMTP 服务器，收到的邮件发送到 mails
+type fakeSMTPServer struct {
+	ln    net.Listener
+	mails chan string
+	rcpts chan []string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("无法监听: %v", err)
+	}
+	s := &fakeSMTPServer{ln: ln, mails: make(chan string, 1), rcpts: make(chan []string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP fake")
+	var rcpts []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			rcpts = append(rcpts, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.rcpts <- rcpts
+			s.mails <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// 测试通过 SMTP 发送邮件
+func TestEmailNotifier(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	defer server.ln.Close()
+
+	cfg := &notifyConfig{
+		Email:      []string{"ops@example.com", "me@example.com"},
+		SMTPServer: server.ln.Addr().String(),
+		SMTPFrom:   "backup@example.com",
+	}
+	rec := testRunRecord(runSuccess)
+	if err := cfg.sendEmail(newNotification(rec)); err != nil {
+		t.Fatalf("发送邮件失败: %v", err)
+	}
+	if rcpts := <-server.rcpts; strings.Join(rcpts, ",") != "ops@example.com,me@example.com" {
+		t.Errorf("收件人错误: %v", rcpts)
+	}
+	mail := <-server.mails
+	for _, want := range []string{"From: backup@example.com\r\n", "To: ops@example.com, me@example.com\r\n", "Subject: [folder_mirror] apply success: home\r\n", "运行日志: " + rec.LogFile + "\r\n"} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("邮件中缺少 %q:\n%s", want, mail)
+		}
+	}
+
+	// 服务器不可用时返回错误
+	server.ln.Close()
+	if err := cfg.sendEmail(newNotification(rec)); err == nil {
+		t.Error("服务器不可用时应当返回错误")
+	}
+}
+
+// 测试 notify-send 的参数，以及失败时只输出警告
+func TestDesktopNotifier(t *testing.T) {
+	origExec, origHook, origDisable := execCommand, printHook, disablePrint
+	defer func() { execCommand, printHook, disablePrint = origExec, origHook, origDisable }()
+	var name string
+	var args []string
+	execCommand = func(n string, a ...string) *exec.Cmd {
+		name, args = n, a
+		return exec.Command("false")
+	}
+	var printed []string
+	printHook = func(message string) { printed = append(printed, message) }
+	disablePrint = true
+
+	rec := testRunRecord(runFailed)
+	sendNotifications(&notifyConfig{Desktop: true}, testRunRecord(runSuccess))
+	if name != "" {
+		t.Error("成功时默认不应发送通知")
+	}
+	sendNotifications(&notifyConfig{Desktop: true}, rec)
+	if name != "notify-send" || len(args) != 4 || args[1] != "--urgency=critical" || !strings.Contains(args[3], rec.LogFile) {
+		t.Errorf("notify-send 参数错误: %s %v", name, args)
+	}
+	if len(printed) != 1 || !strings.Contains(printed[0], "发送 desktop 通知失败") {
+		t.Errorf("发送失败时应当输出警告，但得到 %v", printed)
+	}
+}
+
+// 测试 systemd 单元失败时的通知：运行本身刚刚失败时已经通知过，不再重复
+func TestNotifyCommand(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "notify_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testDir)
+
+	var payloads []webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	oldHistoryFile, oldDisablePrint := historyFile, disablePrint
+	oldResult := os.Getenv("MONITOR_SERVICE_RESULT")
+	defer func() {
+		historyFile, disablePrint = oldHistoryFile, oldDisablePrint
+		os.Setenv("MONITOR_SERVICE_RESULT", oldResult)
+	}()
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	disablePrint = true
+	os.Setenv("MONITOR_SERVICE_RESULT", "timeout")
+	restore := setupProfilesFile(t, testDir, "[home]\nsource = /a\ntarget = /b\nnotify_webhook = "+server.URL+"\n")
+	defer restore()
+
+	// 最近一次运行成功，进程在运行中被终止
+	appendHistory(historyFile, &runRecord{ID: "1", Profile: "home", Mode: "apply", End: time.Now().Add(-time.Hour), Status: runSuccess})
+	if code := runMainForExit([]string{"notify", "--profile", "home", "--unit", "folder_mirror-home.service"}); code != 0 {
+		t.Fatalf("期望退出码 0，但得到 %d", code)
+	}
+	if len(payloads) != 1 || payloads[0].Run.Status != runFailed || !strings.Contains(payloads[0].Message, "systemd 单元 folder_mirror-home.service 失败: timeout") {
+		t.Fatalf("通知不正确: %+v", payloads)
+	}
+
+	// 运行刚刚记录了失败并发送了通知
+	appendHistory(historyFile, &runRecord{ID: "2", Profile: "home", Mode: "apply", End: time.Now(), Status: runFailed})
+	runMainForExit([]string{"notify", "--profile", "home", "--unit", "folder_mirror-home.service"})
+	if len(payloads) != 1 {
+		t.Errorf("运行已经通知过失败时不应重复通知，收到 %d 个通知", len(payloads))
+	}
+
+	if code := runMainForExit([]string{"notify"}); code != 1 {
+		t.Errorf("没有 --profile 时期望退出码 1，但得到 %d", code)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 输出格式
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// 当前的输出格式，由 --output 设置（变量以便于测试）
+var outputFormat = outputText
+
+// 事件类型，JSON 输出中 type 字段的取值，脚本可以依赖这些值
+const (
+	eventMessage    = "message"     // 一般消息，级别见 level
+	eventError      = "error"       // 导致运行失败的错误，code 为稳定的错误代码
+	eventFileChange = "file_change" // rsync 列出的一个文件变化
+	eventProgress   = "progress"    // 当前文件的传输进度
+	eventOutput     = "output"      // 无法解析的 rsync 输出
+	eventSummary    = "summary"     // 一次 plan 或 apply 运行的结果
+	eventDrift      = "drift"       // 校验发现的一处差异，drift 为 missing、extra 或 differ
+	eventScrub      = "scrub"       // scrub 发现的一个问题，problem 为 missing、truncated、modified、bitrot 或 unreadable
+)
+
+// 消息级别
+const (
+	levelDebug   = "debug" // 只在 -v 或 -vv 时输出的细节
+	levelInfo    = "info"
+	levelNotice  = "notice"
+	levelWarning = "warning"
+	levelError   = "error"
+)
+
+// outputEvent 是 --output=json 时输出的一行 JSON
+type outputEvent struct {
+	Time    time.Time  `json:"time"`
+	Type    string     `json:"type"`
+	Level   string     `json:"level,omitempty"`
+	Code    string     `json:"code,omitempty"`
+	ID      string     `json:"id,omitempty"` // 镜像消息的稳定 ID，与 --lang 无关
+	Message string     `json:"message,omitempty"`
+	Path    string     `json:"path,omitempty"`
+	Change  string     `json:"change,omitempty"` // rsync --itemize-changes 的变化代码，删除时为 *deleting
+	Bytes   int64      `json:"bytes,omitempty"`
+	Percent int        `json:"percent,omitempty"`
+	Rate    string     `json:"rate,omitempty"`
+	ETA     string     `json:"eta,omitempty"`
+	Drift   string     `json:"drift,omitempty"`   // 差异类型
+	Reason  string     `json:"reason,omitempty"`  // 条目不一致的原因：type、size、mtime、content 或 link
+	Problem string     `json:"problem,omitempty"` // scrub 发现的问题类型
+	Run     *runRecord `json:"run,omitempty"`
+}
+
+var outputMu sync.Mutex
+
+// 以 JSON 行的形式输出事件
+func emitJSON(ev outputEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	os.Stdout.Write(append(data, '\n'))
+}
+
+// 判断是否以 JSON 行输出
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// outputFlag 实现 --output 参数，只接受 text 和 json
+type outputFlag struct{}
+
+func (outputFlag) String() string { return outputFormat }
+
+func (outputFlag) Set(value string) error {
+	if value != outputText && value != outputJSON {
+		return errors.New(tr("output.invalid", outputText, outputJSON))
+	}
+	outputFormat = value
+	return nil
+}
+
+// 添加 --output 参数
+func addOutputFlag(fs *flag.FlagSet) {
+	fs.Var(outputFlag{}, "output", tr("flag.output"))
+}
+
+// 根据颜色确定消息级别
+// 黄色只表示需要注意的提示，计入运行警告数的警告由 printWarning 输出
+func levelForColor(color string) string {
+	switch color {
+	case colorRed:
+		return levelError
+	case colorYellow:
+		return levelNotice
+	default:
+		return levelInfo
+	}
+}
+
+// 错误对应的稳定错误代码
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{mirror.ErrSourceMissing, "source_missing"},
+	{mirror.ErrSourceEmpty, "source_empty"},
+	{mirror.ErrNestedPaths, "nested_paths"},
+	{mirror.ErrRemotePath, "remote_path"},
+	{mirror.ErrMarkerMissing, "marker_missing"},
+	{mirror.ErrMarkerStale, "marker_stale"},
+	{mirror.ErrMarkerInvalid, "marker_invalid"},
+	{mirror.ErrRuleFileMissing, "rule_file_missing"},
+	{mirror.ErrLocked, "locked"},
+	{mirror.ErrInterrupted, "interrupted"},
+	{mirror.ErrRsyncFailed, "rsync_failed"},
+	{mirror.ErrSyncFailed, "sync_failed"},
+	{errHookFailed, "hook_failed"},
+	{errVerifyDrift, "verify_drift"},
+	{errScrubProblems, "scrub_problems"},
+}
+
+// 返回错误的稳定代码，无法识别时为 "error"
+func errorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return "error"
+}
+
+// 输出导致运行失败的错误
+func printError(err error) {
+	if jsonOutput() {
+		emitJSON(outputEvent{Type: eventError, Level: levelError, Code: errorCode(err), Message: localizedError(err)})
+		if printHook != nil {
+			printHook(tr("msg.error", localizedError(err)))
+		}
+		return
+	}
+	printColored(colorRed, tr("msg.error", localizedError(err)))
+}
+
+// 输出运行结果
+func printSummary(rec *runRecord) {
+	if !jsonOutput() {
+		return
+	}
+	level := levelInfo
+	if rec.Status != runSuccess {
+		level = levelError
+	}
+	emitJSON(outputEvent{Type: eventSummary, Level: level, Message: rec.Status, Run: rec})
+}
+
+// rsync --progress 输出的进度行，例如 "  1,234,567  45%  1.23MB/s    0:00:12"
+var progressLine = regexp.MustCompile(`^\s*([\d,]+)\s+(\d+)%\s+(\S+/s)\s+(\d+:\d+:\d+)`)
+
+// 解析一行 --itemize-changes 输出，返回变化代码和路径
+func parseItemizedLine(line string) (string, string, bool) {
+	if strings.HasPrefix(line, "*deleting") {
+		return "*deleting", strings.TrimSpace(strings.TrimPrefix(line, "*deleting")), true
+	}
+	// 差异行以更新类型字符开头，之后是 10 个属性字符和一个空格
+	if len(line) > 12 && strings.ContainsRune("<>ch.", rune(line[0])) && line[11] == ' ' {
+		return line[:11], line[12:], true
+	}
+	return "", "", false
+}
+
+// changeCounts 统计 rsync --itemize-changes 列出的文件变化
+type changeCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// 统计一行 rsync 输出，只改变属性的条目（变化代码以 . 开头）不计入
+func (c *changeCounts) add(line string) {
+	change, _, ok := parseItemizedLine(line)
+	switch {
+	case !ok:
+	case change == "*deleting":
+		c.Deleted++
+	case strings.HasSuffix(change, "+++++++++"):
+		c.Created++
+	case change[0] != '.':
+		c.Updated++
+	}
+}
+
+// lineWriter 把写入的内容按行（包括 --progress 使用的回车）交给 fn，不完整的行等到换行时才处理
+type lineWriter struct {
+	fn  func(string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// 把一行 rsync 输出转换为事件
+func rsyncOutputEvent(line string) outputEvent {
+	if change, path, ok := parseItemizedLine(line); ok {
+		return outputEvent{Type: eventFileChange, Change: change, Path: path}
+	}
+	if m := progressLine.FindStringSubmatch(line); m != nil {
+		n, _ := strconv.ParseInt(strings.Replace(m[1], ",", "", -1), 10, 64)
+		percent, _ := strconv.Atoi(m[2])
+		return outputEvent{Type: eventProgress, Bytes: n, Percent: percent, Rate: m[3], ETA: m[4]}
+	}
+	return outputEvent{Type: eventOutput, Message: line}
+}
+
+// jsonOutputWriter 把 rsync 的输出按行（包括 --progress 使用的回车）转换为事件
+// 不完整的行等到换行时才输出，进度事件带上最近一个文件变化的路径
+type jsonOutputWriter struct {
+	level string
+	buf   []byte
+	path  string
+}
+
+func (w *jsonOutputWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.emit(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *jsonOutputWriter) emit(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	ev := rsyncOutputEvent(line)
+	switch ev.Type {
+	case eventFileChange:
+		w.path = ev.Path
+	case eventProgress:
+		ev.Path = w.path
+	case eventOutput:
+		ev.Level = w.level
+	}
+	emitJSON(ev)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 测试 rsync 输出行的解析
+func TestRsyncOutputEvent(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected outputEvent
+	}{
+		{">f+++++++++ dir/new file.txt", outputEvent{Type: eventFileChange, Change: ">f+++++++++", Path: "dir/new file.txt"}},
+		{"*deleting   old.txt", outputEvent{Type: eventFileChange, Change: "*deleting", Path: "old.txt"}},
+		{"      1,234,567  45%    1.23MB/s    0:00:12", outputEvent{Type: eventProgress, Bytes: 1234567, Percent: 45, Rate: "1.23MB/s", ETA: "0:00:12"}},
+		{"sent 123 bytes  received 45 bytes  336.00 bytes/sec", outputEvent{Type: eventOutput, Message: "sent 123 bytes  received 45 bytes  336.00 bytes/sec"}},
+	}
+	for _, tc := range testCases {
+		if got := rsyncOutputEvent(tc.line); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: 期望 %+v，但得到 %+v", tc.line, tc.expected, got)
+		}
+	}
+}
+
+// 测试错误代码
+func TestErrorCode(t *testing.T) {
+	testCases := map[error]string{
+		mirror.ErrMarkerMissing:                               "marker_missing",
+		fmt.Errorf("检查失败: %w", mirror.ErrSourceEmpty):         "source_empty",
+		&mirror.LockedError{Path: "/x"}:                       "locked",
+		&mirror.RsyncError{Err: errors.New("exit status 23")}: "rsync_failed",
+		fmt.Errorf("镜像失败: %w", mirror.ErrSyncFailed):          "sync_failed",
+		errors.New("其他错误"):                                    "error",
+	}
+	for err, code := range testCases {
+		if got := errorCode(err); got != code {
+			t.Errorf("%v: 期望错误代码 %s，但得到 %s", err, code, got)
+		}
+	}
+}
+
+// 读取 JSON 行输出，每一行都必须是合法的 JSON
+func readJSONEvents(t *testing.T, path string) []outputEvent {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("打开输出文件失败: %v", err)
+	}
+	defer f.Close()
+	var events []outputEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev outputEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Errorf("输出不是 JSON: %q", scanner.Text())
+			continue
+		}
+		if ev.Type == "" || ev.Time.IsZero() {
+			t.Errorf("事件缺少 type 或 time: %q", scanner.Text())
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// 测试 --output=json 时所有输出都是 JSON 事件
+func TestJSONOutput(t *testing.T) {
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	oldExecCommand := execCommand
+	oldMarkerFile := markerFile
+	oldOutputFormat := outputFormat
+	oldStdout := os.Stdout
+	oldTesting := os.Getenv("TESTING")
+	defer func() {
+		execCommand = oldExecCommand
+		markerFile = oldMarkerFile
+		outputFormat = oldOutputFormat
+		os.Stdout = oldStdout
+		os.Setenv("TESTING", oldTesting)
+	}()
+
+	os.Setenv("TESTING", "1")
+	markerFile = filepath.Join(testDir, "marker")
+	var rsyncArgs []string
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		rsyncArgs = args
+		script := "printf '>f+++++++++ a.txt\\nsent 10 bytes\\n'; echo 'rsync warning: some files vanished' >&2"
+		if len(args) > 0 && !strings.Contains(strings.Join(args, " "), " -n ") {
+			script = "printf '>f+++++++++ a.txt\\n          4 100%%    0.00kB/s    0:00:00\\r'"
+		}
+		return exec.Command("sh", "-c", script)
+	}
+
+	outPath := filepath.Join(testDir, "out.jsonl")
+	out, _ := os.Create(outPath)
+	os.Stdout = out
+	planCode := runMainForExit([]string{"plan", "--output=json", sourceDir, targetDir})
+	applyCode := runMainForExit([]string{"apply", "--output", "json", sourceDir, targetDir})
+	missingCode := runMainForExit([]string{"apply", "--output=json", sourceDir, targetDir})
+	out.Close()
+	os.Stdout = oldStdout
+
+	if planCode != 0 || applyCode != 0 || missingCode != 1 {
+		t.Fatalf("期望退出码 0 0 1，但得到 %d %d %d", planCode, applyCode, missingCode)
+	}
+	if rsyncArgs[len(rsyncArgs)-3] != "--itemize-changes" {
+		t.Errorf("JSON 输出时应当添加 --itemize-changes: %v", rsyncArgs)
+	}
+
+	var summaries []string
+	var types = map[string]int{}
+	for _, ev := range readJSONEvents(t, outPath) {
+		types[ev.Type]++
+		switch ev.Type {
+		case eventFileChange:
+			if ev.Path != "a.txt" || ev.Change != ">f+++++++++" {
+				t.Errorf("文件变化事件不正确: %+v", ev)
+			}
+		case eventProgress:
+			if ev.Path != "a.txt" || ev.Percent != 100 || ev.Bytes != 4 {
+				t.Errorf("进度事件不正确: %+v", ev)
+			}
+		case eventOutput:
+			if ev.Level == levelError && !strings.Contains(ev.Message, "vanished") {
+				t.Errorf("标准错误事件不正确: %+v", ev)
+			}
+		case eventError:
+			if ev.Code != "marker_missing" {
+				t.Errorf("错误事件的代码不正确: %+v", ev)
+			}
+		case eventSummary:
+			if ev.Run == nil {
+				t.Fatalf("结果事件缺少运行记录: %+v", ev)
+			}
+			summaries = append(summaries, ev.Run.Mode+":"+ev.Run.Status)
+			if ev.Run.LogFile == "" {
+				t.Errorf("结果事件应当包含日志路径: %+v", ev.Run)
+			}
+		}
+	}
+	for _, typ := range []string{eventMessage, eventFileChange, eventProgress, eventOutput, eventError, eventSummary} {
+		if types[typ] == 0 {
+			t.Errorf("没有输出 %s 事件: %v", typ, types)
+		}
+	}
+	expected := []string{"plan:success", "apply:success", "apply:failed"}
+	if !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("期望运行结果 %v，但得到 %v", expected, summaries)
+	}
+}
+
+// 测试 --output 只接受 text 和 json
+func TestOutputFlag(t *testing.T) {
+	oldOutputFormat := outputFormat
+	defer func() { outputFormat = oldOutputFormat }()
+
+	fs := newCommandFlagSet("status")
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse([]string{"--output=xml"}); err == nil {
+		t.Error("未知的输出格式应当被拒绝")
+	}
+	if err := fs.Parse([]string{"--output=json"}); err != nil || !jsonOutput() {
+		t.Errorf("应当切换到 JSON 输出: %v", err)
+	}
+}
+
+// 测试只有警告计入运行的警告数，黄色的提示不计入
+func TestWarningCount(t *testing.T) {
+	oldDisablePrint := disablePrint
+	defer func() { disablePrint = oldDisablePrint }()
+	disablePrint = true
+
+	before := warningsSoFar()
+	printNotice("提示")
+	printColored(colorYellow, "需要注意")
+	if got := warningsSoFar() - before; got != 0 {
+		t.Errorf("提示不应计入警告数，但计入了 %d 个", got)
+	}
+	printWarning("警告")
+	if got := warningsSoFar() - before; got != 1 {
+		t.Errorf("警告应当计入警告数，但计入了 %d 个", got)
+	}
+}
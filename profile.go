@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-username/folder_mirror/filter"
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// 配置文件路径，为空时使用默认路径（变量以便于测试）
+var profilesFile = ""
+
+// 内置预设写入的目录，为空时使用用户缓存目录（变量以便于测试）
+var presetDir = ""
+
+// profile 描述配置文件中的一个镜像配置
+type profile struct {
+	Name        string
+	Source      string
+	Target      string
+	ExcludeFrom string            // 排除规则文件，为空时使用默认文件
+	IncludeFrom string            // 包含规则文件，为空时使用默认文件
+	Presets     []string          // 启用的内置规则预设
+	Retention   *retentionPolicy  // 运行日志的保留策略，为 nil 时使用默认策略
+	Hooks       map[string]string // 钩子名称到命令，见 hookNames
+	Notify      notifyConfig      // 运行结束时的通知
+	MetricsDir  string            // node_exporter textfile collector 的目录，为空时不写指标
+	Freshness   time.Duration     // 最近一次成功镜像的最长间隔，status 据此判断配置是否过期，为 0 时不检查
+	Schedule    string            // daemon 运行这个配置的调度表达式，为空时不定时运行
+	Jitter      time.Duration     // 每次定时运行随机推迟的最长时间
+	Unattended  bool              // 定时运行时在 plan 的结果不超过 Limits 时直接 apply
+	Limits      *planLimits       // 无人值守运行和 watch 的上限，为 nil 时使用默认上限
+	Sync        syncSettings      // 同步后端和并行同步的分片
+}
+
+// ruleConfig 描述一次镜像使用的规则来源
+// 规则的生效顺序为：排除规则文件、内置预设、包含规则文件
+type ruleConfig struct {
+	ExcludeFrom string
+	IncludeFrom string
+	Presets     []string
+}
+
+// 获取配置文件路径
+func profilesPath() (string, error) {
+	if profilesFile != "" {
+		return profilesFile, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, "loadrc/bashrc/mirror_profiles"), nil
+}
+
+// 展开路径开头的 ~
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[1:])
+}
+
+// 把逗号分隔的列表拆分为去掉空白的元素
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// 读取配置文件
+// 文件格式为 INI 风格：[名称] 开始一个配置，之后每行一个 key = value，# 和 ; 开头的行为注释
+func loadProfiles(path string) ([]*profile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var profiles []*profile
+	var current *profile
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, errors.New(tr("profile.empty_name", path, lineNo))
+			}
+			for _, p := range profiles {
+				if p.Name == name {
+					return nil, errors.New(tr("profile.duplicate", path, lineNo, name))
+				}
+			}
+			current = &profile{Name: name}
+			profiles = append(profiles, current)
+			continue
+		}
+		if current == nil {
+			return nil, errors.New(tr("profile.outside_section", path, lineNo))
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, errors.New(tr("profile.bad_line", path, lineNo, line))
+		}
+		key := strings.TrimSpace(line[:eq])
+		value := strings.TrimSpace(line[eq+1:])
+		if err := current.set(key, value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// 设置配置项
+func (p *profile) set(key, value string) error {
+	switch key {
+	case "source":
+		p.Source = expandHome(value)
+	case "target":
+		p.Target = expandHome(value)
+	case "exclude_from":
+		p.ExcludeFrom = expandHome(value)
+	case "include_from":
+		p.IncludeFrom = expandHome(value)
+	case "presets":
+		p.Presets = splitList(value)
+	case "metrics_dir":
+		p.MetricsDir = expandHome(value)
+	case "freshness":
+		d, err := parseAge(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		p.Freshness = d
+	case "schedule":
+		if _, err := parseSchedule(value); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		p.Schedule = value
+	case "jitter":
+		d, err := parseAge(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		p.Jitter = d
+	case "backend":
+		if err := checkBackend(value); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		p.Sync.Backend = value
+	case "shards", "shard_depth":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return errors.New(tr("profile.not_positive", key, value))
+		}
+		if key == "shards" {
+			p.Sync.Shards = n
+		} else {
+			p.Sync.ShardDepth = n
+		}
+	case "unattended":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New(tr("config.not_bool", key, value))
+		}
+		p.Unattended = b
+	case "max_deletes", "max_changes":
+		return p.setLimit(key, value)
+	case "log_keep", "log_max_age", "log_compress_after":
+		return p.setRetention(key, value)
+	default:
+		if ok, err := p.Notify.set(key, value); ok {
+			return err
+		}
+		if name := strings.TrimPrefix(key, "hook_"); name != key && validHook(name) {
+			if p.Hooks == nil {
+				p.Hooks = make(map[string]string)
+			}
+			p.Hooks[name] = value
+			return nil
+		}
+		return errors.New(tr("profile.unknown_key", key))
+	}
+	return nil
+}
+
+// 设置运行日志的保留策略，未设置的项使用默认值
+func (p *profile) setRetention(key, value string) error {
+	if p.Retention == nil {
+		policy := defaultLogRetention
+		p.Retention = &policy
+	}
+	if key == "log_keep" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return errors.New(tr("profile.not_non_negative", key, value))
+		}
+		p.Retention.Keep = n
+		return nil
+	}
+	d, err := parseAge(value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	if key == "log_max_age" {
+		p.Retention.MaxAge = d
+	} else {
+		p.Retention.CompressAfter = d
+	}
+	return nil
+}
+
+// 设置无人值守运行和 watch 的上限，未设置的项使用默认值
+func (p *profile) setLimit(key, value string) error {
+	if p.Limits == nil {
+		limits := defaultPlanLimits
+		p.Limits = &limits
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < -1 {
+		return errors.New(tr("profile.bad_limit", key, value))
+	}
+	if key == "max_deletes" {
+		p.Limits.MaxDeletes = n
+	} else {
+		p.Limits.MaxChanges = n
+	}
+	return nil
+}
+
+// 按名称查找配置
+func findProfile(name string) (*profile, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return nil, errors.New(tr("profile.read_failed", err))
+	}
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, errors.New(tr("profile.not_found", path, name))
+}
+
+// 根据默认规则文件、配置和 --preset 参数确定规则来源
+func resolveRuleConfig(profileName, presets string) (ruleConfig, *profile, error) {
+	var prof *profile
+	if profileName != "" {
+		var err error
+		prof, err = findProfile(profileName)
+		if err != nil {
+			return ruleConfig{}, nil, err
+		}
+	}
+	cfg, err := profileRuleConfig(prof, presets)
+	if err != nil {
+		return ruleConfig{}, nil, err
+	}
+	return cfg, prof, nil
+}
+
+// 根据默认规则文件、配置 prof（可以为 nil）和 --preset 参数确定规则来源
+func profileRuleConfig(prof *profile, presets string) (ruleConfig, error) {
+	excludePath, includePath, err := defaultRuleFiles()
+	if err != nil {
+		return ruleConfig{}, errors.New(tr("run.home_dir_failed", err))
+	}
+	cfg := ruleConfig{ExcludeFrom: excludePath, IncludeFrom: includePath}
+	if prof != nil {
+		if prof.ExcludeFrom != "" {
+			cfg.ExcludeFrom = prof.ExcludeFrom
+		}
+		if prof.IncludeFrom != "" {
+			cfg.IncludeFrom = prof.IncludeFrom
+		}
+		cfg.Presets = append(cfg.Presets, prof.Presets...)
+	}
+	cfg.Presets = append(cfg.Presets, splitList(presets)...)
+
+	for _, name := range cfg.Presets {
+		if _, err := filter.PresetSource(name); err != nil {
+			return ruleConfig{}, err
+		}
+	}
+	return cfg, nil
+}
+
+// 按生效顺序加载规则来源中的全部规则
+func loadRuleFilter(cfg ruleConfig) (*filter.Filter, error) {
+	excludes, err := filter.ReadFile(cfg.ExcludeFrom, false)
+	if err != nil {
+		return nil, err
+	}
+	ruleSets := [][]filter.Rule{excludes}
+	for _, name := range cfg.Presets {
+		rules, err := filter.Preset(name)
+		if err != nil {
+			return nil, err
+		}
+		ruleSets = append(ruleSets, rules)
+	}
+	if cfg.IncludeFrom != "" {
+		if _, err := os.Stat(cfg.IncludeFrom); err == nil {
+			includes, err := filter.ReadFile(cfg.IncludeFrom, true)
+			if err != nil {
+				return nil, err
+			}
+			ruleSets = append(ruleSets, includes)
+		}
+	}
+	return filter.New(ruleSets...), nil
+}
+
+// 获取内置预设写入的目录
+func presetCacheDir() (string, error) {
+	if presetDir != "" {
+		return presetDir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "folder_mirror", "presets"), nil
+}
+
+// 把内置预设写入文件，以便通过 --exclude-from 传给 rsync
+// 文件内容与当前程序版本不一致时重写；先写入临时文件再重命名，同时运行的多个进程不会互相删除对方写入的文件
+func writePresetFile(name string) (string, error) {
+	src, err := filter.PresetSource(name)
+	if err != nil {
+		return "", err
+	}
+	dir, err := presetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	if err := securefile.MkdirAll(dir); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name+".rules")
+	header := fmt.Sprintf("# folder_mirror built-in preset %s, generated automatically, do not edit\n", name)
+	data := []byte(header + src)
+	if err := securefile.Check(path); err == nil {
+		if old, err := ioutil.ReadFile(path); err == nil && bytes.Equal(old, data) {
+			return path, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// 判断规则文件是否为写出的内置预设，返回预设名称
+func presetNameForFile(path string) (string, bool) {
+	dir, err := presetCacheDir()
+	if err != nil || filepath.Dir(path) != dir || !strings.HasSuffix(path, ".rules") {
+		return "", false
+	}
+	return strings.TrimSuffix(filepath.Base(path), ".rules"), true
+}
+
+// ruleFlags 保存子命令中与规则来源相关的参数
+type ruleFlags struct {
+	excludeFrom *string
+	includeFrom *string
+	profile     *string
+	presets     *string
+	backend     *string
+	shards      *int
+	shardDepth  *int
+}
+
+// 为子命令添加 --exclude-from、--include-from、--profile、--preset 以及同步方式的 --backend、--shards 和 --shard-depth 参数
+func addRuleFlags(fs *flag.FlagSet) *ruleFlags {
+	rf := &ruleFlags{
+		excludeFrom: fs.String("exclude-from", "", tr("flag.exclude_from")),
+		includeFrom: fs.String("include-from", "", tr("flag.include_from")),
+		profile:     fs.String("profile", "", tr("flag.profile")),
+		presets:     fs.String("preset", "", tr("flag.preset")),
+		backend:     new(string),
+		shards:      fs.Int("shards", 0, tr("flag.shards")),
+		shardDepth:  fs.Int("shard-depth", 0, tr("flag.shard_depth")),
+	}
+	fs.Var(backendFlag{rf.backend}, "backend", tr("flag.backend"))
+	return rf
+}
+
+// 确定同步方式，命令行参数优先于配置
+func (rf *ruleFlags) sync(prof *profile) syncSettings {
+	var s syncSettings
+	if prof != nil {
+		s = prof.Sync
+	}
+	if *rf.backend != "" {
+		s.Backend = *rf.backend
+	}
+	if *rf.shards > 0 {
+		s.Shards = *rf.shards
+	}
+	if *rf.shardDepth > 0 {
+		s.ShardDepth = *rf.shardDepth
+	}
+	return s
+}
+
+// 根据参数确定规则来源，显式指定的规则文件优先于配置
+func (rf *ruleFlags) config() (ruleConfig, *profile, error) {
+	cfg, prof, err := resolveRuleConfig(*rf.profile, *rf.presets)
+	if err != nil {
+		return ruleConfig{}, nil, err
+	}
+	if *rf.excludeFrom != "" {
+		cfg.ExcludeFrom = *rf.excludeFrom
+	}
+	if *rf.includeFrom != "" {
+		cfg.IncludeFrom = *rf.includeFrom
+	}
+	return cfg, prof, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 写入测试用配置文件并让 profilesFile 指向它，返回恢复函数
+func setupProfilesFile(t *testing.T, dir, content string) func() {
+	path := filepath.Join(dir, "mirror_profiles")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("无法写入配置文件: %v", err)
+	}
+	oldProfilesFile := profilesFile
+	profilesFile = path
+	return func() { profilesFile = oldProfilesFile }
+}
+
+// 测试读取配置文件
+func TestLoadProfiles(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "profiles_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "profiles")
+	content := strings.Join([]string{
+		"# 注释",
+		"[home]",
+		"source = /home/user/",
+		"target = /backup/home/",
+		"presets = node, editor ,",
+		"",
+		"[work]",
+		"; 另一种注释",
+		"source = ~/work",
+		"target = /backup/work",
+		"exclude_from = /etc/mirror_exclude",
+	}, "\n")
+	ioutil.WriteFile(path, []byte(content), 0644)
+
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		t.Fatalf("loadProfiles 失败: %v", err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("配置数量不匹配: 得到 %d, 期望 2", len(profiles))
+	}
+	home := profiles[0]
+	if home.Name != "home" || home.Source != "/home/user/" || home.Target != "/backup/home/" {
+		t.Errorf("配置 home 解析错误: %+v", home)
+	}
+	if strings.Join(home.Presets, ",") != "node,editor" {
+		t.Errorf("预设列表解析错误: %v", home.Presets)
+	}
+	homeDir, _ := os.UserHomeDir()
+	if profiles[1].Source != filepath.Join(homeDir, "work") || profiles[1].ExcludeFrom != "/etc/mirror_exclude" {
+		t.Errorf("配置 work 解析错误: %+v", profiles[1])
+	}
+
+	errorCases := map[string]string{
+		"设置项在配置之前": "source = /a\n",
+		"未知设置项":    "[a]\ncolour = red\n",
+		"缺少等号":     "[a]\nsource\n",
+		"重复配置":     "[a]\n[a]\n",
+		"空配置名称":    "[ ]\n",
+	}
+	for name, content := range errorCases {
+		ioutil.WriteFile(path, []byte(content), 0644)
+		if _, err := loadProfiles(path); err == nil {
+			t.Errorf("%s: 应当返回错误", name)
+		}
+	}
+
+	if _, err := loadProfiles(filepath.Join(tempDir, "missing")); err == nil {
+		t.Error("配置文件不存在时应当返回错误")
+	}
+}
+
+// 测试根据配置和参数确定规则来源
+func TestResolveRuleConfig(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "rule_config_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	defer setupProfilesFile(t, tempDir, "[home]\nsource = /a\ntarget = /b\nexclude_from = /x/exclude\npresets = node\n")()
+
+	cfg, prof, err := resolveRuleConfig("home", "editor")
+	if err != nil {
+		t.Fatalf("resolveRuleConfig 失败: %v", err)
+	}
+	if prof == nil || prof.Name != "home" {
+		t.Errorf("应当返回配置 home，得到: %+v", prof)
+	}
+	if cfg.ExcludeFrom != "/x/exclude" || !strings.HasSuffix(cfg.IncludeFrom, "mirror_include") {
+		t.Errorf("规则文件不正确: %+v", cfg)
+	}
+	if strings.Join(cfg.Presets, ",") != "node,editor" {
+		t.Errorf("预设不正确: %v", cfg.Presets)
+	}
+
+	cfg, prof, err = resolveRuleConfig("", "")
+	if err != nil || prof != nil || len(cfg.Presets) != 0 || !strings.HasSuffix(cfg.ExcludeFrom, "mirror_exclude") {
+		t.Errorf("没有配置时应当使用默认规则文件: %+v, %v", cfg, err)
+	}
+
+	if _, _, err := resolveRuleConfig("missing", ""); err == nil {
+		t.Error("配置不存在时应当返回错误")
+	}
+	if _, _, err := resolveRuleConfig("", "no-such-preset"); err == nil {
+		t.Error("预设不存在时应当返回错误")
+	}
+}
+
+// 测试规则按排除文件、预设、包含文件的顺序加载
+func TestLoadRuleFilter(t *testing.T) {
+	testDir, _, _ := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+	excludeFile, includeFile := createTestRuleFiles(t, testDir)
+
+	f, err := loadRuleFilter(ruleConfig{ExcludeFrom: excludeFile, IncludeFrom: includeFile, Presets: []string{"node"}})
+	if err != nil {
+		t.Fatalf("loadRuleFilter 失败: %v", err)
+	}
+	if f.Rules[0].File != excludeFile || f.Rules[len(f.Rules)-1].File != includeFile {
+		t.Error("排除规则应当在最前，包含规则应当在最后")
+	}
+	found := false
+	for _, r := range f.Rules {
+		if r.File == "preset:node" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("应当包含预设 node 的规则")
+	}
+
+	if _, err := loadRuleFilter(ruleConfig{ExcludeFrom: filepath.Join(testDir, "missing")}); err == nil {
+		t.Error("排除规则文件不存在时应当返回错误")
+	}
+}
+
+// 测试内置预设写入文件后传给 rsync
+func TestPresetRsyncArgs(t *testing.T) {
+	testDir, _, _ := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+	excludeFile, includeFile := createTestRuleFiles(t, testDir)
+
+	oldPresetDir := presetDir
+	presetDir = filepath.Join(testDir, "presets")
+	defer func() { presetDir = oldPresetDir }()
+
+	args := prepareRsyncArgsWith(ruleConfig{ExcludeFrom: excludeFile, IncludeFrom: includeFile, Presets: []string{"node", "editor"}})
+	joined := strings.Join(args, " ")
+	nodeFile := filepath.Join(presetDir, "node.rules")
+	if !strings.Contains(joined, "--exclude-from="+nodeFile) {
+		t.Errorf("参数中应当包含预设文件: %v", args)
+	}
+	if strings.Index(joined, "node.rules") > strings.Index(joined, "--include-from=") {
+		t.Error("预设应当位于包含规则之前")
+	}
+
+	// 预设文件与其他状态文件一样只有当前用户可以访问，不跟随符号链接
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(nodeFile); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("预设文件权限应当为 0600: %v, %v", info, err)
+		}
+		if info, err := os.Stat(presetDir); err != nil || info.Mode().Perm() != 0700 {
+			t.Errorf("预设目录权限应当为 0700: %v, %v", info, err)
+		}
+	}
+
+	if name, ok := presetNameForFile(nodeFile); !ok || name != "node" {
+		t.Errorf("presetNameForFile(%s) = %q, %v", nodeFile, name, ok)
+	}
+	if _, ok := presetNameForFile(excludeFile); ok {
+		t.Error("普通规则文件不应当被识别为预设")
+	}
+
+	// 覆盖报告按预设名称显示规则
+	f, err := filterFromRsyncArgs(args)
+	if err != nil {
+		t.Fatalf("filterFromRsyncArgs 失败: %v", err)
+	}
+	d := f.Decide("web/.next", true)
+	if d.Rule == nil || d.Rule.File != "preset:node" {
+		t.Errorf("web/.next 应当由预设 node 排除，得到: %+v", d.Rule)
+	}
+
+	// 同时运行的多个进程写入同一个预设文件不会失败，内容不变时不重写
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := writePresetFile("node"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("同时写入预设文件失败: %v", err)
+	}
+	ioutil.WriteFile(nodeFile, []byte("stale"), 0600)
+	if _, err := writePresetFile("node"); err != nil {
+		t.Fatalf("writePresetFile 失败: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(nodeFile); !strings.Contains(string(data), "node_modules") {
+		t.Errorf("内容过时的预设文件应当被重写: %q", data)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(presetDir, ".*.tmp")); len(matches) > 0 {
+		t.Errorf("不应当留下临时文件: %v", matches)
+	}
+
+	if runtime.GOOS != "windows" {
+		os.Remove(nodeFile)
+		os.Symlink(excludeFile, nodeFile)
+		if _, err := writePresetFile("node"); err == nil {
+			t.Error("预设文件是符号链接时应当失败")
+		}
+	}
+}
+
+// 测试 rules presets 命令
+func TestRunRulesPresets(t *testing.T) {
+	oldOsExit := osExit
+	oldDisablePrint := disablePrint
+	defer func() {
+		osExit = oldOsExit
+		disablePrint = oldDisablePrint
+	}()
+	disablePrint = true
+
+	rescueStdout := os.Stdout
+	_, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() {
+		w.Close()
+		os.Stdout = rescueStdout
+	}()
+
+	for args, code := range map[string]int{"": 0, "node": 0, "no-such-preset": 1} {
+		exitCode := -1
+		osExit = func(c int) {
+			if exitCode == -1 {
+				exitCode = c
+			}
+		}
+		cmdArgs := []string{"presets"}
+		if args != "" {
+			cmdArgs = append(cmdArgs, args)
+		}
+		runRulesCommand(cmdArgs)
+		if exitCode != code {
+			t.Errorf("rules presets %s: 期望退出码 %d，但得到 %d", args, code, exitCode)
+		}
+	}
+}
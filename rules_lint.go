@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// lintIssue 描述规则检查发现的一个问题
+type lintIssue struct {
+	File    string
+	Line    int
+	Pattern string
+	Message string
+
+	index int // 对应规则在规则列表中的下标
+}
+
+func (i lintIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s [%s]", i.File, i.Line, i.Message, i.Pattern)
+}
+
+// 对规则进行静态检查：语法、空白、重复、被覆盖以及永远无法生效的包含规则
+func lintRules(rules []filter.Rule) []lintIssue {
+	var issues []lintIssue
+	for i := range rules {
+		r := &rules[i]
+		add := func(msg string) {
+			issues = append(issues, lintIssue{File: r.File, Line: r.Line, Pattern: r.Raw, Message: msg, index: i})
+		}
+		if err := filter.CheckSyntax(r.Pattern); err != nil {
+			add(tr("lint.bad_syntax", err))
+			continue
+		}
+		if strings.TrimRight(r.Pattern, " \t") != r.Pattern {
+			add(tr("lint.trailing_space"))
+		}
+		if strings.TrimLeft(r.Pattern, " \t") != r.Pattern {
+			add(tr("lint.leading_space"))
+		}
+
+		for j := 0; j < i; j++ {
+			prev := &rules[j]
+			if filter.CheckSyntax(prev.Pattern) != nil {
+				continue
+			}
+			where := fmt.Sprintf("%s:%d", prev.File, prev.Line)
+			if prev.Pattern == r.Pattern && prev.Include == r.Include {
+				add(tr("lint.duplicate", where))
+				break
+			}
+			if prev.Include == r.Include && prev.Subsumes(r) {
+				add(tr("lint.subsumed", where, prev.Pattern))
+				break
+			}
+			if r.Include && !prev.Include && (prev.Subsumes(r) || prev.ExcludesParentOf(r)) {
+				add(tr("lint.include_shadowed", where, prev.Pattern))
+				break
+			}
+		}
+	}
+	return issues
+}
+
+// ruleHits 记录规则在源目录中的命中情况
+type ruleHits struct {
+	matched int // 规则匹配到的路径数
+	decided int // 规则作为第一条匹配规则决定结果的路径数
+}
+
+// 按 rsync 的方式遍历源目录，统计每条规则的命中情况
+// 被排除的目录不会继续深入，这与 rsync 的行为一致
+func collectRuleHits(f *filter.Filter, source string) ([]ruleHits, error) {
+	hits := make([]ruleHits, len(f.Rules))
+	err := f.Walk(source, func(relPath string, info os.FileInfo, idx int, included bool) error {
+		for i := range f.Rules {
+			if f.Rules[i].Matches(relPath, info.IsDir()) {
+				hits[i].matched++
+			}
+		}
+		if idx >= 0 {
+			hits[idx].decided++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+// 结合源目录检查规则：找出没有匹配任何路径或从未生效的规则
+func lintRulesAgainstTree(f *filter.Filter, source string, reported map[int]bool) ([]lintIssue, error) {
+	hits, err := collectRuleHits(f, source)
+	if err != nil {
+		return nil, err
+	}
+	var issues []lintIssue
+	for i := range f.Rules {
+		r := &f.Rules[i]
+		if reported[i] {
+			continue
+		}
+		msg := ""
+		switch {
+		case hits[i].matched == 0:
+			msg = tr("lint.no_match")
+		case hits[i].decided == 0 && r.Include:
+			msg = tr("lint.include_never_decides")
+		case hits[i].decided == 0:
+			msg = tr("lint.never_decides")
+		}
+		if msg != "" {
+			issues = append(issues, lintIssue{File: r.File, Line: r.Line, Pattern: r.Raw, Message: msg, index: i})
+		}
+	}
+	return issues, nil
+}
+
+// 按文件和行号排序问题列表
+func sortLintIssues(issues []lintIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+}
+
+// 处理 rules 子命令
+func runRulesCommand(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "lint":
+			runRulesLint(args[1:])
+			return
+		case "presets":
+			runRulesPresets(args[1:])
+			return
+		}
+	}
+	fmt.Println(tr("rules.usage_lint", os.Args[0]))
+	fmt.Println(tr("rules.usage_presets", os.Args[0]))
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		osExit(0)
+		return
+	}
+	osExit(1)
+}
+
+// 列出内置规则预设，指定名称时输出预设内容
+func runRulesPresets(args []string) {
+	if len(args) == 0 {
+		for _, name := range filter.PresetNames() {
+			fmt.Println(name)
+		}
+		osExit(0)
+		return
+	}
+	src, err := filter.PresetSource(args[0])
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	fmt.Print(src)
+	osExit(0)
+}
+
+// 检查规则文件，发现问题时以非零状态退出
+func runRulesLint(args []string) {
+	fs := newCommandFlagSet("rules lint")
+	rf := addRuleFlags(fs)
+	source := fs.String("source", "", tr("flag.lint_source"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		osExit(1)
+		return
+	}
+
+	cfg, prof, err := rf.config()
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	if *source == "" && prof != nil {
+		*source = prof.Source
+	}
+
+	f, err := loadRuleFilter(cfg)
+	if err != nil {
+		printColored(colorRed, tr("rules.read_failed", err))
+		osExit(1)
+		return
+	}
+
+	issues := lintRules(f.Rules)
+	if *source != "" {
+		if !dirExists(*source) {
+			printError(errors.New(tr("rules.source_missing", *source)))
+			osExit(1)
+			return
+		}
+		reported := map[int]bool{}
+		for _, issue := range issues {
+			reported[issue.index] = true
+		}
+		treeIssues, err := lintRulesAgainstTree(f, *source, reported)
+		if err != nil {
+			printColored(colorRed, tr("rules.walk_failed", err))
+			osExit(1)
+			return
+		}
+		issues = append(issues, treeIssues...)
+	}
+
+	sortLintIssues(issues)
+	for _, issue := range issues {
+		printColored(colorRed, issue.String())
+	}
+	if len(issues) > 0 {
+		printColored(colorRed, tr("rules.lint_failed", len(issues), len(f.Rules)))
+		osExit(1)
+		return
+	}
+	printColored(colorGreen, tr("rules.lint_ok", len(f.Rules)))
+	osExit(0)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 根据模式列表构造规则，便于测试
+func makeRules(t *testing.T, excludes, includes []string) []filter.Rule {
+	var rules []filter.Rule
+	for i, p := range excludes {
+		r := filter.NewRule(p, false)
+		r.File, r.Line = "exclude", i+1
+		rules = append(rules, r)
+	}
+	for i, p := range includes {
+		r := filter.NewRule(p, true)
+		r.File, r.Line = "include", i+1
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// 查找指定位置的问题
+func findIssue(issues []lintIssue, file string, line int) *lintIssue {
+	for i := range issues {
+		if issues[i].File == file && issues[i].Line == line {
+			return &issues[i]
+		}
+	}
+	return nil
+}
+
+// 测试静态检查：空白、重复、覆盖和永远无法生效的包含规则
+func TestLintRules(t *testing.T) {
+	rules := makeRules(t,
+		[]string{"*.out", "*/cscope.out", "*/cscope.po.out ", "*.out", "*/build/*", "[bad", "node_modules/"},
+		[]string{"keep.out", "*/build/keep.js", "node_modules/pkg/index.js", "*.md"},
+	)
+
+	issues := lintRules(rules)
+
+	expectations := []struct {
+		file    string
+		line    int
+		message string
+	}{
+		{"exclude", 2, "覆盖"},
+		{"exclude", 3, "末尾有空白"},
+		{"exclude", 4, "重复"},
+		{"exclude", 6, "无效的通配符语法"},
+		{"include", 1, "永远无法生效"},
+		{"include", 2, "永远无法生效"},
+		{"include", 3, "永远无法生效"},
+	}
+	for _, e := range expectations {
+		issue := findIssue(issues, e.file, e.line)
+		if issue == nil {
+			t.Errorf("%s:%d 应当报告问题 %q，但没有报告", e.file, e.line, e.message)
+			continue
+		}
+		if !strings.Contains(issue.Message, e.message) {
+			t.Errorf("%s:%d 的问题为 %q，期望包含 %q", e.file, e.line, issue.Message, e.message)
+		}
+	}
+
+	for _, ok := range []struct {
+		file string
+		line int
+	}{{"exclude", 1}, {"exclude", 5}, {"exclude", 7}, {"include", 4}} {
+		if issue := findIssue(issues, ok.file, ok.line); issue != nil {
+			t.Errorf("%s:%d 不应当报告问题，但得到: %s", ok.file, ok.line, issue.Message)
+		}
+	}
+}
+
+// 测试结合源目录的检查
+func TestLintRulesAgainstTree(t *testing.T) {
+	testDir, sourceDir, _ := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	rules := makeRules(t,
+		[]string{"*/build/*", "*.pdf", ".git/", "*/output.js"},
+		[]string{"file1.txt"},
+	)
+
+	f := filter.New(rules)
+
+	issues, err := lintRulesAgainstTree(f, sourceDir, map[int]bool{})
+	if err != nil {
+		t.Fatalf("lintRulesAgainstTree 失败: %v", err)
+	}
+
+	if issue := findIssue(issues, "exclude", 2); issue == nil || !strings.Contains(issue.Message, "没有匹配任何路径") {
+		t.Errorf("*.pdf 应当报告没有匹配任何路径，得到: %v", issue)
+	}
+	if issue := findIssue(issues, "exclude", 4); issue == nil || !strings.Contains(issue.Message, "更早的规则") {
+		t.Errorf("*/output.js 应当报告已被更早的规则决定，得到: %v", issue)
+	}
+	for _, line := range []int{1, 3} {
+		if issue := findIssue(issues, "exclude", line); issue != nil {
+			t.Errorf("exclude:%d 不应当报告问题，但得到: %s", line, issue.Message)
+		}
+	}
+	if issue := findIssue(issues, "include", 1); issue != nil {
+		t.Errorf("include:1 不应当报告问题，但得到: %s", issue.Message)
+	}
+
+	// 已经报告过的规则不再重复报告
+	issues, err = lintRulesAgainstTree(f, sourceDir, map[int]bool{1: true})
+	if err != nil {
+		t.Fatalf("lintRulesAgainstTree 失败: %v", err)
+	}
+	if findIssue(issues, "exclude", 2) != nil {
+		t.Error("已报告的规则不应当重复报告")
+	}
+
+	if _, err := lintRulesAgainstTree(f, filepath.Join(testDir, "missing"), nil); err == nil {
+		t.Error("源目录不存在时应当返回错误")
+	}
+}
+
+// 测试 rules lint 命令的退出码
+func TestRunRulesLint(t *testing.T) {
+	testDir, sourceDir, _ := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	goodFile := filepath.Join(testDir, "good_exclude")
+	badFile := filepath.Join(testDir, "bad_exclude")
+	ioutil.WriteFile(goodFile, []byte("*/build/*\n.git/\n"), 0644)
+	ioutil.WriteFile(badFile, []byte("*/build/*\n*.pdf \n"), 0644)
+
+	oldOsExit := osExit
+	oldDisablePrint := disablePrint
+	defer func() {
+		osExit = oldOsExit
+		disablePrint = oldDisablePrint
+	}()
+	disablePrint = true
+
+	testCases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"规则正确", []string{"lint", "--exclude-from", goodFile, "--include-from", "", "--source", sourceDir}, 0},
+		{"规则有问题", []string{"lint", "--exclude-from", badFile, "--include-from", ""}, 1},
+		{"规则文件不存在", []string{"lint", "--exclude-from", filepath.Join(testDir, "missing")}, 1},
+		{"源目录不存在", []string{"lint", "--exclude-from", goodFile, "--source", filepath.Join(testDir, "missing")}, 1},
+		{"缺少子命令", []string{}, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exitCode := -1
+			osExit = func(code int) {
+				if exitCode == -1 {
+					exitCode = code
+				}
+			}
+			runRulesCommand(tc.args)
+			if exitCode != tc.code {
+				t.Errorf("期望退出码 %d，但得到 %d", tc.code, exitCode)
+			}
+		})
+	}
+}
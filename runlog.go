@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// retentionPolicy 描述每对目录的运行日志保留多久
+type retentionPolicy struct {
+	Keep          int           // 最多保留的日志数，0 表示不限
+	MaxAge        time.Duration // 超过这个时间的日志被删除，0 表示不限
+	CompressAfter time.Duration // 超过这个时间的日志被压缩为 .gz，0 表示不压缩
+}
+
+// 默认的运行日志保留策略，配置中的 log_keep、log_max_age 和 log_compress_after 可以覆盖
+var defaultLogRetention = retentionPolicy{Keep: 50, MaxAge: 30 * 24 * time.Hour, CompressAfter: 24 * time.Hour}
+
+// 当前运行使用的保留策略（变量以便于测试）
+var logRetention = defaultLogRetention
+
+// 运行日志中记录的环境变量
+var logEnvVars = []string{"PATH", "HOME", "LANG", "LC_ALL", "XDG_STATE_HOME", "RSYNC_RSH"}
+
+// 解析时间长度，除 time.ParseDuration 支持的格式外还支持以 d 结尾的天数
+func parseAge(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil || days < 0 {
+			return 0, errors.New(tr("runlog.bad_days", value))
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, errors.New(tr("runlog.bad_duration", value))
+	}
+	return d, nil
+}
+
+// runLog 是一次运行的日志文件，记录命令行、环境、事件以及 rsync 的标准输出和标准错误
+// 所有方法对 nil 都是安全的，日志创建失败时运行照常进行
+type runLog struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	start   time.Time
+	writers []*prefixWriter
+}
+
+// 在 dir 中为运行记录创建日志文件，文件名以运行 ID 开头，按名称排序即按时间排序
+func createRunLog(dir string, rec *runRecord, st *pairState, args []string) (*runLog, error) {
+	if err := securefile.MkdirAll(dir); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, rec.ID+"-"+rec.Mode+".log")
+	f, err := securefile.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &runLog{path: path, file: f, start: rec.Start}
+
+	host, _ := os.Hostname()
+	wd, _ := os.Getwd()
+	fmt.Fprintf(f, "# folder_mirror %s\n", rec.Mode)
+	fmt.Fprintln(f, tr("runlog.id", rec.ID))
+	fmt.Fprintln(f, tr("runlog.start", rec.Start.Format("2006-01-02 15:04:05")))
+	fmt.Fprintln(f, tr("runlog.command", strings.Join(os.Args, " ")))
+	fmt.Fprintln(f, tr("runlog.source", st.Source))
+	fmt.Fprintln(f, tr("runlog.target", st.Target))
+	fmt.Fprintln(f, tr("runlog.rsync_args", strings.Join(args, " ")))
+	fmt.Fprintln(f, tr("runlog.host", host, os.Getpid(), runtime.GOOS, runtime.GOARCH))
+	fmt.Fprintln(f, tr("runlog.workdir", wd))
+	for _, name := range logEnvVars {
+		if value, ok := os.LookupEnv(name); ok {
+			fmt.Fprintf(f, "# %s=%s\n", name, value)
+		}
+	}
+	fmt.Fprintln(f)
+	return l, nil
+}
+
+// 路径，日志不存在时为空
+func (l *runLog) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// 记录镜像事件，rsync 的输出原样记录，其余事件带上时间
+func (l *runLog) event(e mirror.Event) {
+	switch e.Kind {
+	case mirror.EventOutput:
+		l.write([]byte(e.Message + "\n"))
+	case mirror.EventWarning:
+		l.writef("[%s] %s\n", time.Now().Format("15:04:05"), tr("msg.warning", eventText(e)))
+	default:
+		l.writef("[%s] %s\n", time.Now().Format("15:04:05"), eventText(e))
+	}
+}
+
+func (l *runLog) writef(format string, a ...interface{}) {
+	l.write([]byte(fmt.Sprintf(format, a...)))
+}
+
+func (l *runLog) write(p []byte) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Write(p)
+	}
+}
+
+// 返回写入日志的 Writer，每行前加上 prefix
+func (l *runLog) writer(prefix string) io.Writer {
+	if l == nil {
+		return ioutil.Discard
+	}
+	w := &prefixWriter{log: l, prefix: prefix}
+	l.mu.Lock()
+	l.writers = append(l.writers, w)
+	l.mu.Unlock()
+	return w
+}
+
+// prefixWriter 按行写入运行日志，不完整的行等到换行或关闭日志时才写入
+type prefixWriter struct {
+	log    *runLog
+	prefix string
+	buf    []byte
+}
+
+// 写入剩余的不完整的行
+func (w *prefixWriter) flush() {
+	if len(w.buf) > 0 {
+		w.log.write(append(append([]byte(w.prefix), w.buf...), '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log.write(append([]byte(w.prefix), w.buf[:i+1]...))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// 写入运行结果并关闭日志文件
+func (l *runLog) close(err error) {
+	if l == nil {
+		return
+	}
+	for _, w := range l.writers {
+		w.flush()
+	}
+	end := time.Now()
+	result := runStatus(err)
+	if err != nil {
+		result += ": " + err.Error()
+	}
+	l.writef("\n%s\n%s\n", tr("runlog.end", end.Format("2006-01-02 15:04:05"), end.Sub(l.start).Round(time.Millisecond)), tr("runlog.result", result))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// 按保留策略清理 dir 中的运行日志：只保留最新的 Keep 个，删除超过 MaxAge 的，
+// 压缩超过 CompressAfter 的。current 是当前运行的日志，不会被删除或压缩
+func pruneRunLogs(dir string, policy retentionPolicy, now time.Time, current string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var logs []os.FileInfo
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && (strings.HasSuffix(entry.Name(), ".log") || strings.HasSuffix(entry.Name(), ".log.gz")) {
+			logs = append(logs, entry)
+		}
+	}
+	// 最新的排在前面
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Name() > logs[j].Name() })
+
+	var firstErr error
+	for i, info := range logs {
+		path := filepath.Join(dir, info.Name())
+		if path == current {
+			continue
+		}
+		age := now.Sub(info.ModTime())
+		var err error
+		switch {
+		case policy.Keep > 0 && i >= policy.Keep, policy.MaxAge > 0 && age > policy.MaxAge:
+			err = os.Remove(path)
+		case policy.CompressAfter > 0 && age > policy.CompressAfter && strings.HasSuffix(path, ".log"):
+			err = compressLog(path)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 把日志压缩为 .gz 并删除原文件，保留修改时间以便按时间清理
+func compressLog(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	dst, err := securefile.Create(path + ".gz")
+	if err != nil {
+		src.Close()
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	zw.ModTime = info.ModTime()
+	_, err = io.Copy(zw, src)
+	src.Close()
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	os.Chtimes(path+".gz", info.ModTime(), info.ModTime())
+	return os.Remove(path)
+}
+
+// 运行记录中的日志文件可能已被压缩，返回实际存在的路径，都不存在时返回空
+func existingLogPath(path string) string {
+	for _, p := range []string{path, path + ".gz"} {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 测试运行日志记录命令行、事件、标准输出和标准错误以及运行结果
+func TestRunLog(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "runlog_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	rec := startRun("apply", "/src/", "/dst/")
+	st := &pairState{mirrorPair: mirrorPair{Source: "/src", Target: "/dst"}}
+	logDir := filepath.Join(testDir, "logs")
+	l, err := createRunLog(logDir, rec, st, []string{"-aH", "--delete-during"})
+	if err != nil {
+		t.Fatalf("创建运行日志失败: %v", err)
+	}
+	if filepath.Dir(l.Path()) != logDir || !strings.HasPrefix(filepath.Base(l.Path()), rec.ID+"-apply") {
+		t.Errorf("运行日志路径不正确: %s", l.Path())
+	}
+	if info, _ := os.Stat(l.Path()); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("运行日志权限应当为 0600，但得到 %v", info.Mode().Perm())
+	}
+
+	l.event(mirror.Event{Kind: mirror.EventInfo, Message: "执行实际文件夹镜像操作..."})
+	l.event(mirror.Event{Kind: mirror.EventOutput, Message: "file.txt"})
+	stdout, stderr := l.writer(""), l.writer("[stderr] ")
+	stdout.Write([]byte("sent 10 bytes\ntotal "))
+	stderr.Write([]byte("rsync: permission denied\n"))
+	stdout.Write([]byte("size is 0"))
+	l.close(errors.New("执行rsync失败"))
+	l.event(mirror.Event{Kind: mirror.EventInfo, Message: "关闭后不应当写入"})
+
+	data, err := ioutil.ReadFile(l.Path())
+	if err != nil {
+		t.Fatalf("读取运行日志失败: %v", err)
+	}
+	log := string(data)
+	for _, want := range []string{
+		"# folder_mirror apply",
+		"# 运行 ID: " + rec.ID,
+		"# 源目录: /src",
+		"# rsync 参数: -aH --delete-during",
+		"] 执行实际文件夹镜像操作...\n",
+		"\nfile.txt\n",
+		"sent 10 bytes\n",
+		"[stderr] rsync: permission denied\n",
+		"total size is 0\n",
+		"# 结果: failed: 执行rsync失败",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("运行日志应当包含 %q，实际内容:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "关闭后") {
+		t.Error("关闭后不应当继续写入运行日志")
+	}
+
+	// 被中断的运行记录为 interrupted 而不是 failed
+	rec = startRun("apply", "/src/", "/dst/")
+	l, err = createRunLog(logDir, rec, st, nil)
+	if err != nil {
+		t.Fatalf("创建运行日志失败: %v", err)
+	}
+	l.close(mirror.ErrInterrupted)
+	if data, _ := ioutil.ReadFile(l.Path()); !strings.Contains(string(data), "# 结果: "+runInterrupted+": ") {
+		t.Errorf("被中断的运行日志结果不正确:\n%s", data)
+	}
+
+	// 日志创建失败时所有方法都可以安全调用
+	var none *runLog
+	none.event(mirror.Event{Message: "x"})
+	none.writer("").Write([]byte("x\n"))
+	none.close(nil)
+	if none.Path() != "" {
+		t.Error("不存在的日志路径应当为空")
+	}
+}
+
+// 测试按保留策略删除和压缩旧的运行日志
+func TestPruneRunLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prune_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	write := func(name string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(name+" content\n"), 0600)
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+		return path
+	}
+	current := write("20240106-000000.000-apply.log", 0)
+	recent := write("20240105-000000.000-plan.log", time.Hour)
+	old := write("20240104-000000.000-apply.log", 3*time.Hour)
+	compressed := write("20240103-000000.000-plan.log.gz", 4*time.Hour)
+	extra := write("20240102-000000.000-plan.log", 5*time.Hour)
+	expired := write("20240101-000000.000-plan.log", 100*time.Hour)
+	unrelated := write("notes.txt", 100*time.Hour)
+
+	policy := retentionPolicy{Keep: 4, MaxAge: 48 * time.Hour, CompressAfter: 2 * time.Hour}
+	if err := pruneRunLogs(dir, policy, now, current); err != nil {
+		t.Fatalf("清理运行日志失败: %v", err)
+	}
+
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	for _, path := range []string{current, recent, compressed, old + ".gz", unrelated} {
+		if !exists(path) {
+			t.Errorf("%s 应当被保留", filepath.Base(path))
+		}
+	}
+	for _, path := range []string{old, extra, expired} {
+		if exists(path) {
+			t.Errorf("%s 应当被删除或压缩", filepath.Base(path))
+		}
+	}
+
+	f, err := os.Open(old + ".gz")
+	if err != nil {
+		t.Fatalf("打开压缩日志失败: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("读取压缩日志失败: %v", err)
+	}
+	if data, _ := ioutil.ReadAll(zr); string(data) != "20240104-000000.000-apply.log content\n" {
+		t.Errorf("压缩日志的内容不正确: %q", data)
+	}
+	if info, _ := os.Stat(old + ".gz"); now.Sub(info.ModTime()) < 2*time.Hour {
+		t.Error("压缩日志应当保留原来的修改时间")
+	}
+	if got := existingLogPath(old); got != old+".gz" {
+		t.Errorf("已压缩的日志应当返回 .gz 路径，但得到 %q", got)
+	}
+	if got := existingLogPath(extra); got != "" {
+		t.Errorf("已删除的日志应当返回空路径，但得到 %q", got)
+	}
+}
+
+// 测试配置中的运行日志保留策略
+func TestProfileRetention(t *testing.T) {
+	p := &profile{Name: "test"}
+	for key, value := range map[string]string{"log_keep": "10", "log_max_age": "7d", "log_compress_after": "12h"} {
+		if err := p.set(key, value); err != nil {
+			t.Fatalf("设置 %s 失败: %v", key, err)
+		}
+	}
+	expected := retentionPolicy{Keep: 10, MaxAge: 7 * 24 * time.Hour, CompressAfter: 12 * time.Hour}
+	if p.Retention == nil || *p.Retention != expected {
+		t.Errorf("期望保留策略 %+v，但得到 %+v", expected, p.Retention)
+	}
+
+	p = &profile{Name: "partial"}
+	p.set("log_keep", "0")
+	if p.Retention.Keep != 0 || p.Retention.MaxAge != logRetention.MaxAge {
+		t.Errorf("未设置的项应当使用默认值: %+v", p.Retention)
+	}
+	for key, value := range map[string]string{"log_keep": "-1", "log_max_age": "soon", "log_compress_after": "-2d"} {
+		if err := p.set(key, value); err == nil {
+			t.Errorf("%s = %s 应当被拒绝", key, value)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// errScrubProblems 表示 scrub 发现了损坏或被修改的文件，可以用 errors.Is 判断
+var errScrubProblems error = catalogError("scrub.err_problems")
+
+// scrubError 描述这次 scrub 发现的问题数
+type scrubError struct {
+	count int
+}
+
+func (e *scrubError) Error() string        { return tr("scrub.problems", e.count) }
+func (e *scrubError) Is(target error) bool { return target == errScrubProblems }
+
+// apply 之后更新目标目录中的完整性清单，paths 不为 nil 时只更新这些路径
+// 作为 AfterApply 在 Apply 释放目标目录的锁之前调用，期间没有其他进程能修改目标目录
+// 镜像本身已经成功，无法读取规则或更新失败时只输出警告；中断时返回中断错误
+func (r *mirrorRun) updateManifest(ctx context.Context, args []string, paths []string) error {
+	f, err := filterFromRsyncArgs(args)
+	if err != nil {
+		printWarning(tr("manifest.failed", localizedError(err)))
+		return nil
+	}
+	res, err := mirror.UpdateManifest(ctx, r.Target(), mirror.ManifestOptions{Filter: f, Paths: paths})
+	if errors.Is(err, mirror.ErrInterrupted) {
+		return err
+	}
+	if err != nil {
+		printWarning(tr("manifest.failed", localizedError(err)))
+		return nil
+	}
+	msg := tr("manifest.updated", res.Files, res.Hashed, formatBytes(res.Bytes), res.Removed)
+	printVerbose(verbosityVerbose, msg)
+	r.log.writef("[%s] %s\n", time.Now().Format("15:04:05"), msg)
+	return nil
+}
+
+// scrub 发现的一个问题的说明
+func scrubText(p mirror.ScrubProblem) string {
+	switch p.Kind {
+	case mirror.ScrubMissing:
+		return tr("scrub.missing", p.Path)
+	case mirror.ScrubTruncated:
+		return tr("scrub.truncated", p.Path)
+	case mirror.ScrubModified:
+		return tr("scrub.modified", p.Path)
+	case mirror.ScrubBitrot:
+		return tr("scrub.bitrot", p.Path)
+	default:
+		return tr("scrub.unreadable", p.Path, p.Err)
+	}
+}
+
+// 输出 scrub 发现的一个问题
+func printScrubProblem(p mirror.ScrubProblem) {
+	if jsonOutput() {
+		ev := outputEvent{Type: eventScrub, Level: levelWarning, Path: p.Path, Problem: string(p.Kind)}
+		if p.Err != nil {
+			ev.Message = p.Err.Error()
+		}
+		emitJSON(ev)
+		return
+	}
+	printColored(colorRed, scrubText(p))
+}
+
+// 数据量的后缀
+var byteUnits = map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+
+// 解析数据量，例如 500G、1.5T，后缀按 1024 进位，没有后缀时为字节数
+func parseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	unit := int64(1)
+	if n := len(s); n > 0 {
+		if u, ok := byteUnits[s[n-1:]]; ok {
+			unit, s = u, s[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New(tr("scrub.bad_size", value))
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// 处理 scrub 子命令
+func runScrubCommand(args []string) {
+	fs := newCommandFlagSet("scrub")
+	profileName := fs.String("profile", "", tr("flag.profile"))
+	maxBytes := fs.String("max-bytes", "", tr("flag.max_bytes"))
+	maxDuration := fs.Duration("max-duration", 0, tr("flag.max_duration"))
+	restart := fs.Bool("restart", false, tr("flag.scrub_restart"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+
+	target, opts, err := scrubSettings(*profileName, positional, *maxBytes, *maxDuration)
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	intr := notifyInterrupt()
+	defer intr.stop()
+	if err := scrubTarget(intr.ctx, target, opts, *restart); err != nil {
+		printError(err)
+		osExit(intr.exitCode(err))
+		return
+	}
+	osExit(0)
+}
+
+// 确定要检查的目标目录和这次检查的上限
+func scrubSettings(profileName string, positional []string, maxBytes string, maxDuration time.Duration) (string, mirror.ScrubOptions, error) {
+	var opts mirror.ScrubOptions
+	var target string
+	switch {
+	case len(positional) == 1 && profileName == "":
+		target = positional[0]
+	case len(positional) == 0 && profileName != "":
+		prof, err := findProfile(profileName)
+		if err != nil {
+			return "", opts, err
+		}
+		if prof.Target == "" {
+			return "", opts, errors.New(tr("cli.profile_no_paths", prof.Name))
+		}
+		target = prof.Target
+	case len(positional) == 0:
+		return "", opts, errors.New(tr("scrub.need_target"))
+	default:
+		return "", opts, errors.New(tr("cli.arg_count", strings.Join(positional, " ")))
+	}
+	if !dirExists(target) {
+		return "", opts, errors.New(tr("verify.dir_missing", target))
+	}
+	if maxBytes != "" {
+		n, err := parseByteSize(maxBytes)
+		if err != nil {
+			return "", opts, err
+		}
+		opts.MaxBytes = n
+	}
+	if maxDuration > 0 {
+		opts.Deadline = time.Now().Add(maxDuration)
+	}
+	return target, opts, nil
+}
+
+// 从检查点继续检查目标目录，检查点保存在目标目录中，检查完一轮后删除
+// 检查期间锁定目标目录；这次发现问题时返回 errScrubProblems，中断时保存进度并返回中断错误
+func scrubTarget(ctx context.Context, target string, opts mirror.ScrubOptions, restart bool) error {
+	lock, err := mirror.AcquireLock(filepath.Join(target, mirror.LockFileName))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	m, err := mirror.ReadManifest(target)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.New(tr("scrub.no_manifest", target))
+		}
+		return err
+	}
+	cp, err := mirror.ReadScrubCheckpoint(target)
+	if err != nil {
+		return err
+	}
+	printColored(colorGreen, tr("scrub.start", target))
+	if cp == nil || restart {
+		cp = &mirror.ScrubCheckpoint{Started: time.Now()}
+	} else {
+		printNotice(tr("scrub.resume", cp.Started.Format("2006-01-02 15:04"), cp.Checked))
+	}
+
+	opts.After = cp.After
+	opts.OnProblem = printScrubProblem
+	res, scrubErr := mirror.Scrub(ctx, target, m, opts)
+	cp.After = res.Resume
+	cp.Checked += res.Checked
+	cp.Bytes += res.Bytes
+	cp.Problems += len(res.Problems)
+
+	if res.Complete {
+		if err := mirror.WriteScrubCheckpoint(target, nil); err != nil {
+			return err
+		}
+		printColored(colorGreen, tr("scrub.summary", cp.Checked, formatBytes(cp.Bytes), cp.Problems))
+	} else {
+		if err := mirror.WriteScrubCheckpoint(target, cp); err != nil {
+			return err
+		}
+		printNotice(tr("scrub.paused", cp.Checked, res.Total, formatBytes(res.Bytes)))
+	}
+	if scrubErr != nil {
+		return scrubErr
+	}
+	if len(res.Problems) > 0 {
+		return &scrubError{count: len(res.Problems)}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 测试 apply 写入完整性清单，scrub 发现内容损坏并能分多次完成
+func TestScrubCommand(t *testing.T) {
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	oldMarkerFile := markerFile
+	oldHistoryFile := historyFile
+	oldDisablePrint := disablePrint
+	oldSyncConfig := syncConfig
+	oldTesting, hadTesting := os.LookupEnv("TESTING")
+	oldStdout := os.Stdout
+	oldStderr := os.Stderr
+	defer func() {
+		markerFile = oldMarkerFile
+		historyFile = oldHistoryFile
+		disablePrint = oldDisablePrint
+		syncConfig = oldSyncConfig
+		if hadTesting {
+			os.Setenv("TESTING", oldTesting)
+		}
+		os.Stdout = oldStdout
+		os.Stderr = oldStderr
+		outputFormat = outputText
+	}()
+
+	// 清单按规则文件过滤，TESTING 模式下的临时规则文件在使用前就被删除
+	os.Unsetenv("TESTING")
+	markerFile = filepath.Join(testDir, "marker")
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	disablePrint = true
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer devNull.Close()
+	os.Stdout = devNull
+	os.Stderr = devNull
+
+	excludeFile := filepath.Join(testDir, "exclude")
+	if err := ioutil.WriteFile(excludeFile, []byte("node_modules/\n"), 0644); err != nil {
+		t.Fatalf("无法写入排除文件: %v", err)
+	}
+	mirrorArgs := func(cmd string) []string {
+		return []string{cmd, "--backend", "native", "--exclude-from", excludeFile,
+			"--include-from", filepath.Join(testDir, "include"), sourceDir, targetDir}
+	}
+	for _, cmd := range []string{"plan", "apply"} {
+		if code := runMainForExit(mirrorArgs(cmd)); code != 0 {
+			t.Fatalf("%s 退出码为 %d，期望 0", cmd, code)
+		}
+	}
+	m, err := mirror.ReadManifest(targetDir)
+	if err != nil {
+		t.Fatalf("apply 之后应当写入完整性清单: %v", err)
+	}
+	if len(m.Entries) != 6 {
+		t.Errorf("清单中应当有 6 个文件，得到 %+v", m.Entries)
+	}
+	if code := runMainForExit([]string{"scrub", targetDir}); code != 0 {
+		t.Errorf("没有变化时 scrub 退出码为 %d，期望 0", code)
+	}
+
+	// 模拟静默损坏：内容变化但大小和修改时间不变，再次镜像既不修复它也不更新清单
+	corrupt := filepath.Join(targetDir, "subdir", "file3.txt")
+	info, err := os.Stat(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(corrupt)
+	data[0] ^= 0xff
+	ioutil.WriteFile(corrupt, data, 0644)
+	os.Chtimes(corrupt, info.ModTime(), info.ModTime())
+	for _, cmd := range []string{"plan", "apply"} {
+		if code := runMainForExit(mirrorArgs(cmd)); code != 0 {
+			t.Fatalf("%s 退出码为 %d，期望 0", cmd, code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, mirror.ManifestFileName)); err != nil {
+		t.Fatalf("镜像不应删除完整性清单: %v", err)
+	}
+
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	code := runMainForExit([]string{"scrub", "--output", "json", targetDir})
+	w.Close()
+	os.Stdout = devNull
+	out, _ := ioutil.ReadAll(r)
+	if code != 1 {
+		t.Errorf("内容损坏时 scrub 退出码为 %d，期望 1", code)
+	}
+	var bitrot, failed bool
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		var ev outputEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("无法解析 JSON 输出 %q: %v", line, err)
+		}
+		if ev.Type == eventScrub && ev.Path == "subdir/file3.txt" && ev.Problem == "bitrot" {
+			bitrot = true
+		}
+		if ev.Type == eventError && ev.Code == "scrub_problems" {
+			failed = true
+		}
+	}
+	if !bitrot || !failed {
+		t.Errorf("JSON 输出中缺少损坏或错误事件:\n%s", out)
+	}
+
+	// 每次最多读取 1 字节时，每次检查一个文件，检查点记录进度
+	ioutil.WriteFile(corrupt, []byte("repaired"), 0644)
+	for _, cmd := range []string{"plan", "apply"} {
+		if code := runMainForExit(mirrorArgs(cmd)); code != 0 {
+			t.Fatalf("%s 退出码为 %d，期望 0", cmd, code)
+		}
+	}
+	for i := 1; i <= 6; i++ {
+		if code := runMainForExit([]string{"scrub", "--max-bytes", "1", targetDir}); code != 0 {
+			t.Fatalf("第 %d 次 scrub 退出码为 %d，期望 0", i, code)
+		}
+		cp, err := mirror.ReadScrubCheckpoint(targetDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < 6 && (cp == nil || cp.Checked != i) {
+			t.Errorf("第 %d 次 scrub 之后的检查点不正确: %+v", i, cp)
+		}
+		if i == 6 && cp != nil {
+			t.Errorf("检查完一轮后应当删除检查点: %+v", cp)
+		}
+	}
+
+	if code := runMainForExit([]string{"scrub", testDir}); code != 1 {
+		t.Errorf("没有完整性清单时 scrub 应当失败")
+	}
+	if code := runMainForExit([]string{"scrub", "--max-bytes", "lots", targetDir}); code != 1 {
+		t.Errorf("无效的 --max-bytes 应当失败")
+	}
+}
+
+// 测试解析数据量
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{"100": 100, "1K": 1024, "500G": 500 << 30, "1.5T": 3 << 39, "2MiB": 2 << 20, "4kb": 4096}
+	for value, want := range cases {
+		if got, err := parseByteSize(value); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v，期望 %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "G", "-1", "ten"} {
+		if _, err := parseByteSize(value); err == nil {
+			t.Errorf("parseByteSize(%q) 应当失败", value)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package securefile
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 错误的消息，键为稳定的消息 ID，值为默认的中文格式
+// 调用方可以根据 ErrorMessage 返回的 ID 和参数翻译消息
+var messages = map[string]string{
+	"securefile.err.not_owned":      "不属于当前用户",
+	"securefile.err.symlink":        "是符号链接",
+	"securefile.err.not_regular":    "不是普通文件",
+	"securefile.err.not_owned_at":   "%s 不属于当前用户",
+	"securefile.err.symlink_at":     "%s 是符号链接",
+	"securefile.err.not_regular_at": "%s 不是普通文件",
+	"securefile.err.not_dir_at":     "%s 不是目录",
+}
+
+// 按消息 ID 生成默认的中文消息
+func message(id string, args ...interface{}) string {
+	if len(args) == 0 {
+		return messages[id]
+	}
+	return fmt.Sprintf(messages[id], args...)
+}
+
+// MessageIDs 返回所有错误的消息 ID，按名称排序
+func MessageIDs() []string {
+	ids := make([]string, 0, len(messages))
+	for id := range messages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// MessageFormat 返回消息 ID 对应的默认中文格式
+func MessageFormat(id string) string {
+	return messages[id]
+}
+
+// 错误类型对应的消息 ID
+var sentinelMessages = map[error]string{
+	ErrNotOwned:   "securefile.err.not_owned",
+	ErrSymlink:    "securefile.err.symlink",
+	ErrNotRegular: "securefile.err.not_regular",
+}
+
+// ErrorMessage 返回本包创建的错误的消息 ID 和参数，用于翻译错误信息
+// 只描述 err 本身，不展开包装；不是本包创建的错误时 ok 为 false
+func ErrorMessage(err error) (id string, args []interface{}, ok bool) {
+	if e, isPath := err.(*pathError); isPath {
+		return e.id, []interface{}{e.path}, true
+	}
+	id, ok = sentinelMessages[err]
+	return id, nil, ok
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package securefile
+
+import (
+	"os"
+	"syscall"
+)
+
+const oNoFollow = syscall.O_NOFOLLOW
+
+// 判断文件是否属于当前用户
+func ownedByCurrentUser(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return !ok || int(st.Uid) == os.Getuid()
+}
@@ -0,0 +1,11 @@
+package securefile
+
+import "os"
+
+// Windows 上没有 O_NOFOLLOW
+const oNoFollow = 0
+
+// Windows 上不检查文件所有者
+func ownedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
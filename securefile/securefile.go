@@ -0,0 +1,120 @@
+// Package securefile 在可能被其他用户访问的位置安全地创建状态文件
+//
+// 文件以 O_EXCL/O_NOFOLLOW 创建，权限为 0600；已存在的文件和目录如果是符号链接
+// 或不属于当前用户，会被拒绝，防止其他用户预先创建文件或符号链接来阻止运行或覆盖文件。
+package securefile
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	// ErrNotOwned 表示文件或目录不属于当前用户
+	ErrNotOwned = errors.New(message("securefile.err.not_owned"))
+	// ErrSymlink 表示路径是符号链接
+	ErrSymlink = errors.New(message("securefile.err.symlink"))
+	// ErrNotRegular 表示路径不是普通文件
+	ErrNotRegular = errors.New(message("securefile.err.not_regular"))
+)
+
+// pathError 描述路径 path 的问题，errors.Is(err, kind) 对它成立
+type pathError struct {
+	path string
+	kind error
+	id   string
+}
+
+func (e *pathError) Error() string { return message(e.id, e.path) }
+func (e *pathError) Unwrap() error { return e.kind }
+
+// Check 检查已存在的文件是否为当前用户拥有的普通文件，不跟随符号链接
+func Check(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	return checkInfo(path, info)
+}
+
+func checkInfo(path string, info os.FileInfo) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return &pathError{path, ErrSymlink, "securefile.err.symlink_at"}
+	}
+	if !info.Mode().IsRegular() {
+		return &pathError{path, ErrNotRegular, "securefile.err.not_regular_at"}
+	}
+	if !ownedByCurrentUser(info) {
+		return &pathError{path, ErrNotOwned, "securefile.err.not_owned_at"}
+	}
+	return nil
+}
+
+// Create 创建新文件用于写入，权限为 0600
+// 已存在的文件必须属于当前用户，会被删除后重新以 O_EXCL 创建
+func Create(path string) (*os.File, error) {
+	if err := Check(path); err == nil {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|oNoFollow, 0600)
+}
+
+// WriteFile 以 Create 的方式创建文件并写入数据
+func WriteFile(path string, data []byte) error {
+	f, err := Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// OpenFile 以给定的标志打开文件，文件不存在时以 0600 权限创建
+// 不跟随符号链接，打开后检查文件是否为当前用户拥有的普通文件
+func OpenFile(path string, flag int) (*os.File, error) {
+	f, err := os.OpenFile(path, flag|os.O_CREATE|oNoFollow, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		err = checkInfo(path, info)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// MkdirAll 创建权限为 0700 的目录
+// 已存在的目录必须属于当前用户且不是符号链接，组和其他用户的权限会被去掉
+func MkdirAll(path string) error {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return &pathError{path, ErrSymlink, "securefile.err.symlink_at"}
+	}
+	if !info.IsDir() {
+		return &pathError{path, nil, "securefile.err.not_dir_at"}
+	}
+	if !ownedByCurrentUser(info) {
+		return &pathError{path, ErrNotOwned, "securefile.err.not_owned_at"}
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return os.Chmod(path, 0700)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package securefile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "securefile_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	return dir
+}
+
+// 测试创建文件：权限为 0600，替换已有文件，拒绝符号链接
+func TestCreate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上不检查权限和符号链接")
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "marker")
+
+	ioutil.WriteFile(path, []byte("old"), 0644)
+	if err := WriteFile(path, []byte("new")); err != nil {
+		t.Fatalf("替换已有文件失败: %v", err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("文件权限应当为 0600，但得到 %v", info.Mode().Perm())
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "new" {
+		t.Errorf("文件内容不正确: %q", data)
+	}
+
+	victim := filepath.Join(dir, "victim")
+	ioutil.WriteFile(victim, []byte("keep"), 0600)
+	link := filepath.Join(dir, "link")
+	os.Symlink(victim, link)
+	if err := WriteFile(link, []byte("evil")); !errors.Is(err, ErrSymlink) {
+		t.Errorf("写入符号链接时期望 ErrSymlink，但得到 %v", err)
+	}
+	if _, err := OpenFile(link, os.O_WRONLY|os.O_APPEND); err == nil {
+		t.Error("打开符号链接应当失败")
+	}
+	if data, _ := ioutil.ReadFile(victim); string(data) != "keep" {
+		t.Errorf("符号链接指向的文件不应当被修改: %q", data)
+	}
+
+	os.Mkdir(filepath.Join(dir, "sub"), 0700)
+	if _, err := Create(filepath.Join(dir, "sub")); err == nil {
+		t.Error("目录不应当被当作文件替换")
+	}
+}
+
+// 测试创建状态目录：权限为 0700，拒绝符号链接
+func TestMkdirAll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上不检查权限和符号链接")
+	}
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	state := filepath.Join(dir, "state", "folder_mirror")
+	if err := MkdirAll(state); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	os.Chmod(state, 0777)
+	if err := MkdirAll(state); err != nil {
+		t.Fatalf("检查已有目录失败: %v", err)
+	}
+	if info, _ := os.Stat(state); info.Mode().Perm() != 0700 {
+		t.Errorf("目录权限应当为 0700，但得到 %v", info.Mode().Perm())
+	}
+
+	link := filepath.Join(dir, "link")
+	os.Symlink(state, link)
+	if err := MkdirAll(link); !errors.Is(err, ErrSymlink) {
+		t.Errorf("符号链接目录期望 ErrSymlink，但得到 %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 运行被信号中断时的默认退出码（128 + SIGINT）
+const exitInterrupted = 130
+
+// interrupter 把 SIGINT/SIGTERM 转换为镜像的取消：
+// 第一次收到信号时取消 ctx，rsync 会结束当前文件后退出；第二次收到信号时强制终止 rsync
+type interrupter struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	force  chan struct{}
+	ch     chan os.Signal
+
+	mu  sync.Mutex
+	sig os.Signal // 收到的第一个信号
+}
+
+// 开始监听中断信号，结束时需要调用 stop
+func notifyInterrupt() *interrupter {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := &interrupter{ctx: ctx, cancel: cancel, force: make(chan struct{}), ch: make(chan os.Signal, 2)}
+	signal.Notify(in.ch, os.Interrupt, syscall.SIGTERM)
+	go in.loop()
+	return in
+}
+
+func (in *interrupter) loop() {
+	count := 0
+	for sig := range in.ch {
+		count++
+		switch count {
+		case 1:
+			in.mu.Lock()
+			in.sig = sig
+			in.mu.Unlock()
+			printNotice(tr("signal.waiting", sig))
+			in.cancel()
+		case 2:
+			printColored(colorRed, tr("signal.force"))
+			close(in.force)
+		}
+	}
+}
+
+// 停止监听信号
+func (in *interrupter) stop() {
+	signal.Stop(in.ch)
+	close(in.ch)
+	in.cancel()
+}
+
+// 根据运行错误确定退出码：被信号中断时为 128 加信号编号，其他错误为 1
+func (in *interrupter) exitCode(err error) int {
+	if !errors.Is(err, mirror.ErrInterrupted) {
+		return 1
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if sig, ok := in.sig.(syscall.Signal); ok {
+		return 128 + int(sig)
+	}
+	return exitInterrupted
+}
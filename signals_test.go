@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 测试第一次信号取消运行、第二次信号强制终止，以及中断时的退出码
+func TestInterrupter(t *testing.T) {
+	oldDisablePrint := disablePrint
+	defer func() { disablePrint = oldDisablePrint }()
+	disablePrint = true
+
+	in := notifyInterrupt()
+	defer in.stop()
+
+	if code := in.exitCode(errors.New("其他错误")); code != 1 {
+		t.Errorf("普通错误的退出码应当为 1，但得到 %d", code)
+	}
+
+	in.ch <- syscall.SIGTERM
+	select {
+	case <-in.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("收到信号后应当取消运行")
+	}
+	select {
+	case <-in.force:
+		t.Fatal("第一次信号不应当强制终止")
+	default:
+	}
+
+	in.ch <- syscall.SIGINT
+	select {
+	case <-in.force:
+	case <-time.After(5 * time.Second):
+		t.Fatal("第二次信号应当强制终止")
+	}
+
+	if code := in.exitCode(mirror.ErrInterrupted); code != 128+int(syscall.SIGTERM) {
+		t.Errorf("被 SIGTERM 中断时退出码应当为 %d，但得到 %d", 128+int(syscall.SIGTERM), code)
+	}
+}
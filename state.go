@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/your-username/folder_mirror/securefile"
+)
+
+// 状态目录，为空时使用 $XDG_STATE_HOME/folder_mirror（变量以便于测试）
+var stateDir = ""
+
+// 保存每对源目录和目标目录状态的子目录
+const pairsDirName = "pairs"
+
+// 获取状态目录，不存在时以 0700 权限创建
+// 已存在的目录必须属于当前用户，不能是符号链接
+func stateRoot() (string, error) {
+	dir := stateDir
+	if dir == "" {
+		base := os.Getenv("XDG_STATE_HOME")
+		if base == "" || !filepath.IsAbs(base) {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			base = filepath.Join(homeDir, ".local", "state")
+		}
+		dir = filepath.Join(base, "folder_mirror")
+	}
+	if err := securefile.MkdirAll(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// mirrorPair 是写入 pair.json 的源目录和目标目录
+type mirrorPair struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// pairState 描述一对源目录和目标目录的状态文件
+type pairState struct {
+	mirrorPair
+	Dir    string
+	Marker string // plan 创建的标记文件
+	LogDir string // 每次运行的日志
+	Lock   string // 防止同时运行的锁文件
+}
+
+// 规范化路径，使同一目录的不同写法对应同一个状态目录
+func canonicalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// 状态子目录的名称：目标目录的名称加上源目录和目标目录的哈希
+func pairDirName(p mirrorPair) string {
+	sum := sha256.Sum256([]byte(p.Source + "\x00" + p.Target))
+	name := filepath.Base(p.Target)
+	if name == string(filepath.Separator) || name == "." {
+		name = "root"
+	}
+	return name + "-" + hex.EncodeToString(sum[:6])
+}
+
+// 获取一对源目录和目标目录的状态文件，需要时创建状态子目录
+func statePaths(source, target string) (*pairState, error) {
+	root, err := stateRoot()
+	if err != nil {
+		return nil, err
+	}
+	st := pairStateIn(root, source, target)
+	if err := securefile.MkdirAll(st.Dir); err != nil {
+		return nil, err
+	}
+	if err := writePairInfo(st.Dir, st.mirrorPair); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// 计算一对源目录和目标目录在状态目录 root 中的状态文件，不创建任何文件
+// markerFile 不为空时优先使用
+func pairStateIn(root, source, target string) *pairState {
+	p := mirrorPair{Source: canonicalPath(source), Target: canonicalPath(target)}
+	dir := filepath.Join(root, pairsDirName, pairDirName(p))
+	st := &pairState{
+		mirrorPair: p,
+		Dir:        dir,
+		Marker:     filepath.Join(dir, "marker"),
+		LogDir:     filepath.Join(dir, "logs"),
+		Lock:       filepath.Join(dir, "state.lock"),
+	}
+	if markerFile != "" {
+		st.Marker = markerFile
+		st.Lock = markerFile + ".lock"
+	}
+	return st
+}
+
+// 记录状态子目录对应的源目录和目标目录，供 status 列出
+func writePairInfo(dir string, p mirrorPair) error {
+	path := filepath.Join(dir, "pair.json")
+	if securefile.Check(path) == nil {
+		return nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return securefile.WriteFile(path, append(data, '\n'))
+}
+
+// 列出状态目录中记录过的所有源目录和目标目录，按目标目录排序
+func listPairStates() ([]*pairState, error) {
+	root, err := stateRoot()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(root, pairsDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var states []*pairState
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(root, pairsDirName, entry.Name(), "pair.json"))
+		if err != nil {
+			continue
+		}
+		var p mirrorPair
+		if json.Unmarshal(data, &p) != nil || p.Source == "" || p.Target == "" {
+			continue
+		}
+		states = append(states, pairStateIn(root, p.Source, p.Target))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Target < states[j].Target })
+	return states, nil
+}
+
+// 获取运行历史文件路径，historyFile 不为空时优先使用
+func historyPath() (string, error) {
+	if historyFile != "" {
+		return historyFile, nil
+	}
+	root, err := stateRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "history.jsonl"), nil
+}
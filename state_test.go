@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// 测试状态目录的位置以及每对目录的状态文件
+func TestStatePaths(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "state_test")
+	if err != nil {
+		t.Fatalf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	oldStateDir, oldMarkerFile, oldHistoryFile := stateDir, markerFile, historyFile
+	oldXDG, hadXDG := os.LookupEnv("XDG_STATE_HOME")
+	defer func() {
+		stateDir, markerFile, historyFile = oldStateDir, oldMarkerFile, oldHistoryFile
+		if hadXDG {
+			os.Setenv("XDG_STATE_HOME", oldXDG)
+		} else {
+			os.Unsetenv("XDG_STATE_HOME")
+		}
+	}()
+	stateDir, markerFile, historyFile = "", "", ""
+	os.Setenv("XDG_STATE_HOME", filepath.Join(testDir, "xdg"))
+
+	root, err := stateRoot()
+	if err != nil {
+		t.Fatalf("创建状态目录失败: %v", err)
+	}
+	if root != filepath.Join(testDir, "xdg", "folder_mirror") {
+		t.Errorf("状态目录应当位于 XDG_STATE_HOME 中，但得到 %s", root)
+	}
+	if info, _ := os.Stat(root); runtime.GOOS != "windows" && info.Mode().Perm() != 0700 {
+		t.Errorf("状态目录权限应当为 0700，但得到 %v", info.Mode().Perm())
+	}
+
+	a, err := statePaths("/data/src", "/backup/dst")
+	if err != nil {
+		t.Fatalf("获取状态文件失败: %v", err)
+	}
+	if !strings.HasPrefix(a.Marker, filepath.Join(root, pairsDirName)) || filepath.Dir(a.LogDir) != a.Dir || filepath.Dir(a.Lock) != a.Dir {
+		t.Errorf("状态文件应当位于状态子目录中: %+v", a)
+	}
+	if !strings.HasPrefix(filepath.Base(a.Dir), "dst-") {
+		t.Errorf("状态子目录应当以目标目录名称开头: %s", a.Dir)
+	}
+	same, _ := statePaths("/data/src/", "/backup/dst/")
+	if same.Dir != a.Dir {
+		t.Errorf("同一对目录的不同写法应当使用同一个状态目录: %s %s", a.Dir, same.Dir)
+	}
+	other, _ := statePaths("/data/other", "/backup/dst")
+	if other.Dir == a.Dir {
+		t.Error("不同的源目录应当使用不同的状态目录")
+	}
+
+	states, err := listPairStates()
+	if err != nil {
+		t.Fatalf("列出状态失败: %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("期望 2 对目录，但得到 %d", len(states))
+	}
+	for _, st := range states {
+		if st.Dir != a.Dir && st.Dir != other.Dir {
+			t.Errorf("列出了未知的状态目录: %+v", st)
+		}
+	}
+
+	if path, _ := historyPath(); path != filepath.Join(root, "history.jsonl") {
+		t.Errorf("运行历史应当位于状态目录中，但得到 %s", path)
+	}
+
+	markerFile = filepath.Join(testDir, "marker")
+	if st, _ := statePaths("/data/src", "/backup/dst"); st.Marker != markerFile || st.Lock != markerFile+".lock" {
+		t.Errorf("设置 markerFile 时应当使用它: %+v", st)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 描述标记文件的状态，返回描述以及标记文件是否有效
+func describeMarker(path string, now time.Time) (string, bool) {
+	created, err := mirror.MarkerTime(path)
+	if os.IsNotExist(err) {
+		return tr("status.marker_missing"), false
+	}
+	if err != nil {
+		return tr("status.marker_invalid", err), false
+	}
+	age := now.Sub(created)
+	remaining := time.Duration(markerTimeout)*time.Second - age
+	if remaining < 0 {
+		return tr("status.marker_stale", created.Format("2006-01-02 15:04:05"), age.Round(time.Second)), false
+	}
+	return tr("status.marker_valid", created.Format("2006-01-02 15:04:05"), remaining.Round(time.Second)), true
+}
+
+// 筛选属于指定源目录和目标目录的运行记录
+func pairRecords(records []runRecord, st *pairState) []runRecord {
+	var out []runRecord
+	for _, r := range records {
+		if canonicalPath(r.Source) == st.Source && canonicalPath(r.Target) == st.Target {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// 输出一对源目录和目标目录的状态
+func printPairStatus(st *pairState, records []runRecord) {
+	printColored(colorGreen, fmt.Sprintf("%s -> %s", st.Source, st.Target))
+
+	if holder, err := mirror.ReadLockInfo(st.Lock); err == nil && holder.Running() {
+		printColored(colorYellow, tr("status.running", holder))
+	}
+
+	msg, valid := describeMarker(st.Marker, time.Now())
+	if valid {
+		printColored(colorGreen, msg)
+	} else {
+		printColored(colorYellow, msg)
+	}
+
+	records = pairRecords(records, st)
+	if len(records) == 0 {
+		printNotice(tr("history.empty"))
+		return
+	}
+	last := records[len(records)-1]
+	color := colorGreen
+	if last.Status != runSuccess {
+		color = colorRed
+	}
+	printColored(color, tr("status.last_run", formatRunRecord(last)))
+	if path := existingLogPath(last.LogFile); path != "" {
+		printColored(colorGreen, tr("status.log_file", path))
+	}
+	if success := lastSuccessfulApply(records); success != nil && success != &records[len(records)-1] {
+		printColored(colorGreen, tr("status.last_success", success.End.Format("2006-01-02 15:04:05")))
+	}
+}
+
+// 最近一次成功的 apply，没有时返回 nil
+func lastSuccessfulApply(records []runRecord) *runRecord {
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Mode == "apply" && records[i].Status == runSuccess {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// 把时间长度格式化为便于阅读的形式，超过一天时以天为单位
+func formatAge(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%.1fd", d.Hours()/24)
+	}
+	return d.Round(time.Second).String()
+}
+
+// 筛选属于配置的运行记录：记录了这个配置名称，或者源目录和目标目录与配置相同
+func profileRecords(records []runRecord, p *profile, st *pairState) []runRecord {
+	var out []runRecord
+	for _, r := range records {
+		if r.Profile == p.Name || (st != nil && canonicalPath(r.Source) == st.Source && canonicalPath(r.Target) == st.Target) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// 检查配置是否满足新鲜度要求，返回描述以及是否满足
+// 没有设置 freshness 时总是满足
+func checkFreshness(p *profile, last *runRecord, now time.Time) (string, bool) {
+	if p.Freshness <= 0 {
+		return "", true
+	}
+	if last == nil {
+		return tr("status.stale_never", formatAge(p.Freshness)), false
+	}
+	age := now.Sub(last.End)
+	if age > p.Freshness {
+		return tr("status.stale", formatAge(age), formatAge(p.Freshness)), false
+	}
+	return tr("status.fresh", formatAge(age), formatAge(p.Freshness)), true
+}
+
+// 描述目标目录是否可以访问以及可用空间，返回描述以及是否可以访问
+func describeTarget(target string) (string, bool) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return tr("status.target_unreachable", err), false
+	}
+	if !info.IsDir() {
+		return tr("status.target_not_dir", target), false
+	}
+	free, total, err := diskSpace(target)
+	if err != nil {
+		return tr("status.target_no_space", err), true
+	}
+	return tr("status.target_ok", formatBytes(int64(free)), formatBytes(int64(total))), true
+}
+
+// 输出一个配置的状态，返回配置是否满足新鲜度要求
+func printProfileStatus(p *profile, root string, records []runRecord, now time.Time) bool {
+	var st *pairState
+	if p.Source != "" && p.Target != "" {
+		st = pairStateIn(root, p.Source, p.Target)
+		printColored(colorGreen, fmt.Sprintf("[%s] %s -> %s", p.Name, st.Source, st.Target))
+	} else {
+		printColored(colorGreen, fmt.Sprintf("[%s]", p.Name))
+	}
+
+	if st != nil {
+		if holder, err := mirror.ReadLockInfo(st.Lock); err == nil && holder.Running() {
+			printColored(colorYellow, tr("status.running", holder))
+		}
+	}
+
+	records = profileRecords(records, p, st)
+	success := lastSuccessfulApply(records)
+	if success != nil {
+		printColored(colorGreen, tr("status.last_success_age",
+			success.End.Format("2006-01-02 15:04:05"), formatAge(now.Sub(success.End))))
+	} else {
+		printColored(colorYellow, tr("status.never_succeeded"))
+	}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		color := colorGreen
+		if last.Status != runSuccess {
+			color = colorRed
+		}
+		printColored(color, tr("status.last_run", formatRunRecord(last)))
+	}
+
+	if st != nil {
+		msg, valid := describeMarker(st.Marker, now)
+		if valid {
+			printColored(colorGreen, msg)
+		} else {
+			printColored(colorYellow, msg)
+		}
+		msg, ok := describeTarget(st.Target)
+		if ok {
+			printColored(colorGreen, msg)
+		} else {
+			printColored(colorRed, msg)
+		}
+	} else {
+		printColored(colorYellow, tr("status.no_paths"))
+	}
+
+	msg, fresh := checkFreshness(p, success, now)
+	if !fresh {
+		printColored(colorRed, msg)
+	} else if msg != "" {
+		printColored(colorGreen, msg)
+	}
+	return fresh
+}
+
+// 读取配置文件，文件不存在时返回空列表
+func loadAllProfiles() ([]*profile, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := loadProfiles(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return profiles, err
+}
+
+// 处理 status 子命令
+// 显示每个配置的状态以及不属于任何配置的运行过的目录；指定 --profile 时只显示该配置，
+// 指定 SOURCE_DIR 和 TARGET_DIR 时只显示这对目录
+// 有配置超过了 freshness 要求时退出码为 1，可以用作健康检查
+func runStatusCommand(args []string) {
+	fs := newCommandFlagSet("status")
+	profileName := fs.String("profile", "", tr("flag.profile"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	if (len(positional) != 0 && len(positional) != 2) || (*profileName != "" && len(positional) != 0) {
+		fs.Usage()
+		osExit(1)
+		return
+	}
+
+	root, err := stateRoot()
+	if err != nil {
+		printColored(colorRed, tr("status.state_dir_failed", err))
+		osExit(1)
+		return
+	}
+
+	var profiles []*profile
+	if *profileName != "" {
+		var p *profile
+		p, err = findProfile(*profileName)
+		profiles = []*profile{p}
+	} else if len(positional) == 0 {
+		profiles, err = loadAllProfiles()
+	}
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+
+	var states []*pairState
+	if len(positional) == 2 {
+		states = []*pairState{pairStateIn(root, positional[0], positional[1])}
+	} else if *profileName == "" {
+		states, err = listPairStates()
+		if err != nil {
+			printColored(colorRed, tr("status.state_dir_failed", err))
+			osExit(1)
+			return
+		}
+	}
+	// 属于配置的目录已经在配置的状态中显示
+	var others []*pairState
+	for _, st := range states {
+		owned := false
+		for _, p := range profiles {
+			if p.Source != "" && p.Target != "" && canonicalPath(p.Source) == st.Source && canonicalPath(p.Target) == st.Target {
+				owned = true
+			}
+		}
+		if !owned {
+			others = append(others, st)
+		}
+	}
+
+	path, err := historyPath()
+	var records []runRecord
+	if err == nil {
+		records, err = readHistory(path)
+	}
+	if err != nil {
+		printColored(colorRed, tr("history.read_failed", err))
+		osExit(1)
+		return
+	}
+
+	if len(profiles) == 0 && len(others) == 0 {
+		printNotice(tr("history.empty"))
+		osExit(0)
+		return
+	}
+	now := time.Now()
+	healthy := true
+	for i, p := range profiles {
+		if i > 0 {
+			fmt.Println()
+		}
+		if !printProfileStatus(p, root, records, now) {
+			healthy = false
+		}
+	}
+	for i, st := range others {
+		if i > 0 || len(profiles) > 0 {
+			fmt.Println()
+		}
+		printPairStatus(st, records)
+	}
+	if !healthy {
+		osExit(1)
+		return
+	}
+	osExit(0)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 测试新鲜度要求的判断
+func TestCheckFreshness(t *testing.T) {
+	now := time.Now()
+	p := &profile{Name: "home"}
+	recent := &runRecord{End: now.Add(-time.Hour)}
+	old := &runRecord{End: now.Add(-72 * time.Hour)}
+
+	if _, fresh := checkFreshness(p, nil, now); !fresh {
+		t.Error("没有设置 freshness 时应当总是满足")
+	}
+	if err := p.set("freshness", "2d"); err != nil {
+		t.Fatalf("设置 freshness 失败: %v", err)
+	}
+	if msg, fresh := checkFreshness(p, recent, now); !fresh || !strings.Contains(msg, "1h0m0s 前") {
+		t.Errorf("一小时前成功的镜像应当满足要求，得到 %q", msg)
+	}
+	if msg, fresh := checkFreshness(p, old, now); fresh || !strings.Contains(msg, "3.0d 前") || !strings.Contains(msg, "2.0d") {
+		t.Errorf("三天前成功的镜像应当过期，得到 %q", msg)
+	}
+	if _, fresh := checkFreshness(p, nil, now); fresh {
+		t.Error("从未成功的镜像应当过期")
+	}
+	if err := p.set("freshness", "soon"); err == nil {
+		t.Error("无效的 freshness 应当返回错误")
+	}
+}
+
+// 测试按配置显示状态，以及超过新鲜度要求时的退出码
+func TestProfileStatus(t *testing.T) {
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	oldHistoryFile, oldHook, oldDisable := historyFile, printHook, disablePrint
+	defer func() { historyFile, printHook, disablePrint = oldHistoryFile, oldHook, oldDisable }()
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	var printed []string
+	printHook = func(message string) { printed = append(printed, message) }
+	disablePrint = true
+
+	now := time.Now()
+	records := []*runRecord{
+		{ID: "1", Mode: "apply", Source: sourceDir, Target: targetDir, Start: now.Add(-41 * time.Hour), End: now.Add(-40 * time.Hour), Status: runSuccess},
+		{ID: "2", Mode: "apply", Profile: "home", Source: sourceDir, Target: targetDir, Start: now.Add(-time.Hour), End: now.Add(-time.Hour), Status: runFailed, Error: "rsync 失败"},
+	}
+	for _, r := range records {
+		if err := appendHistory(historyFile, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	profiles := "[home]\nsource = " + sourceDir + "\ntarget = " + targetDir + "\nfreshness = 2d\n[docs]\n"
+	restore := setupProfilesFile(t, testDir, profiles)
+	defer restore()
+
+	// 持有者已经退出的锁文件不表示正在运行
+	st, err := statePaths(sourceDir, targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("无法运行 true: %v", err)
+	}
+	host, _ := os.Hostname()
+	data, _ := json.Marshal(mirror.LockInfo{PID: cmd.Process.Pid, Host: host, Started: now, Command: "folder_mirror apply"})
+	os.MkdirAll(filepath.Dir(st.Lock), 0700)
+	ioutil.WriteFile(st.Lock, data, 0600)
+
+	// 最近一次成功在 40 小时前，满足 2 天的要求
+	if code := runMainForExit([]string{"status", "--profile", "home"}); code != 0 {
+		t.Fatalf("期望退出码 0，但得到 %d: %v", code, printed)
+	}
+	output := strings.Join(printed, "\n")
+	if strings.Contains(output, "正在运行") {
+		t.Errorf("持有者已经退出时不应当显示正在运行:\n%s", output)
+	}
+	for _, want := range []string{"[home] ", "最近一次成功镜像: ", "最近一次运行: ", "rsync 失败", "标记文件不存在", "目标目录可以访问，可用空间", "新鲜: "} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出中缺少 %q:\n%s", want, output)
+		}
+	}
+
+	// 要求变为 1 天后过期，没有路径的配置同样显示
+	restore2 := setupProfilesFile(t, testDir, strings.Replace(profiles, "2d", "1d", 1))
+	defer restore2()
+	printed = nil
+	if code := runMainForExit([]string{"status"}); code != 1 {
+		t.Errorf("超过新鲜度要求时期望退出码 1，但得到 %d", code)
+	}
+	output = strings.Join(printed, "\n")
+	for _, want := range []string{"已过期: 最近一次成功镜像在 1.7d 前", "[docs]", "从未成功镜像", "配置中没有源目录和目标目录"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出中缺少 %q:\n%s", want, output)
+		}
+	}
+
+	// 目标目录无法访问
+	os.RemoveAll(targetDir)
+	printed = nil
+	runMainForExit([]string{"status", "--profile", "home"})
+	if output = strings.Join(printed, "\n"); !strings.Contains(output, "目标目录无法访问") {
+		t.Errorf("目标目录不存在时应当显示无法访问:\n%s", output)
+	}
+
+	printed = nil
+	if code := runMainForExit([]string{"status", "--profile", "nope"}); code != 1 {
+		t.Errorf("配置不存在时期望退出码 1，但得到 %d", code)
+	}
+	if output = strings.Join(printed, "\n"); !strings.HasPrefix(output, "错误: ") {
+		t.Errorf("配置不存在时应当输出错误:\n%s", output)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 生成的单元文件的第一行，install-timer 只覆盖以它开头的文件
+// 单元文件由 systemctl 和管理员读取，内容不随 --lang 变化，统一使用英文
+const unitHeader = "# Generated by folder_mirror install-timer; running install-timer again overwrites this file"
+
+// 系统单元的目录
+const systemUnitDir = "/etc/systemd/system"
+
+// 获取程序的路径（变量以便于测试）
+var executablePath = os.Executable
+
+// systemd 日历事件中的星期名称，下标为 time.Weekday
+var systemdWeekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// unitFile 是一个要写入的单元文件
+type unitFile struct {
+	Name    string
+	Content string
+}
+
+// timerOptions 是 install-timer 的设置
+type timerOptions struct {
+	System   bool   // 生成系统单元
+	Schedule string // 调度表达式，为空时使用配置中的 schedule
+}
+
+// 处理 install-timer 子命令
+func runInstallTimerCommand(args []string) {
+	fs := newCommandFlagSet("install-timer")
+	opts := timerOptions{}
+	fs.BoolVar(&opts.System, "system", false, tr("flag.system"))
+	fs.StringVar(&opts.Schedule, "schedule", "", tr("flag.schedule"))
+	dir := fs.String("dir", "", tr("flag.unit_dir"))
+	force := fs.Bool("force", false, tr("flag.force"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		osExit(1)
+		return
+	}
+	p, err := findProfile(positional[0])
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	units, err := systemdUnits(p, opts)
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+
+	if *dir == "" {
+		*dir, err = defaultUnitDir(opts.System)
+		if err != nil {
+			printError(err)
+			osExit(1)
+			return
+		}
+	}
+	if err := writeUnits(*dir, units, *force); err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	if _, err := os.Stat(p.Target); err != nil {
+		printWarning(tr("timer.target_missing", p.Target))
+	}
+	systemctl := "systemctl --user"
+	if opts.System {
+		systemctl = "systemctl"
+	}
+	printNotice(tr("timer.enable", fmt.Sprintf("%s daemon-reload && %s enable --now %s", systemctl, systemctl, units[1].Name)))
+	osExit(0)
+}
+
+// 单元文件的默认目录：用户单元位于 $XDG_CONFIG_HOME/systemd/user
+func defaultUnitDir(system bool) (string, error) {
+	if system {
+		return systemUnitDir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "systemd", "user"), nil
+}
+
+// 写入单元文件，不覆盖不是 install-timer 生成的文件，除非 force 为 true
+func writeUnits(dir string, units []unitFile, force bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, u := range units {
+		path := filepath.Join(dir, u.Name)
+		if data, err := ioutil.ReadFile(path); err == nil && !force && !strings.HasPrefix(string(data), unitHeader) {
+			return errors.New(tr("timer.exists", path))
+		}
+		if err := ioutil.WriteFile(path, []byte(u.Content), 0644); err != nil {
+			return err
+		}
+		printColored(colorGreen, tr("timer.written", path))
+	}
+	return nil
+}
+
+// 生成运行配置的服务、定时器和报告失败的服务，按这个顺序返回
+// 服务以 daemon --once 运行配置一次，调度、随机推迟和错过后的补跑由定时器负责
+func systemdUnits(p *profile, opts timerOptions) ([]unitFile, error) {
+	schedule := opts.Schedule
+	if schedule == "" {
+		schedule = p.Schedule
+	}
+	if schedule == "" {
+		return nil, errors.New(tr("timer.no_schedule", p.Name))
+	}
+	if p.Source == "" || p.Target == "" {
+		return nil, errors.New(tr("cli.profile_no_paths", p.Name))
+	}
+	timing, err := timerSettings(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if p.Jitter > 0 {
+		timing = append(timing, fmt.Sprintf("RandomizedDelaySec=%d", int64(p.Jitter/time.Second)))
+	}
+	exe, err := executablePath()
+	if err != nil {
+		return nil, err
+	}
+	state, err := stateRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	// 运行时需要写入的目录：目标目录、状态目录，以及可能还不存在的预设目录和指标目录
+	writable := []string{systemdQuote(canonicalPath(p.Target)), systemdQuote(state)}
+	if dir, err := presetCacheDir(); err == nil {
+		writable = append(writable, "-"+systemdQuote(dir))
+	}
+	if p.MetricsDir != "" {
+		writable = append(writable, "-"+systemdQuote(canonicalPath(p.MetricsDir)))
+	}
+
+	// 系统单元以当前用户运行，使用同样的配置文件和状态目录
+	var userLine []string
+	if opts.System {
+		if u, err := user.Current(); err == nil && u.Uid != "0" {
+			userLine = []string{"User=" + u.Username}
+		}
+	}
+	env := "Environment=" + systemdQuote("XDG_STATE_HOME="+filepath.Dir(state))
+
+	base := "folder_mirror-" + systemdEscape(p.Name)
+	name := strings.Replace(p.Name, "%", "%%", -1)
+	service := unitLines(
+		"[Unit]",
+		"Description=folder_mirror profile "+name,
+		"OnFailure="+base+"-failure.service",
+		"",
+		"[Service]",
+		"Type=oneshot",
+		"ExecStart="+systemdExec(exe, "daemon", "--once", "--profile", p.Name),
+		userLine,
+		env,
+		"Nice=10",
+		"IOSchedulingClass=idle",
+		"ProtectSystem=strict",
+		"ProtectHome=read-only",
+		"ReadWritePaths="+strings.Join(writable, " "),
+		"PrivateTmp=true",
+		"NoNewPrivileges=true",
+	)
+	timer := unitLines(
+		"[Unit]",
+		"Description=Run folder_mirror profile "+name+" on its schedule",
+		"",
+		"[Timer]",
+		timing,
+		"Unit="+base+".service",
+		"",
+		"[Install]",
+		"WantedBy=timers.target",
+	)
+	failure := unitLines(
+		"[Unit]",
+		"Description=Report failures of folder_mirror profile "+name,
+		"",
+		"[Service]",
+		"Type=oneshot",
+		"ExecStart="+systemdExec(exe, "notify", "--profile", p.Name, "--unit", base+".service"),
+		userLine,
+		env,
+	)
+	return []unitFile{
+		{Name: base + ".service", Content: service},
+		{Name: base + ".timer", Content: timer},
+		{Name: base + "-failure.service", Content: failure},
+	}, nil
+}
+
+// 把行（字符串或字符串切片）连接为以 unitHeader 开头的单元文件
+func unitLines(lines ...interface{}) string {
+	var b strings.Builder
+	b.WriteString(unitHeader + "\n")
+	for _, line := range lines {
+		switch v := line.(type) {
+		case string:
+			b.WriteString(v + "\n")
+		case []string:
+			for _, s := range v {
+				b.WriteString(s + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// 把调度表达式转换为定时器的设置
+// cron 表达式转换为 OnCalendar，@every 转换为 OnUnitActiveSec；systemd 的日和星期同时满足才触发，
+// 无法表示 cron 中日和星期都有限制时满足任意一个即可的规则
+func timerSettings(schedule string) ([]string, error) {
+	sched, err := parseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	switch s := sched.(type) {
+	case everySchedule:
+		secs := int64(s.interval / time.Second)
+		return []string{fmt.Sprintf("OnBootSec=%d", secs), fmt.Sprintf("OnUnitActiveSec=%d", secs)}, nil
+	case *cronSpec:
+		if !s.domAny && !s.dowAny {
+			return nil, errors.New(tr("timer.dom_and_dow", schedule))
+		}
+		calendar := ""
+		if !s.dowAny {
+			var days []string
+			for d, name := range systemdWeekdays {
+				if s.dow&(1<<uint(d)) != 0 {
+					days = append(days, name)
+				}
+			}
+			calendar = strings.Join(days, ",") + " "
+		}
+		calendar += fmt.Sprintf("*-%s-%s %s:%s:00", calendarField(s.month, 1, 12), calendarField(s.dom, 1, 31),
+			calendarField(s.hour, 0, 23), calendarField(s.minute, 0, 59))
+		// Persistent 使定时器在开机后补上关机期间错过的运行
+		return []string{"OnCalendar=" + calendar, "Persistent=true"}, nil
+	}
+	return nil, errors.New(tr("timer.bad_schedule", schedule))
+}
+
+// 把字段的位集合转换为日历事件中的取值列表，全部取值时为 *
+func calendarField(bits uint64, min, max int) string {
+	var values []string
+	for v := min; v <= max; v++ {
+		if bits&(1<<uint(v)) != 0 {
+			values = append(values, fmt.Sprintf("%02d", v))
+		}
+	}
+	if len(values) == max-min+1 {
+		return "*"
+	}
+	return strings.Join(values, ",")
+}
+
+// 按 systemd-escape 的规则转义单元名称中的字符
+func systemdEscape(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == ':', c == '_', c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
+// 引用单元文件中的一个值：% 写为 %%，包含空白、引号或反斜杠时加上双引号
+func systemdQuote(s string) string {
+	s = strings.Replace(s, "%", "%%", -1)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// 生成 ExecStart 的命令行，$ 写为 $$ 以免被当作环境变量展开
+func systemdExec(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = systemdQuote(strings.Replace(arg, "$", "$$", -1))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 测试调度表达式转换为定时器设置
+func TestTimerSettings(t *testing.T) {
+	tests := []struct {
+		schedule string
+		want     []string
+	}{
+		{"30 2 * * *", []string{"OnCalendar=*-*-* 02:30:00", "Persistent=true"}},
+		{"@daily", []string{"OnCalendar=*-*-* 00:00:00", "Persistent=true"}},
+		{"*/15 * * * *", []string{"OnCalendar=*-*-* *:00,15,30,45:00", "Persistent=true"}},
+		{"0 9 * * mon-fri", []string{"OnCalendar=Mon,Tue,Wed,Thu,Fri *-*-* 09:00:00", "Persistent=true"}},
+		{"0 3 1 jan,jul *", []string{"OnCalendar=*-01,07-01 03:00:00", "Persistent=true"}},
+		{"@every 6h", []string{"OnBootSec=21600", "OnUnitActiveSec=21600"}},
+	}
+	for _, tt := range tests {
+		got, err := timerSettings(tt.schedule)
+		if err != nil {
+			t.Errorf("%q: 转换失败: %v", tt.schedule, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: 期望 %v，但得到 %v", tt.schedule, tt.want, got)
+		}
+	}
+	if _, err := timerSettings("0 0 1 * mon"); err == nil {
+		t.Error("同时限制日和星期的调度应当返回错误")
+	}
+}
+
+// 测试单元名称的转义和值的引用
+func TestSystemdEscape(t *testing.T) {
+	for name, want := range map[string]string{"home": "home", "my-docs": `my\x2ddocs`, "a b/c": `a\x20b-c`, ".hidden": `\x2ehidden`} {
+		if got := systemdEscape(name); got != want {
+			t.Errorf("%q: 期望 %s，但得到 %s", name, want, got)
+		}
+	}
+	if got := systemdExec("/opt/my tools/folder_mirror", "--profile", "100%$"); got != `"/opt/my tools/folder_mirror" --profile 100%%$$` {
+		t.Errorf("ExecStart 引用不正确: %s", got)
+	}
+}
+
+// 测试 install-timer 写入的单元文件
+func TestInstallTimer(t *testing.T) {
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+	unitDir := filepath.Join(testDir, "units")
+
+	oldExecutable, oldDisablePrint := executablePath, disablePrint
+	defer func() { executablePath, disablePrint = oldExecutable, oldDisablePrint }()
+	executablePath = func() (string, error) { return "/usr/local/bin/folder_mirror", nil }
+	disablePrint = true
+
+	restore := setupProfilesFile(t, testDir, "[home]\nsource = "+sourceDir+"\ntarget = "+targetDir+
+		"\nschedule = 30 2 * * *\njitter = 15m\nmetrics_dir = /var/lib/node_exporter\n[docs]\nsource = /a\ntarget = /b\n")
+	defer restore()
+
+	if code := runMainForExit([]string{"install-timer", "--dir", unitDir, "home"}); code != 0 {
+		t.Fatalf("期望退出码 0，但得到 %d", code)
+	}
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(unitDir, name))
+		if err != nil {
+			t.Fatalf("没有写入 %s: %v", name, err)
+		}
+		return string(data)
+	}
+	service := read("folder_mirror-home.service")
+	state, _ := stateRoot()
+	for _, want := range []string{
+		"ExecStart=/usr/local/bin/folder_mirror daemon --once --profile home\n",
+		"OnFailure=folder_mirror-home-failure.service\n",
+		"ProtectSystem=strict\n",
+		"ReadWritePaths=" + canonicalPath(targetDir) + " " + state + " -",
+		" -/var/lib/node_exporter\n",
+		"IOSchedulingClass=idle\n",
+		"Environment=XDG_STATE_HOME=" + filepath.Dir(state) + "\n",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("服务中缺少 %q:\n%s", want, service)
+		}
+	}
+	if strings.Contains(service, "User=") {
+		t.Error("用户单元不应设置 User=")
+	}
+	timer := read("folder_mirror-home.timer")
+	for _, want := range []string{"OnCalendar=*-*-* 02:30:00\n", "Persistent=true\n", "RandomizedDelaySec=900\n", "WantedBy=timers.target\n"} {
+		if !strings.Contains(timer, want) {
+			t.Errorf("定时器中缺少 %q:\n%s", want, timer)
+		}
+	}
+	if failure := read("folder_mirror-home-failure.service"); !strings.Contains(failure, "notify --profile home --unit folder_mirror-home.service") {
+		t.Errorf("失败时的服务不正确:\n%s", failure)
+	}
+
+	// 再次运行会覆盖生成的文件，但不覆盖手写的文件
+	if code := runMainForExit([]string{"install-timer", "--dir", unitDir, "--schedule", "@hourly", "home"}); code != 0 {
+		t.Errorf("覆盖生成的文件时期望退出码 0，但得到 %d", code)
+	}
+	if !strings.Contains(read("folder_mirror-home.timer"), "OnCalendar=*-*-* *:00:00") {
+		t.Error("--schedule 没有生效")
+	}
+	ioutil.WriteFile(filepath.Join(unitDir, "folder_mirror-home.service"), []byte("[Service]\n"), 0644)
+	if code := runMainForExit([]string{"install-timer", "--dir", unitDir, "home"}); code != 1 {
+		t.Errorf("不覆盖手写的文件时期望退出码 1，但得到 %d", code)
+	}
+	if code := runMainForExit([]string{"install-timer", "--dir", unitDir, "--force", "home"}); code != 0 {
+		t.Errorf("--force 时期望退出码 0，但得到 %d", code)
+	}
+
+	// 没有调度的配置
+	if code := runMainForExit([]string{"install-timer", "--dir", unitDir, "docs"}); code != 1 {
+		t.Errorf("没有 schedule 时期望退出码 1，但得到 %d", code)
+	}
+}
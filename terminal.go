@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+)
+
+// 颜色模式，由 --color 设置
+const (
+	colorAuto   = "auto"   // 标准输出是终端并且没有设置 NO_COLOR 时使用颜色
+	colorAlways = "always" // 总是使用颜色
+	colorNever  = "never"  // 从不使用颜色
+)
+
+// 当前的颜色模式（变量以便于测试）
+var colorMode = colorAuto
+
+// 判断文件是否是终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// 判断终端输出是否使用颜色
+// auto 时输出到管道、文件或 TERM=dumb 的终端不使用颜色，NO_COLOR 不为空时也不使用（见 https://no-color.org）
+func useColor() bool {
+	switch colorMode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// colorFlag 实现 --color 参数
+type colorFlag struct{}
+
+func (colorFlag) String() string { return colorMode }
+
+func (colorFlag) Set(value string) error {
+	if value != colorAuto && value != colorAlways && value != colorNever {
+		return errors.New(tr("color.invalid", colorAuto, colorAlways, colorNever))
+	}
+	colorMode = value
+	return nil
+}
+
+// 添加 --color 参数
+func addColorFlag(fs *flag.FlagSet) {
+	fs.Var(colorFlag{}, "color", tr("flag.color"))
+}
+
+// 输出的详细程度，由 -q、-v 和 -vv 设置
+const (
+	verbosityQuiet   = -1 // 只输出警告和错误
+	verbosityNormal  = 0
+	verbosityVerbose = 1 // 输出 rsync 参数等细节，rsync 加上 -v
+	verbosityDebug   = 2 // 再输出状态文件的路径，rsync 加上 -vv
+)
+
+// 当前的详细程度（变量以便于测试）
+var verbosity = verbosityNormal
+
+// verbosityFlag 实现 -q、-v 和 -vv，值为对应的详细程度
+type verbosityFlag int
+
+func (f verbosityFlag) String() string {
+	if int(f) == verbosity {
+		return "true"
+	}
+	return "false"
+}
+
+func (f verbosityFlag) Set(value string) error {
+	switch value {
+	case "true":
+		verbosity = int(f)
+	case "false":
+		if verbosity == int(f) {
+			verbosity = verbosityNormal
+		}
+	default:
+		return errors.New(tr("verbosity.invalid", value))
+	}
+	return nil
+}
+
+func (verbosityFlag) IsBoolFlag() bool { return true }
+
+// 添加 -q、-v 和 -vv 参数
+func addVerbosityFlags(fs *flag.FlagSet) {
+	fs.Var(verbosityFlag(verbosityQuiet), "q", tr("flag.quiet"))
+	fs.Var(verbosityFlag(verbosityVerbose), "v", tr("flag.verbose"))
+	fs.Var(verbosityFlag(verbosityDebug), "vv", tr("flag.very_verbose"))
+}
+
+// 判断某个级别的消息是否输出，-q 时只输出警告和错误
+func shouldPrint(level string) bool {
+	switch level {
+	case levelWarning, levelError:
+		return true
+	default:
+		return verbosity > verbosityQuiet
+	}
+}
+
+// 详细程度不低于 min 时输出细节
+func printVerbose(min int, message string) {
+	if verbosity >= min {
+		printMessage(levelDebug, "", message)
+	}
+}
+
+// 根据详细程度调整 rsync 参数：
+// 只有输出到终端（或 JSON 输出）并且不是 -q 时才保留 --progress，-v 和 -vv 给 rsync 加上同样多的 -v
+func rsyncVerbosityArgs(args []string) []string {
+	progress := verbosity > verbosityQuiet && (jsonOutput() || isTerminal(os.Stdout))
+	var out []string
+	for _, arg := range args {
+		if arg == "--progress" && !progress {
+			continue
+		}
+		out = append(out, arg)
+	}
+	for i := verbosityNormal; i < verbosity; i++ {
+		out = append(out, "-v")
+	}
+	return out
+}
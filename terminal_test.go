@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 测试颜色模式和 NO_COLOR
+func TestUseColor(t *testing.T) {
+	origMode := colorMode
+	origNoColor, hadNoColor := os.LookupEnv("NO_COLOR")
+	defer func() {
+		colorMode = origMode
+		if hadNoColor {
+			os.Setenv("NO_COLOR", origNoColor)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	}()
+
+	colorMode = colorAlways
+	os.Setenv("NO_COLOR", "1")
+	if !useColor() {
+		t.Error("--color=always 应当忽略 NO_COLOR")
+	}
+	colorMode = colorAuto
+	if useColor() {
+		t.Error("设置了 NO_COLOR 时不应使用颜色")
+	}
+	colorMode = colorNever
+	if useColor() {
+		t.Error("--color=never 时不应使用颜色")
+	}
+
+	// 测试中标准输出不是终端
+	os.Unsetenv("NO_COLOR")
+	colorMode = colorAuto
+	if useColor() != isTerminal(os.Stdout) {
+		t.Error("auto 时应当根据标准输出是否是终端决定")
+	}
+
+	if err := (colorFlag{}).Set("sometimes"); err == nil {
+		t.Error("--color=sometimes 应当返回错误")
+	}
+}
+
+// 测试 -q、-v 和 -vv 的解析
+func TestVerbosityFlags(t *testing.T) {
+	defer func() { verbosity = verbosityNormal }()
+	testCases := []struct {
+		args     []string
+		expected int
+	}{
+		{nil, verbosityNormal},
+		{[]string{"-q"}, verbosityQuiet},
+		{[]string{"-v"}, verbosityVerbose},
+		{[]string{"-vv"}, verbosityDebug},
+		{[]string{"-q=false"}, verbosityNormal},
+	}
+	for _, tc := range testCases {
+		verbosity = verbosityNormal
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		addVerbosityFlags(fs)
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatalf("%v: 解析失败: %v", tc.args, err)
+		}
+		if verbosity != tc.expected {
+			t.Errorf("%v: 期望详细程度 %d，但得到 %d", tc.args, tc.expected, verbosity)
+		}
+	}
+}
+
+// 测试 -q 时只输出警告和错误，-v 时才输出细节
+func TestQuietOutput(t *testing.T) {
+	origHook, origDisable := printHook, disablePrint
+	defer func() {
+		printHook, disablePrint = origHook, origDisable
+		verbosity = verbosityNormal
+	}()
+	var printed []string
+	printHook = func(message string) { printed = append(printed, message) }
+	disablePrint = true
+
+	verbosity = verbosityQuiet
+	printColored(colorGreen, "信息")
+	printNotice("提示")
+	printColored(colorYellow, "需要注意")
+	printVerbose(verbosityVerbose, "细节")
+	printWarning("警告内容")
+	printColored(colorRed, "错误内容")
+	// 可选的包含规则文件不存在时只是提示
+	prepareRsyncArgsWith(ruleConfig{ExcludeFrom: os.DevNull, IncludeFrom: filepath.Join(os.TempDir(), "folder_mirror_missing_include")})
+	expected := []string{"警告: 警告内容", "错误内容"}
+	if !reflect.DeepEqual(printed, expected) {
+		t.Errorf("-q 时期望输出 %v，但得到 %v", expected, printed)
+	}
+
+	printed = nil
+	verbosity = verbosityVerbose
+	printColored(colorGreen, "信息")
+	printVerbose(verbosityVerbose, "细节")
+	printVerbose(verbosityDebug, "调试")
+	expected = []string{"信息", "细节"}
+	if !reflect.DeepEqual(printed, expected) {
+		t.Errorf("-v 时期望输出 %v，但得到 %v", expected, printed)
+	}
+}
+
+// 测试根据详细程度调整 rsync 参数
+func TestRsyncVerbosityArgs(t *testing.T) {
+	origFormat := outputFormat
+	defer func() {
+		verbosity = verbosityNormal
+		outputFormat = origFormat
+	}()
+	args := []string{"-aH", "--delete-during", "--progress"}
+
+	// JSON 输出时需要进度，-q 时不需要
+	outputFormat = outputJSON
+	verbosity = verbosityNormal
+	if got := rsyncVerbosityArgs(args); !reflect.DeepEqual(got, args) {
+		t.Errorf("期望 %v，但得到 %v", args, got)
+	}
+	verbosity = verbosityQuiet
+	if got, expected := rsyncVerbosityArgs(args), []string{"-aH", "--delete-during"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("-q 时期望 %v，但得到 %v", expected, got)
+	}
+	verbosity = verbosityDebug
+	if got, expected := rsyncVerbosityArgs(args), append(append([]string(nil), args...), "-v", "-v"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("-vv 时期望 %v，但得到 %v", expected, got)
+	}
+
+	// 输出不是终端时去掉进度
+	outputFormat = outputText
+	verbosity = verbosityNormal
+	if !isTerminal(os.Stdout) {
+		if got, expected := rsyncVerbosityArgs(args), []string{"-aH", "--delete-during"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("输出不是终端时期望 %v，但得到 %v", expected, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/your-username/folder_mirror/filter"
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// verifyMode 是 apply 之后的校验方式
+type verifyMode int
+
+const (
+	verifyNone     verifyMode = iota
+	verifyQuick               // 比较条目、大小和修改时间
+	verifyChecksum            // 再比较 SHA-256
+)
+
+// errVerifyDrift 表示校验发现目标目录与源目录不一致，可以用 errors.Is 判断
+var errVerifyDrift error = catalogError("verify.err_drift")
+
+// driftError 描述校验发现的差异数
+type driftError struct {
+	count int
+}
+
+func (e *driftError) Error() string        { return tr("verify.drift", e.count) }
+func (e *driftError) Is(target error) bool { return target == errVerifyDrift }
+
+// 条目不一致的原因对应的消息
+var driftReasons = map[string]string{
+	mirror.ReasonType:    "verify.reason.type",
+	mirror.ReasonSize:    "verify.reason.size",
+	mirror.ReasonMtime:   "verify.reason.mtime",
+	mirror.ReasonContent: "verify.reason.content",
+	mirror.ReasonLink:    "verify.reason.link",
+}
+
+// 一处差异的说明
+func driftText(d mirror.Drift) string {
+	switch d.Kind {
+	case mirror.DriftMissing:
+		return tr("verify.missing", d.Path)
+	case mirror.DriftExtra:
+		return tr("verify.extra", d.Path)
+	default:
+		return tr("verify.differ", d.Path, tr(driftReasons[d.Reason]))
+	}
+}
+
+// 输出一处差异
+func printDrift(d mirror.Drift) {
+	if jsonOutput() {
+		emitJSON(outputEvent{Type: eventDrift, Level: levelWarning, Path: d.Path, Drift: string(d.Kind), Reason: d.Reason})
+		return
+	}
+	printColored(colorRed, driftText(d))
+}
+
+// 按规则比较源目录和目标目录并输出每处差异，有差异时返回 errVerifyDrift
+// 校验期间锁定目标目录，不允许镜像修改它；onDrift 不为 nil 时对每处差异再调用一次
+func verifyTarget(ctx context.Context, source, target string, f *filter.Filter, mode verifyMode, onDrift func(mirror.Drift)) error {
+	lock, err := mirror.AcquireLock(filepath.Join(target, mirror.LockFileName))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	printColored(colorGreen, tr("verify.start", target))
+	res, err := mirror.Verify(ctx, source, target, mirror.VerifyOptions{
+		Filter:   f,
+		Checksum: mode == verifyChecksum,
+		OnDrift: func(d mirror.Drift) {
+			printDrift(d)
+			if onDrift != nil {
+				onDrift(d)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	counts := make(map[mirror.DriftKind]int)
+	for _, d := range res.Drift {
+		counts[d.Kind]++
+	}
+	printColored(colorGreen, tr("verify.summary", res.Entries, formatBytes(res.Hashed),
+		counts[mirror.DriftMissing], counts[mirror.DriftExtra], counts[mirror.DriftDiffer]))
+	if len(res.Drift) > 0 {
+		return &driftError{count: len(res.Drift)}
+	}
+	printColored(colorGreen, tr("verify.ok"))
+	return nil
+}
+
+// 处理 verify 子命令
+func runVerifyCommand(args []string) {
+	fs := newCommandFlagSet("verify")
+	rf := addRuleFlags(fs)
+	checksum := fs.Bool("checksum", false, tr("flag.checksum"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+
+	cfg, prof, err := rf.config()
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	source, target, err := resolveMirrorPaths(prof, positional)
+	if err != nil {
+		printError(err)
+		osExit(1)
+		return
+	}
+	if !strings.HasSuffix(source, "/") {
+		source += "/"
+	}
+	if !strings.HasSuffix(target, "/") {
+		target += "/"
+	}
+	for _, dir := range []string{source, target} {
+		if !dirExists(dir) {
+			printError(errors.New(tr("verify.dir_missing", dir)))
+			osExit(1)
+			return
+		}
+	}
+	f, err := loadRuleFilter(cfg)
+	if err != nil {
+		printError(fmt.Errorf("%s: %w", tr("verify.rules_failed"), err))
+		osExit(1)
+		return
+	}
+
+	mode := verifyQuick
+	if *checksum {
+		mode = verifyChecksum
+	}
+	intr := notifyInterrupt()
+	defer intr.stop()
+	if err := verifyTarget(intr.ctx, source, target, f, mode, nil); err != nil {
+		printError(err)
+		osExit(intr.exitCode(err))
+		return
+	}
+	osExit(0)
+}
+
+// apply 之后按镜像参数中的规则校验目标目录，差异同时写入运行日志
+func (r *mirrorRun) verify(ctx context.Context, args []string, mode verifyMode) error {
+	f, err := filterFromRsyncArgs(args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", tr("verify.rules_failed"), err)
+	}
+	return verifyTarget(ctx, r.Source(), r.Target(), f, mode, func(d mirror.Drift) {
+		r.log.writef("[%s] %s\n", time.Now().Format("15:04:05"), driftText(d))
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试 verify 命令和 apply --verify：只有比较内容才能发现大小和修改时间都没有变化的损坏
+func TestVerifyCommand(t *testing.T) {
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+
+	oldMarkerFile := markerFile
+	oldHistoryFile := historyFile
+	oldDisablePrint := disablePrint
+	oldSyncConfig := syncConfig
+	oldTesting, hadTesting := os.LookupEnv("TESTING")
+	oldStdout := os.Stdout
+	oldStderr := os.Stderr
+	defer func() {
+		markerFile = oldMarkerFile
+		historyFile = oldHistoryFile
+		disablePrint = oldDisablePrint
+		syncConfig = oldSyncConfig
+		if hadTesting {
+			os.Setenv("TESTING", oldTesting)
+		}
+		os.Stdout = oldStdout
+		os.Stderr = oldStderr
+		outputFormat = outputText
+	}()
+
+	// 校验按规则文件过滤，TESTING 模式下的临时规则文件在使用前就被删除
+	os.Unsetenv("TESTING")
+	markerFile = filepath.Join(testDir, "marker")
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	disablePrint = true
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer devNull.Close()
+	os.Stdout = devNull
+	os.Stderr = devNull
+
+	excludeFile := filepath.Join(testDir, "exclude")
+	if err := ioutil.WriteFile(excludeFile, []byte("node_modules/\n"), 0644); err != nil {
+		t.Fatalf("无法写入排除文件: %v", err)
+	}
+	rules := []string{"--backend", "native", "--exclude-from", excludeFile, "--include-from", filepath.Join(testDir, "include")}
+	run := func(args ...string) int {
+		return runMainForExit(append(append(args, rules...), sourceDir, targetDir))
+	}
+
+	if code := run("plan"); code != 0 {
+		t.Fatalf("plan 退出码为 %d，期望 0", code)
+	}
+	if code := run("apply", "--verify-checksum"); code != 0 {
+		t.Fatalf("apply --verify-checksum 退出码为 %d，期望 0", code)
+	}
+	// 被排除的条目在目标目录中不算多余
+	os.MkdirAll(filepath.Join(targetDir, "node_modules"), 0755)
+	if err := ioutil.WriteFile(filepath.Join(targetDir, "node_modules", "local.js"), []byte("本地文件"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := run("verify", "--checksum"); code != 0 {
+		t.Errorf("同步后 verify --checksum 退出码为 %d，期望 0", code)
+	}
+
+	// 模拟静默损坏：内容变化但大小和修改时间不变
+	corrupt := filepath.Join(targetDir, "subdir", "file3.txt")
+	info, err := os.Stat(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(corrupt)
+	data[0] ^= 0xff
+	ioutil.WriteFile(corrupt, data, 0644)
+	os.Chtimes(corrupt, info.ModTime(), info.ModTime())
+
+	if code := run("verify"); code != 0 {
+		t.Errorf("只比较大小和修改时间时 verify 退出码为 %d，期望 0", code)
+	}
+	if code := run("verify", "--checksum"); code != 1 {
+		t.Errorf("比较内容时 verify 退出码为 %d，期望 1", code)
+	}
+
+	// rsync 的快速检查不会修复损坏，apply --verify-checksum 使运行失败
+	if code := run("plan"); code != 0 {
+		t.Fatalf("plan 退出码为 %d，期望 0", code)
+	}
+	if code := run("apply", "--verify-checksum"); code != 1 {
+		t.Errorf("目标损坏时 apply --verify-checksum 退出码为 %d，期望 1", code)
+	}
+	records, err := readHistory(historyFile)
+	if err != nil || len(records) == 0 {
+		t.Fatalf("读取运行历史失败: %v", err)
+	}
+	if last := records[len(records)-1]; last.Mode != "apply" || last.Status == runSuccess {
+		t.Errorf("校验失败的 apply 应当记录为失败，得到 %+v", last)
+	}
+
+	// JSON 输出中每处差异是一个 drift 事件
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	code := run("verify", "--checksum", "--output", "json")
+	w.Close()
+	os.Stdout = devNull
+	out, _ := ioutil.ReadAll(r)
+	if code != 1 {
+		t.Errorf("JSON 输出时 verify 退出码为 %d，期望 1", code)
+	}
+	var drift, failed bool
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		var ev outputEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("无法解析 JSON 输出 %q: %v", line, err)
+		}
+		if ev.Type == eventDrift && ev.Path == "subdir/file3.txt" && ev.Drift == "differ" && ev.Reason == "content" {
+			drift = true
+		}
+		if ev.Type == eventError && ev.Code == "verify_drift" {
+			failed = true
+		}
+	}
+	if !drift || !failed {
+		t.Errorf("JSON 输出中缺少差异或错误事件:\n%s", out)
+	}
+
+	// 缺少和多余的文件
+	os.Remove(filepath.Join(targetDir, "file1.txt"))
+	ioutil.WriteFile(filepath.Join(targetDir, "extra.txt"), []byte("多余"), 0644)
+	os.Chtimes(corrupt, time.Now(), time.Now())
+	if code := run("verify"); code != 1 {
+		t.Errorf("缺少和多余文件时 verify 退出码为 %d，期望 1", code)
+	}
+	if code := runMainForExit([]string{"verify", sourceDir, filepath.Join(testDir, "none")}); code != 1 {
+		t.Errorf("目标目录不存在时 verify 应当失败")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/your-username/folder_mirror/filter"
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// sourceWatcher 报告源目录中发生变化的路径
+// 路径相对于源目录并使用 / 分隔，空字符串表示无法确定变化的路径（例如事件队列溢出），需要完整镜像
+type sourceWatcher interface {
+	Changes() <-chan string
+	Errors() <-chan error
+	Close() error
+}
+
+// watchOptions 是 watch 命令的设置
+type watchOptions struct {
+	Debounce     time.Duration // 最后一次变化之后等待多久开始增量镜像
+	FullInterval time.Duration // 完整镜像的间隔，为 0 时只在需要时完整镜像
+}
+
+// 一批变化最长等待的时间是 Debounce 的倍数，避免持续写入的文件使镜像一直推迟
+const maxDebounceFactor = 10
+
+// 创建源目录的监视器（变量以便于测试）
+var newSourceWatcher = defaultSourceWatcher
+
+// 处理 watch 子命令
+func runWatchCommand(args []string) {
+	fs := newCommandFlagSet("watch")
+	addVerbosityFlags(fs)
+	rf := addRuleFlags(fs)
+	opts := watchOptions{}
+	fs.DurationVar(&opts.Debounce, "debounce", 2*time.Second, tr("flag.debounce"))
+	fs.DurationVar(&opts.FullInterval, "full-interval", time.Hour, tr("flag.full_interval"))
+	positional, ok := parseCommandArgs(fs, args)
+	if !ok {
+		return
+	}
+	args, source, target, ok := prepareMirror(rf, positional)
+	if !ok {
+		return
+	}
+	intr := notifyInterrupt()
+	defer intr.stop()
+	osExit(watchMirror(intr, args, source, target, opts))
+}
+
+// 持续镜像，直到收到中断信号或无法继续监视，返回退出码
+// 第一轮是需要有效标记文件的完整镜像；之后收集源目录中变化的路径，
+// 在变化停止 Debounce 之后只镜像这些路径，并每隔 FullInterval 完整镜像一次。
+// 之后的每一轮在镜像之前先预览，删除或变化的文件数超过配置的上限（见 planLimits）时不执行这一轮。
+// 每一轮都会检查源目录是否存在、是否为空，失败的一轮不会终止 watch。
+func watchMirror(intr *interrupter, args []string, source, target string, opts watchOptions) int {
+	f, err := filterFromRsyncArgs(args)
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	// 在第一轮之前开始监视，第一轮期间的变化不会丢失
+	w, err := newSourceWatcher(source, f)
+	if err != nil {
+		printError(errors.New(tr("watch.start_failed", err)))
+		return 1
+	}
+	defer w.Close()
+
+	if err := watchPass(intr, args, source, target, nil, nil); err != nil {
+		if errors.Is(err, mirror.ErrMarkerMissing) || errors.Is(err, mirror.ErrMarkerStale) || errors.Is(err, mirror.ErrMarkerInvalid) {
+			printColored(colorRed, tr("run.replan"))
+		}
+		return intr.exitCode(err)
+	}
+	printColored(colorGreen, tr("watch.watching", source))
+
+	var full <-chan time.Time
+	if opts.FullInterval > 0 {
+		ticker := time.NewTicker(opts.FullInterval)
+		defer ticker.Stop()
+		full = ticker.C
+	}
+	limits := profileLimits(activeProfile)
+	pending := map[string]bool{}
+	needFull := false
+	var batchStart time.Time
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+
+	// 执行一轮镜像，被中断时返回 false
+	pass := func(all bool) bool {
+		debounce.Stop()
+		var paths []string
+		if !all {
+			paths = reducePaths(f, source, target, pending)
+		}
+		pending, needFull, batchStart = map[string]bool{}, false, time.Time{}
+		if !all && len(paths) == 0 {
+			return true
+		}
+		err := watchPass(intr, args, source, target, paths, &limits)
+		return !errors.Is(err, mirror.ErrInterrupted)
+	}
+
+	for {
+		select {
+		case <-intr.ctx.Done():
+			printColored(colorGreen, tr("watch.stopped"))
+			return 0
+		case err := <-w.Errors():
+			printError(err)
+			return 1
+		case path := <-w.Changes():
+			if path == "" {
+				needFull = true
+			} else {
+				pending[path] = true
+			}
+			// 变化停止 Debounce 之后开始镜像，但一批变化最多等待 Debounce 的 maxDebounceFactor 倍
+			now := time.Now()
+			if batchStart.IsZero() {
+				batchStart = now
+			}
+			wait := opts.Debounce
+			if limit := batchStart.Add(maxDebounceFactor * opts.Debounce).Sub(now); limit < wait {
+				wait = limit
+			}
+			resetTimer(debounce, wait)
+		case <-debounce.C:
+			if !pass(needFull) {
+				return intr.exitCode(mirror.ErrInterrupted)
+			}
+		case <-full:
+			if !pass(true) {
+				return intr.exitCode(mirror.ErrInterrupted)
+			}
+		}
+	}
+}
+
+// 执行 watch 的一轮镜像，paths 为空时完整镜像
+// 与 apply 一样记录运行历史、执行钩子和发送通知
+// limits 为 nil 时检查标记文件（第一轮），否则先预览这一轮并按 limits 检查
+func watchPass(intr *interrupter, args []string, source, target string, paths []string, limits *planLimits) error {
+	if paths == nil {
+		printNotice(tr("watch.pass_full"))
+	} else {
+		printNotice(tr("watch.pass_paths", len(paths)))
+		for _, p := range paths {
+			printVerbose(verbosityVerbose, "  "+p)
+		}
+	}
+	run, err := startMirrorRun("apply", args, source, target, limits, intr.force)
+	if err != nil {
+		printError(err)
+		return err
+	}
+	run.rec.Paths = len(paths)
+	if err := run.runHook(hookPreRun, nil, 0); err != nil {
+		printError(err)
+		run.finish(err, 1)
+		return err
+	}
+	if paths == nil {
+		_, err = run.Apply(intr.ctx)
+	} else {
+		_, err = run.ApplyPaths(intr.ctx, paths)
+	}
+	if err != nil {
+		printError(err)
+		run.finish(err, intr.exitCode(err))
+		return err
+	}
+	run.finish(nil, 0)
+	return nil
+}
+
+// 判断变化的路径是否是目录，只对 build/ 这样只匹配目录的规则有意义
+// 已经从源目录删除的路径按目标目录中的副本判断，否则被排除的目录删除后会被当作文件，
+// 不再被排除，镜像时反而删除目标目录中的副本
+func changedIsDir(source, target, p string) bool {
+	info, err := os.Lstat(filepath.Join(source, filepath.FromSlash(p)))
+	if os.IsNotExist(err) {
+		info, err = os.Lstat(filepath.Join(target, filepath.FromSlash(p)))
+	}
+	return err == nil && info.IsDir()
+}
+
+// 整理要镜像的路径：去掉被规则排除的路径，以及已经被列出的目录包含的路径，按名称排序
+// rsync 会递归镜像列出的目录
+func reducePaths(f *filter.Filter, source, target string, pending map[string]bool) []string {
+	var paths []string
+	for p := range pending {
+		if !f.Decide(p, changedIsDir(source, target, p)).Included {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	// 排序后上级目录总在它包含的路径之前
+	sort.Strings(paths)
+	var out []string
+	kept := map[string]bool{}
+	for _, p := range paths {
+		covered := false
+		for dir := p; strings.Contains(dir, "/") && !covered; {
+			dir = dir[:strings.LastIndex(dir, "/")]
+			covered = kept[dir]
+		}
+		if !covered {
+			out = append(out, p)
+			kept[p] = true
+		}
+	}
+	return out
+}
+
+// 重新设置定时器，丢弃已经触发但没有读取的时间
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 监视的 inotify 事件
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// Linux 上使用 inotify 监视源目录
+func defaultSourceWatcher(root string, f *filter.Filter) (sourceWatcher, error) {
+	return newInotifyWatcher(root, f)
+}
+
+// inotifyWatcher 使用 inotify 监视源目录中每个会被镜像的目录
+// 新建或移入的目录会自动加入监视，删除或移出的目录停止监视
+type inotifyWatcher struct {
+	root    string
+	filter  *filter.Filter
+	file    *os.File
+	fd      int
+	dirs    map[int32]string // 监视描述符到目录的相对路径，源目录本身为空字符串
+	changes chan string
+	errs    chan error
+	done    chan struct{}
+}
+
+func newInotifyWatcher(root string, f *filter.Filter) (*inotifyWatcher, error) {
+	// 非阻塞的文件描述符由运行时轮询，Close 可以打断等待中的 Read
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{
+		root:    root,
+		filter:  f,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		dirs:    map[int32]string{},
+		changes: make(chan string, 1024),
+		errs:    make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+	if err := w.addTree(""); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	go w.loop()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Changes() <-chan string { return w.changes }
+func (w *inotifyWatcher) Errors() <-chan error   { return w.errs }
+
+func (w *inotifyWatcher) Close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+// 监视目录 rel 以及其中所有会被镜像的子目录
+func (w *inotifyWatcher) addTree(rel string) error {
+	dir := filepath.Join(w.root, filepath.FromSlash(rel))
+	if err := w.addWatch(dir, rel); err != nil {
+		return err
+	}
+	err := w.filter.Walk(dir, func(relPath string, info os.FileInfo, rule int, included bool) error {
+		if !included || !info.IsDir() {
+			return nil
+		}
+		if rel != "" {
+			relPath = rel + "/" + relPath
+		}
+		return w.addWatch(filepath.Join(w.root, filepath.FromSlash(relPath)), relPath)
+	})
+	// 遍历期间被删除的目录可以忽略
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOENT) {
+		return nil
+	}
+	return err
+}
+
+func (w *inotifyWatcher) addWatch(dir, rel string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask|syscall.IN_ONLYDIR|syscall.IN_DONT_FOLLOW)
+	if err == syscall.ENOSPC {
+		return errors.New(tr("watch.too_many_dirs"))
+	}
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.dirs[int32(wd)] = rel
+	return nil
+}
+
+// 停止监视目录 rel 以及其中的子目录
+func (w *inotifyWatcher) removeTree(rel string) {
+	for wd, dir := range w.dirs {
+		if dir == rel || strings.HasPrefix(dir, rel+"/") {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+func (w *inotifyWatcher) loop() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			default:
+				w.errs <- err
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(ev.Len)]
+			offset += syscall.SizeofInotifyEvent + int(ev.Len)
+			if err := w.handle(ev.Wd, ev.Mask, strings.TrimRight(string(nameBytes), "\x00")); err != nil {
+				w.errs <- err
+				return
+			}
+		}
+	}
+}
+
+// 处理一个事件，返回错误时停止监视
+func (w *inotifyWatcher) handle(wd int32, mask uint32, name string) error {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.send("")
+		return nil
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return nil
+	}
+	dir, ok := w.dirs[wd]
+	if !ok {
+		return nil
+	}
+	if name == "" {
+		// 子目录本身的删除和移动由上级目录的事件处理
+		if dir == "" && mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+			return errors.New(tr("watch.source_gone"))
+		}
+		return nil
+	}
+
+	rel := name
+	if dir != "" {
+		rel = dir + "/" + name
+	}
+	isDir := mask&syscall.IN_ISDIR != 0
+	if !w.filter.Decide(rel, isDir).Included {
+		return nil
+	}
+	if isDir {
+		switch {
+		case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+			if err := w.addTree(rel); err != nil {
+				return err
+			}
+		case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+			w.removeTree(rel)
+		}
+	}
+	w.send(rel)
+	return nil
+}
+
+func (w *inotifyWatcher) send(path string) {
+	select {
+	case w.changes <- path:
+	case <-w.done:
+	}
+}
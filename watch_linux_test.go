@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 测试 inotify 监视器
+func TestInotifyWatcher(t *testing.T) {
+	testSourceWatcher(t, func(root string, f *filter.Filter) (sourceWatcher, error) {
+		return newInotifyWatcher(root, f)
+	})
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "github.com/your-username/folder_mirror/filter"
+
+// 没有 inotify 的平台定期轮询源目录
+func defaultSourceWatcher(root string, f *filter.Filter) (sourceWatcher, error) {
+	return newPollWatcher(root, f)
+}
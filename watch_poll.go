@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/your-username/folder_mirror/filter"
+)
+
+// 轮询监视器遍历源目录的间隔（变量以便于测试）
+var pollInterval = 5 * time.Second
+
+// pollState 是轮询时记录的一个条目的状态
+type pollState struct {
+	size  int64
+	mtime int64
+	mode  os.FileMode
+}
+
+// pollWatcher 定期遍历源目录，比较每个条目的大小、修改时间和权限来发现变化
+// 用于没有 inotify 的平台，被规则排除的目录不会遍历
+type pollWatcher struct {
+	root    string
+	filter  *filter.Filter
+	changes chan string
+	errs    chan error
+	done    chan struct{}
+}
+
+// 开始轮询 root，第一次遍历在返回之前完成
+func newPollWatcher(root string, f *filter.Filter) (*pollWatcher, error) {
+	w := &pollWatcher{
+		root:    root,
+		filter:  f,
+		changes: make(chan string, 1024),
+		errs:    make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+	snapshot, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	go w.loop(snapshot)
+	return w, nil
+}
+
+func (w *pollWatcher) Changes() <-chan string { return w.changes }
+func (w *pollWatcher) Errors() <-chan error   { return w.errs }
+
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+// 遍历源目录，记录每个会被镜像的条目的状态
+// 目录的修改时间随其中的条目变化，只比较目录的权限，避免一个新文件使整个目录被重新镜像
+func (w *pollWatcher) scan() (map[string]pollState, error) {
+	snapshot := map[string]pollState{}
+	err := w.filter.Walk(w.root, func(relPath string, info os.FileInfo, rule int, included bool) error {
+		if !included {
+			return nil
+		}
+		st := pollState{mode: info.Mode()}
+		if !info.IsDir() {
+			st.size, st.mtime = info.Size(), info.ModTime().UnixNano()
+		}
+		snapshot[relPath] = st
+		return nil
+	})
+	return snapshot, err
+}
+
+func (w *pollWatcher) loop(snapshot map[string]pollState) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		current, err := w.scan()
+		if err != nil {
+			if _, statErr := os.Stat(w.root); os.IsNotExist(statErr) {
+				err = errors.New(tr("watch.source_gone"))
+			}
+			w.errs <- err
+			return
+		}
+		for path, st := range current {
+			if old, ok := snapshot[path]; !ok || old != st {
+				w.send(path)
+			}
+		}
+		for path := range snapshot {
+			if _, ok := current[path]; !ok {
+				w.send(path)
+			}
+		}
+		snapshot = current
+	}
+}
+
+func (w *pollWatcher) send(path string) {
+	select {
+	case w.changes <- path:
+	case <-w.done:
+	}
+}
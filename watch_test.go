@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-username/folder_mirror/filter"
+	"github.com/your-username/folder_mirror/mirror"
+)
+
+// 等待监视器报告 expected 中的全部路径，返回收到的全部路径
+func waitChanges(t *testing.T, w sourceWatcher, expected ...string) map[string]bool {
+	seen := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for {
+		missing := false
+		for _, p := range expected {
+			if !seen[p] {
+				missing = true
+			}
+		}
+		if !missing {
+			return seen
+		}
+		select {
+		case p := <-w.Changes():
+			seen[p] = true
+		case err := <-w.Errors():
+			t.Fatalf("监视出错: %v", err)
+		case <-timeout:
+			t.Fatalf("期望收到 %v，但只收到 %v", expected, seen)
+		}
+	}
+}
+
+// 测试监视器报告新建、修改和删除的路径，不报告被排除的路径
+func testSourceWatcher(t *testing.T, newWatcher func(string, *filter.Filter) (sourceWatcher, error)) {
+	dir, err := ioutil.TempDir("", "watch_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.MkdirAll(filepath.Join(dir, "node_modules"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "old.txt"), []byte("old"), 0644)
+
+	f := filter.New([]filter.Rule{filter.NewRule("node_modules/", false), filter.NewRule("*.tmp", false)})
+	w, err := newWatcher(dir, f)
+	if err != nil {
+		t.Fatalf("无法开始监视: %v", err)
+	}
+	defer w.Close()
+
+	ioutil.WriteFile(filepath.Join(dir, "sub", "new.txt"), []byte("new"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "skip.tmp"), []byte("x"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "node_modules", "pkg.js"), []byte("x"), 0644)
+	os.Remove(filepath.Join(dir, "sub", "old.txt"))
+	seen := waitChanges(t, w, "sub/new.txt", "sub/old.txt")
+
+	// 新建的目录中的变化同样被报告
+	os.MkdirAll(filepath.Join(dir, "added"), 0755)
+	waitChanges(t, w, "added")
+	time.Sleep(50 * time.Millisecond)
+	ioutil.WriteFile(filepath.Join(dir, "added", "file.txt"), []byte("x"), 0644)
+	for p := range waitChanges(t, w, "added/file.txt") {
+		seen[p] = true
+	}
+	for p := range seen {
+		if strings.HasSuffix(p, ".tmp") || strings.HasPrefix(p, "node_modules") {
+			t.Errorf("不应报告被排除的路径 %s", p)
+		}
+	}
+}
+
+// 测试轮询监视器
+func TestPollWatcher(t *testing.T) {
+	oldInterval := pollInterval
+	defer func() { pollInterval = oldInterval }()
+	pollInterval = 20 * time.Millisecond
+	testSourceWatcher(t, func(root string, f *filter.Filter) (sourceWatcher, error) {
+		return newPollWatcher(root, f)
+	})
+}
+
+// 测试整理要镜像的路径
+func TestReducePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source")
+	target := filepath.Join(dir, "target")
+	os.MkdirAll(filepath.Join(source, "a", "b"), 0755)
+	os.MkdirAll(filepath.Join(source, "build"), 0755)
+	// node_modules 已经从源目录删除，只剩目标目录中的副本
+	os.MkdirAll(filepath.Join(target, "node_modules", "pkg"), 0755)
+
+	f := filter.New([]filter.Rule{filter.NewRule("build/", false), filter.NewRule("node_modules/", false)})
+	pending := map[string]bool{
+		"a": true, "a/b": true, "a/b/c.txt": true, "a b.txt": true,
+		"build": true, "build/out.o": true, "deleted.txt": true, "z/y.txt": true,
+		"node_modules": true, "node_modules/pkg": true,
+	}
+	expected := []string{"a", "a b.txt", "deleted.txt", "z/y.txt"}
+	if got := reducePaths(f, source, target, pending); !reflect.DeepEqual(got, expected) {
+		t.Errorf("期望 %v，但得到 %v", expected, got)
+	}
+}
+
+// 等待运行历史中至少有 n 条记录
+func waitHistory(t *testing.T, n int) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if records, _ := readHistory(historyFile); len(records) >= n {
+			return
+		}
+	}
+	t.Fatalf("运行历史中没有 %d 条记录", n)
+}
+
+// 测试 watch 的第一轮完整镜像、之后的增量镜像以及停止
+func TestWatchMirror(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用 sh 模拟 rsync")
+	}
+	testDir, sourceDir, targetDir := setupTestDirs(t)
+	defer os.RemoveAll(testDir)
+	ioutil.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("x"), 0644)
+
+	oldExecCommand, oldDisablePrint, oldHistoryFile, oldProfile := execCommand, disablePrint, historyFile, activeProfile
+	defer func() {
+		execCommand, disablePrint, historyFile, activeProfile = oldExecCommand, oldDisablePrint, oldHistoryFile, oldProfile
+	}()
+	disablePrint = true
+	historyFile = filepath.Join(testDir, "history.jsonl")
+	activeProfile = &profile{Name: "watch", Limits: &planLimits{MaxDeletes: 1, MaxChanges: -1}}
+
+	// 模拟的 rsync 把参数和 --files-from 列出的路径写入 calls
+	// 预览中列出了 many 开头的路径时报告删除两个文件，超过上限
+	calls := make(chan string, 10)
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		line := strings.Join(args, " ")
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "--files-from=") {
+				data, _ := ioutil.ReadFile(strings.TrimPrefix(arg, "--files-from="))
+				line += " paths=" + strings.Replace(string(data), "\x00", ",", -1)
+			}
+		}
+		calls <- line
+		if strings.Contains(line, " -n ") && strings.Contains(line, "paths=many") {
+			return exec.Command("sh", "-c", "echo '*deleting   many/a'; echo '*deleting   many/b'")
+		}
+		return exec.Command("sh", "-c", "exit 0")
+	}
+
+	args := []string{"-aH", "--delete-during"}
+	ctx, cancel := context.WithCancel(context.Background())
+	intr := &interrupter{ctx: ctx, cancel: cancel, force: make(chan struct{})}
+	opts := watchOptions{Debounce: 50 * time.Millisecond}
+
+	// 没有标记文件时第一轮失败
+	if code := watchMirror(intr, args, sourceDir, targetDir, opts); code != 1 {
+		t.Fatalf("没有标记文件时期望退出码 1，但得到 %d", code)
+	}
+
+	st, err := statePaths(sourceDir, targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mirror.CreateMarker(st.Marker); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan int)
+	go func() { done <- watchMirror(intr, args, sourceDir, targetDir, opts) }()
+
+	if first := <-calls; strings.Contains(first, "--files-from") {
+		t.Errorf("第一轮应当完整镜像: %s", first)
+	}
+	waitHistory(t, 2)
+	if _, err := os.Stat(st.Marker); !os.IsNotExist(err) {
+		t.Error("第一轮之后应当删除标记文件")
+	}
+
+	// 之后的每一轮先预览再镜像
+	ioutil.WriteFile(filepath.Join(sourceDir, "new.txt"), []byte("new"), 0644)
+	for _, dryRun := range []bool{true, false} {
+		select {
+		case call := <-calls:
+			if !strings.Contains(call, "--delete-missing-args") || !strings.Contains(call, "paths=new.txt,") || strings.Contains(call, " -n ") != dryRun {
+				t.Errorf("增量镜像的参数不正确: %s", call)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("修改源目录后没有增量镜像")
+		}
+	}
+	waitHistory(t, 3)
+
+	// 预览超过上限时不执行这一轮
+	os.MkdirAll(filepath.Join(sourceDir, "many"), 0755)
+	select {
+	case call := <-calls:
+		if !strings.Contains(call, " -n ") {
+			t.Errorf("应当先预览: %s", call)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("修改源目录后没有增量镜像")
+	}
+	waitHistory(t, 4)
+	select {
+	case call := <-calls:
+		t.Errorf("超过上限时不应当镜像: %s", call)
+	default:
+	}
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Errorf("停止 watch 时期望退出码 0，但得到 %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch 没有停止")
+	}
+
+	records, _ := readHistory(historyFile)
+	if n := len(records); n != 4 || records[2].Paths != 1 || records[2].Status != runSuccess ||
+		records[3].Status != runFailed || !strings.Contains(records[3].Error, "超过上限") {
+		t.Errorf("运行历史不正确: %+v", records)
+	}
+}